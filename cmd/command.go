@@ -7,6 +7,8 @@ package cmd
 import (
 	"context"
 	"flag"
+	"slices"
+	"strings"
 
 	"go.uber.org/zap"
 )
@@ -15,6 +17,8 @@ import (
 type Command struct {
 	// Name is the name of the command.
 	Name string
+	// UsageLine is the one-line usage message of the command.
+	UsageLine string
 	// ShortDesc is the short description of the command.
 	ShortDesc string
 	// LongDesc is the text containing the details of the command.
@@ -29,15 +33,30 @@ var (
 	// Commands is a list of possible commands that could be run
 	Commands = []*Command{
 		&EtcdCmd,
+		&ValidateConfigCmd,
+		&InspectDataCmd,
+		&DefragOfflineCmd,
+		&HashCmd,
+		&SnapshotSaveCmd,
+		&SnapshotRestoreCmd,
+		&VerifySnapshotCmd,
+		&VersionCmd,
 	}
 )
 
-// IsCommandSupported checks if the command with the passed in commandName is a supported command.
-func IsCommandSupported(commandName string) bool {
+// LookupCommand returns the command named by the leading args together with the remaining args. Names of commands
+// can consist of several words, e.g. "snapshot save", in which case the command with the longest matching name is
+// returned. It returns nil if no command matches.
+func LookupCommand(args []string) (*Command, []string) {
+	var (
+		command   *Command
+		nameWords int
+	)
 	for _, cmd := range Commands {
-		if cmd.Name == commandName {
-			return true
+		words := strings.Fields(cmd.Name)
+		if len(words) > nameWords && len(words) <= len(args) && slices.Equal(words, args[:len(words)]) {
+			command, nameWords = cmd, len(words)
 		}
 	}
-	return false
+	return command, args[nameWords:]
 }
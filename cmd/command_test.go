@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestLookupCommand(t *testing.T) {
+	table := []struct {
+		description     string
+		args            []string
+		expectedCommand *Command
+		expectedArgs    []string
+	}{
+		{"should find a command named by a single word", []string{"hash", "--revision", "5"}, &HashCmd, []string{"--revision", "5"}},
+		{"should find a command named by several words", []string{"snapshot", "save", "--out", "db"}, &SnapshotSaveCmd, []string{"--out", "db"}},
+		{"should not find a command for a prefix of its name", []string{"snapshot", "--out", "db"}, nil, []string{"snapshot", "--out", "db"}},
+		{"should not find an unsupported command", []string{"unknown"}, nil, []string{"unknown"}},
+		{"should not find a command without args", nil, nil, nil},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		command, args := LookupCommand(entry.args)
+		g.Expect(command).To(Equal(entry.expectedCommand))
+		if len(entry.expectedArgs) == 0 {
+			g.Expect(args).To(BeEmpty())
+			continue
+		}
+		g.Expect(args).To(Equal(entry.expectedArgs))
+	}
+}
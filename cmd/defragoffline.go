@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// DefragOfflineCmd defragments the database of a data directory of etcd which is not in use.
+	DefragOfflineCmd = Command{
+		Name:      "defrag-offline",
+		UsageLine: "etcd-wrapper defrag-offline --data-dir <path> [flags]",
+		ShortDesc: "Defragments the database of an etcd data directory which is not in use",
+		LongDesc: `Defragments the bbolt database of an etcd data directory offline, i.e. while etcd is not running, and reports
+the size of the database before and after the defragmentation. The data directory is locked for the duration of
+the defragmentation. The file system needs enough free space for a second copy of the database in use.
+
+Flags:
+	--data-dir
+		Path of the etcd data directory whose database is defragmented.
+	--output
+		Output format, either text or json. Default: text`,
+		AddFlags: AddDefragOfflineFlags,
+		Run:      DefragOffline,
+	}
+	// defragOfflineOpts are the options of the defrag-offline command.
+	defragOfflineOpts = struct {
+		dataDir      string
+		outputFormat string
+	}{}
+)
+
+// AddDefragOfflineFlags adds the flags of the defrag-offline command to the passed FlagSet.
+func AddDefragOfflineFlags(fs *flag.FlagSet) {
+	fs.StringVar(&defragOfflineOpts.dataDir, "data-dir", "", "Path of the etcd data directory whose database is defragmented")
+	fs.StringVar(&defragOfflineOpts.outputFormat, "output", outputFormatText, "Output format, either text or json")
+}
+
+// DefragOffline defragments the database of the data directory and prints the report to stdout.
+func DefragOffline(_ context.Context, _ context.CancelFunc, logger *zap.Logger) error {
+	if strings.TrimSpace(defragOfflineOpts.dataDir) == "" {
+		return errors.New("--data-dir is required")
+	}
+	if err := validateOutputFormat(defragOfflineOpts.outputFormat); err != nil {
+		return err
+	}
+	report, err := datadir.DefragOffline(defragOfflineOpts.dataDir, logger)
+	if err != nil {
+		return err
+	}
+	return writeDefragReport(os.Stdout, report, defragOfflineOpts.outputFormat)
+}
+
+func writeDefragReport(w io.Writer, report *datadir.DefragReport, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return printJSON(w, report)
+	}
+	_, err := fmt.Fprintf(w, `Defragmented database %s in %.3fs
+  size before: %d bytes (%d bytes in use)
+  size after: %d bytes
+  reclaimed: %d bytes
+`, report.Path, report.DurationSeconds, report.SizeBytesBefore, report.SizeInUseBytesBefore, report.SizeBytesAfter, report.ReclaimedBytes)
+	return err
+}
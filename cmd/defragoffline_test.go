@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWriteDefragReport(t *testing.T) {
+	report := &datadir.DefragReport{
+		Path:                 "/var/etcd/data/new.etcd/member/snap/db",
+		SizeBytesBefore:      8388608,
+		SizeInUseBytesBefore: 2097152,
+		SizeBytesAfter:       2097152,
+		ReclaimedBytes:       6291456,
+		DurationSeconds:      1.5,
+	}
+	table := []struct {
+		description  string
+		outputFormat string
+	}{
+		{"should print report as text", outputFormatText},
+		{"should print report as JSON", outputFormatJSON},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		var buf bytes.Buffer
+		g.Expect(writeDefragReport(&buf, report, entry.outputFormat)).To(Succeed())
+		if entry.outputFormat == outputFormatJSON {
+			var decoded datadir.DefragReport
+			g.Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+			g.Expect(&decoded).To(Equal(report))
+			continue
+		}
+		g.Expect(buf.String()).To(Equal(`Defragmented database /var/etcd/data/new.etcd/member/snap/db in 1.500s
+  size before: 8388608 bytes (2097152 bytes in use)
+  size after: 2097152 bytes
+  reclaimed: 6291456 bytes
+`))
+	}
+}
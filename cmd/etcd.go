@@ -6,19 +6,31 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
 	"time"
 
 	"github.com/gardener/etcd-wrapper/internal/types"
 
 	"github.com/gardener/etcd-wrapper/internal/app"
+	"github.com/gardener/etcd-wrapper/internal/tracing"
+	"github.com/gardener/etcd-wrapper/internal/version"
 	"go.uber.org/zap"
+	"sigs.k8s.io/yaml"
 )
 
+// tracingShutdownTimeout is the time allowed to flush pending spans when etcd-wrapper exits.
+const tracingShutdownTimeout = 5 * time.Second
+
 var (
 	// EtcdCmd initializes and starts an embedded etcd.
 	EtcdCmd = Command{
 		Name:      "start-etcd",
+		UsageLine: "etcd-wrapper start-etcd [flags]",
 		ShortDesc: "Starts the etcd-wrapper application by initializing and starting an embedded etcd",
 		LongDesc: `Initializes the etcd data directory by coordinating with a backup-sidecar container
 and starts an embedded etcd which is by default exposed on port 2379 for client traffic.
@@ -29,9 +41,15 @@ Flags:
 	--backup-restore-tls-enabled
 		Enables TLS for communicating with backup-restore if its value is true. It is disabled by default.
 	--backup-restore-host-port
-		Host address and port of the backup restore with which this container will interact during initialization. Should be of the format <host>:<port> and must not include the protocol.
+		Host address and port of the backup restore with which this container will interact during initialization. Should be of the format <host>:<port>, where host can be a bracketed IPv6 literal, a full URL of the format <scheme>://<host>:<port>[/<path-prefix>], or a unix domain socket of the format unix:///<path>.
+	--backup-restore-tls-server-name
+		Server name used to verify the certificate of backup-restore. Defaults to the host of backup-restore-host-port.
 	--backup-restore-ca-cert-bundle-path
 		Path of CA cert bundle (This will be used when TLS is enabled via backup-restore-tls-enabled flag.
+	--backup-restore-client-cert-path
+		Path of the client certificate presented to backup-restore for mutual TLS. Must be set together with backup-restore-client-key-path.
+	--backup-restore-client-key-path
+		Path of the client key presented to backup-restore for mutual TLS. Must be set together with backup-restore-client-cert-path.
     --etcd-client-port
 		Client port when talking to etcd. Default: 2379
     --etcd-client-cert-path
@@ -41,36 +59,149 @@ Flags:
 	--etcd-server-name
 		Name of the server (host) which will be used to configure TLS config to connect to the etcd server process.
 	--etcd-ready-timeout
-		time duration the application will wait for etcd to get ready, by default it waits forever.`,
+		time duration the application will wait for etcd to get ready, by default it waits forever.
+	--etcd-use-wrapper-logger
+		Routes the logs of the embedded etcd through the etcd-wrapper logger. It is disabled by default.
+	--tracing-enabled
+		Enables exporting OpenTelemetry traces of the etcd-wrapper bootstrap if its value is true. It is disabled by default.
+	--tracing-otlp-endpoint
+		Host address and port of the OTLP gRPC collector to which traces are exported. Should be of the format <host>:<port>.
+	--tracing-sampling-rate-per-million
+		Number of traces that are sampled per million. Default: 1000000
+	--etcd-distributed-tracing-enabled
+		Enables distributed tracing in the embedded etcd, exporting to the same OTLP endpoint. It is disabled by default.
+	--etcd-config-overlay-file
+		Path of a YAML file which is merged on top of the etcd configuration fetched from backup-restore before etcd is started.
+	--etcd-config-override
+		Overrides a field of the etcd configuration fetched from backup-restore, of the format <key>=<value>. Keys of nested fields are separated by dots. Can be passed several times and takes precedence over --etcd-config-overlay-file.
+	--preflight-checks-mode
+		Decides how failed pre-flight checks of the data and WAL directories are treated before etcd is started, one of disabled, warn or fatal. Default: warn
+	--snapshot-verification-file
+		Path of a local snapshot, e.g. written by 'etcd-wrapper snapshot save', which is periodically verified to be restorable.
+	--snapshot-verification-interval
+		Interval in which the snapshot passed with snapshot-verification-file is verified, by restoring it into a throwaway etcd
+		started by verify-snapshot in a separate process. Default: 0, which disables the verification.
+	--snapshot-verification-temp-dir
+		Directory in which the snapshot is restored for its verification. Defaults to the directory for temporary files.
+	--consistency-check-interval
+		Interval in which the hash of the key space is compared with the peers at the same revision. Default: 0, which disables the check.
+	--consistency-check-mismatch-policy
+		Decides what happens once the key space of this member has diverged from a quorum of its peers, one of alert, fail-readiness or stop. With stop, etcd is stopped and its data directory is fully validated on the next start. Default: alert
+	--defragmentation-schedule
+		Cron expression of five fields, e.g. "0 3 * * *", at which every member defragments itself, one after the other, the leader last after transferring its leadership. Cannot be combined with --defragmentation-interval.
+	--defragmentation-interval
+		Interval in which every member defragments itself. Default: 0, which disables the scheduled defragmentation unless --defragmentation-schedule is set.
+	--defragmentation-sampling-interval
+		Interval in which every member samples the fragmentation of its database, and defragments itself once it exceeds --defragmentation-min-fragmentation-ratio. Default: 0, which disables the sampling.
+	--defragmentation-min-fragmentation-ratio
+		Minimal share of the database size which is not in use for a member to be defragmented. Default: 0, which defragments every member.
+	--defragmentation-min-db-size
+		Minimal size of the database in bytes for a member to be defragmented. Default: 0
+	--quota-watch-interval
+		Interval in which the size of the database is compared with the backend quota of etcd. Default: 0, which disables the watcher.
+	--quota-warning-thresholds
+		Comma separated, ascending percentages of the backend quota at which a warning is logged once the size of the database exceeds them. Default: 70,85,95
+	--quota-compaction-enabled
+		Compacts the key space on the leader once the size of the database exceeds a warning threshold, up to the revision sampled by the quota watcher at least one hour before. The compaction is deferred until the samples span one hour, e.g. after a restart. It is disabled by default.
+	--dry-run
+		Prints the validation mode and the effective etcd configuration, with all flags applied and secrets redacted, and exits without triggering an initialization or starting etcd. It is disabled by default.
+	--dry-run-etcd-config-file
+		Path of an etcd configuration file which is used by --dry-run instead of fetching the configuration from backup-restore.`,
 		AddFlags: AddEtcdFlags,
 		Run:      InitAndStartEtcd,
 	}
 	config = types.Config{}
 	// etcdReadyTimeout is the timeout for an embedded etcd server to be ready.
 	etcdReadyTimeout time.Duration
+	// dryRunOpts are the options of a dry run of start-etcd.
+	dryRunOpts = struct {
+		enabled            bool
+		etcdConfigFilePath string
+	}{}
 )
 
 // AddEtcdFlags adds flags from the parsed FlagSet into application structs
 func AddEtcdFlags(fs *flag.FlagSet) {
 	fs.IntVar(&config.EtcdWrapperPort, "etcd-wrapper-port", 9095, "Port used by etcd-wrapper to expose the server. Default: 9095")
 	fs.BoolVar(&config.BackupRestore.TLSEnabled, "backup-restore-tls-enabled", types.DefaultBackupRestoreTLSEnabled, "Enables TLS for communicating with backup-restore container")
-	fs.StringVar(&config.BackupRestore.HostPort, "backup-restore-host-port", types.DefaultBackupRestoreHostPort, "Host and Port to be used to connect to the backup-restore container")
+	fs.StringVar(&config.BackupRestore.HostPort, "backup-restore-host-port", types.DefaultBackupRestoreHostPort, "Host and Port (or unix:///<path> of a unix domain socket) to be used to connect to the backup-restore container")
+	fs.StringVar(&config.BackupRestore.TLSServerName, "backup-restore-tls-server-name", "", "Server name used to verify the certificate of the backup-restore container, defaults to the host of backup-restore-host-port")
 	fs.StringVar(&config.BackupRestore.CaCertBundlePath, "backup-restore-ca-cert-bundle-path", "", "File path of CA cert bundle to help establish TLS communication with backup-restore container")
+	fs.StringVar(&config.BackupRestore.ClientCertPath, "backup-restore-client-cert-path", "", "File path of the client certificate presented to the backup-restore container for mutual TLS")
+	fs.StringVar(&config.BackupRestore.ClientKeyPath, "backup-restore-client-key-path", "", "File path of the client key presented to the backup-restore container for mutual TLS")
 	fs.StringVar(&config.EtcdClientTLS.ServerName, "etcd-server-name", "", "Name of the server (host) which will be used to configure TLS config to connect to the etcd server process")
 	fs.IntVar(&config.EtcdClientPort, "etcd-client-port", 2379, "Client port when talking to etcd. Default: 2379")
 	fs.StringVar(&config.EtcdClientTLS.CertPath, "etcd-client-cert-path", "", "File path of ETCD client certificate to help establish TLS communication of the client to ETCD")
 	fs.StringVar(&config.EtcdClientTLS.KeyPath, "etcd-client-key-path", "", "File path of ETCD client key to help establish TLS communication of the client to ETCD")
 	fs.DurationVar(&etcdReadyTimeout, "etcd-ready-timeout", 0, "Time duration to wait for etcd to be ready")
+	fs.BoolVar(&config.EtcdLogger.UseWrapperLogger, "etcd-use-wrapper-logger", false, "Routes the logs of the embedded etcd through the etcd-wrapper logger")
+	fs.BoolVar(&config.Tracing.Enabled, "tracing-enabled", false, "Enables exporting OpenTelemetry traces of the etcd-wrapper bootstrap")
+	fs.StringVar(&config.Tracing.Endpoint, "tracing-otlp-endpoint", "", "Host and Port of the OTLP gRPC collector to which traces are exported")
+	fs.IntVar(&config.Tracing.SamplingRatePerMillion, "tracing-sampling-rate-per-million", types.MaxTracingSamplingRatePerMillion, "Number of traces that are sampled per million")
+	fs.BoolVar(&config.Tracing.EtcdTracingEnabled, "etcd-distributed-tracing-enabled", false, "Enables distributed tracing in the embedded etcd, exporting to the same OTLP endpoint")
+	fs.StringVar(&config.EtcdConfigOverrides.OverlayFilePath, "etcd-config-overlay-file", "", "File path of a YAML file which is merged on top of the etcd configuration fetched from backup-restore")
+	fs.Var(stringSliceFlag{values: &config.EtcdConfigOverrides.Overrides}, "etcd-config-override", "Overrides a field of the etcd configuration fetched from backup-restore, of the format <key>=<value>, can be passed several times")
+	fs.StringVar((*string)(&config.Preflight.Mode), "preflight-checks-mode", string(types.PreflightModeWarn), "Decides how failed pre-flight checks of the data directory are treated, one of disabled, warn or fatal")
+	fs.StringVar(&config.SnapshotVerification.SnapshotPath, "snapshot-verification-file", "", "File path of a local snapshot which is periodically verified to be restorable")
+	fs.DurationVar(&config.SnapshotVerification.Interval, "snapshot-verification-interval", 0, "Interval in which the snapshot is verified by restoring it into a throwaway etcd, 0 disables the verification")
+	fs.StringVar(&config.SnapshotVerification.TempDir, "snapshot-verification-temp-dir", "", "Directory in which the snapshot is restored for its verification, defaults to the directory for temporary files")
+	fs.DurationVar(&config.ConsistencyCheck.Interval, "consistency-check-interval", 0, "Interval in which the hash of the key space is compared with the peers, 0 disables the check")
+	fs.StringVar((*string)(&config.ConsistencyCheck.MismatchPolicy), "consistency-check-mismatch-policy", string(types.ConsistencyMismatchPolicyAlert), "Policy applied once the key space of this member has diverged from its peers, one of alert, fail-readiness or stop")
+	fs.StringVar(&config.Defragmentation.Schedule, "defragmentation-schedule", "", "Cron expression at which every member defragments itself, the leader last")
+	fs.DurationVar(&config.Defragmentation.Interval, "defragmentation-interval", 0, "Interval in which every member defragments itself, 0 disables the scheduled defragmentation unless a schedule is set")
+	fs.DurationVar(&config.Defragmentation.SamplingInterval, "defragmentation-sampling-interval", 0, "Interval in which the fragmentation is sampled to defragment a member once it exceeds the minimal fragmentation ratio, 0 disables the sampling")
+	fs.Float64Var(&config.Defragmentation.MinFragmentationRatio, "defragmentation-min-fragmentation-ratio", 0, "Minimal share of the database size which is not in use for a member to be defragmented")
+	fs.Int64Var(&config.Defragmentation.MinDBSizeBytes, "defragmentation-min-db-size", 0, "Minimal size of the database in bytes for a member to be defragmented")
+	fs.DurationVar(&config.QuotaWatcher.Interval, "quota-watch-interval", 0, "Interval in which the size of the database is compared with the backend quota, 0 disables the watcher")
+	config.QuotaWatcher.WarningThresholds = slices.Clone(types.DefaultQuotaWarningThresholds)
+	fs.Var(float64ListFlag{values: &config.QuotaWatcher.WarningThresholds}, "quota-warning-thresholds", "Comma separated, ascending percentages of the backend quota at which a warning is logged")
+	fs.BoolVar(&config.QuotaWatcher.CompactionEnabled, "quota-compaction-enabled", false, "Compacts the key space up to the revision sampled at least one hour before once the size of the database exceeds a warning threshold")
+	fs.BoolVar(&dryRunOpts.enabled, "dry-run", false, "Prints the validation mode and the effective etcd configuration and exits without starting etcd")
+	fs.StringVar(&dryRunOpts.etcdConfigFilePath, "dry-run-etcd-config-file", "", "File path of an etcd configuration used by --dry-run instead of fetching it from backup-restore")
 }
 
 // InitAndStartEtcd sets up and starts an embedded etcd
 func InitAndStartEtcd(ctx context.Context, cancelFn context.CancelFunc, logger *zap.Logger) error {
+	logger.Info("Starting etcd-wrapper", zap.Any("buildInfo", version.Get()))
+	if dryRunOpts.etcdConfigFilePath != "" && !dryRunOpts.enabled {
+		return errors.New("--dry-run-etcd-config-file can only be used together with --dry-run")
+	}
+	shutdownTracing, err := tracing.Setup(ctx, config.Tracing, logger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// the application context is already cancelled at this point, spans are flushed with a fresh context
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			logger.Error("failed to shut down tracing", zap.Error(err))
+		}
+	}()
+
 	etcdApp, err := app.NewApplication(ctx, cancelFn, config, etcdReadyTimeout, logger)
 	if err != nil {
 		return err
 	}
+	if dryRunOpts.enabled {
+		report, err := etcdApp.DryRun(dryRunOpts.etcdConfigFilePath)
+		if err != nil {
+			return err
+		}
+		return writeDryRunReport(os.Stdout, report)
+	}
 	if err := etcdApp.Setup(); err != nil {
 		return err
 	}
 	return etcdApp.Start()
 }
+
+// writeDryRunReport writes the report of a dry run as YAML to w.
+func writeDryRunReport(w io.Writer, report *app.DryRunReport) error {
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dry run report: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
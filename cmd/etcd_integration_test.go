@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/brclient"
+	"github.com/gardener/etcd-wrapper/internal/testutil"
+
+	. "github.com/onsi/gomega"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+const etcdConfigTemplate = `name: {{ .Name }}
+data-dir: {{ .DataDir }}
+log-level: warn
+listen-client-urls: http://127.0.0.1:{{ .ClientPort }}
+advertise-client-urls: http://127.0.0.1:{{ .ClientPort }}
+listen-peer-urls: http://127.0.0.1:{{ .PeerPort }}
+initial-advertise-peer-urls: http://127.0.0.1:{{ .PeerPort }}
+initial-cluster: {{ .Name }}=http://127.0.0.1:{{ .PeerPort }}
+initial-cluster-token: etcd-cluster
+initial-cluster-state: new
+`
+
+type etcdConfigTemplateData struct {
+	Name       string
+	DataDir    string
+	ClientPort int
+	PeerPort   int
+}
+
+// TestStartEtcdWithFakeBackupRestore runs start-etcd end to end against a fake backup-restore which fails the first
+// initialization, and checks that the embedded etcd serves requests once the second initialization succeeded.
+func TestStartEtcdWithFakeBackupRestore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping end to end test of start-etcd in short mode")
+	}
+	g := NewWithT(t)
+	tempDir := t.TempDir()
+	// the etcd configuration fetched from backup-restore is written to the home directory
+	t.Setenv("HOME", tempDir)
+
+	templateData := etcdConfigTemplateData{
+		Name:       "etcd-test",
+		DataDir:    filepath.Join(tempDir, "data"),
+		ClientPort: getFreePort(g),
+		PeerPort:   getFreePort(g),
+	}
+	fakeBR, err := testutil.NewFakeBackupRestore(
+		testutil.WithTLS(),
+		testutil.WithCapabilities(brclient.CapabilityInitializationStartPost, brclient.CapabilityLifecycleEvents),
+		testutil.WithInitializationSteps(testutil.InitializationStatusInProgress, testutil.InitializationStatusFailed, testutil.InitializationStatusInProgress, testutil.InitializationStatusSuccessful),
+		testutil.WithLatency(10*time.Millisecond),
+		testutil.WithEtcdConfigTemplate(etcdConfigTemplate, templateData),
+	)
+	g.Expect(err).ToNot(HaveOccurred())
+	defer fakeBR.Close()
+	caCertPath := filepath.Join(tempDir, "ca.crt")
+	g.Expect(fakeBR.WriteCACert(caCertPath)).To(Succeed())
+
+	etcdWrapperPort := getFreePort(g)
+	fs := flag.NewFlagSet("start-etcd", flag.ContinueOnError)
+	AddEtcdFlags(fs)
+	g.Expect(fs.Parse([]string{
+		"-etcd-wrapper-port", strconv.Itoa(etcdWrapperPort),
+		"-backup-restore-tls-enabled=true",
+		"-backup-restore-host-port", fakeBR.HostPort(),
+		"-backup-restore-ca-cert-bundle-path", caCertPath,
+		"-etcd-server-name", "127.0.0.1",
+		"-etcd-client-port", strconv.Itoa(templateData.ClientPort),
+		"-etcd-ready-timeout", "30s",
+	})).To(Succeed())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- InitAndStartEtcd(ctx, cancel, zap.NewNop())
+	}()
+
+	t.Log("waiting for etcd-wrapper to report etcd as ready")
+	readyzURL := fmt.Sprintf("http://127.0.0.1:%d/readyz", etcdWrapperPort)
+	g.Eventually(func() int {
+		response, err := http.Get(readyzURL) // #nosec G107 -- URL of the etcd-wrapper started by this test.
+		if err != nil {
+			return 0
+		}
+		defer func() { _ = response.Body.Close() }()
+		return response.StatusCode
+	}, 60*time.Second, 500*time.Millisecond).Should(Equal(http.StatusOK))
+
+	t.Log("checking that the embedded etcd serves requests")
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{fmt.Sprintf("http://127.0.0.1:%d", templateData.ClientPort)},
+		DialTimeout: 5 * time.Second,
+		Logger:      zap.NewNop(),
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	defer func() { _ = cli.Close() }()
+	_, err = cli.Put(ctx, "foo", "bar")
+	g.Expect(err).ToNot(HaveOccurred())
+	getResponse, err := cli.Get(ctx, "foo")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(getResponse.Kvs).To(HaveLen(1))
+	g.Expect(string(getResponse.Kvs[0].Value)).To(Equal("bar"))
+
+	t.Log("checking that the negotiated cluster version is reported")
+	g.Eventually(func() string {
+		response, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/version", etcdWrapperPort)) // #nosec G107 -- URL of the etcd-wrapper started by this test.
+		if err != nil {
+			return ""
+		}
+		defer func() { _ = response.Body.Close() }()
+		var body struct {
+			EtcdClusterVersion string `json:"etcdClusterVersion"`
+		}
+		if err = json.NewDecoder(response.Body).Decode(&body); err != nil {
+			return ""
+		}
+		return body.EtcdClusterVersion
+	}, 10*time.Second, 500*time.Millisecond).Should(Equal("3.5.0"))
+
+	t.Log("checking that the initialization was triggered again after it failed")
+	initializationRequests := fakeBR.InitializationRequests()
+	g.Expect(initializationRequests).To(HaveLen(2))
+	for _, request := range initializationRequests {
+		g.Expect(request.Method).To(Equal(http.MethodPost))
+		var initializationRequest brclient.InitializationRequest
+		g.Expect(json.Unmarshal(request.Body, &initializationRequest)).To(Succeed())
+		g.Expect(initializationRequest.Mode).To(Equal(brclient.FullValidation))
+	}
+	g.Expect(filepath.Join(tempDir, "etcd.conf.yaml")).To(BeAnExistingFile())
+
+	t.Log("checking that backup-restore has been notified that etcd is ready and the leader")
+	g.Eventually(fakeBR.LifecycleEvents, 10*time.Second).Should(ConsistOf(
+		testutil.FakeLifecycleEvent{Event: string(brclient.EtcdReady)},
+		testutil.FakeLifecycleEvent{Event: string(brclient.LeadershipGained)},
+	))
+
+	t.Log("stopping etcd-wrapper")
+	cancel()
+	g.Eventually(runErr, 30*time.Second).Should(Receive(BeNil()))
+	g.Expect(fakeBR.LifecycleEvents()).To(ContainElement(testutil.FakeLifecycleEvent{Event: string(brclient.EtcdStopping), Reason: "application context has been cancelled"}))
+}
+
+func getFreePort(g *WithT) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer func() { _ = listener.Close() }()
+	return listener.Addr().(*net.TCPAddr).Port
+}
@@ -5,9 +5,15 @@
 package cmd
 
 import (
+	"bytes"
 	"flag"
+	"io"
 	"testing"
 
+	"github.com/gardener/etcd-wrapper/internal/app"
+	"github.com/gardener/etcd-wrapper/internal/brclient"
+	"github.com/gardener/etcd-wrapper/internal/types"
+
 	. "github.com/onsi/gomega"
 )
 
@@ -15,18 +21,37 @@ func TestAddEtcdFlags(t *testing.T) {
 	g := NewWithT(t)
 	expectedBRHostPort := "etcd-main-local:8080"
 	expectedBRCACertPath := "/var/etcd/ssl/ca/bundle.crt"
+	expectedBRTLSServerName := "etcd-main-local"
+	expectedBRClientCertPath := "/var/etcd/ssl/backup-restore-client/tls.crt"
+	expectedBRClientKeyPath := "/var/etcd/ssl/backup-restore-client/tls.key"
 	expectedETCDServerName := "etcd-main-local"
 	expectedETCDClientCertPath := "/var/etcd/ssl/client/tls.crt"
 	expectedETCDClientKeyPath := "/var/etcd/ssl/client/tls.key"
 	expectedETCDReadyTimeout := "2m0s"
+	expectedSnapshotVerificationFile := "/var/etcd/backup/etcd.db"
+	expectedSnapshotVerificationInterval := "6h0m0s"
 	args := []string{
 		"-backup-restore-tls-enabled=true",
 		"-backup-restore-host-port", expectedBRHostPort,
 		"-backup-restore-ca-cert-bundle-path", expectedBRCACertPath,
+		"-backup-restore-tls-server-name", expectedBRTLSServerName,
+		"-backup-restore-client-cert-path", expectedBRClientCertPath,
+		"-backup-restore-client-key-path", expectedBRClientKeyPath,
 		"-etcd-server-name", expectedETCDServerName,
 		"-etcd-client-cert-path", expectedETCDClientCertPath,
 		"-etcd-client-key-path", expectedETCDClientKeyPath,
 		"-etcd-ready-timeout", expectedETCDReadyTimeout,
+		"-snapshot-verification-file", expectedSnapshotVerificationFile,
+		"-snapshot-verification-interval", expectedSnapshotVerificationInterval,
+		"-consistency-check-interval", "30m",
+		"-consistency-check-mismatch-policy", "fail-readiness",
+		"-defragmentation-schedule", "0 3 * * *",
+		"-defragmentation-sampling-interval", "5m",
+		"-defragmentation-min-fragmentation-ratio", "0.5",
+		"-defragmentation-min-db-size", "104857600",
+		"-quota-watch-interval", "1m",
+		"-quota-warning-thresholds", "80, 90",
+		"-quota-compaction-enabled",
 	}
 	fs := flag.NewFlagSet("testutil", flag.ContinueOnError)
 	AddEtcdFlags(fs)
@@ -35,8 +60,97 @@ func TestAddEtcdFlags(t *testing.T) {
 	g.Expect(config.BackupRestore.TLSEnabled).To(BeTrue())
 	g.Expect(config.BackupRestore.HostPort).To(Equal(expectedBRHostPort))
 	g.Expect(config.BackupRestore.CaCertBundlePath).To(Equal(expectedBRCACertPath))
+	g.Expect(config.BackupRestore.TLSServerName).To(Equal(expectedBRTLSServerName))
+	g.Expect(config.BackupRestore.ClientCertPath).To(Equal(expectedBRClientCertPath))
+	g.Expect(config.BackupRestore.ClientKeyPath).To(Equal(expectedBRClientKeyPath))
 	g.Expect(config.EtcdClientTLS.ServerName).To(Equal(expectedETCDServerName))
 	g.Expect(config.EtcdClientTLS.CertPath).To(Equal(expectedETCDClientCertPath))
 	g.Expect(config.EtcdClientTLS.KeyPath).To(Equal(expectedETCDClientKeyPath))
 	g.Expect(etcdReadyTimeout.String()).To(Equal(expectedETCDReadyTimeout))
+	g.Expect(config.SnapshotVerification.SnapshotPath).To(Equal(expectedSnapshotVerificationFile))
+	g.Expect(config.SnapshotVerification.Interval.String()).To(Equal(expectedSnapshotVerificationInterval))
+	g.Expect(config.ConsistencyCheck.Interval.String()).To(Equal("30m0s"))
+	g.Expect(config.ConsistencyCheck.MismatchPolicy).To(Equal(types.ConsistencyMismatchPolicyFailReadiness))
+	g.Expect(config.Defragmentation.Schedule).To(Equal("0 3 * * *"))
+	g.Expect(config.Defragmentation.SamplingInterval.String()).To(Equal("5m0s"))
+	g.Expect(config.Defragmentation.MinFragmentationRatio).To(Equal(0.5))
+	g.Expect(config.Defragmentation.MinDBSizeBytes).To(BeEquivalentTo(104857600))
+	g.Expect(config.QuotaWatcher.Interval.String()).To(Equal("1m0s"))
+	g.Expect(config.QuotaWatcher.WarningThresholds).To(Equal([]float64{80, 90}))
+	g.Expect(config.QuotaWatcher.CompactionEnabled).To(BeTrue())
+}
+
+func TestQuotaWarningThresholdsFlag(t *testing.T) {
+	table := []struct {
+		description        string
+		args               []string
+		expectedThresholds []float64
+		expectedError      bool
+	}{
+		{"should default to the default thresholds", nil, types.DefaultQuotaWarningThresholds, false},
+		{"should replace the default thresholds", []string{"-quota-warning-thresholds", "50,75.5"}, []float64{50, 75.5}, false},
+		{"should allow to disable all thresholds", []string{"-quota-warning-thresholds", ""}, []float64{}, false},
+		{"should disallow thresholds which are not numbers", []string{"-quota-warning-thresholds", "70,high"}, nil, true},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		config = types.Config{}
+		fs := flag.NewFlagSet("testutil", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		AddEtcdFlags(fs)
+		err := fs.Parse(entry.args)
+		g.Expect(err != nil).To(Equal(entry.expectedError))
+		if !entry.expectedError {
+			g.Expect(config.QuotaWatcher.WarningThresholds).To(Equal(entry.expectedThresholds))
+		}
+		g.Expect(fs.Lookup("quota-warning-thresholds").DefValue).To(Equal("70,85,95"))
+	}
+	config = types.Config{}
+}
+
+func TestAddEtcdDryRunFlags(t *testing.T) {
+	g := NewWithT(t)
+	fs := flag.NewFlagSet("testutil", flag.ContinueOnError)
+	AddEtcdFlags(fs)
+	g.Expect(fs.Parse([]string{"-dry-run", "-dry-run-etcd-config-file", "/var/etcd/config/etcd.conf.yaml"})).To(Succeed())
+	g.Expect(dryRunOpts.enabled).To(BeTrue())
+	g.Expect(dryRunOpts.etcdConfigFilePath).To(Equal("/var/etcd/config/etcd.conf.yaml"))
+}
+
+func TestWriteDryRunReport(t *testing.T) {
+	g := NewWithT(t)
+	report := &app.DryRunReport{
+		ValidationMode:   brclient.SanityValidation,
+		ValidationReason: brclient.ValidationReason{Description: "previous run was terminated gracefully", LastExitSignal: "terminated"},
+		EtcdConfigSource: "/var/etcd/config/etcd.conf.yaml",
+		EtcdConfig:       map[string]any{"name": "etcd-main-0", "initial-cluster-token": types.RedactedValue},
+	}
+	var buf bytes.Buffer
+	g.Expect(writeDryRunReport(&buf, report)).To(Succeed())
+	g.Expect(buf.String()).To(Equal(`etcdConfig:
+  initial-cluster-token: <redacted>
+  name: etcd-main-0
+etcdConfigSource: /var/etcd/config/etcd.conf.yaml
+validationMode: sanity
+validationReason:
+  consecutiveFailedStarts: 0
+  description: previous run was terminated gracefully
+  lastExitSignal: terminated
+`))
+}
+
+func TestAddEtcdConfigOverrideFlags(t *testing.T) {
+	g := NewWithT(t)
+	config = types.Config{}
+	defer func() { config = types.Config{} }()
+	fs := flag.NewFlagSet("testutil", flag.ContinueOnError)
+	AddEtcdFlags(fs)
+	g.Expect(fs.Parse([]string{
+		"-etcd-config-overlay-file", "/var/etcd/config/overlay.yaml",
+		"-etcd-config-override", "snapshot-count=10000",
+		"-etcd-config-override", "quota-backend-bytes=8589934592",
+	})).To(Succeed())
+	g.Expect(config.EtcdConfigOverrides.OverlayFilePath).To(Equal("/var/etcd/config/overlay.yaml"))
+	g.Expect(config.EtcdConfigOverrides.Overrides).To(Equal([]string{"snapshot-count=10000", "quota-backend-bytes=8589934592"}))
 }
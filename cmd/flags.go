@@ -0,0 +1,273 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// FlagSourceDefault denotes that a flag has its default value.
+	FlagSourceDefault FlagSource = "default"
+	// FlagSourceFile denotes that a flag has been set from the wrapper configuration file.
+	FlagSourceFile FlagSource = "file"
+	// FlagSourceEnv denotes that a flag has been set from an environment variable.
+	FlagSourceEnv FlagSource = "env"
+	// FlagSourceCommandLine denotes that a flag has been passed on the command line.
+	FlagSourceCommandLine FlagSource = "flag"
+
+	// EnvVarPrefix is the prefix of the environment variables from which flags are set.
+	EnvVarPrefix = types.EnvVarPrefix
+	// configFileFlagName is the name of the flag holding the path of the wrapper configuration file.
+	configFileFlagName = "config-file"
+)
+
+// FlagSource describes where the value of a flag has been taken from.
+type FlagSource string
+
+// ParseFlags parses the flags of a command from args, from ETCD_WRAPPER_* environment variables and from the
+// wrapper configuration file passed with --config-file, in this order of precedence. It returns the source of the
+// value of every flag.
+//
+// The wrapper configuration file may hold flags of other commands, as it can be shared by all commands via the
+// environment variable of --config-file. These are skipped, only names which are no flag of any command are rejected.
+func ParseFlags(fs *flag.FlagSet, args []string) (map[string]FlagSource, error) {
+	knownFlagNames := commandFlagNames()
+	var configFile string
+	fs.StringVar(&configFile, configFileFlagName, "", "File path of a YAML file with values of flags which are neither passed on the command line nor via environment variables")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]FlagSource)
+	fs.VisitAll(func(f *flag.Flag) {
+		sources[f.Name] = FlagSourceDefault
+	})
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = FlagSourceCommandLine
+	})
+
+	// the configuration file can itself be passed as environment variable, it cannot be set in the file though
+	if sources[configFileFlagName] == FlagSourceDefault {
+		if err := setFromEnv(fs, fs.Lookup(configFileFlagName), sources); err != nil {
+			return nil, err
+		}
+	}
+	fileValues, err := readWrapperConfigFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fileValues[configFileFlagName]; ok {
+		return nil, fmt.Errorf("%s cannot be set in the wrapper configuration file %s", configFileFlagName, configFile)
+	}
+	for name := range fileValues {
+		if fs.Lookup(name) == nil && !knownFlagNames[name] {
+			return nil, fmt.Errorf("unknown flag %s in wrapper configuration file %s", name, configFile)
+		}
+	}
+
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	for _, f := range flags {
+		if sources[f.Name] != FlagSourceDefault {
+			continue
+		}
+		if err = setFromEnv(fs, f, sources); err != nil {
+			return nil, err
+		}
+		if value, ok := fileValues[f.Name]; ok && sources[f.Name] == FlagSourceDefault {
+			if err = setFromFile(fs, f, value); err != nil {
+				return nil, fmt.Errorf("invalid value for flag %s in wrapper configuration file %s: %w", f.Name, configFile, err)
+			}
+			sources[f.Name] = FlagSourceFile
+		}
+	}
+	return sources, nil
+}
+
+// commandFlagNames returns the names of the flags of all commands. Adding the flags of a command resets the
+// variables they are bound to to their defaults, so it must be called before any flags are parsed.
+func commandFlagNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, command := range Commands {
+		fs := flag.NewFlagSet(command.Name, flag.ContinueOnError)
+		command.AddFlags(fs)
+		fs.VisitAll(func(f *flag.Flag) {
+			names[f.Name] = true
+		})
+	}
+	return names
+}
+
+// EnvVarName returns the name of the environment variable from which the flag with the passed name is set.
+func EnvVarName(flagName string) string {
+	return EnvVarPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// setFromEnv sets the flag from its environment variable, if that is set. Values of flags which can be passed
+// several times are separated by newlines.
+func setFromEnv(fs *flag.FlagSet, f *flag.Flag, sources map[string]FlagSource) error {
+	envVarName := EnvVarName(f.Name)
+	value, ok := os.LookupEnv(envVarName)
+	if !ok {
+		return nil
+	}
+	values := []string{value}
+	if _, repeatable := f.Value.(stringSliceFlag); repeatable {
+		values = strings.Split(strings.TrimSpace(value), "\n")
+	}
+	for _, v := range values {
+		if err := fs.Set(f.Name, v); err != nil {
+			return fmt.Errorf("invalid value for flag %s in environment variable %s: %w", f.Name, envVarName, err)
+		}
+	}
+	sources[f.Name] = FlagSourceEnv
+	return nil
+}
+
+// setFromFile sets the flag from a value of the wrapper configuration file. Values of flags which can be passed
+// several times are given as lists.
+func setFromFile(fs *flag.FlagSet, f *flag.Flag, value any) error {
+	values, isList := value.([]any)
+	if _, repeatable := f.Value.(stringSliceFlag); !repeatable || !isList {
+		if isList {
+			return fmt.Errorf("flag cannot be passed several times")
+		}
+		values = []any{value}
+	}
+	for _, v := range values {
+		var s string
+		switch typed := v.(type) {
+		case string:
+			s = typed
+		case float64:
+			s = strconv.FormatFloat(typed, 'f', -1, 64)
+		case bool:
+			s = strconv.FormatBool(typed)
+		default:
+			return fmt.Errorf("unsupported value %v", v)
+		}
+		if err := fs.Set(f.Name, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readWrapperConfigFile reads the wrapper configuration file at path, which maps flag names to their values.
+func readWrapperConfigFile(path string) (map[string]any, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- path of the wrapper configuration passed by the operator.
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wrapper configuration file %s: %w", path, err)
+	}
+	var values map[string]any
+	if err = yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse wrapper configuration file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// RedactedFlagValue returns the value of the flag as string, with sensitive values redacted. It should be used
+// wherever flags are logged.
+func RedactedFlagValue(f *flag.Flag) string {
+	// flags bound to fields of the config are sensitive if the fields are tagged with `redact`
+	redact, ok := config.Redactors()[boundAddress(f.Value)]
+	if !ok {
+		return f.Value.String()
+	}
+	if slice, ok := f.Value.(stringSliceFlag); ok && slice.values != nil {
+		redacted := make([]string, 0, len(*slice.values))
+		for _, value := range *slice.values {
+			redacted = append(redacted, redact(value))
+		}
+		return strings.Join(redacted, ",")
+	}
+	if f.Value.String() == "" {
+		return ""
+	}
+	return redact(f.Value.String())
+}
+
+// boundAddress returns the address of the variable the value of a flag is bound to, or 0 if it is not known.
+func boundAddress(value flag.Value) uintptr {
+	switch v := value.(type) {
+	case stringSliceFlag:
+		return reflect.ValueOf(v.values).Pointer()
+	case float64ListFlag:
+		return reflect.ValueOf(v.values).Pointer()
+	}
+	// the values of the flags defined by the flag package are pointers to the variables they are bound to
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Pointer {
+		return rv.Pointer()
+	}
+	return 0
+}
+
+// stringSliceFlag is a flag.Value which collects the values of a flag which can be passed several times.
+type stringSliceFlag struct {
+	values *[]string
+}
+
+// String returns the collected values separated by commas.
+func (f stringSliceFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+// Set appends value to the collected values.
+func (f stringSliceFlag) Set(value string) error {
+	*f.values = append(*f.values, value)
+	return nil
+}
+
+// float64ListFlag is a flag.Value which parses a comma separated list of numbers, replacing its default value.
+type float64ListFlag struct {
+	values *[]float64
+}
+
+// String returns the values separated by commas.
+func (f float64ListFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	formatted := make([]string, 0, len(*f.values))
+	for _, value := range *f.values {
+		formatted = append(formatted, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	return strings.Join(formatted, ",")
+}
+
+// Set parses value as comma separated list of numbers. An empty value results in an empty list.
+func (f float64ListFlag) Set(value string) error {
+	values := []float64{}
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", part)
+		}
+		values = append(values, parsed)
+	}
+	*f.values = values
+	return nil
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	. "github.com/onsi/gomega"
+)
+
+// testFlags are the flags used to test the flag sources.
+type testFlags struct {
+	port      int
+	hostPort  string
+	enabled   bool
+	timeout   time.Duration
+	overrides []string
+}
+
+func newTestFlagSet(flags *testFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.IntVar(&flags.port, "etcd-wrapper-port", 9095, "")
+	fs.StringVar(&flags.hostPort, "backup-restore-host-port", ":8080", "")
+	fs.BoolVar(&flags.enabled, "tracing-enabled", false, "")
+	fs.DurationVar(&flags.timeout, "etcd-ready-timeout", 0, "")
+	fs.Var(stringSliceFlag{values: &flags.overrides}, "etcd-config-override", "")
+	return fs
+}
+
+func TestParseFlags(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "wrapper.yaml")
+	g := NewWithT(t)
+	g.Expect(os.WriteFile(configFile, []byte(`etcd-wrapper-port: 9096
+backup-restore-host-port: etcd-main-local:8080
+tracing-enabled: true
+etcd-ready-timeout: 2m
+etcd-config-override:
+- snapshot-count=10000
+- quota-backend-bytes=8589934592
+`), 0600)).To(Succeed())
+
+	table := []struct {
+		description     string
+		args            []string
+		env             map[string]string
+		expectedFlags   testFlags
+		expectedSources map[string]FlagSource
+	}{
+		{"should use defaults without any source", nil, nil,
+			testFlags{port: 9095, hostPort: ":8080"},
+			map[string]FlagSource{"etcd-wrapper-port": FlagSourceDefault, "backup-restore-host-port": FlagSourceDefault, configFileFlagName: FlagSourceDefault}},
+		{"should take values from the file", []string{"--config-file", configFile}, nil,
+			testFlags{port: 9096, hostPort: "etcd-main-local:8080", enabled: true, timeout: 2 * time.Minute, overrides: []string{"snapshot-count=10000", "quota-backend-bytes=8589934592"}},
+			map[string]FlagSource{"etcd-wrapper-port": FlagSourceFile, "etcd-config-override": FlagSourceFile, configFileFlagName: FlagSourceCommandLine}},
+		{"should let environment variables take precedence over the file", nil, map[string]string{"ETCD_WRAPPER_CONFIG_FILE": configFile, "ETCD_WRAPPER_ETCD_WRAPPER_PORT": "9097", "ETCD_WRAPPER_ETCD_CONFIG_OVERRIDE": "snapshot-count=20000\nmax-txn-ops=256"},
+			testFlags{port: 9097, hostPort: "etcd-main-local:8080", enabled: true, timeout: 2 * time.Minute, overrides: []string{"snapshot-count=20000", "max-txn-ops=256"}},
+			map[string]FlagSource{"etcd-wrapper-port": FlagSourceEnv, "backup-restore-host-port": FlagSourceFile, "etcd-config-override": FlagSourceEnv, configFileFlagName: FlagSourceEnv}},
+		{"should let flags take precedence over environment variables and the file", []string{"--config-file", configFile, "--etcd-wrapper-port", "9098", "--tracing-enabled=false"}, map[string]string{"ETCD_WRAPPER_ETCD_WRAPPER_PORT": "9097"},
+			testFlags{port: 9098, hostPort: "etcd-main-local:8080", timeout: 2 * time.Minute, overrides: []string{"snapshot-count=10000", "quota-backend-bytes=8589934592"}},
+			map[string]FlagSource{"etcd-wrapper-port": FlagSourceCommandLine, "tracing-enabled": FlagSourceCommandLine, "etcd-ready-timeout": FlagSourceFile}},
+	}
+	for _, entry := range table {
+		t.Run(entry.description, func(t *testing.T) {
+			g := NewWithT(t)
+			for name, value := range entry.env {
+				t.Setenv(name, value)
+			}
+			var flags testFlags
+			sources, err := ParseFlags(newTestFlagSet(&flags), entry.args)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(flags).To(Equal(entry.expectedFlags))
+			for name, source := range entry.expectedSources {
+				g.Expect(sources).To(HaveKeyWithValue(name, source))
+			}
+		})
+	}
+}
+
+func TestParseFlagsErrors(t *testing.T) {
+	dir := t.TempDir()
+	table := []struct {
+		description string
+		fileContent string
+		env         map[string]string
+	}{
+		{"should fail for an unknown flag in the file", "etcd-wrapper-prt: 9096\n", nil},
+		{"should fail for an invalid value in the file", "etcd-wrapper-port: not-a-number\n", nil},
+		{"should fail for a list of values of a flag which can only be passed once", "etcd-wrapper-port: [9096, 9097]\n", nil},
+		{"should fail for the config file being set in the file", "config-file: other.yaml\n", nil},
+		{"should fail for an invalid value in an environment variable", "", map[string]string{"ETCD_WRAPPER_ETCD_READY_TIMEOUT": "forever"}},
+	}
+	for i, entry := range table {
+		t.Run(entry.description, func(t *testing.T) {
+			g := NewWithT(t)
+			for name, value := range entry.env {
+				t.Setenv(name, value)
+			}
+			configFile := filepath.Join(dir, "wrapper-"+string(rune('a'+i))+".yaml")
+			g.Expect(os.WriteFile(configFile, []byte(entry.fileContent), 0600)).To(Succeed())
+			var flags testFlags
+			_, err := ParseFlags(newTestFlagSet(&flags), []string{"--config-file", configFile})
+			g.Expect(err).To(HaveOccurred())
+		})
+	}
+}
+
+func TestParseFlagsWithConfigFileOfOtherCommand(t *testing.T) {
+	g := NewWithT(t)
+	configFile := filepath.Join(t.TempDir(), "wrapper.yaml")
+	g.Expect(os.WriteFile(configFile, []byte(`etcd-wrapper-port: 9096
+backup-restore-host-port: etcd-main-local:8080
+output: json
+`), 0600)).To(Succeed())
+	t.Setenv(EnvVarName(configFileFlagName), configFile)
+	defer func() { versionOutputFormat = outputFormatText }()
+
+	fs := flag.NewFlagSet(VersionCmd.Name, flag.ContinueOnError)
+	VersionCmd.AddFlags(fs)
+	sources, err := ParseFlags(fs, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(versionOutputFormat).To(Equal(outputFormatJSON))
+	g.Expect(sources).To(Equal(map[string]FlagSource{"output": FlagSourceFile, configFileFlagName: FlagSourceEnv}))
+}
+
+func TestEnvVarName(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(EnvVarName("backup-restore-host-port")).To(Equal("ETCD_WRAPPER_BACKUP_RESTORE_HOST_PORT"))
+}
+
+func TestRedactedFlagValue(t *testing.T) {
+	g := NewWithT(t)
+	config = types.Config{}
+	defer func() { config = types.Config{} }()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	AddEtcdFlags(fs)
+	g.Expect(fs.Parse([]string{
+		"-backup-restore-host-port", "etcd-main-local:8080",
+		"-backup-restore-client-key-path", "/var/etcd/ssl/backup-restore-client/tls.key",
+		"-etcd-config-override", "snapshot-count=10000",
+		"-etcd-config-override", "initial-cluster-token=secret-token",
+	})).To(Succeed())
+
+	g.Expect(RedactedFlagValue(fs.Lookup("backup-restore-host-port"))).To(Equal("etcd-main-local:8080"))
+	g.Expect(RedactedFlagValue(fs.Lookup("backup-restore-client-key-path"))).To(Equal(types.RedactedValue))
+	g.Expect(RedactedFlagValue(fs.Lookup("etcd-client-key-path"))).To(BeEmpty())
+	g.Expect(RedactedFlagValue(fs.Lookup("etcd-config-override"))).To(Equal("snapshot-count=10000,initial-cluster-token=" + types.RedactedValue))
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// HashCmd computes the hash of the key space of a data directory of etcd which is not in use.
+	HashCmd = Command{
+		Name:      "hash",
+		UsageLine: "etcd-wrapper hash --data-dir <path> [--revision <revision>] [flags]",
+		ShortDesc: "Computes the hash of the key space of an etcd data directory which is not in use",
+		LongDesc: `Computes the hash of the key space of an etcd data directory offline, i.e. while etcd is not running, up to a
+revision. It is the same hash which is returned by the HashKV API of etcd, so it can be compared with the hash of
+other members, e.g. from 'etcdctl endpoint hashkv --rev <revision>', to find members whose data has diverged. The
+database is opened read-only, the data directory is not changed.
+
+Flags:
+	--data-dir
+		Path of the etcd data directory whose key space is hashed.
+	--revision
+		Revision up to which the key space is hashed. Default: 0, which hashes up to the latest revision.
+	--output
+		Output format, either text or json. Default: text`,
+		AddFlags: AddHashFlags,
+		Run:      Hash,
+	}
+	// hashOpts are the options of the hash command.
+	hashOpts = struct {
+		dataDir      string
+		revision     int64
+		outputFormat string
+	}{}
+)
+
+// AddHashFlags adds the flags of the hash command to the passed FlagSet.
+func AddHashFlags(fs *flag.FlagSet) {
+	fs.StringVar(&hashOpts.dataDir, "data-dir", "", "Path of the etcd data directory whose key space is hashed")
+	fs.Int64Var(&hashOpts.revision, "revision", 0, "Revision up to which the key space is hashed, defaults to the latest revision")
+	fs.StringVar(&hashOpts.outputFormat, "output", outputFormatText, "Output format, either text or json")
+}
+
+// Hash computes the hash of the key space of the data directory and prints the report to stdout.
+func Hash(_ context.Context, _ context.CancelFunc, logger *zap.Logger) error {
+	if strings.TrimSpace(hashOpts.dataDir) == "" {
+		return errors.New("--data-dir is required")
+	}
+	if hashOpts.revision < 0 {
+		return fmt.Errorf("--revision must not be negative, got %d", hashOpts.revision)
+	}
+	if err := validateOutputFormat(hashOpts.outputFormat); err != nil {
+		return err
+	}
+	report, err := datadir.HashKV(hashOpts.dataDir, hashOpts.revision)
+	if err != nil {
+		return err
+	}
+	return writeHashReport(os.Stdout, report, hashOpts.outputFormat)
+}
+
+func writeHashReport(w io.Writer, report *datadir.HashReport, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return printJSON(w, report)
+	}
+	_, err := fmt.Fprintf(w, `Hash of database %s
+  hash: %d
+  revision: %d, compact revision: %d, current revision: %d
+`, report.Path, report.Hash, report.Revision, report.CompactRevision, report.CurrentRevision)
+	return err
+}
@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWriteHashReport(t *testing.T) {
+	report := &datadir.HashReport{
+		Path:            "/var/etcd/data/new.etcd/member/snap/db",
+		Hash:            3735928559,
+		Revision:        42,
+		CompactRevision: 10,
+		CurrentRevision: 50,
+	}
+	table := []struct {
+		description  string
+		outputFormat string
+	}{
+		{"should print report as text", outputFormatText},
+		{"should print report as JSON", outputFormatJSON},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		var buf bytes.Buffer
+		g.Expect(writeHashReport(&buf, report, entry.outputFormat)).To(Succeed())
+		if entry.outputFormat == outputFormatJSON {
+			var decoded datadir.HashReport
+			g.Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+			g.Expect(&decoded).To(Equal(report))
+			continue
+		}
+		g.Expect(buf.String()).To(Equal(`Hash of database /var/etcd/data/new.etcd/member/snap/db
+  hash: 3735928559
+  revision: 42, compact revision: 10, current revision: 50
+`))
+	}
+}
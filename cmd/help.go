@@ -6,8 +6,8 @@ package cmd
 
 import (
 	"bufio"
-	"html/template"
 	"io"
+	"text/template"
 )
 
 var (
@@ -21,16 +21,30 @@ USAGE:
 DESCRIPTION:
 {{printf "\t%s" .LongDesc}}
 {{end}}
+`
+	flagSourcesHelp = `
+FLAG SOURCES:
+	Every flag can also be set via an environment variable named ETCD_WRAPPER_ followed by the flag name in upper
+	case with dashes replaced by underscores, e.g. ETCD_WRAPPER_ETCD_WRAPPER_PORT, or in a YAML file mapping flag
+	names to values which is passed with --config-file (or ETCD_WRAPPER_CONFIG_FILE). Values passed on the command line
+	take precedence over environment variables, which take precedence over the file, which takes precedence over
+	the defaults.
 `
 )
 
-// PrintHelp prints out help test for the start-etcd command
+// PrintHelp prints out help text for all supported commands
 func PrintHelp(w io.Writer) error {
 	bufW := bufio.NewWriter(w)
 	defer func() {
 		_ = bufW.Flush()
 	}()
-	return executeTemplate(w, cliHelpTemplate, EtcdCmd)
+	for _, cmd := range Commands {
+		if err := executeTemplate(bufW, cliHelpTemplate, cmd); err != nil {
+			return err
+		}
+	}
+	_, err := bufW.WriteString(flagSourcesHelp)
+	return err
 }
 
 func executeTemplate(w io.Writer, tmplText string, tmplData interface{}) error {
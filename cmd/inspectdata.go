@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// InspectDataCmd describes the contents of a data directory of etcd which is not in use.
+	InspectDataCmd = Command{
+		Name:      "inspect-data",
+		UsageLine: "etcd-wrapper inspect-data --data-dir <path> [flags]",
+		ShortDesc: "Describes the WAL, snapshots and database of an etcd data directory which is not in use",
+		LongDesc: `Reads an etcd data directory offline, i.e. while etcd is not running, and describes its write-ahead log, its
+raft snapshots and its bbolt database: the member and cluster ID, the WAL segments and snapshot files, sizes, free
+pages, revisions, raft indexes, the number of keys per bucket and the number of keys, revisions and value bytes per
+key prefix. The data directory is only read.
+
+Flags:
+	--data-dir
+		Path of the etcd data directory to inspect.
+	--wal-dir
+		Path of the dedicated WAL directory of etcd. Default: the WAL directory in the data directory.
+	--prefix-depth
+		Number of path segments of keys, separated by /, by which keys are grouped into prefixes. Default: 2
+	--output
+		Output format, either text or json. Default: text`,
+		AddFlags: AddInspectDataFlags,
+		Run:      InspectData,
+	}
+	// inspectDataOpts are the options of the inspect-data command.
+	inspectDataOpts = struct {
+		outputFormat string
+		datadir.InspectOptions
+	}{}
+)
+
+// AddInspectDataFlags adds the flags of the inspect-data command to the passed FlagSet.
+func AddInspectDataFlags(fs *flag.FlagSet) {
+	fs.StringVar(&inspectDataOpts.DataDir, "data-dir", "", "Path of the etcd data directory to inspect")
+	fs.StringVar(&inspectDataOpts.WALDir, "wal-dir", "", "Path of the dedicated WAL directory of etcd, defaults to the WAL directory in the data directory")
+	fs.IntVar(&inspectDataOpts.PrefixDepth, "prefix-depth", datadir.DefaultPrefixDepth, "Number of path segments of keys by which keys are grouped into prefixes")
+	fs.StringVar(&inspectDataOpts.outputFormat, "output", outputFormatText, "Output format, either text or json")
+}
+
+// InspectData inspects the data directory and prints the report to stdout.
+func InspectData(_ context.Context, _ context.CancelFunc, _ *zap.Logger) error {
+	if strings.TrimSpace(inspectDataOpts.DataDir) == "" {
+		return errors.New("--data-dir is required")
+	}
+	if err := validateOutputFormat(inspectDataOpts.outputFormat); err != nil {
+		return err
+	}
+	if inspectDataOpts.PrefixDepth <= 0 {
+		return fmt.Errorf("--prefix-depth must be positive, got %d", inspectDataOpts.PrefixDepth)
+	}
+	report, err := datadir.Inspect(inspectDataOpts.InspectOptions)
+	if err != nil {
+		return err
+	}
+	return writeDataReport(os.Stdout, report, inspectDataOpts.outputFormat)
+}
+
+func writeDataReport(w io.Writer, report *datadir.DataReport, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return printJSON(w, report)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Data directory %s\n", report.DataDir)
+	if report.MemberID != "" {
+		fmt.Fprintf(&sb, "Member %s of cluster %s\n", report.MemberID, report.ClusterID)
+	}
+	fmt.Fprintf(&sb, "WAL (%s)\n", report.WAL.Dir)
+	fmt.Fprintf(&sb, "  segments: %d, size: %d bytes\n", report.WAL.Segments, report.WAL.SizeBytes)
+	if report.WAL.Segments > 0 {
+		for _, name := range report.WAL.SegmentFiles {
+			fmt.Fprintf(&sb, "    %s\n", name)
+		}
+		fmt.Fprintf(&sb, "  last entry: term %d, index %d\n", report.WAL.LastTerm, report.WAL.LastIndex)
+	}
+	fmt.Fprintf(&sb, "Snapshots (%s)\n", report.Snap.Dir)
+	fmt.Fprintf(&sb, "  snapshots: %d, size: %d bytes\n", report.Snap.Snapshots, report.Snap.SizeBytes)
+	if report.Snap.Snapshots > 0 {
+		for _, name := range report.Snap.Files {
+			fmt.Fprintf(&sb, "    %s\n", name)
+		}
+		fmt.Fprintf(&sb, "  latest snapshot: term %d, index %d\n", report.Snap.LatestTerm, report.Snap.LatestIndex)
+	}
+	backend := report.Backend
+	if backend == nil {
+		sb.WriteString("Database: none\n")
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+	fmt.Fprintf(&sb, "Database (%s)\n", backend.Path)
+	fmt.Fprintf(&sb, "  size: %d bytes, in use: %d bytes, free pages: %d\n", backend.SizeBytes, backend.SizeInUseBytes, backend.FreePages)
+	fmt.Fprintf(&sb, "  revision: %d, compact revision: %d\n", backend.Revision, backend.CompactRevision)
+	fmt.Fprintf(&sb, "  consistent index: %d, term: %d\n", backend.ConsistentIndex, backend.Term)
+	fmt.Fprintf(&sb, "  keys: %d, revisions: %d\n", backend.Keys, backend.Revisions)
+	bucketNames := make([]string, 0, len(backend.Buckets))
+	for name := range backend.Buckets {
+		bucketNames = append(bucketNames, name)
+	}
+	sort.Strings(bucketNames)
+	sb.WriteString("  buckets:\n")
+	for _, name := range bucketNames {
+		fmt.Fprintf(&sb, "    %s: %d\n", name, backend.Buckets[name])
+	}
+	sb.WriteString("  prefixes:\n")
+	tw := tabwriter.NewWriter(&sb, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "    PREFIX\tKEYS\tREVISIONS\tVALUE BYTES")
+	for _, prefix := range backend.Prefixes {
+		fmt.Fprintf(tw, "    %q\t%d\t%d\t%d\n", prefix.Prefix, prefix.Keys, prefix.Revisions, prefix.ValueSizeBytes)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
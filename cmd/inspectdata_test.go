@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWriteDataReport(t *testing.T) {
+	report := &datadir.DataReport{
+		DataDir:   "/var/etcd/data/new.etcd",
+		MemberID:  "8e9e05c52164694d",
+		ClusterID: "cdf818194e3a8c32",
+		WAL: datadir.WALStats{
+			Dir:          "/var/etcd/data/new.etcd/member/wal",
+			Segments:     2,
+			SizeBytes:    128000000,
+			SegmentFiles: []string{"0000000000000000-0000000000000000.wal", "0000000000000001-0000000000000a3c.wal"},
+			LastIndex:    2750,
+			LastTerm:     3,
+		},
+		Snap: datadir.SnapStats{
+			Dir:         "/var/etcd/data/new.etcd/member/snap",
+			Snapshots:   1,
+			SizeBytes:   8192,
+			Files:       []string{"0000000000000003-00000000000009c4.snap"},
+			LatestTerm:  3,
+			LatestIndex: 2500,
+		},
+		Backend: &datadir.BackendStats{
+			Path:            "/var/etcd/data/new.etcd/member/snap/db",
+			SizeBytes:       2097152,
+			SizeInUseBytes:  1048576,
+			FreePages:       256,
+			Revision:        42,
+			CompactRevision: 10,
+			ConsistentIndex: 2700,
+			Term:            3,
+			Buckets:         map[string]int{"meta": 4, "key": 32},
+			Keys:            20,
+			Revisions:       32,
+			Prefixes: []datadir.PrefixStats{
+				{Prefix: "/registry/pods/", Keys: 19, Revisions: 30, ValueSizeBytes: 4096},
+				{Prefix: "", Keys: 1, Revisions: 2, ValueSizeBytes: 3},
+			},
+		},
+	}
+	table := []struct {
+		description  string
+		outputFormat string
+	}{
+		{"should print report as text", outputFormatText},
+		{"should print report as JSON", outputFormatJSON},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		var buf bytes.Buffer
+		g.Expect(writeDataReport(&buf, report, entry.outputFormat)).To(Succeed())
+		if entry.outputFormat == outputFormatJSON {
+			var decoded datadir.DataReport
+			g.Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+			g.Expect(&decoded).To(Equal(report))
+			continue
+		}
+		g.Expect(buf.String()).To(Equal(`Data directory /var/etcd/data/new.etcd
+Member 8e9e05c52164694d of cluster cdf818194e3a8c32
+WAL (/var/etcd/data/new.etcd/member/wal)
+  segments: 2, size: 128000000 bytes
+    0000000000000000-0000000000000000.wal
+    0000000000000001-0000000000000a3c.wal
+  last entry: term 3, index 2750
+Snapshots (/var/etcd/data/new.etcd/member/snap)
+  snapshots: 1, size: 8192 bytes
+    0000000000000003-00000000000009c4.snap
+  latest snapshot: term 3, index 2500
+Database (/var/etcd/data/new.etcd/member/snap/db)
+  size: 2097152 bytes, in use: 1048576 bytes, free pages: 256
+  revision: 42, compact revision: 10
+  consistent index: 2700, term: 3
+  keys: 20, revisions: 32
+  buckets:
+    key: 32
+    meta: 4
+  prefixes:
+    PREFIX             KEYS  REVISIONS  VALUE BYTES
+    "/registry/pods/"  19    30         4096
+    ""                 1     2          3
+`))
+	}
+}
@@ -0,0 +1,251 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/etcdconfig"
+	"github.com/gardener/etcd-wrapper/internal/snapshot"
+	"github.com/gardener/etcd-wrapper/internal/types"
+	"github.com/gardener/etcd-wrapper/internal/util"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+var (
+	// SnapshotSaveCmd saves a snapshot of a running etcd to a local file.
+	SnapshotSaveCmd = Command{
+		Name:      "snapshot save",
+		UsageLine: "etcd-wrapper snapshot save --out <path> [flags]",
+		ShortDesc: "Saves a snapshot of a running etcd to a local file together with its SHA-256 checksum",
+		LongDesc: `Streams a snapshot of the database of a running etcd member to a local file, e.g. on a persistent volume, and
+writes the SHA-256 checksum of the snapshot to a sidecar file named <path>.sha256 in the format of sha256sum. The
+snapshot can be restored with 'etcd-wrapper snapshot restore' without involving backup-restore or an object store.
+
+Flags:
+	--out
+		Path of the file the snapshot is written to. An existing file is replaced.
+	--etcd-endpoint
+		Client URL of the etcd member to take the snapshot from. Default: http://127.0.0.1:2379
+	--etcd-ca-cert-path
+		Path of the CA certificate bundle to verify the certificate of etcd. Required if the endpoint uses https.
+	--etcd-client-cert-path
+		Path of the TLS certificate of the etcd client, if etcd requires client certificates.
+	--etcd-client-key-path
+		Path of the TLS key of the etcd client, if etcd requires client certificates.
+	--etcd-server-name
+		Server name used to verify the certificate of etcd. Defaults to the host of etcd-endpoint.
+	--timeout
+		Time allowed to take the snapshot. Default: 10m
+	--output
+		Output format, either text or json. Default: text`,
+		AddFlags: AddSnapshotSaveFlags,
+		Run:      SnapshotSave,
+	}
+	// snapshotSaveOpts are the options of the snapshot save command.
+	snapshotSaveOpts = struct {
+		out            string
+		endpoint       string
+		caCertPath     string
+		clientCertPath string
+		clientKeyPath  string
+		serverName     string
+		timeout        time.Duration
+		outputFormat   string
+	}{}
+
+	// SnapshotRestoreCmd restores a data directory from a local snapshot file.
+	SnapshotRestoreCmd = Command{
+		Name:      "snapshot restore",
+		UsageLine: "etcd-wrapper snapshot restore --from <path> --etcd-config-file <path> [flags]",
+		ShortDesc: "Restores an etcd data directory from a local snapshot file",
+		LongDesc: `Verifies the integrity of a snapshot and restores it into a new data directory for the member described by an
+etcd configuration file, i.e. with its name, advertised peer URLs, initial cluster and initial cluster token. The
+snapshot is verified against the checksum in its sidecar file <path>.sha256 written by 'etcd-wrapper snapshot save'
+and against the checksum which etcd appends to every snapshot. The data directory must not exist or be empty, and
+etcd must not be running. This allows to recover from a disaster with a snapshot file copied onto the volume of the
+member, without backup-restore and an object store. Every member of the cluster has to be restored from the same
+snapshot.
+
+Flags:
+	--from
+		Path of the snapshot to restore.
+	--etcd-config-file
+		Path of the etcd configuration file of the member, from which the cluster details are taken.
+	--data-dir
+		Path of the data directory to restore into. Defaults to the data directory in the etcd configuration file.
+	--wal-dir
+		Path of the dedicated WAL directory to restore into. Defaults to the WAL directory in the etcd configuration file.
+	--skip-checksum-file
+		Skips verifying the snapshot against its sidecar checksum file, e.g. for snapshots not taken by etcd-wrapper.
+		The checksum which etcd appends to every snapshot is verified nevertheless. Default: false
+	--output
+		Output format, either text or json. Default: text`,
+		AddFlags: AddSnapshotRestoreFlags,
+		Run:      SnapshotRestore,
+	}
+	// snapshotRestoreOpts are the options of the snapshot restore command.
+	snapshotRestoreOpts = struct {
+		from             string
+		etcdConfigFile   string
+		dataDir          string
+		walDir           string
+		skipChecksumFile bool
+		outputFormat     string
+	}{}
+)
+
+// AddSnapshotSaveFlags adds the flags of the snapshot save command to the passed FlagSet.
+func AddSnapshotSaveFlags(fs *flag.FlagSet) {
+	fs.StringVar(&snapshotSaveOpts.out, "out", "", "Path of the file the snapshot is written to")
+	fs.StringVar(&snapshotSaveOpts.endpoint, "etcd-endpoint", "http://127.0.0.1:2379", "Client URL of the etcd member to take the snapshot from")
+	fs.StringVar(&snapshotSaveOpts.caCertPath, "etcd-ca-cert-path", "", "Path of the CA certificate bundle to verify the certificate of etcd")
+	fs.StringVar(&snapshotSaveOpts.clientCertPath, "etcd-client-cert-path", "", "Path of the TLS certificate of the etcd client")
+	fs.StringVar(&snapshotSaveOpts.clientKeyPath, "etcd-client-key-path", "", "Path of the TLS key of the etcd client")
+	fs.StringVar(&snapshotSaveOpts.serverName, "etcd-server-name", "", "Server name used to verify the certificate of etcd, defaults to the host of etcd-endpoint")
+	fs.DurationVar(&snapshotSaveOpts.timeout, "timeout", 10*time.Minute, "Time allowed to take the snapshot")
+	fs.StringVar(&snapshotSaveOpts.outputFormat, "output", outputFormatText, "Output format, either text or json")
+}
+
+// SnapshotSave saves a snapshot of etcd to the file passed with --out and prints the report to stdout.
+func SnapshotSave(ctx context.Context, _ context.CancelFunc, logger *zap.Logger) error {
+	if strings.TrimSpace(snapshotSaveOpts.out) == "" {
+		return errors.New("--out is required")
+	}
+	if err := validateOutputFormat(snapshotSaveOpts.outputFormat); err != nil {
+		return err
+	}
+	cli, err := createSnapshotClient(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cli.Close() }()
+
+	ctx, cancel := context.WithTimeout(ctx, snapshotSaveOpts.timeout)
+	defer cancel()
+	report, err := snapshot.Save(ctx, cli, snapshotSaveOpts.out)
+	if err != nil {
+		return err
+	}
+	return writeSnapshotSaveReport(os.Stdout, report, snapshotSaveOpts.outputFormat)
+}
+
+// createSnapshotClient creates an etcd client for the endpoint passed with --etcd-endpoint.
+func createSnapshotClient(ctx context.Context, logger *zap.Logger) (*clientv3.Client, error) {
+	endpoint, err := url.Parse(snapshotSaveOpts.endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid etcd endpoint %q, should be of the format <scheme>://<host>:<port>", snapshotSaveOpts.endpoint)
+	}
+	config := clientv3.Config{
+		Context:   ctx,
+		Endpoints: []string{endpoint.String()},
+		Logger:    logger,
+	}
+	if endpoint.Scheme == "https" {
+		serverName := snapshotSaveOpts.serverName
+		if serverName == "" {
+			serverName = endpoint.Hostname()
+		}
+		var keyPair *util.KeyPair
+		if snapshotSaveOpts.clientCertPath != "" || snapshotSaveOpts.clientKeyPath != "" {
+			keyPair = &util.KeyPair{CertPath: snapshotSaveOpts.clientCertPath, KeyPath: snapshotSaveOpts.clientKeyPath}
+		}
+		if config.TLS, err = util.CreateTLSConfig(func() bool { return true }, serverName, snapshotSaveOpts.caCertPath, keyPair); err != nil {
+			return nil, fmt.Errorf("failed to create TLS configuration for etcd endpoint %s: %w", endpoint, err)
+		}
+	}
+	return clientv3.New(config)
+}
+
+// AddSnapshotRestoreFlags adds the flags of the snapshot restore command to the passed FlagSet.
+func AddSnapshotRestoreFlags(fs *flag.FlagSet) {
+	fs.StringVar(&snapshotRestoreOpts.from, "from", "", "Path of the snapshot to restore")
+	fs.StringVar(&snapshotRestoreOpts.etcdConfigFile, "etcd-config-file", "", "Path of the etcd configuration file of the member, from which the cluster details are taken")
+	fs.StringVar(&snapshotRestoreOpts.dataDir, "data-dir", "", "Path of the data directory to restore into, defaults to the data directory in the etcd configuration file")
+	fs.StringVar(&snapshotRestoreOpts.walDir, "wal-dir", "", "Path of the dedicated WAL directory to restore into, defaults to the WAL directory in the etcd configuration file")
+	fs.BoolVar(&snapshotRestoreOpts.skipChecksumFile, "skip-checksum-file", false, "Skips verifying the snapshot against its sidecar checksum file")
+	fs.StringVar(&snapshotRestoreOpts.outputFormat, "output", outputFormatText, "Output format, either text or json")
+}
+
+// SnapshotRestore restores the snapshot passed with --from into a new data directory and prints the report to
+// stdout.
+func SnapshotRestore(_ context.Context, _ context.CancelFunc, logger *zap.Logger) error {
+	if strings.TrimSpace(snapshotRestoreOpts.from) == "" {
+		return errors.New("--from is required")
+	}
+	if strings.TrimSpace(snapshotRestoreOpts.etcdConfigFile) == "" {
+		return errors.New("--etcd-config-file is required")
+	}
+	if err := validateOutputFormat(snapshotRestoreOpts.outputFormat); err != nil {
+		return err
+	}
+	cfg, err := etcdconfig.LoadConfig(snapshotRestoreOpts.etcdConfigFile, types.EtcdConfigOverridesConfig{}, logger)
+	if err != nil {
+		return fmt.Errorf("failed to load etcd configuration %s: %w", snapshotRestoreOpts.etcdConfigFile, err)
+	}
+	opts := snapshot.RestoreOptions{
+		SnapshotPath:        snapshotRestoreOpts.from,
+		SkipChecksumFile:    snapshotRestoreOpts.skipChecksumFile,
+		DataDir:             cfg.Dir,
+		WALDir:              cfg.WalDir,
+		Name:                cfg.Name,
+		InitialCluster:      cfg.InitialCluster,
+		InitialClusterToken: cfg.InitialClusterToken,
+	}
+	for _, peerURL := range cfg.AdvertisePeerUrls {
+		opts.AdvertisePeerURLs = append(opts.AdvertisePeerURLs, peerURL.String())
+	}
+	if snapshotRestoreOpts.dataDir != "" {
+		opts.DataDir = snapshotRestoreOpts.dataDir
+	}
+	if snapshotRestoreOpts.walDir != "" {
+		opts.WALDir = snapshotRestoreOpts.walDir
+	}
+	if strings.TrimSpace(opts.DataDir) == "" {
+		return fmt.Errorf("--data-dir is required if etcd configuration %s does not configure a data directory", snapshotRestoreOpts.etcdConfigFile)
+	}
+	report, err := snapshot.Restore(opts, logger)
+	if err != nil {
+		return err
+	}
+	return writeRestoreReport(os.Stdout, report, snapshotRestoreOpts.outputFormat)
+}
+
+func writeSnapshotSaveReport(w io.Writer, report *snapshot.SaveReport, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return printJSON(w, report)
+	}
+	_, err := fmt.Fprintf(w, `Saved snapshot %s in %.2fs
+  size: %d bytes
+  sha256: %s (%s)
+`, report.Path, report.DurationSeconds, report.SizeBytes, report.SHA256, report.ChecksumPath)
+	return err
+}
+
+func writeRestoreReport(w io.Writer, report *snapshot.RestoreReport, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return printJSON(w, report)
+	}
+	sha256 := report.SHA256
+	if sha256 == "" {
+		sha256 = "not verified, checksum file skipped"
+	}
+	_, err := fmt.Fprintf(w, `Restored snapshot %s into data directory %s
+  sha256: %s
+  wal directory: %s
+  member: %s (ID %s), cluster ID: %s
+`, report.SnapshotPath, report.DataDir, sha256, report.WALDir, report.Name, report.MemberID, report.ClusterID)
+	return err
+}
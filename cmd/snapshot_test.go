@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/snapshot"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWriteSnapshotSaveReport(t *testing.T) {
+	report := &snapshot.SaveReport{
+		Path:            "/var/etcd/backup/etcd.db",
+		ChecksumPath:    "/var/etcd/backup/etcd.db.sha256",
+		SHA256:          "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		SizeBytes:       20480,
+		DurationSeconds: 1.5,
+	}
+	table := []struct {
+		description  string
+		outputFormat string
+	}{
+		{"should print report as text", outputFormatText},
+		{"should print report as JSON", outputFormatJSON},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		var buf bytes.Buffer
+		g.Expect(writeSnapshotSaveReport(&buf, report, entry.outputFormat)).To(Succeed())
+		if entry.outputFormat == outputFormatJSON {
+			var decoded snapshot.SaveReport
+			g.Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+			g.Expect(&decoded).To(Equal(report))
+			continue
+		}
+		g.Expect(buf.String()).To(Equal(`Saved snapshot /var/etcd/backup/etcd.db in 1.50s
+  size: 20480 bytes
+  sha256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08 (/var/etcd/backup/etcd.db.sha256)
+`))
+	}
+}
+
+func TestWriteRestoreReport(t *testing.T) {
+	report := &snapshot.RestoreReport{
+		SnapshotPath: "/var/etcd/backup/etcd.db",
+		DataDir:      "/var/etcd/data/new.etcd",
+		WALDir:       "/var/etcd/data/new.etcd/member/wal",
+		Name:         "etcd-main-0",
+		MemberID:     "8e9e05c52164694d",
+		ClusterID:    "cdf818194e3a8c32",
+	}
+	table := []struct {
+		description  string
+		outputFormat string
+		sha256       string
+		expectedText string
+	}{
+		{"should print report as text", outputFormatText, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", `Restored snapshot /var/etcd/backup/etcd.db into data directory /var/etcd/data/new.etcd
+  sha256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+  wal directory: /var/etcd/data/new.etcd/member/wal
+  member: etcd-main-0 (ID 8e9e05c52164694d), cluster ID: cdf818194e3a8c32
+`},
+		{"should print report as text if the checksum file has been skipped", outputFormatText, "", `Restored snapshot /var/etcd/backup/etcd.db into data directory /var/etcd/data/new.etcd
+  sha256: not verified, checksum file skipped
+  wal directory: /var/etcd/data/new.etcd/member/wal
+  member: etcd-main-0 (ID 8e9e05c52164694d), cluster ID: cdf818194e3a8c32
+`},
+		{"should print report as JSON", outputFormatJSON, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", ""},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		report.SHA256 = entry.sha256
+		var buf bytes.Buffer
+		g.Expect(writeRestoreReport(&buf, report, entry.outputFormat)).To(Succeed())
+		if entry.outputFormat == outputFormatJSON {
+			var decoded snapshot.RestoreReport
+			g.Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+			g.Expect(&decoded).To(Equal(report))
+			continue
+		}
+		g.Expect(buf.String()).To(Equal(entry.expectedText))
+	}
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gardener/etcd-wrapper/internal/etcdconfig"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ValidateConfigCmd validates an etcd configuration file without starting etcd.
+	ValidateConfigCmd = Command{
+		Name:      "validate-config",
+		UsageLine: "etcd-wrapper validate-config --file <path> [flags]",
+		ShortDesc: "Validates an etcd configuration file without starting etcd",
+		LongDesc: `Loads an etcd configuration file the same way the embedded etcd does and validates it. In addition to the
+validation done by etcd, it checks that all URLs are well-formed, that the hosts of the advertised URLs and of the
+initial cluster can be resolved, that the configured TLS files exist and match, that the backend quota fits onto the
+data volume and that the initial cluster is consistent with the name and advertised peer URLs of the member. Exits
+with a non-zero exit code if any check fails, hosts which cannot be resolved are only warned about.
+
+Flags:
+	--file
+		Path of the etcd configuration file to validate.
+	--output
+		Output format, either text or json. Default: text
+	--data-volume-size-bytes
+		Size of the volume holding the data directory. Default: 0, which uses the size of the file system the data directory resides on.`,
+		AddFlags: AddValidateConfigFlags,
+		Run:      ValidateConfig,
+	}
+	// validateConfigOpts are the options of the validate-config command.
+	validateConfigOpts = struct {
+		file         string
+		outputFormat string
+		etcdconfig.ValidationOptions
+	}{}
+)
+
+// AddValidateConfigFlags adds the flags of the validate-config command to the passed FlagSet.
+func AddValidateConfigFlags(fs *flag.FlagSet) {
+	fs.StringVar(&validateConfigOpts.file, "file", "", "Path of the etcd configuration file to validate")
+	fs.StringVar(&validateConfigOpts.outputFormat, "output", outputFormatText, "Output format, either text or json")
+	fs.Int64Var(&validateConfigOpts.DataVolumeSizeBytes, "data-volume-size-bytes", 0, "Size of the volume holding the data directory, defaults to the size of the file system the data directory resides on")
+}
+
+// ValidateConfig validates the etcd configuration file and prints the report to stdout. It returns an error if the
+// configuration is invalid.
+func ValidateConfig(_ context.Context, _ context.CancelFunc, _ *zap.Logger) error {
+	if strings.TrimSpace(validateConfigOpts.file) == "" {
+		return errors.New("--file is required")
+	}
+	if err := validateOutputFormat(validateConfigOpts.outputFormat); err != nil {
+		return err
+	}
+	report := etcdconfig.Validate(validateConfigOpts.file, validateConfigOpts.ValidationOptions)
+	if err := writeValidationReport(os.Stdout, report, validateConfigOpts.outputFormat); err != nil {
+		return err
+	}
+	if !report.Valid {
+		return fmt.Errorf("etcd configuration %s is invalid", report.File)
+	}
+	return nil
+}
+
+func writeValidationReport(w io.Writer, report etcdconfig.Report, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return printJSON(w, report)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Validating etcd configuration %s\n", report.File)
+	for _, check := range report.Checks {
+		fmt.Fprintf(&sb, "  [%s] %s\n", strings.ToUpper(string(check.Status)), check.Name)
+		for _, message := range check.Messages {
+			fmt.Fprintf(&sb, "      - %s\n", message)
+		}
+	}
+	if report.Valid {
+		sb.WriteString("Result: valid\n")
+	} else {
+		sb.WriteString("Result: invalid\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/etcdconfig"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWriteValidationReport(t *testing.T) {
+	report := etcdconfig.Report{
+		File:  "/var/etcd/config/etcd.conf.yaml",
+		Valid: false,
+		Checks: []etcdconfig.CheckResult{
+			{Name: etcdconfig.CheckURLs, Status: etcdconfig.CheckPassed},
+			{Name: etcdconfig.CheckInitialCluster, Status: etcdconfig.CheckFailed, Messages: []string{`initial-cluster does not contain a member named "etcd-0"`}},
+		},
+	}
+	table := []struct {
+		description  string
+		outputFormat string
+	}{
+		{"should print report as text", outputFormatText},
+		{"should print report as JSON", outputFormatJSON},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		var buf bytes.Buffer
+		g.Expect(writeValidationReport(&buf, report, entry.outputFormat)).To(Succeed())
+		if entry.outputFormat == outputFormatJSON {
+			var decoded etcdconfig.Report
+			g.Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+			g.Expect(decoded).To(Equal(report))
+			continue
+		}
+		g.Expect(buf.String()).To(Equal(`Validating etcd configuration /var/etcd/config/etcd.conf.yaml
+  [PASSED] urls
+  [FAILED] initial-cluster
+      - initial-cluster does not contain a member named "etcd-0"
+Result: invalid
+`))
+	}
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+	"github.com/gardener/etcd-wrapper/internal/snapshot"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// VerifySnapshotCmd verifies that a snapshot is restorable by restoring it into a throwaway etcd.
+	VerifySnapshotCmd = Command{
+		Name:      "verify-snapshot",
+		UsageLine: "etcd-wrapper verify-snapshot --from <path> [flags]",
+		ShortDesc: "Verifies that a snapshot is restorable by restoring it into a throwaway etcd",
+		LongDesc: `Restores a snapshot into a temporary data directory, starts a single member etcd on loopback ports from it and
+checks that etcd serves the revision, the hash of the key space and the number of keys per prefix which are stored
+in the snapshot. Everything is torn down afterwards. Exits with a non-zero exit code if any check fails.
+
+Flags:
+	--from
+		Path of the snapshot to verify.
+	--skip-checksum-file
+		Skips verifying the snapshot against its sidecar checksum file, e.g. for snapshots not taken by etcd-wrapper. Default: false
+	--temp-dir
+		Directory in which the temporary data directory is created. Defaults to the directory for temporary files.
+	--prefix-depth
+		Number of path segments by which keys are grouped to count them per prefix. Default: 2
+	--ready-timeout
+		Time the throwaway etcd is given to become ready. Default: 2m
+	--output
+		Output format, either text or json. Default: text`,
+		AddFlags: AddVerifySnapshotFlags,
+		Run:      VerifySnapshot,
+	}
+	// verifySnapshotOpts are the options of the verify-snapshot command.
+	verifySnapshotOpts = struct {
+		snapshot.VerifyOptions
+		outputFormat string
+	}{}
+)
+
+// AddVerifySnapshotFlags adds the flags of the verify-snapshot command to the passed FlagSet.
+func AddVerifySnapshotFlags(fs *flag.FlagSet) {
+	fs.StringVar(&verifySnapshotOpts.SnapshotPath, "from", "", "Path of the snapshot to verify")
+	fs.BoolVar(&verifySnapshotOpts.SkipChecksumFile, "skip-checksum-file", false, "Skips verifying the snapshot against its sidecar checksum file")
+	fs.StringVar(&verifySnapshotOpts.TempDir, "temp-dir", "", "Directory in which the temporary data directory is created, defaults to the directory for temporary files")
+	fs.IntVar(&verifySnapshotOpts.PrefixDepth, "prefix-depth", datadir.DefaultPrefixDepth, "Number of path segments by which keys are grouped to count them per prefix")
+	fs.DurationVar(&verifySnapshotOpts.ReadyTimeout, "ready-timeout", snapshot.DefaultVerifyReadyTimeout, "Time the throwaway etcd is given to become ready")
+	fs.StringVar(&verifySnapshotOpts.outputFormat, "output", outputFormatText, "Output format, either text or json")
+}
+
+// VerifySnapshot verifies the snapshot passed with --from and prints the report to stdout. It returns an error if
+// the snapshot is not restorable.
+func VerifySnapshot(ctx context.Context, _ context.CancelFunc, logger *zap.Logger) error {
+	if strings.TrimSpace(verifySnapshotOpts.SnapshotPath) == "" {
+		return errors.New("--from is required")
+	}
+	if verifySnapshotOpts.PrefixDepth < 1 {
+		return fmt.Errorf("--prefix-depth must be at least 1, got %d", verifySnapshotOpts.PrefixDepth)
+	}
+	if verifySnapshotOpts.ReadyTimeout <= 0 {
+		return fmt.Errorf("--ready-timeout must be positive, got %s", verifySnapshotOpts.ReadyTimeout)
+	}
+	if err := validateOutputFormat(verifySnapshotOpts.outputFormat); err != nil {
+		return err
+	}
+	report, err := snapshot.Verify(ctx, verifySnapshotOpts.VerifyOptions, logger)
+	if err != nil {
+		return err
+	}
+	if err = writeVerifyReport(os.Stdout, report, verifySnapshotOpts.outputFormat); err != nil {
+		return err
+	}
+	if !report.Valid {
+		return fmt.Errorf("snapshot %s is not restorable", report.SnapshotPath)
+	}
+	return nil
+}
+
+func writeVerifyReport(w io.Writer, report *snapshot.VerifyReport, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return printJSON(w, report)
+	}
+	result := "restorable"
+	if !report.Valid {
+		result = "NOT restorable"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Snapshot %s is %s, verified at %s in %.2fs\n", report.SnapshotPath, result, report.VerifiedAt.Format(time.RFC3339), report.DurationSeconds)
+	sb.WriteString("  checks:\n")
+	for _, check := range report.Checks {
+		status := "passed"
+		if !check.Passed {
+			status = "FAILED"
+		}
+		fmt.Fprintf(&sb, "    [%s] %s: %s\n", status, check.Name, check.Message)
+	}
+	if report.Valid {
+		fmt.Fprintf(&sb, "  revision: %d, compact revision: %d, hash: %d, keys: %d\n", report.Revision, report.CompactRevision, report.Hash, report.Keys)
+		sb.WriteString("  prefixes:\n")
+		tw := tabwriter.NewWriter(&sb, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "    PREFIX\tKEYS")
+		for _, prefix := range report.Prefixes {
+			fmt.Fprintf(tw, "    %q\t%d\n", prefix.Prefix, prefix.Keys)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
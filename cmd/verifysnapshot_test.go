@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/snapshot"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWriteVerifyReport(t *testing.T) {
+	validReport := &snapshot.VerifyReport{
+		SnapshotPath:    "/var/etcd/backup/etcd.db",
+		SHA256:          "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		Valid:           true,
+		Revision:        42,
+		CompactRevision: 10,
+		Hash:            3735928559,
+		Keys:            3,
+		Prefixes: []snapshot.PrefixCount{
+			{Prefix: "/registry/pods/", Keys: 2},
+			{Prefix: "/registry/", Keys: 1},
+		},
+		Checks: []snapshot.VerifyCheck{
+			{Name: snapshot.CheckRestore, Passed: true, Message: "restored"},
+			{Name: snapshot.CheckHash, Passed: true, Message: "hashed"},
+		},
+		VerifiedAt:      time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		DurationSeconds: 2.5,
+	}
+	invalidReport := &snapshot.VerifyReport{
+		SnapshotPath:    "/var/etcd/backup/etcd.db",
+		Checks:          []snapshot.VerifyCheck{{Name: snapshot.CheckRestore, Message: "snapshot is corrupted"}},
+		VerifiedAt:      time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		DurationSeconds: 0.5,
+	}
+	table := []struct {
+		description  string
+		report       *snapshot.VerifyReport
+		outputFormat string
+		expectedText string
+	}{
+		{"should print a valid report as text", validReport, outputFormatText, `Snapshot /var/etcd/backup/etcd.db is restorable, verified at 2024-05-01T12:00:00Z in 2.50s
+  checks:
+    [passed] restore: restored
+    [passed] hash: hashed
+  revision: 42, compact revision: 10, hash: 3735928559, keys: 3
+  prefixes:
+    PREFIX             KEYS
+    "/registry/pods/"  2
+    "/registry/"       1
+`},
+		{"should print an invalid report as text", invalidReport, outputFormatText, `Snapshot /var/etcd/backup/etcd.db is NOT restorable, verified at 2024-05-01T12:00:00Z in 0.50s
+  checks:
+    [FAILED] restore: snapshot is corrupted
+`},
+		{"should print report as JSON", validReport, outputFormatJSON, ""},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		var buf bytes.Buffer
+		g.Expect(writeVerifyReport(&buf, entry.report, entry.outputFormat)).To(Succeed())
+		if entry.outputFormat == outputFormatJSON {
+			var decoded snapshot.VerifyReport
+			g.Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+			g.Expect(&decoded).To(Equal(entry.report))
+			continue
+		}
+		g.Expect(buf.String()).To(Equal(entry.expectedText))
+	}
+}
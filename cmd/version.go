@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gardener/etcd-wrapper/internal/version"
+
+	"go.uber.org/zap"
+)
+
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+var (
+	// VersionCmd prints the version and build information of etcd-wrapper.
+	VersionCmd = Command{
+		Name:      "version",
+		UsageLine: "etcd-wrapper version [flags]",
+		ShortDesc: "Prints the version and build information of etcd-wrapper",
+		LongDesc: `Prints the version, git commit and build date of etcd-wrapper, the Go version it was built with
+and the versions of the vendored etcd server and client.
+
+Flags:
+	--output
+		Output format, either text or json. Default: text`,
+		AddFlags: AddVersionFlags,
+		Run:      PrintVersion,
+	}
+	// versionOutputFormat is the format in which the version is printed.
+	versionOutputFormat string
+)
+
+// AddVersionFlags adds the flags of the version command to the passed FlagSet.
+func AddVersionFlags(fs *flag.FlagSet) {
+	fs.StringVar(&versionOutputFormat, "output", outputFormatText, "Output format, either text or json")
+}
+
+// PrintVersion prints the version and build information of etcd-wrapper to stdout.
+func PrintVersion(_ context.Context, _ context.CancelFunc, _ *zap.Logger) error {
+	return writeVersion(os.Stdout, version.Get(), versionOutputFormat)
+}
+
+func writeVersion(w io.Writer, info version.Info, outputFormat string) error {
+	if err := validateOutputFormat(outputFormat); err != nil {
+		return err
+	}
+	if outputFormat == outputFormatJSON {
+		return printJSON(w, info)
+	}
+	_, err := fmt.Fprintf(w, "Version:             %s\nGit commit:          %s\nBuild date:          %s\nGo version:          %s\nEtcd server version: %s\nEtcd client version: %s\n",
+		info.Version, info.GitCommit, info.BuildDate, info.GoVersion, info.EtcdServerVersion, info.EtcdClientVersion)
+	return err
+}
+
+// validateOutputFormat checks that outputFormat is one of the output formats supported by the commands.
+func validateOutputFormat(outputFormat string) error {
+	if outputFormat != outputFormatText && outputFormat != outputFormatJSON {
+		return fmt.Errorf("unsupported output format %q, should be one of %q or %q", outputFormat, outputFormatText, outputFormatJSON)
+	}
+	return nil
+}
+
+// printJSON writes v to w as indented JSON.
+func printJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/version"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWriteVersion(t *testing.T) {
+	info := version.Info{
+		Version:           "v0.5.0",
+		GitCommit:         "0123456789abcdef",
+		BuildDate:         "2024-05-02T10:15:00Z",
+		GoVersion:         "go1.25.7",
+		EtcdServerVersion: "3.5.27",
+		EtcdClientVersion: "3.5.27",
+	}
+	table := []struct {
+		description  string
+		outputFormat string
+		expectError  bool
+	}{
+		{"should print version as text", outputFormatText, false},
+		{"should print version as JSON", outputFormatJSON, false},
+		{"should return error for unsupported output format", "yaml", true},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		var buf bytes.Buffer
+		err := writeVersion(&buf, info, entry.outputFormat)
+		g.Expect(err != nil).To(Equal(entry.expectError))
+		switch entry.outputFormat {
+		case outputFormatText:
+			g.Expect(buf.String()).To(ContainSubstring("Version:             v0.5.0\n"))
+			g.Expect(buf.String()).To(ContainSubstring("Etcd server version: 3.5.27\n"))
+		case outputFormatJSON:
+			var decoded version.Info
+			g.Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+			g.Expect(decoded).To(Equal(info))
+		}
+	}
+}
@@ -9,11 +9,17 @@ SOURCE_PATH="$(readlink -f "$(dirname "${BASH_SOURCE[0]}")/..")"
 BINARY_PATH="${SOURCE_PATH}/bin"
 mkdir -p "$BINARY_PATH"
 
+VERSION="$(cat "${SOURCE_PATH}/VERSION")"
+GIT_COMMIT="$(git -C "${SOURCE_PATH}" rev-parse --verify HEAD 2>/dev/null || echo "unknown")"
+BUILD_DATE="$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+VERSION_PACKAGE="github.com/gardener/etcd-wrapper/internal/version"
+
 echo "> Build..."
 
 cd "$SOURCE_PATH" &&
   CGO_ENABLED=0 GOOS=$(go env GOOS) GOARCH=$(go env GOARCH) GO111MODULE=on go build \
     -mod vendor \
     -v \
+    -ldflags "-X ${VERSION_PACKAGE}.Version=${VERSION} -X ${VERSION_PACKAGE}.GitCommit=${GIT_COMMIT} -X ${VERSION_PACKAGE}.BuildDate=${BUILD_DATE}" \
     -o "${BINARY_PATH}"/etcd-wrapper \
     main.go
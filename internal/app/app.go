@@ -6,16 +6,25 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gardener/etcd-wrapper/internal/types"
 
 	"github.com/gardener/etcd-wrapper/internal/bootstrap"
+	"github.com/gardener/etcd-wrapper/internal/brclient"
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+	"github.com/gardener/etcd-wrapper/internal/tracing"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/server/v3/embed"
+	"go.etcd.io/etcd/server/v3/etcdserver"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -26,6 +35,7 @@ type Application struct {
 	// Config is the application config
 	Config           types.Config
 	etcdInitializer  bootstrap.EtcdInitializer
+	brClient         brclient.BackupRestoreClient
 	cfg              *embed.Config
 	etcdClient       *clientv3.Client
 	etcd             *embed.Etcd
@@ -33,46 +43,125 @@ type Application struct {
 	logger           *zap.Logger
 	etcdReady        bool // should have only one actor that updates it, queryAndUpdateEtcdReadiness()
 	server           *http.Server
+	etcdClusterID    atomic.Pointer[string]
+	// etcdServer is the server of the embedded etcd, set as soon as etcd has been started.
+	etcdServer atomic.Pointer[etcdserver.EtcdServer]
+	// bootstrapCtx carries bootstrapSpan which spans from the creation of the application until etcd is ready.
+	bootstrapCtx  context.Context
+	bootstrapSpan trace.Span
+	// endBootstrapSpanOnce ensures that bootstrapSpan is ended exactly once, by whichever path ends the bootstrap.
+	endBootstrapSpanOnce sync.Once
+	// dataDirLocks are the locks of the data directory, they are acquired by Setup and released once Start returns.
+	// The data directory is locked via the default lock file and, if it differs, the lock file of the configured data
+	// directory which is locked by the offline commands.
+	dataDirLocks []*datadir.Lock
+	// lifecycleNotifier notifies backup-restore about lifecycle events of etcd, it is set up when the application is started.
+	lifecycleNotifier *lifecycleNotifier
+	// stopRequested is set when a stop has been requested via the /stop endpoint.
+	stopRequested atomic.Bool
+	// consistencyCheckResult is the result of the latest comparison of the key space with the peers.
+	consistencyCheckResult atomic.Pointer[consistencyCheckResult]
+	// keyspaceDiverged is set when the consistency check found the key space of this member to have diverged from
+	// a quorum of members, until it finds it to be consistent again.
+	keyspaceDiverged atomic.Bool
+	// defragmentationResult is the result of the latest defragmentation of this member.
+	defragmentationResult atomic.Pointer[defragmentationResult]
+	// defragmenting is set while this member is defragmented by its scheduled or fragmentation triggered defragmentation.
+	defragmenting atomic.Bool
+	// quotaStatus is the usage of the backend quota as of the latest sample of the quota watcher.
+	quotaStatus atomic.Pointer[quotaStatus]
 }
 
 // NewApplication initializes and returns an application struct
 func NewApplication(ctx context.Context, cancelFn context.CancelFunc, config types.Config, waitReadyTimeout time.Duration, logger *zap.Logger) (*Application, error) {
-	logger.Info("Initializing application", zap.Any("config", config))
-	etcdInitializer, err := bootstrap.NewEtcdInitializer(&config.BackupRestore, logger)
+	logger.Info("Initializing application", zap.Any("config", config.Redacted()))
+	if err := config.Preflight.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.SnapshotVerification.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.ConsistencyCheck.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Defragmentation.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.QuotaWatcher.Validate(); err != nil {
+		return nil, err
+	}
+	etcdInitializer, err := bootstrap.NewEtcdInitializer(&config.BackupRestore, config.EtcdConfigOverrides, logger)
 	if err != nil {
 		return nil, err
 	}
+	bootstrapCtx, bootstrapSpan := tracing.Tracer().Start(ctx, "Bootstrap")
 	return &Application{
 		ctx:              ctx,
 		cancelFn:         cancelFn,
 		Config:           config,
 		etcdInitializer:  etcdInitializer,
+		brClient:         etcdInitializer.BackupRestoreClient(),
 		waitReadyTimeout: waitReadyTimeout,
 		logger:           logger,
+		bootstrapCtx:     bootstrapCtx,
+		bootstrapSpan:    bootstrapSpan,
 	}, nil
 }
 
 // Setup sets up etcd by triggering initialization of the etcd DB.
-func (a *Application) Setup() error {
+func (a *Application) Setup() (err error) {
+	defer func() {
+		if err != nil {
+			a.endBootstrapSpan(err)
+		}
+	}()
+
+	// Lock the data directory before it is initialized, so that no other etcd-wrapper uses it at the same time
+	lock, err := datadir.AcquireLock(types.DefaultLockFilePath, a.logger)
+	if err != nil {
+		return err
+	}
+	a.dataDirLocks = append(a.dataDirLocks, lock)
+	defer func() {
+		if err != nil {
+			a.releaseDataDirLocks()
+		}
+	}()
+
 	// Set up etcd
-	cfg, err := a.etcdInitializer.Run(a.ctx)
+	cfg, err := a.etcdInitializer.Run(a.bootstrapCtx)
 	if err != nil {
 		return err
 	}
+	// Lock the configured data directory via the lock file used by the offline commands as well
+	if lockFilePath := datadir.LockFilePath(cfg.Dir); lockFilePath != lock.Path() {
+		if lock, err = datadir.AcquireLock(lockFilePath, a.logger); err != nil {
+			return err
+		}
+		a.dataDirLocks = append(a.dataDirLocks, lock)
+	}
 	a.cfg = cfg
+	a.applyWrapperConfig()
 
 	syscall.Umask(0077)
 	return nil
 }
 
 // Start sets up readiness probe and starts an embedded etcd.
-func (a *Application) Start() error {
-	var err error
+func (a *Application) Start() (err error) {
+	// the bootstrap span is ended once etcd is ready, any error returned before that ends the bootstrap
+	defer func() { a.endBootstrapSpan(err) }()
+	// the data directory has been locked by Setup
+	defer a.releaseDataDirLocks()
 
-	// Change file permissions for files previously created without umask 0077
-	// TODO (shreyas-s-rao): remove this temporary code in etcd-wrapper v0.8.0
-	if err = bootstrap.ChangeFilePermissions(a.cfg.Dir, 0600); err != nil {
-		return fmt.Errorf("failed to change file permissions: %w", err)
+	// Check the data directory, so that problems like a full disk are reported as such instead of as a panic of etcd
+	if err = a.runPreflightChecks(); err != nil {
+		return err
+	}
+
+	// Migrate the layout of the data directory, every migration is applied only once
+	if err = datadir.Migrate(a.cfg.Dir, datadir.Migrations, a.logger); err != nil {
+		return err
 	}
 
 	// Create etcd client for readiness probe
@@ -83,6 +172,13 @@ func (a *Application) Start() error {
 	a.etcdClient = cli
 	defer a.Close()
 
+	// notify backup-restore about lifecycle events of etcd, the last notification is sent before etcd is closed
+	a.lifecycleNotifier = newLifecycleNotifier(a.brClient, a.logger)
+	exitReason := "etcd-wrapper is exiting"
+	defer func() {
+		a.lifecycleNotifier.stop(exitReason, lifecycleNotifierStopTimeout)
+	}()
+
 	// Setup readiness probe
 	go a.queryAndUpdateEtcdReadiness()
 
@@ -98,27 +194,37 @@ func (a *Application) Start() error {
 
 	// Create embedded etcd and start.
 	if err = a.startEtcd(); err != nil {
+		exitReason = fmt.Sprintf("etcd failed to start: %v", err)
 		return err
 	}
-	// Delete exit code file after etcd starts successfully
-	if err = bootstrap.CleanupExitCode(types.DefaultExitCodeFilePath); err != nil {
-		a.logger.Warn("failed to clean-up last captured exit code", zap.Error(err))
-	}
 
 	// block till application context is cancelled, or there is a notification on etcd.Server.StopNotify channel
 	// or there is an error notification on etcd.Err channel
 	select {
 	case <-a.ctx.Done():
 		a.logger.Error("application context has been cancelled", zap.Error(a.ctx.Err()))
+		exitReason = a.cancellationReason()
 	case <-a.etcd.Server.StopNotify():
 		a.logger.Error("etcd server has been aborted, received notification on StopNotify channel")
+		exitReason = "etcd server has been aborted"
 	case err = <-a.etcd.Err():
 		a.logger.Error("error received on etcd Err channel", zap.Error(err))
+		exitReason = fmt.Sprintf("etcd reported an error: %v", err)
 	}
 
 	return nil
 }
 
+// releaseDataDirLocks releases the locks of the data directory which have been acquired, in reverse order.
+func (a *Application) releaseDataDirLocks() {
+	for i := len(a.dataDirLocks) - 1; i >= 0; i-- {
+		if err := a.dataDirLocks[i].Release(); err != nil {
+			a.logger.Error("failed to release lock of data directory", zap.String("lockFilePath", a.dataDirLocks[i].Path()), zap.Error(err))
+		}
+	}
+	a.dataDirLocks = nil
+}
+
 // Close closes resources(e.g. etcd client) and cancels the context if not already done so.
 func (a *Application) Close() {
 	if err := a.etcdClient.Close(); err != nil {
@@ -130,6 +236,25 @@ func (a *Application) Close() {
 	a.cancelContext()
 }
 
+// cancellationReason describes why the application context has been cancelled.
+func (a *Application) cancellationReason() string {
+	if a.stopRequested.Load() {
+		return "stop requested via the /stop endpoint"
+	}
+	if a.keyspaceDiverged.Load() && a.consistencyMismatchPolicy() == types.ConsistencyMismatchPolicyStop {
+		return "key space of this member has diverged from its peers"
+	}
+	if cause := context.Cause(a.ctx); cause != nil && !errors.Is(cause, context.Canceled) {
+		return cause.Error()
+	}
+	return "application context has been cancelled"
+}
+
+// endBootstrapSpan records err, if any, on the bootstrap span and ends it, unless it has already been ended.
+func (a *Application) endBootstrapSpan(err error) {
+	a.endBootstrapSpanOnce.Do(func() { tracing.EndSpan(a.bootstrapSpan, err) })
+}
+
 func (a *Application) cancelContext() {
 	// only if the context has not yet been cancelled, call the context.CancelFunc
 	if a.ctx.Err() == nil {
@@ -137,23 +262,86 @@ func (a *Application) cancelContext() {
 	}
 }
 
-func (a *Application) startEtcd() error {
-	// TODO StartEtcd returns an Etcd object. In future we should use that to listen on leadership change notifications (when we move to a version of etcd which exposes the channel).
+func (a *Application) startEtcd() (err error) {
+	defer func() { a.endBootstrapSpan(err) }()
+
+	_, startSpan := tracing.Tracer().Start(a.bootstrapCtx, "StartEtcd")
 	etcd, err := embed.StartEtcd(a.cfg)
+	tracing.EndSpan(startSpan, err)
 	if err != nil {
 		return err
 	}
+	a.etcdServer.Store(etcd.Server)
 
 	// wait till the etcd server notifies that it is ready, or if an abrupt stop has happened which is notified
 	// via etcd.Server.Notify or there is a timeout waiting for the etcd server to start.
+	_, readySpan := tracing.Tracer().Start(a.bootstrapCtx, "WaitForEtcdReady")
+	// without a timeout, etcd-wrapper waits until etcd is ready or stopped
+	var readyTimeout <-chan time.Time
+	if a.waitReadyTimeout > 0 {
+		readyTimeout = time.After(a.waitReadyTimeout)
+	}
 	select {
 	case <-etcd.Server.ReadyNotify():
 		a.logger.Info("etcd server is now ready to serve client requests")
+		// Delete exit code file and recorded start attempts only once etcd is ready, a start which times out or
+		// is aborted still counts as a failed attempt
+		if err := bootstrap.CleanupExitCode(types.DefaultExitCodeFilePath); err != nil {
+			a.logger.Warn("failed to clean-up last captured exit code", zap.Error(err))
+		}
+		if err := bootstrap.CleanupStartAttempts(types.DefaultStartAttemptsFilePath); err != nil {
+			a.logger.Warn("failed to clean-up recorded start attempts", zap.Error(err))
+		}
+		a.recordEtcdClusterID(etcd)
+		a.lifecycleNotifier.notifyEtcdReady()
+		go a.watchLeadership(etcd)
+		if a.Config.SnapshotVerification.IsEnabled() {
+			go a.verifySnapshotPeriodically(etcd)
+		}
+		if a.Config.ConsistencyCheck.IsEnabled() {
+			go a.checkConsistencyPeriodically(etcd)
+		}
+		if a.Config.Defragmentation.IsEnabled() {
+			go a.defragmentPeriodically(etcd)
+		}
+		if a.Config.QuotaWatcher.IsEnabled() {
+			go a.watchQuotaPeriodically(etcd)
+		}
+		readySpan.SetAttributes(attribute.String("outcome", "ready"))
 	case <-etcd.Server.StopNotify():
 		a.logger.Error("etcd server has been aborted, received notification on StopNotify channel")
-	case <-time.After(a.waitReadyTimeout):
+		readySpan.SetAttributes(attribute.String("outcome", "stopped"))
+		err = errors.New("etcd did not become ready: stopped")
+	case <-readyTimeout:
 		a.logger.Error("timeout waiting for ReadyNotify signal, aborting start of etcd")
+		readySpan.SetAttributes(attribute.String("outcome", "timeout"))
+		err = fmt.Errorf("etcd did not become ready: timeout after %s", a.waitReadyTimeout)
+		// etcd only serves clients once it is ready, and Close waits for them unless the server has been stopped
+		etcd.Server.HardStop()
 	}
+	tracing.EndSpan(readySpan, err)
+	// etcd is closed by Close, also if it did not become ready
 	a.etcd = etcd
-	return nil
+	return err
+}
+
+// applyWrapperConfig applies the etcd-wrapper flags which override the fetched etcd configuration.
+func (a *Application) applyWrapperConfig() {
+	a.configureEtcdLogger()
+	a.registerEtcdWarningMetrics()
+	a.configureEtcdTracing()
+}
+
+// configureEtcdTracing enables distributed tracing in the embedded etcd if it has been enabled, exporting to the
+// same endpoint and with the same sampling rate as etcd-wrapper.
+func (a *Application) configureEtcdTracing() {
+	if !a.Config.Tracing.EtcdTracingEnabled {
+		return
+	}
+	a.cfg.ExperimentalEnableDistributedTracing = true
+	a.cfg.ExperimentalDistributedTracingAddress = a.Config.Tracing.Endpoint
+	a.cfg.ExperimentalDistributedTracingServiceName = tracing.EtcdServiceName
+	a.cfg.ExperimentalDistributedTracingServiceInstanceID = a.cfg.Name
+	a.cfg.ExperimentalDistributedTracingSamplingRatePerMillion = a.Config.Tracing.SamplingRatePerMillion
+	a.logger.Info("Distributed tracing enabled for the embedded etcd", zap.String("endpoint", a.Config.Tracing.Endpoint))
 }
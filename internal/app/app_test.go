@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	etcdtestutil "github.com/gardener/etcd-wrapper/internal/testutil"
+	"github.com/gardener/etcd-wrapper/internal/tracing"
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	"go.etcd.io/etcd/server/v3/embed"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestConfigureEtcdTracing(t *testing.T) {
+	table := []struct {
+		description    string
+		tracingConfig  types.TracingConfig
+		expectEnabled  bool
+		expectedAddr   string
+		expectedRatePM int
+	}{
+		{"should not enable etcd tracing when not configured", types.TracingConfig{Enabled: true, Endpoint: "collector:4317", SamplingRatePerMillion: 100}, false, "", 0},
+		{"should enable etcd tracing with the wrapper exporter settings", types.TracingConfig{EtcdTracingEnabled: true, Endpoint: "collector:4317", SamplingRatePerMillion: 100}, true, "collector:4317", 100},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.description, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			app := createApplicationInstance(ctx, cancel, g)
+			defer app.Close()
+			app.Config.Tracing = entry.tracingConfig
+			app.cfg = embed.NewConfig()
+			app.cfg.Name = "etcd-main-0"
+
+			app.configureEtcdTracing()
+			g.Expect(app.cfg.ExperimentalEnableDistributedTracing).To(Equal(entry.expectEnabled))
+			if !entry.expectEnabled {
+				return
+			}
+			g.Expect(app.cfg.ExperimentalDistributedTracingAddress).To(Equal(entry.expectedAddr))
+			g.Expect(app.cfg.ExperimentalDistributedTracingSamplingRatePerMillion).To(Equal(entry.expectedRatePM))
+			g.Expect(app.cfg.ExperimentalDistributedTracingServiceName).To(Equal(tracing.EtcdServiceName))
+			g.Expect(app.cfg.ExperimentalDistributedTracingServiceInstanceID).To(Equal("etcd-main-0"))
+		})
+	}
+}
+
+func TestStartEtcdNotReady(t *testing.T) {
+	g := NewWithT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	app := createApplicationInstance(ctx, cancel, g)
+	defer app.Close()
+
+	// etcd cannot become ready without the second member of its initial cluster
+	ports := make([]int, 0, 3)
+	for range 3 {
+		port, err := etcdtestutil.FreePort()
+		g.Expect(err).ToNot(HaveOccurred())
+		ports = append(ports, port)
+	}
+	clientURL := url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", ports[0])}
+	peerURL := url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", ports[1])}
+	app.cfg = embed.NewConfig()
+	app.cfg.Name = "etcd-main-0"
+	app.cfg.Dir = filepath.Join(t.TempDir(), "data")
+	app.cfg.LogLevel = "error"
+	app.cfg.ListenClientUrls = []url.URL{clientURL}
+	app.cfg.AdvertiseClientUrls = []url.URL{clientURL}
+	app.cfg.ListenPeerUrls = []url.URL{peerURL}
+	app.cfg.AdvertisePeerUrls = []url.URL{peerURL}
+	app.cfg.InitialCluster = fmt.Sprintf("etcd-main-0=%s,etcd-main-1=http://127.0.0.1:%d", peerURL.String(), ports[2])
+	app.waitReadyTimeout = time.Second
+
+	err := app.startEtcd()
+	g.Expect(err).To(MatchError("etcd did not become ready: timeout after 1s"))
+	g.Expect(app.etcd).ToNot(BeNil())
+}
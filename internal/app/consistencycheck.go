@@ -0,0 +1,271 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/bootstrap"
+	"github.com/gardener/etcd-wrapper/internal/metrics"
+	"github.com/gardener/etcd-wrapper/internal/tracing"
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// consistencyCheckTimeout is the time allowed to collect the hashes of the key space of all members.
+const consistencyCheckTimeout = time.Minute
+
+// consistencyStatus is the outcome of a comparison of the key space with the peers.
+type consistencyStatus string
+
+const (
+	// consistencyStatusConsistent denotes that all compared members have the same key space.
+	consistencyStatusConsistent consistencyStatus = "consistent"
+	// consistencyStatusInconsistent denotes that the key space of some members differs, but this member agrees with
+	// a quorum or it cannot be decided which members have diverged.
+	consistencyStatusInconsistent consistencyStatus = "inconsistent"
+	// consistencyStatusDiverged denotes that the key space of this member differs from the one agreed on by a quorum
+	// of members. It is the only status to which the mismatch policy is applied.
+	consistencyStatusDiverged consistencyStatus = "diverged"
+	// consistencyStatusInconclusive denotes that the key space could not be compared with enough peers.
+	consistencyStatusInconclusive consistencyStatus = "inconclusive"
+)
+
+// memberHash is the hash of the key space of a member at the revision of a consistency check.
+type memberHash struct {
+	// Name is the name of the member.
+	Name string `json:"name"`
+	// ID is the ID of the member.
+	ID string `json:"id"`
+	// Local is true for this member.
+	Local bool `json:"local,omitempty"`
+	// Hash is the hash of the key space up to the revision of the check, as returned by the HashKV API.
+	Hash uint32 `json:"hash"`
+	// CompactRevision is the revision up to which the key space of the member has been compacted. Only hashes of
+	// members with the same compact revision can be compared.
+	CompactRevision int64 `json:"compactRevision"`
+	// Error describes why the hash could not be obtained. Hash and CompactRevision are not set if it is not empty.
+	Error string `json:"error,omitempty"`
+}
+
+// consistencyCheckResult is the result of a comparison of the key space with the peers.
+type consistencyCheckResult struct {
+	// CheckedAt is the time of the check.
+	CheckedAt time.Time `json:"checkedAt"`
+	// Status is the outcome of the check.
+	Status consistencyStatus `json:"status"`
+	// Message describes the outcome of the check.
+	Message string `json:"message"`
+	// Revision is the revision up to which the key space has been hashed, the latest revision applied by all members.
+	Revision int64 `json:"revision"`
+	// DivergedMembers is the number of members whose hash differs from the one of the largest group of members.
+	DivergedMembers int `json:"divergedMembers"`
+	// Members are the hashes of all members.
+	Members []memberHash `json:"members"`
+}
+
+// checkConsistencyPeriodically compares the key space with the peers in the configured interval, until the
+// application context is cancelled or etcd stops.
+func (a *Application) checkConsistencyPeriodically(etcd *embed.Etcd) {
+	ticker := time.NewTicker(a.Config.ConsistencyCheck.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-etcd.Server.StopNotify():
+			return
+		case <-ticker.C:
+			a.checkConsistency(etcd)
+		}
+	}
+}
+
+// checkConsistency compares the key space with the peers, records the result and applies the mismatch policy if
+// the key space of this member has diverged.
+func (a *Application) checkConsistency(etcd *embed.Etcd) {
+	ctx, cancel := context.WithTimeout(a.ctx, consistencyCheckTimeout)
+	defer cancel()
+	ctx, span := tracing.Tracer().Start(ctx, "CheckConsistency")
+	defer span.End()
+
+	revision, hashes := a.collectMemberHashes(ctx, etcd)
+	result := evaluateConsistency(revision, len(etcd.Server.Cluster().Members()), hashes)
+	span.SetAttributes(attribute.String("status", string(result.Status)), attribute.Int64("revision", revision))
+	a.consistencyCheckResult.Store(result)
+	recordConsistencyCheckResult(result)
+
+	fields := []zap.Field{zap.String("status", string(result.Status)), zap.String("message", result.Message), zap.Int64("revision", result.Revision), zap.Any("members", result.Members)}
+	switch result.Status {
+	case consistencyStatusDiverged:
+		a.logger.Error("Key space of this member has diverged from its peers", append(fields, zap.String("policy", string(a.consistencyMismatchPolicy())))...)
+		a.keyspaceDiverged.Store(true)
+		a.applyConsistencyMismatchPolicy()
+	case consistencyStatusInconsistent:
+		a.logger.Warn("Key space of the members is inconsistent", fields...)
+	case consistencyStatusConsistent:
+		a.logger.Info("Key space is consistent with the peers", fields...)
+		a.keyspaceDiverged.Store(false)
+	default:
+		a.logger.Warn("Key space could not be compared with the peers", fields...)
+	}
+}
+
+// collectMemberHashes returns the latest revision which all reachable members have applied, and the hashes of the
+// key space of all members up to this revision.
+func (a *Application) collectMemberHashes(ctx context.Context, etcd *embed.Etcd) (int64, []memberHash) {
+	localID := etcd.Server.ID()
+	revision := etcd.Server.KV().Rev()
+	hashes := make([]memberHash, 0, len(etcd.Server.Cluster().Members()))
+	endpoints := make(map[int]string)
+	for _, member := range etcd.Server.Cluster().Members() {
+		hash := memberHash{Name: member.Name, ID: member.ID.String(), Local: member.ID == localID}
+		switch {
+		case hash.Local:
+		case len(member.ClientURLs) == 0:
+			hash.Error = "member does not advertise any client URL"
+		default:
+			endpoint := member.ClientURLs[0]
+			status, err := a.etcdClient.Status(ctx, endpoint)
+			if err != nil {
+				hash.Error = fmt.Sprintf("cannot get status from %s: %v", endpoint, err)
+				break
+			}
+			revision = min(revision, status.Header.Revision)
+			endpoints[len(hashes)] = endpoint
+		}
+		hashes = append(hashes, hash)
+	}
+
+	for i := range hashes {
+		hash := &hashes[i]
+		switch {
+		case hash.Error != "":
+		case hash.Local:
+			kvHash, _, err := etcd.Server.KV().HashStorage().HashByRev(revision)
+			if err != nil {
+				hash.Error = fmt.Sprintf("cannot hash key space up to revision %d: %v", revision, err)
+				break
+			}
+			hash.Hash, hash.CompactRevision = kvHash.Hash, kvHash.CompactRevision
+		default:
+			response, err := a.etcdClient.HashKV(ctx, endpoints[i], revision)
+			if err != nil {
+				hash.Error = fmt.Sprintf("cannot get hash of key space up to revision %d from %s: %v", revision, endpoints[i], err)
+				break
+			}
+			hash.Hash, hash.CompactRevision = response.Hash, response.CompactRevision
+		}
+	}
+	return revision, hashes
+}
+
+// evaluateConsistency compares the hashes of the members which have been compacted up to the same revision as this
+// member. The key space of this member has only diverged if the hash of a quorum of the clusterSize members differs
+// from its own hash.
+func evaluateConsistency(revision int64, clusterSize int, hashes []memberHash) *consistencyCheckResult {
+	result := &consistencyCheckResult{CheckedAt: time.Now(), Revision: revision, Members: hashes}
+	var local *memberHash
+	for i := range hashes {
+		if hashes[i].Local {
+			local = &hashes[i]
+		}
+	}
+	if local == nil || local.Error != "" {
+		result.Status = consistencyStatusInconclusive
+		result.Message = "the key space of this member could not be hashed"
+		return result
+	}
+
+	groups := make(map[uint32][]string)
+	for _, hash := range hashes {
+		if hash.Error == "" && hash.CompactRevision == local.CompactRevision {
+			groups[hash.Hash] = append(groups[hash.Hash], hash.Name)
+		}
+	}
+	compared := 0
+	var largest uint32
+	for hash, names := range groups {
+		compared += len(names)
+		if len(names) > len(groups[largest]) || (len(names) == len(groups[largest]) && hash == local.Hash) {
+			largest = hash
+		}
+	}
+	if compared < 2 {
+		result.Status = consistencyStatusInconclusive
+		result.Message = fmt.Sprintf("no peer could be compared with this member at revision %d and compact revision %d", revision, local.CompactRevision)
+		return result
+	}
+	if len(groups) == 1 {
+		result.Status = consistencyStatusConsistent
+		result.Message = fmt.Sprintf("%d members have the same key space", compared)
+		return result
+	}
+
+	result.DivergedMembers = compared - len(groups[largest])
+	var diverged []string
+	for hash, names := range groups {
+		if hash != largest {
+			diverged = append(diverged, names...)
+		}
+	}
+	sort.Strings(diverged)
+	quorum := clusterSize/2 + 1
+	switch {
+	case len(groups[largest]) < quorum:
+		result.Status = consistencyStatusInconsistent
+		result.Message = fmt.Sprintf("the key space of the members differs and no quorum of %d members agrees on it", quorum)
+	case largest != local.Hash:
+		result.Status = consistencyStatusDiverged
+		result.Message = fmt.Sprintf("the key space of this member differs from the one of %s", strings.Join(groups[largest], ", "))
+	default:
+		result.Status = consistencyStatusInconsistent
+		result.Message = fmt.Sprintf("the key space of %s differs from the one of a quorum of members", strings.Join(diverged, ", "))
+	}
+	return result
+}
+
+// applyConsistencyMismatchPolicy applies the configured policy after the key space of this member has diverged.
+// Failing the readiness is done by the readiness handler.
+func (a *Application) applyConsistencyMismatchPolicy() {
+	if a.consistencyMismatchPolicy() != types.ConsistencyMismatchPolicyStop {
+		return
+	}
+	if err := bootstrap.RequestFullValidation(types.DefaultExitCodeFilePath); err != nil {
+		a.logger.Error("failed to request full validation of the data directory", zap.Error(err))
+	}
+	a.logger.Error("Stopping etcd, its data directory will be fully validated on the next start")
+	a.cancelContext()
+}
+
+// consistencyMismatchPolicy returns the configured mismatch policy, defaulting to alert.
+func (a *Application) consistencyMismatchPolicy() types.ConsistencyMismatchPolicy {
+	if a.Config.ConsistencyCheck.MismatchPolicy == "" {
+		return types.ConsistencyMismatchPolicyAlert
+	}
+	return a.Config.ConsistencyCheck.MismatchPolicy
+}
+
+// recordConsistencyCheckResult exports the result of a consistency check as metrics.
+func recordConsistencyCheckResult(result *consistencyCheckResult) {
+	metrics.ConsistencyChecksTotal.WithLabelValues(string(result.Status)).Inc()
+	if result.Status == consistencyStatusInconclusive {
+		return
+	}
+	metrics.ConsistencyCheckRevision.Set(float64(result.Revision))
+	metrics.ConsistencyCheckDivergedMembers.Set(float64(result.DivergedMembers))
+	diverged := 0.0
+	if result.Status == consistencyStatusDiverged {
+		diverged = 1
+	}
+	metrics.ConsistencyCheckDiverged.Set(diverged)
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/metrics"
+	etcdtestutil "github.com/gardener/etcd-wrapper/internal/testutil"
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEvaluateConsistency(t *testing.T) {
+	local := func(hash uint32) memberHash {
+		return memberHash{Name: "etcd-0", Local: true, Hash: hash, CompactRevision: 10}
+	}
+	peer := func(name string, hash uint32, compactRevision int64) memberHash {
+		return memberHash{Name: name, Hash: hash, CompactRevision: compactRevision}
+	}
+	unreachable := func(name string) memberHash {
+		return memberHash{Name: name, Error: "connection refused"}
+	}
+	table := []struct {
+		description             string
+		clusterSize             int
+		hashes                  []memberHash
+		expectedStatus          consistencyStatus
+		expectedDivergedMembers int
+	}{
+		{"should be inconclusive for a single member", 1, []memberHash{local(1)}, consistencyStatusInconclusive, 0},
+		{"should be inconclusive if the local hash is missing", 3, []memberHash{{Name: "etcd-0", Local: true, Error: "compacted"}, peer("etcd-1", 1, 10), peer("etcd-2", 1, 10)}, consistencyStatusInconclusive, 0},
+		{"should be inconclusive if no peer is reachable", 3, []memberHash{local(1), unreachable("etcd-1"), unreachable("etcd-2")}, consistencyStatusInconclusive, 0},
+		{"should be inconclusive if peers have been compacted up to another revision", 3, []memberHash{local(1), peer("etcd-1", 2, 11), peer("etcd-2", 2, 11)}, consistencyStatusInconclusive, 0},
+		{"should be consistent if all hashes match", 3, []memberHash{local(1), peer("etcd-1", 1, 10), peer("etcd-2", 1, 10)}, consistencyStatusConsistent, 0},
+		{"should be consistent if the reachable peers match", 3, []memberHash{local(1), peer("etcd-1", 1, 10), unreachable("etcd-2")}, consistencyStatusConsistent, 0},
+		{"should have diverged if a quorum of peers disagrees with this member", 3, []memberHash{local(1), peer("etcd-1", 2, 10), peer("etcd-2", 2, 10)}, consistencyStatusDiverged, 1},
+		{"should be inconsistent if a peer disagrees with a quorum including this member", 3, []memberHash{local(1), peer("etcd-1", 1, 10), peer("etcd-2", 2, 10)}, consistencyStatusInconsistent, 1},
+		{"should be inconsistent if no quorum agrees", 3, []memberHash{local(1), peer("etcd-1", 2, 10), unreachable("etcd-2")}, consistencyStatusInconsistent, 1},
+		{"should be inconsistent if no quorum agrees in a larger cluster", 5, []memberHash{local(1), peer("etcd-1", 2, 10), peer("etcd-2", 2, 10), peer("etcd-3", 3, 10), unreachable("etcd-4")}, consistencyStatusInconsistent, 2},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		result := evaluateConsistency(42, entry.clusterSize, entry.hashes)
+		g.Expect(result.Status).To(Equal(entry.expectedStatus), result.Message)
+		g.Expect(result.DivergedMembers).To(Equal(entry.expectedDivergedMembers))
+		g.Expect(result.Revision).To(BeEquivalentTo(42))
+		g.Expect(result.Message).ToNot(BeEmpty())
+	}
+}
+
+func TestApplyConsistencyMismatchPolicy(t *testing.T) {
+	table := []struct {
+		description      string
+		policy           types.ConsistencyMismatchPolicy
+		expectedStop     bool
+		expectedReadyErr bool
+	}{
+		{"should only alert with the alert policy", types.ConsistencyMismatchPolicyAlert, false, false},
+		{"should only alert without a policy", "", false, false},
+		{"should fail readiness with the fail-readiness policy", types.ConsistencyMismatchPolicyFailReadiness, false, true},
+		{"should stop etcd with the stop policy", types.ConsistencyMismatchPolicyStop, true, false},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		ctx, cancel := context.WithCancel(context.Background())
+		app := createApplicationInstance(ctx, cancel, g)
+		app.Config.ConsistencyCheck.MismatchPolicy = entry.policy
+		app.etcdReady = true
+		app.keyspaceDiverged.Store(true)
+
+		app.applyConsistencyMismatchPolicy()
+		g.Expect(ctx.Err() != nil).To(Equal(entry.expectedStop))
+		g.Expect(app.isReady()).To(Equal(!entry.expectedReadyErr))
+		if entry.expectedStop {
+			g.Expect(app.cancellationReason()).To(Equal("key space of this member has diverged from its peers"))
+		}
+		app.Close()
+	}
+}
+
+func TestCheckConsistencyOfSingleMember(t *testing.T) {
+	g := NewWithT(t)
+	etcd, err := etcdtestutil.StartEtcd(filepath.Join(t.TempDir(), "data"))
+	g.Expect(err).ToNot(HaveOccurred())
+	defer etcd.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	app := createApplicationInstance(ctx, cancel, g)
+	defer app.Close()
+	metrics.ConsistencyChecksTotal.Reset()
+
+	app.checkConsistency(etcd)
+	result := app.consistencyCheckResult.Load()
+	g.Expect(result).ToNot(BeNil())
+	g.Expect(result.Status).To(Equal(consistencyStatusInconclusive))
+	g.Expect(result.Members).To(HaveLen(1))
+	g.Expect(result.Members[0].Local).To(BeTrue())
+	g.Expect(result.Members[0].Error).To(BeEmpty())
+	g.Expect(testutil.ToFloat64(metrics.ConsistencyChecksTotal.WithLabelValues(string(consistencyStatusInconclusive)))).To(Equal(1.0))
+}
@@ -0,0 +1,475 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/metrics"
+	"github.com/gardener/etcd-wrapper/internal/tracing"
+	"github.com/gardener/etcd-wrapper/internal/types"
+	"github.com/gardener/etcd-wrapper/internal/util"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	// memberStatusTimeout is the time allowed to get the status of a member before and after its defragmentation.
+	memberStatusTimeout = 10 * time.Second
+	// memberDefragmentationTimeout is the time allowed to defragment a single member.
+	memberDefragmentationTimeout = 10 * time.Minute
+	// leadershipTransferTimeout is the time allowed to transfer the leadership before the leader is defragmented.
+	leadershipTransferTimeout = time.Minute
+	// defragmentationLockPrefix is the key prefix of the lock which makes the members defragment one after the other.
+	defragmentationLockPrefix = "/etcd-wrapper/defragmentation"
+	// defragmentationLockTimeout is the time a member waits for the other members to be defragmented before itself.
+	defragmentationLockTimeout = 30 * time.Minute
+	// followerDefragmentationPollInterval is the interval in which the leader checks the status of the followers it
+	// waits for before it queues for the lock.
+	followerDefragmentationPollInterval = 2 * time.Second
+)
+
+// defragmentationStatus is the outcome of a defragmentation.
+type defragmentationStatus string
+
+const (
+	// defragmentationStatusSucceeded denotes that this member has been defragmented.
+	defragmentationStatusSucceeded defragmentationStatus = "succeeded"
+	// defragmentationStatusFailed denotes that this member could not be defragmented.
+	defragmentationStatusFailed defragmentationStatus = "failed"
+	// defragmentationStatusSkipped denotes that this member has not been defragmented, because the cluster is
+	// unhealthy or the member does not exceed the fragmentation thresholds.
+	defragmentationStatusSkipped defragmentationStatus = "skipped"
+)
+
+// defragmentationTrigger is what has triggered a defragmentation.
+type defragmentationTrigger string
+
+const (
+	// defragmentationTriggerSchedule denotes a defragmentation triggered by the schedule or the interval.
+	defragmentationTriggerSchedule defragmentationTrigger = "schedule"
+	// defragmentationTriggerFragmentation denotes a defragmentation triggered by a sample of the fragmentation which
+	// exceeds the thresholds.
+	defragmentationTriggerFragmentation defragmentationTrigger = "fragmentation"
+)
+
+// memberDefragmentation is the outcome of the defragmentation of a single member.
+type memberDefragmentation struct {
+	// Name is the name of the member.
+	Name string `json:"name"`
+	// ID is the ID of the member.
+	ID string `json:"id"`
+	// Leader is true if the member has been the leader before the defragmentation, and has transferred its
+	// leadership.
+	Leader bool `json:"leader,omitempty"`
+	// DBSizeBeforeBytes is the size of the database before the defragmentation.
+	DBSizeBeforeBytes int64 `json:"dbSizeBeforeBytes"`
+	// DBSizeAfterBytes is the size of the database after the defragmentation. It is 0 if it could not be obtained.
+	DBSizeAfterBytes int64 `json:"dbSizeAfterBytes"`
+	// ReclaimedBytes is the decrease of the size of the database by the defragmentation.
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+	// DurationSeconds is the duration of the defragmentation.
+	DurationSeconds float64 `json:"durationSeconds"`
+	// Error describes why the member could not be defragmented.
+	Error string `json:"error,omitempty"`
+}
+
+// defragmentationResult is the result of a defragmentation of this member.
+type defragmentationResult struct {
+	// StartedAt is the time at which the defragmentation started.
+	StartedAt time.Time `json:"startedAt"`
+	// Trigger is what has triggered the defragmentation.
+	Trigger defragmentationTrigger `json:"trigger"`
+	// Status is the outcome of the defragmentation.
+	Status defragmentationStatus `json:"status"`
+	// Message describes the outcome of the defragmentation.
+	Message string `json:"message"`
+	// DurationSeconds is the duration of the defragmentation, including the time waited for the other members.
+	DurationSeconds float64 `json:"durationSeconds"`
+	// Member is the defragmentation of this member. It is nil if the defragmentation has been skipped.
+	Member *memberDefragmentation `json:"member,omitempty"`
+}
+
+// defragmentationCandidate is a member which may be defragmented.
+type defragmentationCandidate struct {
+	name     string
+	id       uint64
+	endpoint string
+	local    bool
+	learner  bool
+	status   *clientv3.StatusResponse
+}
+
+// defragmentPeriodically defragments this member according to the configured schedule or interval, and whenever a
+// sample of its fragmentation exceeds the thresholds, until the application context is cancelled or etcd stops.
+func (a *Application) defragmentPeriodically(etcd *embed.Etcd) {
+	var nextRun func(now time.Time) time.Time
+	switch {
+	case a.Config.Defragmentation.Schedule != "":
+		schedule, err := util.ParseCronSchedule(a.Config.Defragmentation.Schedule)
+		if err != nil {
+			a.logger.Error("Cannot schedule defragmentation", zap.Error(err))
+			return
+		}
+		nextRun = schedule.Next
+	case a.Config.Defragmentation.Interval > 0:
+		nextRun = func(now time.Time) time.Time { return now.Add(a.Config.Defragmentation.Interval) }
+	}
+	var samples <-chan time.Time
+	if a.Config.Defragmentation.SamplingInterval > 0 {
+		ticker := time.NewTicker(a.Config.Defragmentation.SamplingInterval)
+		defer ticker.Stop()
+		samples = ticker.C
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	scheduleNextRun := func() {
+		timer.Stop()
+		if nextRun == nil {
+			return
+		}
+		next := nextRun(time.Now())
+		if next.IsZero() {
+			a.logger.Warn("Defragmentation schedule is never activated", zap.String("schedule", a.Config.Defragmentation.Schedule))
+			nextRun = nil
+			return
+		}
+		timer.Reset(time.Until(next))
+	}
+	scheduleNextRun()
+	for {
+		if nextRun == nil && samples == nil {
+			return
+		}
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-etcd.Server.StopNotify():
+			return
+		case <-timer.C:
+			a.defragment(etcd, defragmentationTriggerSchedule)
+			scheduleNextRun()
+		case <-samples:
+			a.defragment(etcd, defragmentationTriggerFragmentation)
+		}
+	}
+}
+
+// defragment defragments this member if it exceeds the fragmentation thresholds, after the other members which are
+// defragmented at the same time and, if it is the leader, after it has transferred its leadership. The result is
+// recorded, unless a sample of the fragmentation has not exceeded the thresholds.
+func (a *Application) defragment(etcd *embed.Etcd, trigger defragmentationTrigger) {
+	ctx, span := tracing.Tracer().Start(a.ctx, "Defragment", trace.WithAttributes(attribute.String("trigger", string(trigger))))
+	defer span.End()
+
+	result := a.defragmentLocalMember(ctx, etcd, trigger)
+	span.SetAttributes(attribute.String("status", string(result.Status)))
+	if trigger == defragmentationTriggerFragmentation && result.Status == defragmentationStatusSkipped {
+		a.logger.Debug("Skipped defragmentation of member", zap.String("message", result.Message))
+		return
+	}
+	a.defragmentationResult.Store(result)
+	recordDefragmentationResult(result)
+
+	fields := []zap.Field{zap.String("trigger", string(trigger)), zap.String("status", string(result.Status)), zap.String("message", result.Message), zap.Float64("durationSeconds", result.DurationSeconds), zap.Any("member", result.Member)}
+	switch result.Status {
+	case defragmentationStatusSucceeded:
+		a.logger.Info("Defragmented member", fields...)
+	case defragmentationStatusFailed:
+		a.logger.Error("Defragmentation of member failed", fields...)
+	default:
+		a.logger.Info("Skipped defragmentation of member", fields...)
+	}
+}
+
+// defragmentLocalMember defragments this member if it exceeds the fragmentation thresholds. The members are
+// defragmented one after the other, as they hold a lock in etcd while they are defragmented. The leader only queues for
+// the lock once no follower exceeds the thresholds anymore, and transfers its leadership before it is defragmented.
+func (a *Application) defragmentLocalMember(ctx context.Context, etcd *embed.Etcd, trigger defragmentationTrigger) (result *defragmentationResult) {
+	result = &defragmentationResult{StartedAt: time.Now(), Trigger: trigger}
+	defer func() { result.DurationSeconds = time.Since(result.StartedAt).Seconds() }()
+
+	local, followers, err := a.localDefragmentationCandidate(ctx, etcd)
+	if err != nil {
+		result.Status = defragmentationStatusSkipped
+		result.Message = fmt.Sprintf("cluster is unhealthy: %v", err)
+		return
+	}
+	if local == nil {
+		result.Status = defragmentationStatusSkipped
+		result.Message = "this member does not exceed the fragmentation thresholds"
+		return
+	}
+	if etcd.Server.Leader() == etcd.Server.ID() && len(followers) > 0 {
+		if err = a.waitForFollowerDefragmentation(ctx, etcd, followers); err != nil {
+			result.Status = defragmentationStatusSkipped
+			result.Message = fmt.Sprintf("followers have not been defragmented before this leader: %v", err)
+			return
+		}
+	}
+	unlock, err := a.lockDefragmentation(ctx)
+	if err != nil {
+		result.Status = defragmentationStatusFailed
+		result.Message = fmt.Sprintf("cannot acquire the defragmentation lock: %v", err)
+		return
+	}
+	defer unlock()
+
+	// the cluster and the leader may have changed while other members have been defragmented
+	candidates, err := a.collectDefragmentationCandidates(ctx, etcd)
+	if err != nil {
+		result.Status = defragmentationStatusSkipped
+		result.Message = fmt.Sprintf("cluster is unhealthy: %v", err)
+		return
+	}
+	local = nil
+	for i := range candidates {
+		if candidates[i].local && needsDefragmentation(a.Config.Defragmentation, candidates[i].status.DbSize, candidates[i].status.DbSizeInUse) {
+			local = &candidates[i]
+		}
+	}
+	if local == nil {
+		result.Status = defragmentationStatusSkipped
+		result.Message = "this member does not exceed the fragmentation thresholds"
+		return
+	}
+	leader := etcd.Server.Leader() == etcd.Server.ID()
+	if leader {
+		if err = transferLeadership(ctx, etcd, candidates); err != nil {
+			result.Status = defragmentationStatusFailed
+			result.Message = fmt.Sprintf("leadership could not be transferred before defragmenting this member: %v", err)
+			return
+		}
+	}
+	a.defragmenting.Store(true)
+	defragmented := a.defragmentMember(ctx, local)
+	a.defragmenting.Store(false)
+	defragmented.Leader = leader
+	result.Member = &defragmented
+	if defragmented.Error != "" {
+		result.Status = defragmentationStatusFailed
+		result.Message = fmt.Sprintf("member %s could not be defragmented", local.name)
+		return
+	}
+	result.Status = defragmentationStatusSucceeded
+	result.Message = fmt.Sprintf("member %s has been defragmented", local.name)
+	return
+}
+
+// localDefragmentationCandidate returns this member if it exceeds the fragmentation thresholds, or nil otherwise,
+// and the other members which exceed the thresholds as well.
+func (a *Application) localDefragmentationCandidate(ctx context.Context, etcd *embed.Etcd) (*defragmentationCandidate, []defragmentationCandidate, error) {
+	candidates, err := a.collectDefragmentationCandidates(ctx, etcd)
+	if err != nil {
+		return nil, nil, err
+	}
+	var local *defragmentationCandidate
+	var others []defragmentationCandidate
+	for i := range candidates {
+		candidate := &candidates[i]
+		if !needsDefragmentation(a.Config.Defragmentation, candidate.status.DbSize, candidate.status.DbSizeInUse) {
+			continue
+		}
+		if candidate.local {
+			local = candidate
+		} else {
+			others = append(others, *candidate)
+		}
+	}
+	return local, others, nil
+}
+
+// waitForFollowerDefragmentation waits until none of the passed followers exceeds the fragmentation thresholds
+// anymore, checking their status in etcd, so that the leader is defragmented last. A follower is not waited for
+// anymore once its database has shrunk, it has left the cluster or it has become the leader. The wait ends early if
+// this member is not the leader anymore, and fails after defragmentationLockTimeout.
+func (a *Application) waitForFollowerDefragmentation(ctx context.Context, etcd *embed.Etcd, followers []defragmentationCandidate) error {
+	ctx, cancel := context.WithTimeout(ctx, defragmentationLockTimeout)
+	defer cancel()
+	ticker := time.NewTicker(followerDefragmentationPollInterval)
+	defer ticker.Stop()
+	a.logger.Info("Waiting for followers to be defragmented before the leader", zap.Strings("followers", defragmentationCandidateNames(followers)))
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %s: %w", strings.Join(defragmentationCandidateNames(followers), ", "), ctx.Err())
+		case <-ticker.C:
+		}
+		if etcd.Server.Leader() != etcd.Server.ID() {
+			return nil
+		}
+		candidates, err := a.collectDefragmentationCandidates(ctx, etcd)
+		if err != nil {
+			// a follower may not serve its status while it is defragmented
+			a.logger.Debug("Cannot get status of followers", zap.Error(err))
+			continue
+		}
+		pending := make([]defragmentationCandidate, 0, len(followers))
+		for _, follower := range followers {
+			for _, candidate := range candidates {
+				if candidate.id == follower.id && candidate.id != uint64(etcd.Server.Leader()) && candidate.status.DbSize >= follower.status.DbSize &&
+					needsDefragmentation(a.Config.Defragmentation, candidate.status.DbSize, candidate.status.DbSizeInUse) {
+					pending = append(pending, follower)
+				}
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		followers = pending
+	}
+}
+
+// defragmentationCandidateNames returns the names of the passed members.
+func defragmentationCandidateNames(candidates []defragmentationCandidate) []string {
+	names := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		names = append(names, candidate.name)
+	}
+	return names
+}
+
+// lockDefragmentation acquires the lock which is held by a member while it is defragmented, and returns the function
+// which releases it. The lock is bound to a lease, so that it is released if this member fails while holding it.
+func (a *Application) lockDefragmentation(ctx context.Context) (func(), error) {
+	session, err := concurrency.NewSession(a.etcdClient, concurrency.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	lockCtx, cancel := context.WithTimeout(ctx, defragmentationLockTimeout)
+	defer cancel()
+	mutex := concurrency.NewMutex(session, defragmentationLockPrefix)
+	if err = mutex.Lock(lockCtx); err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	return func() {
+		unlockCtx, cancel := context.WithTimeout(ctx, memberStatusTimeout)
+		defer cancel()
+		if err := mutex.Unlock(unlockCtx); err != nil {
+			a.logger.Warn("Cannot release defragmentation lock, it expires with its lease", zap.Error(err))
+		}
+		_ = session.Close()
+	}, nil
+}
+
+// collectDefragmentationCandidates returns all members with their status. It fails if a member is not healthy, as
+// defragmenting a member of an unhealthy cluster could make it lose its quorum.
+func (a *Application) collectDefragmentationCandidates(ctx context.Context, etcd *embed.Etcd) ([]defragmentationCandidate, error) {
+	for _, alarm := range etcd.Server.Alarms() {
+		if alarm.Alarm == etcdserverpb.AlarmType_CORRUPT {
+			return nil, fmt.Errorf("corruption alarm has been raised for member %x", alarm.MemberID)
+		}
+	}
+	members := etcd.Server.Cluster().Members()
+	candidates := make([]defragmentationCandidate, 0, len(members))
+	for _, member := range members {
+		if len(member.ClientURLs) == 0 {
+			return nil, fmt.Errorf("member %s has not been started", member.ID)
+		}
+		candidate := defragmentationCandidate{
+			name:     member.Name,
+			id:       uint64(member.ID),
+			endpoint: member.ClientURLs[0],
+			local:    member.ID == etcd.Server.ID(),
+			learner:  member.IsLearner,
+		}
+		status, err := a.memberStatus(ctx, candidate.endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get status of member %s: %w", member.Name, err)
+		}
+		if len(status.Errors) > 0 {
+			return nil, fmt.Errorf("member %s reports errors: %s", member.Name, strings.Join(status.Errors, ", "))
+		}
+		candidate.status = status
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+// needsDefragmentation checks if a member with the passed database size and size in use exceeds the fragmentation
+// thresholds.
+func needsDefragmentation(config types.DefragmentationConfig, dbSize, dbSizeInUse int64) bool {
+	if dbSize <= 0 || dbSize < config.MinDBSizeBytes {
+		return false
+	}
+	return float64(dbSize-dbSizeInUse)/float64(dbSize) >= config.MinFragmentationRatio
+}
+
+// defragmentMember defragments a single member and measures the space reclaimed by it.
+func (a *Application) defragmentMember(ctx context.Context, candidate *defragmentationCandidate) memberDefragmentation {
+	defragmented := memberDefragmentation{
+		Name:              candidate.name,
+		ID:                fmt.Sprintf("%x", candidate.id),
+		DBSizeBeforeBytes: candidate.status.DbSize,
+	}
+	a.logger.Info("Defragmenting member", zap.String("member", candidate.name), zap.Int64("dbSize", candidate.status.DbSize), zap.Int64("dbSizeInUse", candidate.status.DbSizeInUse))
+	defragCtx, cancel := context.WithTimeout(ctx, memberDefragmentationTimeout)
+	defer cancel()
+	start := time.Now()
+	_, err := a.etcdClient.Defragment(defragCtx, candidate.endpoint)
+	defragmented.DurationSeconds = time.Since(start).Seconds()
+	if err != nil {
+		defragmented.Error = err.Error()
+		return defragmented
+	}
+	status, err := a.memberStatus(ctx, candidate.endpoint)
+	if err != nil {
+		a.logger.Warn("Cannot get database size after defragmentation", zap.String("member", candidate.name), zap.Error(err))
+		return defragmented
+	}
+	defragmented.DBSizeAfterBytes = status.DbSize
+	defragmented.ReclaimedBytes = max(0, defragmented.DBSizeBeforeBytes-status.DbSize)
+	return defragmented
+}
+
+// memberStatus returns the status of the member serving the passed endpoint.
+func (a *Application) memberStatus(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, memberStatusTimeout)
+	defer cancel()
+	return a.etcdClient.Status(ctx, endpoint)
+}
+
+// transferLeadership transfers the leadership of this member to the voting follower which has applied the most
+// entries. A single member keeps its leadership.
+func transferLeadership(ctx context.Context, etcd *embed.Etcd, candidates []defragmentationCandidate) error {
+	var transferee *defragmentationCandidate
+	for i := range candidates {
+		candidate := &candidates[i]
+		if candidate.local || candidate.learner {
+			continue
+		}
+		if transferee == nil || candidate.status.RaftAppliedIndex > transferee.status.RaftAppliedIndex {
+			transferee = candidate
+		}
+	}
+	if transferee == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, leadershipTransferTimeout)
+	defer cancel()
+	return etcd.Server.MoveLeader(ctx, uint64(etcd.Server.ID()), transferee.id)
+}
+
+// recordDefragmentationResult exports the result of a defragmentation of this member as metrics.
+func recordDefragmentationResult(result *defragmentationResult) {
+	metrics.DefragmentationsTotal.WithLabelValues(string(result.Status)).Inc()
+	if member := result.Member; member != nil && member.Error == "" {
+		metrics.DefragmentationDurationSeconds.WithLabelValues(member.Name).Set(member.DurationSeconds)
+		metrics.DefragmentationReclaimedBytes.WithLabelValues(member.Name).Set(float64(member.ReclaimedBytes))
+	}
+	if result.Status == defragmentationStatusSucceeded {
+		metrics.DefragmentationLastSuccessTimestampSeconds.Set(float64(result.StartedAt.Unix()))
+	}
+}
@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/metrics"
+	etcdtestutil "github.com/gardener/etcd-wrapper/internal/testutil"
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.uber.org/zap"
+)
+
+func TestNeedsDefragmentation(t *testing.T) {
+	table := []struct {
+		description    string
+		config         types.DefragmentationConfig
+		dbSize         int64
+		dbSizeInUse    int64
+		expectedResult bool
+	}{
+		{"should defragment every member without thresholds", types.DefragmentationConfig{}, 100, 100, true},
+		{"should not defragment an empty database", types.DefragmentationConfig{}, 0, 0, false},
+		{"should defragment a member at the fragmentation ratio", types.DefragmentationConfig{MinFragmentationRatio: 0.5}, 100, 50, true},
+		{"should not defragment a member below the fragmentation ratio", types.DefragmentationConfig{MinFragmentationRatio: 0.5}, 100, 51, false},
+		{"should defragment a member at the database size", types.DefragmentationConfig{MinDBSizeBytes: 100}, 100, 100, true},
+		{"should not defragment a member below the database size", types.DefragmentationConfig{MinDBSizeBytes: 101}, 100, 10, false},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		g.Expect(needsDefragmentation(entry.config, entry.dbSize, entry.dbSizeInUse)).To(Equal(entry.expectedResult))
+	}
+}
+
+func TestDefragmentSingleMember(t *testing.T) {
+	table := []struct {
+		description    string
+		config         types.DefragmentationConfig
+		trigger        defragmentationTrigger
+		expectedStatus defragmentationStatus
+		expectedMember bool
+		expectedResult bool
+	}{
+		{"should defragment the leader without thresholds", types.DefragmentationConfig{Interval: 1}, defragmentationTriggerSchedule, defragmentationStatusSucceeded, true, true},
+		{"should skip the defragmentation if the member does not exceed the thresholds", types.DefragmentationConfig{Interval: 1, MinDBSizeBytes: 1 << 40}, defragmentationTriggerSchedule, defragmentationStatusSkipped, false, true},
+		{"should defragment the member once a sample exceeds the fragmentation ratio", types.DefragmentationConfig{SamplingInterval: time.Minute, MinFragmentationRatio: 0.5}, defragmentationTriggerFragmentation, defragmentationStatusSucceeded, true, true},
+		{"should not record a sample which does not exceed the fragmentation ratio", types.DefragmentationConfig{SamplingInterval: time.Minute, MinFragmentationRatio: 0.99}, defragmentationTriggerFragmentation, defragmentationStatusSkipped, false, false},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		etcd := startFragmentedEtcdCluster(t, g, 1)[0]
+		app := createDefragmentingApplication(g, etcd, entry.config)
+		metrics.DefragmentationsTotal.Reset()
+
+		app.defragment(etcd, entry.trigger)
+		result := app.defragmentationResult.Load()
+		if !entry.expectedResult {
+			g.Expect(result).To(BeNil())
+			g.Expect(testutil.CollectAndCount(metrics.DefragmentationsTotal)).To(BeZero())
+		} else {
+			g.Expect(result).ToNot(BeNil())
+			g.Expect(result.Trigger).To(Equal(entry.trigger))
+			g.Expect(result.Status).To(Equal(entry.expectedStatus), result.Message)
+			g.Expect(result.Member != nil).To(Equal(entry.expectedMember))
+			g.Expect(testutil.ToFloat64(metrics.DefragmentationsTotal.WithLabelValues(string(entry.expectedStatus)))).To(Equal(1.0))
+		}
+		if entry.expectedMember {
+			member := result.Member
+			g.Expect(member.Error).To(BeEmpty())
+			g.Expect(member.Leader).To(BeTrue())
+			g.Expect(member.DBSizeAfterBytes).To(BeNumerically(">", 0))
+			g.Expect(member.ReclaimedBytes).To(BeNumerically(">", 0))
+			g.Expect(member.ReclaimedBytes).To(Equal(member.DBSizeBeforeBytes - member.DBSizeAfterBytes))
+		}
+		locks, err := app.etcdClient.Get(context.Background(), defragmentationLockPrefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(locks.Count).To(BeZero())
+		g.Expect(app.defragmenting.Load()).To(BeFalse())
+		g.Expect(app.isReady()).To(BeTrue())
+		app.Close()
+		etcd.Close()
+	}
+}
+
+func TestDefragmentLeaderAfterFollower(t *testing.T) {
+	g := NewWithT(t)
+	etcds := startFragmentedEtcdCluster(t, g, 2)
+	leader, follower := etcds[0], etcds[1]
+	if follower.Server.Leader() == follower.Server.ID() {
+		leader, follower = follower, leader
+	}
+	config := types.DefragmentationConfig{Interval: 1, MinFragmentationRatio: 0.5}
+	leaderApp := createDefragmentingApplication(g, leader, config)
+	followerApp := createDefragmentingApplication(g, follower, config)
+
+	// the tick of the leader comes before the one of the follower
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		leaderApp.defragment(leader, defragmentationTriggerSchedule)
+	}()
+	time.Sleep(time.Second)
+	followerApp.defragment(follower, defragmentationTriggerSchedule)
+	<-done
+
+	followerResult := followerApp.defragmentationResult.Load()
+	g.Expect(followerResult).ToNot(BeNil())
+	g.Expect(followerResult.Status).To(Equal(defragmentationStatusSucceeded), followerResult.Message)
+	g.Expect(followerResult.Member.Leader).To(BeFalse())
+	leaderResult := leaderApp.defragmentationResult.Load()
+	g.Expect(leaderResult).ToNot(BeNil())
+	g.Expect(leaderResult.Status).To(Equal(defragmentationStatusSucceeded), leaderResult.Message)
+	g.Expect(leaderResult.Member.Leader).To(BeTrue())
+	g.Expect(leaderResult.StartedAt).To(BeTemporally("<", followerResult.StartedAt))
+	g.Expect(leader.Server.Leader()).To(Equal(follower.Server.ID()))
+
+	leaderApp.Close()
+	followerApp.Close()
+	for _, etcd := range etcds {
+		etcd.Close()
+	}
+}
+
+func TestIsReadyWhileDefragmenting(t *testing.T) {
+	g := NewWithT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	app := createApplicationInstance(ctx, cancel, g)
+	defer app.Close()
+	app.etcdReady = true
+	app.defragmenting.Store(true)
+	g.Expect(app.isReady()).To(BeFalse())
+	app.defragmenting.Store(false)
+	g.Expect(app.isReady()).To(BeTrue())
+}
+
+// createDefragmentingApplication creates an application whose client connects to the passed etcd, with the passed
+// defragmentation configuration.
+func createDefragmentingApplication(g *WithT, etcd *embed.Etcd, config types.DefragmentationConfig) *Application {
+	ctx, cancel := context.WithCancel(context.Background())
+	app := createApplicationInstance(ctx, cancel, g)
+	g.Expect(app.etcdClient.Close()).To(Succeed())
+	cli, err := clientv3.New(clientv3.Config{Endpoints: []string{etcd.Config().AdvertiseClientUrls[0].String()}, Logger: zap.NewNop()})
+	g.Expect(err).ToNot(HaveOccurred())
+	app.etcdClient = cli
+	app.Config.Defragmentation = config
+	app.etcdReady = true
+	return app
+}
+
+// startFragmentedEtcdCluster starts an etcd cluster of the passed number of members whose databases have space to be
+// reclaimed by a defragmentation.
+func startFragmentedEtcdCluster(t *testing.T, g *WithT, members int) []*embed.Etcd {
+	dataDirs := make([]string, 0, members)
+	for i := range members {
+		dataDirs = append(dataDirs, filepath.Join(t.TempDir(), fmt.Sprintf("data-%d", i)))
+	}
+	etcds, err := etcdtestutil.StartEtcdCluster(dataDirs...)
+	g.Expect(err).ToNot(HaveOccurred())
+	etcd := etcds[0]
+	kvs := make(map[string]string)
+	keys := make([]string, 0, 1000)
+	for i := range 1000 {
+		key := fmt.Sprintf("/registry/pods/pod-%d", i)
+		kvs[key] = string(make([]byte, 1024))
+		keys = append(keys, key)
+	}
+	g.Expect(etcdtestutil.PutKeys(etcd, kvs)).To(Succeed())
+	g.Expect(etcdtestutil.DeleteKeys(etcd, keys...)).To(Succeed())
+	_, err = etcd.Server.Compact(context.Background(), &etcdserverpb.CompactionRequest{Revision: etcd.Server.KV().Rev(), Physical: true})
+	g.Expect(err).ToNot(HaveOccurred())
+	return etcds
+}
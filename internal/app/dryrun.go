@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/gardener/etcd-wrapper/internal/brclient"
+	"github.com/gardener/etcd-wrapper/internal/etcdconfig"
+
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.uber.org/zap"
+)
+
+// DryRunReport describes what etcd-wrapper would do when starting etcd.
+type DryRunReport struct {
+	// ValidationMode is the validation mode with which the initialization would be triggered.
+	ValidationMode brclient.ValidationType `json:"validationMode"`
+	// ValidationReason explains why ValidationMode has been chosen.
+	ValidationReason brclient.ValidationReason `json:"validationReason"`
+	// EtcdConfigSource is where the etcd configuration has been read from.
+	EtcdConfigSource string `json:"etcdConfigSource"`
+	// EtcdConfig is the effective etcd configuration with all etcd-wrapper flags applied and sensitive values redacted.
+	EtcdConfig map[string]any `json:"etcdConfig"`
+}
+
+// DryRun determines the validation mode and the effective etcd configuration without triggering an initialization
+// or starting etcd. If etcdConfigFilePath is set, the etcd configuration is read from that file instead of being
+// fetched from backup-restore.
+func (a *Application) DryRun(etcdConfigFilePath string) (report *DryRunReport, err error) {
+	defer func() { a.endBootstrapSpan(err) }()
+
+	validationMode, reason := a.etcdInitializer.DetermineValidationMode()
+	report = &DryRunReport{
+		ValidationMode:   validationMode,
+		ValidationReason: reason,
+	}
+	var cfg *embed.Config
+	if etcdConfigFilePath != "" {
+		a.logger.Info("Dry run: reading etcd configuration from file", zap.String("path", etcdConfigFilePath))
+		report.EtcdConfigSource = etcdConfigFilePath
+		cfg, err = etcdconfig.LoadConfig(etcdConfigFilePath, a.Config.EtcdConfigOverrides, a.logger)
+	} else {
+		a.logger.Info("Dry run: fetching etcd configuration from backup-restore", zap.String("hostPort", a.Config.BackupRestore.HostPort))
+		report.EtcdConfigSource = fmt.Sprintf("backup-restore (%s)", a.Config.BackupRestore.HostPort)
+		cfg, err = a.etcdInitializer.GetEtcdConfig(a.bootstrapCtx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load etcd configuration from %s: %w", report.EtcdConfigSource, err)
+	}
+	a.cfg = cfg
+	a.applyWrapperConfig()
+	report.EtcdConfig = etcdconfig.EffectiveConfig(a.cfg)
+	return report, nil
+}
@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/testutil"
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap/zaptest"
+)
+
+const dryRunEtcdConfig = `name: {{ .Name }}
+data-dir: /var/etcd/data/new.etcd
+listen-client-urls: http://127.0.0.1:2379
+advertise-client-urls: http://127.0.0.1:2379
+listen-peer-urls: http://127.0.0.1:2380
+initial-advertise-peer-urls: http://127.0.0.1:2380
+initial-cluster: {{ .Name }}=http://127.0.0.1:2380
+initial-cluster-token: secret-token
+`
+
+func TestDryRun(t *testing.T) {
+	g := NewWithT(t)
+	// the etcd configuration fetched from backup-restore is written to the home directory
+	t.Setenv("HOME", t.TempDir())
+	fakeBR, err := testutil.NewFakeBackupRestore(testutil.WithEtcdConfigTemplate(dryRunEtcdConfig, map[string]string{"Name": "etcd-from-br"}))
+	g.Expect(err).ToNot(HaveOccurred())
+	defer fakeBR.Close()
+	etcdConfigFilePath := filepath.Join(t.TempDir(), "etcd.conf.yaml")
+	g.Expect(os.WriteFile(etcdConfigFilePath, []byte(`name: etcd-from-file
+initial-cluster: etcd-from-file=http://localhost:2380
+`), 0600)).To(Succeed())
+
+	table := []struct {
+		description        string
+		etcdConfigFilePath string
+		expectedName       string
+		expectedSource     string
+	}{
+		{"should fetch the etcd configuration from backup-restore", "", "etcd-from-br", "backup-restore (" + fakeBR.HostPort() + ")"},
+		{"should read the etcd configuration from the passed file", etcdConfigFilePath, "etcd-from-file", etcdConfigFilePath},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		config := types.Config{
+			BackupRestore: types.BackupRestoreConfig{HostPort: fakeBR.HostPort()},
+			Tracing:       types.TracingConfig{EtcdTracingEnabled: true, Endpoint: "collector:4317", SamplingRatePerMillion: 100},
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		app, err := NewApplication(ctx, cancel, config, time.Minute, zaptest.NewLogger(t))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		report, err := app.DryRun(entry.etcdConfigFilePath)
+		cancel()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(report.ValidationMode).ToNot(BeEmpty())
+		g.Expect(report.ValidationReason.Description).ToNot(BeEmpty())
+		g.Expect(report.EtcdConfigSource).To(Equal(entry.expectedSource))
+		g.Expect(report.EtcdConfig).To(HaveKeyWithValue("name", entry.expectedName))
+		// flags of etcd-wrapper are applied
+		g.Expect(report.EtcdConfig).To(HaveKeyWithValue("experimental-distributed-tracing-address", "collector:4317"))
+		g.Expect(report.EtcdConfig).To(HaveKeyWithValue("initial-cluster-token", types.RedactedValue))
+		// a dry run never triggers an initialization
+		g.Expect(fakeBR.InitializationRequests()).To(BeEmpty())
+	}
+}
+
+func TestDryRunFailsForMissingEtcdConfigFile(t *testing.T) {
+	g := NewWithT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app, err := NewApplication(ctx, cancel, types.Config{BackupRestore: types.BackupRestoreConfig{HostPort: ":2379"}}, time.Minute, zaptest.NewLogger(t))
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = app.DryRun(filepath.Join(t.TempDir(), "missing.yaml"))
+	g.Expect(err).To(HaveOccurred())
+}
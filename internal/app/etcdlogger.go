@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/types"
+	"github.com/gardener/etcd-wrapper/internal/version"
+
+	"go.etcd.io/etcd/client/pkg/v3/logutil"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// noisyMessageSamplingTick is the interval within which repeated noisy messages are sampled.
+	noisyMessageSamplingTick = 10 * time.Second
+	// noisyMessageSamplingFirst is the number of identical noisy messages logged per tick before sampling kicks in.
+	noisyMessageSamplingFirst = 5
+	// noisyMessageSamplingThereafter is the rate at which identical noisy messages are logged once sampling kicks in.
+	noisyMessageSamplingThereafter = 100
+)
+
+// noisyEtcdMessages are messages logged by the embedded etcd which can be repeated many times per second
+// when the member is under pressure (slow disk, slow network, unreachable peers).
+var noisyEtcdMessages = map[string]struct{}{
+	"apply request took too long":                            {},
+	"slow fdatasync":                                         {},
+	"waiting for ReadIndex response took too long, retrying": {},
+	"leader failed to send out heartbeat on time; took too long, leader is overloaded likely from slow disk": {},
+	"lost TCP streaming connection with remote peer":                                                         {},
+	"prober detected unhealthy status":                                                                       {},
+	"rejected connection on client endpoint":                                                                 {},
+	"rejected connection on peer endpoint":                                                                   {},
+}
+
+// etcdTLSInfoKeyFilesPattern matches the paths of the key files in the string representation of the TLS info logged
+// by etcd, e.g. "cert = /tls.crt, key = /tls.key, client-cert=, client-key=, ...".
+var etcdTLSInfoKeyFilesPattern = regexp.MustCompile(`(^|, )(key = |client-key=)[^,]*`)
+
+// configureEtcdLogger sets up the embedded etcd to log through the etcd-wrapper logger if it has been enabled.
+// All entries logged by etcd carry the member name, the etcd-wrapper version and, once etcd has started, the
+// cluster ID. Known noisy messages are sampled and the values of sensitive fields are redacted.
+func (a *Application) configureEtcdLogger() {
+	if !a.Config.EtcdLogger.UseWrapperLogger {
+		return
+	}
+	etcdLogger := a.logger.Named("etcd")
+	// the log level in the etcd configuration can only make the etcd-wrapper logger more restrictive
+	if etcdLogLevel := logutil.ConvertToZapLevel(a.cfg.LogLevel); etcdLogLevel > etcdLogger.Level() {
+		etcdLogger = etcdLogger.WithOptions(zap.IncreaseLevel(etcdLogLevel))
+	}
+	etcdLogger = etcdLogger.
+		WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return newNoisyMessageSamplingCore(newDynamicFieldsCore(newRedactingCore(core), a.etcdClusterIDFields))
+		})).
+		With(
+			zap.String("member-name", a.cfg.Name),
+			zap.String("wrapper-version", version.Version),
+		)
+	a.cfg.ZapLoggerBuilder = embed.NewZapLoggerBuilder(etcdLogger)
+	a.logger.Info("Logs of the embedded etcd will be routed through the etcd-wrapper logger")
+}
+
+// etcdClusterIDFields returns the cluster ID field once it is known, nil otherwise.
+func (a *Application) etcdClusterIDFields() []zapcore.Field {
+	clusterID := a.etcdClusterID.Load()
+	if clusterID == nil {
+		return nil
+	}
+	return []zapcore.Field{zap.String("cluster-id", *clusterID)}
+}
+
+// recordEtcdClusterID records the ID of the cluster the embedded etcd has joined.
+func (a *Application) recordEtcdClusterID(etcd *embed.Etcd) {
+	clusterID := etcd.Server.Cluster().ID().String()
+	a.etcdClusterID.Store(&clusterID)
+}
+
+// dynamicFieldsCore is a zapcore.Core which appends fields to every entry at the time it is written. This is used
+// for fields whose value is only known after the logger has been handed over, like the etcd cluster ID.
+type dynamicFieldsCore struct {
+	zapcore.Core
+	fieldsFn func() []zapcore.Field
+}
+
+func newDynamicFieldsCore(core zapcore.Core, fieldsFn func() []zapcore.Field) zapcore.Core {
+	return &dynamicFieldsCore{Core: core, fieldsFn: fieldsFn}
+}
+
+func (c *dynamicFieldsCore) With(fields []zapcore.Field) zapcore.Core {
+	return &dynamicFieldsCore{Core: c.Core.With(fields), fieldsFn: c.fieldsFn}
+}
+
+func (c *dynamicFieldsCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *dynamicFieldsCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	dynamicFields := c.fieldsFn()
+	if len(dynamicFields) == 0 {
+		return c.Core.Write(ent, fields)
+	}
+	// full slice expression to never write into the backing array of the caller
+	return c.Core.Write(ent, append(fields[:len(fields):len(fields)], dynamicFields...))
+}
+
+// redactingCore is a zapcore.Core which redacts the values of the fields logged by etcd which hold sensitive etcd
+// configuration fields, like the initial cluster token, and the key files in the TLS info logged by etcd.
+type redactingCore struct {
+	zapcore.Core
+}
+
+func newRedactingCore(core zapcore.Core) zapcore.Core {
+	return &redactingCore{Core: core}
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(redactEtcdLogFields(fields))}
+}
+
+func (c *redactingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, redactEtcdLogFields(fields))
+}
+
+// redactEtcdLogFields returns the fields with sensitive values redacted. The passed fields are never changed.
+func redactEtcdLogFields(fields []zapcore.Field) []zapcore.Field {
+	var redacted []zapcore.Field
+	for i, field := range fields {
+		if field.Type != zapcore.StringType || field.String == "" {
+			continue
+		}
+		value := field.String
+		switch {
+		case types.IsSensitiveEtcdConfigKey(field.Key):
+			value = types.RedactedValue
+		case field.Key == "tls-info":
+			value = etcdTLSInfoKeyFilesPattern.ReplaceAllString(value, "${1}${2}"+types.RedactedValue)
+		default:
+			continue
+		}
+		if redacted == nil {
+			redacted = append([]zapcore.Field{}, fields...)
+		}
+		redacted[i] = zap.String(field.Key, value)
+	}
+	if redacted == nil {
+		return fields
+	}
+	return redacted
+}
+
+// noisyMessageSamplingCore is a zapcore.Core which samples entries with a message in noisyEtcdMessages and passes
+// through all other entries unchanged.
+type noisyMessageSamplingCore struct {
+	zapcore.Core
+	sampled zapcore.Core
+}
+
+func newNoisyMessageSamplingCore(core zapcore.Core) zapcore.Core {
+	return &noisyMessageSamplingCore{
+		Core:    core,
+		sampled: zapcore.NewSamplerWithOptions(core, noisyMessageSamplingTick, noisyMessageSamplingFirst, noisyMessageSamplingThereafter),
+	}
+}
+
+func (c *noisyMessageSamplingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &noisyMessageSamplingCore{Core: c.Core.With(fields), sampled: c.sampled.With(fields)}
+}
+
+func (c *noisyMessageSamplingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if _, ok := noisyEtcdMessages[ent.Message]; ok {
+		return c.sampled.Check(ent, ce)
+	}
+	return c.Core.Check(ent, ce)
+}
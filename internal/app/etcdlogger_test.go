@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestConfigureEtcdLogger(t *testing.T) {
+	table := []struct {
+		description          string
+		useWrapperLogger     bool
+		expectLoggerBuilder  bool
+		expectedMemberName   string
+		expectedEntriesCount int
+	}{
+		{"should not replace the etcd logger when not enabled", false, false, "", 0},
+		{"should route etcd logs through the wrapper logger when enabled", true, true, "etcd-main-0", 1},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.description, func(t *testing.T) {
+			g := NewWithT(t)
+			core, logs := observer.New(zapcore.InfoLevel)
+			ctx, cancel := context.WithCancel(context.Background())
+			app := createApplicationInstance(ctx, cancel, g)
+			defer app.Close()
+			app.logger = zap.New(core)
+			app.Config.EtcdLogger.UseWrapperLogger = entry.useWrapperLogger
+			app.cfg = embed.NewConfig()
+			app.cfg.Name = "etcd-main-0"
+
+			app.configureEtcdLogger()
+			g.Expect(app.cfg.ZapLoggerBuilder != nil).To(Equal(entry.expectLoggerBuilder))
+			if !entry.expectLoggerBuilder {
+				return
+			}
+			g.Expect(app.cfg.ZapLoggerBuilder(app.cfg)).To(Succeed())
+			clusterID := "cdf818194e3a8c32"
+			app.etcdClusterID.Store(&clusterID)
+			app.cfg.GetLogger().Info("etcd log entry", zap.String("initial-cluster-token", "etcd-cluster-secret"))
+
+			etcdLogs := logs.FilterMessage("etcd log entry").All()
+			g.Expect(etcdLogs).To(HaveLen(entry.expectedEntriesCount))
+			g.Expect(etcdLogs[0].LoggerName).To(Equal("etcd"))
+			g.Expect(etcdLogs[0].ContextMap()).To(HaveKeyWithValue("member-name", entry.expectedMemberName))
+			g.Expect(etcdLogs[0].ContextMap()).To(HaveKeyWithValue("cluster-id", clusterID))
+			g.Expect(etcdLogs[0].ContextMap()).To(HaveKey("wrapper-version"))
+			g.Expect(etcdLogs[0].ContextMap()).To(HaveKeyWithValue("initial-cluster-token", types.RedactedValue))
+		})
+	}
+}
+
+func TestDynamicFieldsCore(t *testing.T) {
+	g := NewWithT(t)
+	var dynamicFields []zapcore.Field
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(newDynamicFieldsCore(core, func() []zapcore.Field { return dynamicFields }))
+
+	logger.Info("before", zap.String("static", "value"))
+	dynamicFields = []zapcore.Field{zap.String("dynamic", "value")}
+	logger.Info("after", zap.String("static", "value"))
+	logger.Debug("filtered")
+
+	g.Expect(logs.Len()).To(Equal(2))
+	g.Expect(logs.All()[0].ContextMap()).ToNot(HaveKey("dynamic"))
+	g.Expect(logs.All()[1].ContextMap()).To(HaveKeyWithValue("dynamic", "value"))
+	g.Expect(logs.All()[1].ContextMap()).To(HaveKeyWithValue("static", "value"))
+}
+
+func TestRedactingCore(t *testing.T) {
+	table := []struct {
+		description   string
+		field         zapcore.Field
+		expectedValue any
+	}{
+		{"should redact the initial cluster token", zap.String("initial-cluster-token", "etcd-cluster-secret"), types.RedactedValue},
+		{"should redact the auth token", zap.String("auth-token", "jwt,priv-key=jwt.key"), types.RedactedValue},
+		{"should redact the key files in the TLS info", zap.String("tls-info", "cert = /tls.crt, key = /tls.key, client-cert=, client-key=/client.key, trusted-ca = /ca.crt, client-cert-auth = true, crl-file = "),
+			"cert = /tls.crt, key = " + types.RedactedValue + ", client-cert=, client-key=" + types.RedactedValue + ", trusted-ca = /ca.crt, client-cert-auth = true, crl-file = "},
+		{"should keep an empty initial cluster token", zap.String("initial-cluster-token", ""), ""},
+		{"should keep fields which are not sensitive", zap.String("initial-cluster-state", "new"), "new"},
+		{"should keep fields which are not strings", zap.Int64("quota-backend-bytes", 8589934592), int64(8589934592)},
+	}
+
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		core, logs := observer.New(zapcore.InfoLevel)
+		fields := []zapcore.Field{entry.field}
+		zap.New(newRedactingCore(core)).Info("starting an etcd server", fields...)
+		zap.New(newRedactingCore(core)).With(fields...).Info("with fields")
+		g.Expect(logs.Len()).To(Equal(2))
+		for _, log := range logs.All() {
+			g.Expect(log.ContextMap()).To(HaveKeyWithValue(entry.field.Key, entry.expectedValue))
+		}
+		// the fields of the caller are not changed
+		g.Expect(fields[0]).To(Equal(entry.field))
+	}
+}
+
+func TestNoisyMessageSamplingCore(t *testing.T) {
+	table := []struct {
+		description   string
+		message       string
+		logCount      int
+		expectedCount int
+	}{
+		{"should sample known noisy messages", "slow fdatasync", 20, noisyMessageSamplingFirst},
+		{"should not sample other messages", "added member", 20, 20},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.description, func(t *testing.T) {
+			g := NewWithT(t)
+			core, logs := observer.New(zapcore.InfoLevel)
+			logger := zap.New(newNoisyMessageSamplingCore(core)).With(zap.String("member-name", "etcd-main-0"))
+			for i := 0; i < entry.logCount; i++ {
+				logger.Warn(entry.message)
+			}
+			g.Expect(logs.FilterMessage(entry.message).Len()).To(Equal(entry.expectedCount))
+		})
+	}
+}
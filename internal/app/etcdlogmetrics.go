@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/metrics"
+
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// etcdWarning describes a performance warning which etcd only reports as a log message.
+type etcdWarning struct {
+	// name is the value of the metrics.LabelWarning label.
+	name string
+	// durationField is the name of the field carrying the duration reported in the message, if any.
+	durationField string
+}
+
+// etcdWarnings maps the messages logged by the embedded etcd to the warnings they report.
+var etcdWarnings = map[string]etcdWarning{
+	"apply request took too long": {name: "slow_apply", durationField: "took"},
+	"slow fdatasync":              {name: "slow_fdatasync", durationField: "took"},
+	"leader failed to send out heartbeat on time; took too long, leader is overloaded likely from slow disk": {name: "slow_heartbeat", durationField: "exceeded-duration"},
+	"waiting for ReadIndex response took too long, retrying":                                                 {name: "slow_read_index"},
+}
+
+// registerEtcdWarningMetrics hooks into the logger of the embedded etcd and records metrics for every
+// performance warning in etcdWarnings that it logs.
+func (a *Application) registerEtcdWarningMetrics() {
+	buildLogger := a.cfg.ZapLoggerBuilder
+	if buildLogger == nil {
+		// embed.ConfigFromFile always sets up a builder, this only guards against a config which was never validated
+		buildLogger = embed.NewZapLoggerBuilder(a.logger.Named("etcd"))
+	}
+	a.cfg.ZapLoggerBuilder = func(cfg *embed.Config) error {
+		if err := buildLogger(cfg); err != nil {
+			return err
+		}
+		etcdLogger := cfg.GetLogger().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(core, etcdWarningMetricsCore{})
+		}))
+		return embed.NewZapLoggerBuilder(etcdLogger)(cfg)
+	}
+}
+
+// etcdWarningMetricsCore is a zapcore.Core which does not write any entries, but records metrics for the
+// messages in etcdWarnings.
+type etcdWarningMetricsCore struct{}
+
+func (c etcdWarningMetricsCore) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.WarnLevel
+}
+
+func (c etcdWarningMetricsCore) With(_ []zapcore.Field) zapcore.Core {
+	return c
+}
+
+func (c etcdWarningMetricsCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if _, ok := etcdWarnings[ent.Message]; ok && c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c etcdWarningMetricsCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	warning, ok := etcdWarnings[ent.Message]
+	if !ok {
+		return nil
+	}
+	metrics.EtcdWarningsTotal.WithLabelValues(warning.name).Inc()
+	if warning.durationField == "" {
+		return nil
+	}
+	for _, field := range fields {
+		if field.Key == warning.durationField && field.Type == zapcore.DurationType {
+			metrics.EtcdWarningDurationSeconds.WithLabelValues(warning.name).Observe(time.Duration(field.Integer).Seconds())
+			break
+		}
+	}
+	return nil
+}
+
+func (c etcdWarningMetricsCore) Sync() error {
+	return nil
+}
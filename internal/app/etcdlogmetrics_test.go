@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestEtcdWarningMetricsCore(t *testing.T) {
+	table := []struct {
+		description              string
+		level                    zapcore.Level
+		message                  string
+		fields                   []zapcore.Field
+		warning                  string
+		expectedCountIncrement   float64
+		expectedSamplesIncrement int
+	}{
+		{"should count slow applies and observe their duration", zapcore.WarnLevel, "apply request took too long",
+			[]zapcore.Field{zap.Duration("took", 300*time.Millisecond), zap.Duration("expected-duration", 100*time.Millisecond)}, "slow_apply", 1, 1},
+		{"should count slow fdatasyncs and observe their duration", zapcore.WarnLevel, "slow fdatasync",
+			[]zapcore.Field{zap.Duration("took", 2*time.Second), zap.Duration("expected-duration", time.Second)}, "slow_fdatasync", 1, 1},
+		{"should count late heartbeats and observe the exceeded duration", zapcore.WarnLevel, "leader failed to send out heartbeat on time; took too long, leader is overloaded likely from slow disk",
+			[]zapcore.Field{zap.Duration("exceeded-duration", 50*time.Millisecond)}, "slow_heartbeat", 1, 1},
+		{"should only count slow read index requests", zapcore.WarnLevel, "waiting for ReadIndex response took too long, retrying",
+			[]zapcore.Field{zap.Duration("retry-timeout", 500*time.Millisecond)}, "slow_read_index", 1, 0},
+		{"should ignore known messages below warn level", zapcore.InfoLevel, "slow fdatasync",
+			[]zapcore.Field{zap.Duration("took", 2*time.Second)}, "slow_fdatasync", 0, 0},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.description, func(t *testing.T) {
+			g := NewWithT(t)
+			core, logs := observer.New(zapcore.InfoLevel)
+			logger := zap.New(zapcore.NewTee(core, etcdWarningMetricsCore{}))
+			count := testutil.ToFloat64(metrics.EtcdWarningsTotal.WithLabelValues(entry.warning))
+			samples := warningDurationSampleCount(g, entry.warning)
+
+			if ce := logger.Check(entry.level, entry.message); ce != nil {
+				ce.Write(entry.fields...)
+			}
+
+			g.Expect(logs.Len()).To(Equal(1))
+			g.Expect(testutil.ToFloat64(metrics.EtcdWarningsTotal.WithLabelValues(entry.warning))).To(Equal(count + entry.expectedCountIncrement))
+			g.Expect(warningDurationSampleCount(g, entry.warning)).To(Equal(samples + uint64(entry.expectedSamplesIncrement)))
+		})
+	}
+}
+
+func TestRegisterEtcdWarningMetrics(t *testing.T) {
+	g := NewWithT(t)
+	core, logs := observer.New(zapcore.InfoLevel)
+	ctx, cancel := context.WithCancel(context.Background())
+	app := createApplicationInstance(ctx, cancel, g)
+	defer app.Close()
+	app.cfg = embed.NewConfig()
+	app.cfg.ZapLoggerBuilder = embed.NewZapLoggerBuilder(zap.New(core))
+	count := testutil.ToFloat64(metrics.EtcdWarningsTotal.WithLabelValues("slow_fdatasync"))
+
+	app.registerEtcdWarningMetrics()
+	g.Expect(app.cfg.ZapLoggerBuilder(app.cfg)).To(Succeed())
+	app.cfg.GetLogger().Warn("slow fdatasync", zap.Duration("took", 2*time.Second))
+
+	g.Expect(logs.FilterMessage("slow fdatasync").Len()).To(Equal(1))
+	g.Expect(testutil.ToFloat64(metrics.EtcdWarningsTotal.WithLabelValues("slow_fdatasync"))).To(Equal(count + 1))
+}
+
+func warningDurationSampleCount(g *WithT, warning string) uint64 {
+	m := &dto.Metric{}
+	g.Expect(metrics.EtcdWarningDurationSeconds.WithLabelValues(warning).(prometheus.Metric).Write(m)).To(Succeed())
+	return m.GetHistogram().GetSampleCount()
+}
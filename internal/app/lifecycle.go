@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/brclient"
+
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.uber.org/zap"
+)
+
+const (
+	// lifecycleEventQueueSize is the number of notifications which can be pending before further ones are dropped.
+	lifecycleEventQueueSize = 16
+	// lifecycleEventTimeout is the timeout for sending a single notification to backup-restore.
+	lifecycleEventTimeout = 5 * time.Second
+	// lifecycleNotifierStopTimeout is the maximum time to wait for pending notifications when etcd is about to stop.
+	lifecycleNotifierStopTimeout = 3 * time.Second
+)
+
+// lifecycleNotification is a pending notification of backup-restore about a lifecycle event of the embedded etcd.
+type lifecycleNotification struct {
+	event brclient.LifecycleEvent
+	send  func(ctx context.Context) error
+}
+
+// lifecycleNotifier notifies backup-restore about lifecycle events of the embedded etcd on a best-effort basis.
+// Notifications are sent in order by a single goroutine, so that a slow or unavailable backup-restore never blocks
+// etcd. Notifications which can not be queued are dropped.
+type lifecycleNotifier struct {
+	brClient      brclient.BackupRestoreClient
+	logger        *zap.Logger
+	notifications chan lifecycleNotification
+	done          chan struct{}
+	mu            sync.Mutex
+	stopped       bool
+}
+
+func newLifecycleNotifier(brClient brclient.BackupRestoreClient, logger *zap.Logger) *lifecycleNotifier {
+	n := &lifecycleNotifier{
+		brClient:      brClient,
+		logger:        logger,
+		notifications: make(chan lifecycleNotification, lifecycleEventQueueSize),
+		done:          make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+func (n *lifecycleNotifier) run() {
+	defer close(n.done)
+	for notification := range n.notifications {
+		ctx, cancel := context.WithTimeout(context.Background(), lifecycleEventTimeout)
+		if err := notification.send(ctx); err != nil {
+			n.logger.Warn("failed to notify backup-restore about lifecycle event", zap.String("event", string(notification.event)), zap.Error(err))
+		}
+		cancel()
+	}
+}
+
+// notifyEtcdReady queues a notification that etcd is ready.
+func (n *lifecycleNotifier) notifyEtcdReady() {
+	n.enqueue(brclient.EtcdReady, n.brClient.NotifyEtcdReady)
+}
+
+// notifyLeadershipChanged queues a notification that etcd has gained or lost leadership.
+func (n *lifecycleNotifier) notifyLeadershipChanged(isLeader bool) {
+	event := brclient.LeadershipLost
+	if isLeader {
+		event = brclient.LeadershipGained
+	}
+	n.enqueue(event, func(ctx context.Context) error {
+		return n.brClient.NotifyLeadershipChanged(ctx, isLeader)
+	})
+}
+
+// stop queues a notification that etcd is about to stop for the given reason, and waits for at most timeout for
+// all pending notifications to be sent. No notifications are sent after stop has been called.
+func (n *lifecycleNotifier) stop(reason string, timeout time.Duration) {
+	n.enqueue(brclient.EtcdStopping, func(ctx context.Context) error {
+		return n.brClient.NotifyEtcdStopping(ctx, reason)
+	})
+	n.mu.Lock()
+	if !n.stopped {
+		n.stopped = true
+		close(n.notifications)
+	}
+	n.mu.Unlock()
+	select {
+	case <-n.done:
+	case <-time.After(timeout):
+		n.logger.Warn("timed out waiting for pending lifecycle event notifications to be sent to backup-restore")
+	}
+}
+
+func (n *lifecycleNotifier) enqueue(event brclient.LifecycleEvent, send func(ctx context.Context) error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped {
+		return
+	}
+	select {
+	case n.notifications <- lifecycleNotification{event: event, send: send}:
+	default:
+		n.logger.Warn("dropping lifecycle event notification for backup-restore, too many notifications are pending", zap.String("event", string(event)))
+	}
+}
+
+// watchLeadership notifies backup-restore whenever the embedded etcd gains or loses leadership, until the
+// application context is cancelled or etcd stops.
+func (a *Application) watchLeadership(etcd *embed.Etcd) {
+	isLeader := false
+	for {
+		// the channel has to be obtained before checking the leader, to not miss a change in between
+		leaderChanged := etcd.Server.LeaderChangedNotify()
+		if nowLeader := etcd.Server.Leader() == etcd.Server.ID(); nowLeader != isLeader {
+			isLeader = nowLeader
+			a.logger.Info("Leadership of etcd changed", zap.Bool("isLeader", isLeader))
+			a.lifecycleNotifier.notifyLeadershipChanged(isLeader)
+		}
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-etcd.Server.StopNotify():
+			return
+		case <-leaderChanged:
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/brclient"
+	"github.com/gardener/etcd-wrapper/internal/testutil"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestLifecycleNotifier(t *testing.T) {
+	expectedEvents := []testutil.FakeLifecycleEvent{
+		{Event: string(brclient.EtcdReady)},
+		{Event: string(brclient.LeadershipGained)},
+		{Event: string(brclient.LeadershipLost)},
+		{Event: string(brclient.EtcdStopping), Reason: "etcd server has been aborted"},
+	}
+	table := []struct {
+		description   string
+		latency       time.Duration
+		stopTimeout   time.Duration
+		expectAllSent bool
+	}{
+		{"should send all notifications in order before stopping", 0, time.Minute, true},
+		{"should not wait longer than the stop timeout for a slow backup-restore", 500 * time.Millisecond, 100 * time.Millisecond, false},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		fakeBR, err := testutil.NewFakeBackupRestore(testutil.WithCapabilities(brclient.CapabilityLifecycleEvents), testutil.WithLatency(entry.latency))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		n := newLifecycleNotifier(brclient.NewClient(&http.Client{}, fakeBR.URL(), ""), zaptest.NewLogger(t))
+		start := time.Now()
+		n.notifyEtcdReady()
+		n.notifyLeadershipChanged(true)
+		n.notifyLeadershipChanged(false)
+		n.stop("etcd server has been aborted", entry.stopTimeout)
+		g.Expect(time.Since(start)).To(BeNumerically("<", entry.latency+entry.stopTimeout))
+		if entry.expectAllSent {
+			g.Expect(fakeBR.LifecycleEvents()).To(Equal(expectedEvents))
+		} else {
+			g.Expect(len(fakeBR.LifecycleEvents())).To(BeNumerically("<", len(expectedEvents)))
+		}
+
+		// pending notifications are still sent, but notifications after stop are ignored
+		n.notifyEtcdReady()
+		<-n.done
+		g.Expect(fakeBR.LifecycleEvents()).To(Equal(expectedEvents))
+		fakeBR.Close()
+	}
+}
+
+func TestLifecycleNotifierDropsNotificationsWhenQueueIsFull(t *testing.T) {
+	g := NewWithT(t)
+	fakeBR, err := testutil.NewFakeBackupRestore(testutil.WithCapabilities(brclient.CapabilityLifecycleEvents), testutil.WithLatency(10*time.Millisecond))
+	g.Expect(err).ToNot(HaveOccurred())
+	defer fakeBR.Close()
+
+	n := newLifecycleNotifier(brclient.NewClient(&http.Client{}, fakeBR.URL(), ""), zaptest.NewLogger(t))
+	start := time.Now()
+	for i := 0; i < 2*lifecycleEventQueueSize; i++ {
+		n.notifyLeadershipChanged(i%2 == 0)
+	}
+	g.Expect(time.Since(start)).To(BeNumerically("<", 10*time.Millisecond))
+	n.stop("etcd-wrapper is exiting", time.Minute)
+	// at most one notification has been taken off the queue while it was filled
+	g.Expect(len(fakeBR.LifecycleEvents())).To(BeNumerically("<=", lifecycleEventQueueSize+1))
+}
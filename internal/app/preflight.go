@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+	"github.com/gardener/etcd-wrapper/internal/metrics"
+	"github.com/gardener/etcd-wrapper/internal/tracing"
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// runPreflightChecks checks the directories of etcd before it is started, logs the results and records them as
+// metrics. In the fatal mode, an error is returned if any check failed.
+func (a *Application) runPreflightChecks() (err error) {
+	if a.Config.Preflight.Mode == types.PreflightModeDisabled {
+		a.logger.Info("Pre-flight checks of the data directory are disabled")
+		return nil
+	}
+	_, span := tracing.Tracer().Start(a.bootstrapCtx, "PreflightChecks")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	results := datadir.RunPreflightChecks(datadir.PreflightOptions{
+		DataDir:           a.cfg.Dir,
+		WALDir:            a.cfg.WalDir,
+		QuotaBackendBytes: a.cfg.QuotaBackendBytes,
+	})
+	for _, result := range results {
+		recordPreflightCheckResult(result)
+		fields := []zap.Field{zap.String("check", result.Name), zap.String("dir", result.Dir), zap.String("path", result.Path), zap.String("message", result.Message)}
+		switch result.Status {
+		case datadir.CheckFailed:
+			a.logger.Error("Pre-flight check failed", fields...)
+		case datadir.CheckWarning:
+			a.logger.Warn("Pre-flight check reported a warning", fields...)
+		default:
+			a.logger.Info("Pre-flight check passed", fields...)
+		}
+	}
+	failed := datadir.HasFailures(results)
+	span.SetAttributes(attribute.Bool("failed", failed))
+	if failed && a.Config.Preflight.Mode == types.PreflightModeFatal {
+		return fmt.Errorf("pre-flight checks of the data directory %s failed, not starting etcd", a.cfg.Dir)
+	}
+	return nil
+}
+
+// recordPreflightCheckResult exports the result of a pre-flight check as metrics.
+func recordPreflightCheckResult(result datadir.CheckResult) {
+	for _, status := range []datadir.CheckStatus{datadir.CheckPassed, datadir.CheckWarning, datadir.CheckFailed} {
+		value := 0.0
+		if status == result.Status {
+			value = 1
+		}
+		metrics.PreflightCheckStatus.WithLabelValues(result.Name, result.Dir, string(status)).Set(value)
+	}
+	switch result.Name {
+	case datadir.CheckFreeSpace:
+		metrics.PreflightFreeBytes.WithLabelValues(result.Dir).Set(result.Value)
+	case datadir.CheckFsyncLatency:
+		metrics.PreflightFsyncLatencySeconds.WithLabelValues(result.Dir).Set(result.Value)
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+	"github.com/gardener/etcd-wrapper/internal/metrics"
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+func TestRunPreflightChecks(t *testing.T) {
+	dir := t.TempDir()
+	notADir := filepath.Join(dir, "not-a-dir")
+	g := NewWithT(t)
+	g.Expect(os.WriteFile(notADir, []byte("etcd"), 0600)).To(Succeed())
+
+	table := []struct {
+		description     string
+		mode            types.PreflightMode
+		dataDir         string
+		expectError     bool
+		expectedRecords bool
+	}{
+		{"should not run any checks in disabled mode", types.PreflightModeDisabled, notADir, false, false},
+		{"should not return an error for failed checks in warn mode", types.PreflightModeWarn, notADir, false, true},
+		{"should return an error for failed checks in fatal mode", types.PreflightModeFatal, notADir, true, true},
+		{"should not return an error for passed checks in fatal mode", types.PreflightModeFatal, filepath.Join(dir, "data"), false, true},
+	}
+	for _, entry := range table {
+		t.Run(entry.description, func(t *testing.T) {
+			g := NewWithT(t)
+			metrics.PreflightCheckStatus.Reset()
+			ctx, cancel := context.WithCancel(context.Background())
+			app := createApplicationInstance(ctx, cancel, g)
+			defer app.Close()
+			app.Config.Preflight.Mode = entry.mode
+			app.cfg = embed.NewConfig()
+			app.cfg.Dir = entry.dataDir
+
+			err := app.runPreflightChecks()
+			g.Expect(err != nil).To(Equal(entry.expectError))
+			if !entry.expectedRecords {
+				g.Expect(testutil.CollectAndCount(metrics.PreflightCheckStatus)).To(BeZero())
+				return
+			}
+			expectedOwnershipStatus := datadir.CheckPassed
+			if entry.dataDir == notADir {
+				expectedOwnershipStatus = datadir.CheckFailed
+			}
+			g.Expect(testutil.ToFloat64(metrics.PreflightCheckStatus.WithLabelValues(datadir.CheckOwnership, datadir.DirData, string(expectedOwnershipStatus)))).To(Equal(1.0))
+			g.Expect(testutil.ToFloat64(metrics.PreflightCheckStatus.WithLabelValues(datadir.CheckOwnership, datadir.DirData, string(datadir.CheckWarning)))).To(Equal(0.0))
+		})
+	}
+}
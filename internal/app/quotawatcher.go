@@ -0,0 +1,230 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/metrics"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.etcd.io/etcd/server/v3/etcdserver"
+	"go.etcd.io/etcd/server/v3/mvcc"
+	"go.uber.org/zap"
+)
+
+const (
+	// quotaGrowthWindow is the window over which the growth rate of the database is measured.
+	quotaGrowthWindow = time.Hour
+	// quotaCompactionTimeout is the time allowed to compact the key space once a warning threshold is exceeded.
+	quotaCompactionTimeout = time.Minute
+)
+
+// quotaSample is a sample of the size of the database.
+type quotaSample struct {
+	at          time.Time
+	dbSize      int64
+	dbSizeInUse int64
+	revision    int64
+}
+
+// quotaStatus is the usage of the backend quota by the database as of the latest sample.
+type quotaStatus struct {
+	// SampledAt is the time of the latest sample.
+	SampledAt time.Time `json:"sampledAt"`
+	// QuotaBytes is the backend quota of etcd.
+	QuotaBytes int64 `json:"quotaBytes"`
+	// DBSizeBytes is the size of the database, which is compared with the quota by etcd.
+	DBSizeBytes int64 `json:"dbSizeBytes"`
+	// DBSizeInUseBytes is the part of the database which is in use, the rest can be reclaimed by a defragmentation.
+	DBSizeInUseBytes int64 `json:"dbSizeInUseBytes"`
+	// UsagePercent is the size of the database in percent of the quota.
+	UsagePercent float64 `json:"usagePercent"`
+	// ExceededThresholdPercent is the highest warning threshold exceeded by the database, 0 if it exceeds none.
+	ExceededThresholdPercent float64 `json:"exceededThresholdPercent,omitempty"`
+	// GrowthRateBytesPerSecond is the growth rate of the database within the growth window, negative if it has shrunk.
+	GrowthRateBytesPerSecond float64 `json:"growthRateBytesPerSecond"`
+	// ProjectedTimeToFullSeconds is the time until the database reaches the quota at its growth rate. It is only
+	// present if the database grows.
+	ProjectedTimeToFullSeconds *float64 `json:"projectedTimeToFullSeconds,omitempty"`
+	// ProjectedFullAt is the time at which the database reaches the quota at its growth rate. It is only present if
+	// the database grows.
+	ProjectedFullAt *time.Time `json:"projectedFullAt,omitempty"`
+}
+
+// quotaWatcher keeps the samples of the size of the database within the growth window.
+type quotaWatcher struct {
+	quota      int64
+	thresholds []float64
+	samples    []quotaSample
+	exceeded   float64
+	// compactionPending is set once a warning threshold has been exceeded, until the key space has been compacted or
+	// the database falls below the thresholds again.
+	compactionPending bool
+}
+
+// newQuotaWatcher creates a quotaWatcher for the passed quota and ascending warning thresholds in percent.
+func newQuotaWatcher(quota int64, thresholds []float64) *quotaWatcher {
+	return &quotaWatcher{quota: quota, thresholds: thresholds}
+}
+
+// observe adds a sample and returns the usage of the quota as of this sample.
+func (w *quotaWatcher) observe(sample quotaSample) *quotaStatus {
+	w.samples = append(w.samples, sample)
+	for len(w.samples) > 1 && sample.at.Sub(w.samples[1].at) >= quotaGrowthWindow {
+		w.samples = w.samples[1:]
+	}
+
+	status := &quotaStatus{
+		SampledAt:        sample.at,
+		QuotaBytes:       w.quota,
+		DBSizeBytes:      sample.dbSize,
+		DBSizeInUseBytes: sample.dbSizeInUse,
+		UsagePercent:     float64(sample.dbSize) / float64(w.quota) * 100,
+	}
+	w.exceeded = 0
+	for _, threshold := range w.thresholds {
+		if status.UsagePercent >= threshold {
+			w.exceeded = threshold
+		}
+	}
+	status.ExceededThresholdPercent = w.exceeded
+
+	oldest := w.samples[0]
+	if elapsed := sample.at.Sub(oldest.at).Seconds(); elapsed > 0 {
+		status.GrowthRateBytesPerSecond = float64(sample.dbSize-oldest.dbSize) / elapsed
+	}
+	if status.GrowthRateBytesPerSecond > 0 {
+		timeToFull := max(0, float64(w.quota-sample.dbSize)/status.GrowthRateBytesPerSecond)
+		fullAt := sample.at.Add(time.Duration(timeToFull * float64(time.Second)))
+		status.ProjectedTimeToFullSeconds = &timeToFull
+		status.ProjectedFullAt = &fullAt
+	}
+	return status
+}
+
+// compactionRevision returns the revision of the oldest sample, which has been taken at least the growth window ago.
+// It returns false if the samples do not span the growth window yet, e.g. right after a restart, as the history
+// within the growth window is kept by a compaction.
+func (w *quotaWatcher) compactionRevision() (int64, bool) {
+	oldest, latest := w.samples[0], w.samples[len(w.samples)-1]
+	if latest.at.Sub(oldest.at) < quotaGrowthWindow {
+		return 0, false
+	}
+	return oldest.revision, true
+}
+
+// watchQuotaPeriodically samples the size of the database in the configured interval, until the application
+// context is cancelled or etcd stops.
+func (a *Application) watchQuotaPeriodically(etcd *embed.Etcd) {
+	quota := a.cfg.QuotaBackendBytes
+	if quota < 0 {
+		a.logger.Info("Backend quota of etcd is disabled, not watching the size of the database")
+		return
+	}
+	if quota == 0 {
+		quota = etcdserver.DefaultQuotaBytes
+	}
+	watcher := newQuotaWatcher(quota, a.Config.QuotaWatcher.WarningThresholds)
+	metrics.QuotaBackendBytes.Set(float64(quota))
+	ticker := time.NewTicker(a.Config.QuotaWatcher.Interval)
+	defer ticker.Stop()
+	for {
+		a.watchQuota(etcd, watcher)
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-etcd.Server.StopNotify():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchQuota samples the size of the database, records the usage of the quota and warns once the database exceeds
+// a higher warning threshold than before.
+func (a *Application) watchQuota(etcd *embed.Etcd, watcher *quotaWatcher) {
+	previous := watcher.exceeded
+	status := watcher.observe(quotaSample{
+		at:          time.Now(),
+		dbSize:      etcd.Server.Backend().Size(),
+		dbSizeInUse: etcd.Server.Backend().SizeInUse(),
+		revision:    etcd.Server.KV().Rev(),
+	})
+	a.quotaStatus.Store(status)
+	recordQuotaStatus(status, watcher.thresholds, previous)
+
+	fields := []zap.Field{zap.Int64("dbSize", status.DBSizeBytes), zap.Int64("dbSizeInUse", status.DBSizeInUseBytes), zap.Int64("quota", status.QuotaBytes), zap.Float64("usagePercent", status.UsagePercent), zap.Float64("growthRateBytesPerSecond", status.GrowthRateBytesPerSecond)}
+	if status.ProjectedFullAt != nil {
+		fields = append(fields, zap.Time("projectedFullAt", *status.ProjectedFullAt))
+	}
+	switch {
+	case status.ExceededThresholdPercent > previous:
+		a.logger.Warn("Size of the database has exceeded a warning threshold of the backend quota", append(fields, zap.Float64("thresholdPercent", status.ExceededThresholdPercent))...)
+		watcher.compactionPending = a.Config.QuotaWatcher.CompactionEnabled
+	case status.ExceededThresholdPercent < previous:
+		a.logger.Info("Size of the database has fallen below a warning threshold of the backend quota", append(fields, zap.Float64("thresholdPercent", previous))...)
+		watcher.compactionPending = watcher.compactionPending && status.ExceededThresholdPercent > 0
+	default:
+		a.logger.Debug("Sampled size of the database", fields...)
+	}
+	if !watcher.compactionPending {
+		return
+	}
+	revision, ok := watcher.compactionRevision()
+	if !ok {
+		a.logger.Debug("Deferring the compaction of the key space until the samples of the size of the database span the growth window", zap.Duration("growthWindow", quotaGrowthWindow))
+		return
+	}
+	a.compactForQuota(etcd, revision)
+	watcher.compactionPending = false
+}
+
+// compactForQuota compacts the key space up to the passed revision if this member is the leader, so that the space
+// of older revisions can be reused. The history within the growth window is kept.
+func (a *Application) compactForQuota(etcd *embed.Etcd, revision int64) {
+	if etcd.Server.Leader() != etcd.Server.ID() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(a.ctx, quotaCompactionTimeout)
+	defer cancel()
+	_, err := etcd.Server.Compact(ctx, &etcdserverpb.CompactionRequest{Revision: revision})
+	switch {
+	case errors.Is(err, mvcc.ErrCompacted):
+		a.logger.Info("Key space has already been compacted beyond the start of the growth window", zap.Int64("revision", revision))
+	case err != nil:
+		a.logger.Error("Cannot compact the key space", zap.Int64("revision", revision), zap.Error(err))
+	default:
+		a.logger.Info("Compacted the key space after a warning threshold of the backend quota was exceeded", zap.Int64("revision", revision))
+	}
+}
+
+// recordQuotaStatus exports the usage of the quota as metrics. A warning is counted for every threshold above the
+// previously exceeded one.
+func recordQuotaStatus(status *quotaStatus, thresholds []float64, previous float64) {
+	metrics.QuotaBackendBytes.Set(float64(status.QuotaBytes))
+	metrics.QuotaUsageRatio.Set(status.UsagePercent / 100)
+	metrics.QuotaGrowthRateBytesPerSecond.Set(status.GrowthRateBytesPerSecond)
+	timeToFull := -1.0
+	if status.ProjectedTimeToFullSeconds != nil {
+		timeToFull = *status.ProjectedTimeToFullSeconds
+	}
+	metrics.QuotaProjectedTimeToFullSeconds.Set(timeToFull)
+	for _, threshold := range thresholds {
+		label := strconv.FormatFloat(threshold, 'f', -1, 64)
+		exceeded := 0.0
+		if threshold <= status.ExceededThresholdPercent {
+			exceeded = 1
+			if threshold > previous {
+				metrics.QuotaWarningsTotal.WithLabelValues(label).Inc()
+			}
+		}
+		metrics.QuotaThresholdExceeded.WithLabelValues(label).Set(exceeded)
+	}
+}
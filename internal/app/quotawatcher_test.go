@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/metrics"
+	etcdtestutil "github.com/gardener/etcd-wrapper/internal/testutil"
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+func TestQuotaWatcherObserve(t *testing.T) {
+	start := time.Date(2024, time.May, 2, 10, 0, 0, 0, time.UTC)
+	sampleAt := func(minutes int, dbSize int64) quotaSample {
+		return quotaSample{at: start.Add(time.Duration(minutes) * time.Minute), dbSize: dbSize}
+	}
+	table := []struct {
+		description        string
+		samples            []quotaSample
+		expectedUsage      float64
+		expectedExceeded   float64
+		expectedGrowthRate float64 // in bytes per second
+		expectedTimeToFull float64 // in seconds, negative if not projected
+	}{
+		{"should not project a single sample", []quotaSample{sampleAt(0, 500)}, 50, 0, 0, -1},
+		{"should report the highest exceeded threshold", []quotaSample{sampleAt(0, 900)}, 90, 85, 0, -1},
+		{"should project a growing database", []quotaSample{sampleAt(0, 400), sampleAt(10, 700)}, 70, 70, 0.5, 600},
+		{"should not project a shrinking database", []quotaSample{sampleAt(0, 700), sampleAt(10, 400)}, 40, 0, -0.5, -1},
+		{"should not project a database of constant size", []quotaSample{sampleAt(0, 400), sampleAt(10, 400)}, 40, 0, 0, -1},
+		{"should project a full database to be full now", []quotaSample{sampleAt(0, 400), sampleAt(10, 1000)}, 100, 95, 1, 0},
+		{"should measure the growth rate within the growth window", []quotaSample{sampleAt(0, 100), sampleAt(30, 400), sampleAt(90, 400), sampleAt(150, 760)}, 76, 70, 0.1, 2400},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		watcher := newQuotaWatcher(1000, types.DefaultQuotaWarningThresholds)
+		var status *quotaStatus
+		for _, sample := range entry.samples {
+			status = watcher.observe(sample)
+		}
+		g.Expect(status.QuotaBytes).To(BeEquivalentTo(1000))
+		g.Expect(status.UsagePercent).To(BeNumerically("~", entry.expectedUsage, 1e-9))
+		g.Expect(status.ExceededThresholdPercent).To(Equal(entry.expectedExceeded))
+		g.Expect(status.GrowthRateBytesPerSecond).To(BeNumerically("~", entry.expectedGrowthRate, 1e-9))
+		if entry.expectedTimeToFull < 0 {
+			g.Expect(status.ProjectedTimeToFullSeconds).To(BeNil())
+			g.Expect(status.ProjectedFullAt).To(BeNil())
+			continue
+		}
+		g.Expect(status.ProjectedTimeToFullSeconds).ToNot(BeNil())
+		g.Expect(*status.ProjectedTimeToFullSeconds).To(BeNumerically("~", entry.expectedTimeToFull, 1e-6))
+		g.Expect(status.ProjectedFullAt.Sub(status.SampledAt).Seconds()).To(BeNumerically("~", entry.expectedTimeToFull, 1e-3))
+	}
+}
+
+func TestWatchQuota(t *testing.T) {
+	table := []struct {
+		description          string
+		quota                int64
+		compactionEnabled    bool
+		sampledBefore        time.Duration // age of the first sample, no sample is taken before if 0
+		expectedWarnings     float64
+		expectedCompactedRev bool
+	}{
+		{"should not warn below the thresholds", 1 << 40, true, quotaGrowthWindow + time.Minute, 0, false},
+		{"should warn once a threshold is exceeded", 1, false, quotaGrowthWindow + time.Minute, 3, false},
+		{"should compact the key space once a threshold is exceeded", 1, true, quotaGrowthWindow + time.Minute, 3, true},
+		{"should not compact the key space before the samples span the growth window", 1, true, time.Minute, 3, false},
+		{"should not compact the key space right after a restart", 1, true, 0, 3, false},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		etcd, err := etcdtestutil.StartEtcd(filepath.Join(t.TempDir(), "data"))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(etcdtestutil.PutKeys(etcd, map[string]string{"/registry/pods/pod-0": "v1"})).To(Succeed())
+		g.Expect(etcdtestutil.PutKeys(etcd, map[string]string{"/registry/pods/pod-0": "v2"})).To(Succeed())
+		ctx, cancel := context.WithCancel(context.Background())
+		app := createApplicationInstance(ctx, cancel, g)
+		app.Config.QuotaWatcher = types.QuotaWatcherConfig{Interval: time.Minute, WarningThresholds: types.DefaultQuotaWarningThresholds, CompactionEnabled: entry.compactionEnabled}
+		metrics.QuotaWarningsTotal.Reset()
+
+		watcher := newQuotaWatcher(entry.quota, app.Config.QuotaWatcher.WarningThresholds)
+		if entry.sampledBefore > 0 {
+			// the first sample is the start of the growth window, the key space is compacted up to its revision
+			watcher.samples = []quotaSample{{at: time.Now().Add(-entry.sampledBefore), revision: etcd.Server.KV().Rev() - 1}}
+		}
+		app.watchQuota(etcd, watcher)
+		app.watchQuota(etcd, watcher)
+
+		status := app.quotaStatus.Load()
+		g.Expect(status).ToNot(BeNil())
+		g.Expect(status.DBSizeBytes).To(BeNumerically(">", 0))
+		if entry.sampledBefore > 0 {
+			g.Expect(status.GrowthRateBytesPerSecond).To(BeNumerically(">", 0))
+		}
+		warnings := 0.0
+		for _, threshold := range []string{"70", "85", "95"} {
+			warnings += testutil.ToFloat64(metrics.QuotaWarningsTotal.WithLabelValues(threshold))
+		}
+		g.Expect(warnings).To(Equal(entry.expectedWarnings))
+		g.Expect(watcher.compactionPending).To(Equal(entry.compactionEnabled && entry.expectedWarnings > 0 && !entry.expectedCompactedRev))
+		_, err = etcd.Server.Range(context.Background(), &etcdserverpb.RangeRequest{Key: []byte("/registry/pods/pod-0"), Revision: etcd.Server.KV().Rev() - 2})
+		g.Expect(err != nil).To(Equal(entry.expectedCompactedRev))
+		app.Close()
+		etcd.Close()
+	}
+}
+
+func TestQuotaWatcherCompactionRevision(t *testing.T) {
+	start := time.Date(2024, time.May, 2, 10, 0, 0, 0, time.UTC)
+	sampleAt := func(minutes int, revision int64) quotaSample {
+		return quotaSample{at: start.Add(time.Duration(minutes) * time.Minute), revision: revision}
+	}
+	table := []struct {
+		description      string
+		samples          []quotaSample
+		expectedRevision int64
+		expectedOK       bool
+	}{
+		{"should not compact with a single sample", []quotaSample{sampleAt(0, 10)}, 0, false},
+		{"should not compact before the samples span the growth window", []quotaSample{sampleAt(0, 10), sampleAt(59, 20)}, 0, false},
+		{"should compact up to the sample taken the growth window ago", []quotaSample{sampleAt(0, 10), sampleAt(30, 20), sampleAt(60, 30)}, 10, true},
+		{"should compact up to the latest sample taken at least the growth window ago", []quotaSample{sampleAt(0, 10), sampleAt(30, 20), sampleAt(60, 30), sampleAt(95, 40)}, 20, true},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		watcher := newQuotaWatcher(1000, types.DefaultQuotaWarningThresholds)
+		for _, sample := range entry.samples {
+			watcher.observe(sample)
+		}
+		revision, ok := watcher.compactionRevision()
+		g.Expect(ok).To(Equal(entry.expectedOK))
+		g.Expect(revision).To(Equal(entry.expectedRevision))
+	}
+}
@@ -6,15 +6,19 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gardener/etcd-wrapper/internal/bootstrap"
+	"github.com/gardener/etcd-wrapper/internal/metrics"
 	"github.com/gardener/etcd-wrapper/internal/types"
 	"github.com/gardener/etcd-wrapper/internal/util"
+	"github.com/gardener/etcd-wrapper/internal/version"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.uber.org/zap"
 )
@@ -61,13 +65,25 @@ func (a *Application) isEtcdReady() bool {
 
 // readinessHandler reads the etcd status from the etcdStatus struct and writes that onto the http responsewriter
 func (a *Application) readinessHandler(w http.ResponseWriter, _ *http.Request) {
-	if a.etcdReady {
+	if a.isReady() {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 	w.WriteHeader(http.StatusServiceUnavailable)
 }
 
+// isReady returns whether etcd is ready, it is not being defragmented and its readiness has not been failed by the
+// consistency check.
+func (a *Application) isReady() bool {
+	if a.defragmenting.Load() {
+		return false
+	}
+	if a.keyspaceDiverged.Load() && a.consistencyMismatchPolicy() == types.ConsistencyMismatchPolicyFailReadiness {
+		return false
+	}
+	return a.etcdReady
+}
+
 // createEtcdClient creates an ETCD client
 func (a *Application) createEtcdClient() (*clientv3.Client, error) {
 	// fetch tls configuration
@@ -100,11 +116,62 @@ func (a *Application) isTLSEnabled() bool {
 		len(strings.TrimSpace(a.cfg.ClientTLSInfo.TrustedCAFile)) != 0
 }
 
+// versionResponse is the response of the /version endpoint.
+type versionResponse struct {
+	version.Info
+	// EtcdClusterVersion is the cluster version negotiated by the embedded etcd. It is empty until etcd has
+	// been started and the cluster version has been decided.
+	EtcdClusterVersion string `json:"etcdClusterVersion,omitempty"`
+}
+
+// versionHandler writes the build information of etcd-wrapper and the cluster version of the embedded etcd as JSON.
+func (a *Application) versionHandler(w http.ResponseWriter, _ *http.Request) {
+	response := versionResponse{Info: version.Get()}
+	if server := a.etcdServer.Load(); server != nil {
+		if clusterVersion := server.ClusterVersion(); clusterVersion != nil {
+			response.EtcdClusterVersion = clusterVersion.String()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		a.logger.Error("failed to write version response", zap.Error(err))
+	}
+}
+
+// statusResponse is the response of the /status endpoint.
+type statusResponse struct {
+	// Ready is the readiness of this member as served on /readyz.
+	Ready bool `json:"ready"`
+	// ConsistencyCheck is the result of the latest comparison of the key space with the peers. It is only present
+	// once the consistency check has run.
+	ConsistencyCheck *consistencyCheckResult `json:"consistencyCheck,omitempty"`
+	// Defragmentation is the result of the latest defragmentation of this member, triggered by the schedule, the
+	// interval or a sample of the fragmentation. It is only present once a defragmentation has been recorded.
+	Defragmentation *defragmentationResult `json:"defragmentation,omitempty"`
+	// Quota is the usage of the backend quota by the database. It is only present once the quota watcher has run.
+	Quota *quotaStatus `json:"quota,omitempty"`
+}
+
+// statusHandler writes the status of the periodic checks of etcd-wrapper as JSON.
+func (a *Application) statusHandler(w http.ResponseWriter, _ *http.Request) {
+	response := statusResponse{
+		Ready:            a.isReady(),
+		ConsistencyCheck: a.consistencyCheckResult.Load(),
+		Defragmentation:  a.defragmentationResult.Load(),
+		Quota:            a.quotaStatus.Load(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		a.logger.Error("failed to write status response", zap.Error(err))
+	}
+}
+
 func (a *Application) stopEtcdHandler(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "POST" {
 		return
 	}
 	a.logger.Info("received stop request, stopping etcd-wrapper...")
+	a.stopRequested.Store(true)
 	a.cancelContext()
 	w.WriteHeader(http.StatusOK)
 }
@@ -142,6 +209,9 @@ func (a *Application) RegisterHandler() {
 
 	mux.HandleFunc("/readyz", a.readinessHandler)
 	mux.HandleFunc("/stop", a.stopEtcdHandler)
+	mux.HandleFunc("/version", a.versionHandler)
+	mux.HandleFunc("/status", a.statusHandler)
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
 
 	a.server = &http.Server{
 		Addr:              fmt.Sprintf(":%d", a.Config.EtcdWrapperPort),
@@ -6,6 +6,7 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/gardener/etcd-wrapper/internal/testutil"
 	"github.com/gardener/etcd-wrapper/internal/types"
+	"github.com/gardener/etcd-wrapper/internal/version"
 
 	"go.etcd.io/etcd/server/v3/embed"
 	"go.uber.org/zap"
@@ -38,6 +40,8 @@ func TestSuit(t *testing.T) {
 	}{
 		{"queryAndUpdateEtcdReadiness", testQueryEtcdReadiness},
 		{"readinessHandler", testReadinessHandler},
+		{"versionHandler", testVersionHandler},
+		{"statusHandler", testStatusHandler},
 		{"createEtcdClient", testCreateEtcdClient},
 		{"isTLSEnabled", testIsTLSEnabled},
 	}
@@ -85,12 +89,16 @@ func testQueryEtcdReadiness(t *testing.T) {
 
 func testReadinessHandler(t *testing.T) {
 	table := []struct {
-		description    string
-		readyStatus    bool
-		expectedStatus int
+		description      string
+		readyStatus      bool
+		keyspaceDiverged bool
+		mismatchPolicy   types.ConsistencyMismatchPolicy
+		expectedStatus   int
 	}{
-		{"should return http.StatusOK when etcdStatus.Ready is set to true", true, http.StatusOK},
-		{"should return http.StatusServiceUnavailable when etcdStatus.Ready is set to false", false, http.StatusServiceUnavailable},
+		{"should return http.StatusOK when etcdStatus.Ready is set to true", true, false, "", http.StatusOK},
+		{"should return http.StatusServiceUnavailable when etcdStatus.Ready is set to false", false, false, "", http.StatusServiceUnavailable},
+		{"should return http.StatusOK when the key space has diverged with the alert policy", true, true, types.ConsistencyMismatchPolicyAlert, http.StatusOK},
+		{"should return http.StatusServiceUnavailable when the key space has diverged with the fail-readiness policy", true, true, types.ConsistencyMismatchPolicyFailReadiness, http.StatusServiceUnavailable},
 	}
 
 	for _, entry := range table {
@@ -100,6 +108,8 @@ func testReadinessHandler(t *testing.T) {
 		ctx, cancel := context.WithCancel(context.Background())
 		app := createApplicationInstance(ctx, cancel, g)
 		app.etcdReady = entry.readyStatus
+		app.keyspaceDiverged.Store(entry.keyspaceDiverged)
+		app.Config.ConsistencyCheck.MismatchPolicy = entry.mismatchPolicy
 
 		request, err := http.NewRequest("GET", "/readyz", nil)
 		g.Expect(err).To(BeNil())
@@ -112,6 +122,59 @@ func testReadinessHandler(t *testing.T) {
 	}
 }
 
+func testVersionHandler(t *testing.T) {
+	g := NewWithT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	app := createApplicationInstance(ctx, cancel, g)
+	defer app.Close()
+
+	request, err := http.NewRequest("GET", "/version", nil)
+	g.Expect(err).To(BeNil())
+	response := httptest.NewRecorder()
+	http.HandlerFunc(app.versionHandler).ServeHTTP(response, request)
+	g.Expect(response.Code).To(Equal(http.StatusOK))
+	g.Expect(response.Header().Get("Content-Type")).To(Equal("application/json"))
+
+	var body versionResponse
+	g.Expect(json.NewDecoder(response.Body).Decode(&body)).To(Succeed())
+	g.Expect(body.Info).To(Equal(version.Get()))
+	t.Log("cluster version should not be reported before etcd has been started")
+	g.Expect(body.EtcdClusterVersion).To(BeEmpty())
+}
+
+func testStatusHandler(t *testing.T) {
+	g := NewWithT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	app := createApplicationInstance(ctx, cancel, g)
+	defer app.Close()
+	app.etcdReady = true
+
+	serveStatus := func() statusResponse {
+		request, err := http.NewRequest("GET", "/status", nil)
+		g.Expect(err).To(BeNil())
+		response := httptest.NewRecorder()
+		http.HandlerFunc(app.statusHandler).ServeHTTP(response, request)
+		g.Expect(response.Code).To(Equal(http.StatusOK))
+		g.Expect(response.Header().Get("Content-Type")).To(Equal("application/json"))
+		var body statusResponse
+		g.Expect(json.NewDecoder(response.Body).Decode(&body)).To(Succeed())
+		return body
+	}
+
+	t.Log("the consistency check should not be reported before it has run")
+	body := serveStatus()
+	g.Expect(body.Ready).To(BeTrue())
+	g.Expect(body.ConsistencyCheck).To(BeNil())
+
+	t.Log("the result of the latest consistency check should be reported")
+	app.consistencyCheckResult.Store(&consistencyCheckResult{Status: consistencyStatusConsistent, Revision: 42, Members: []memberHash{{Name: "etcd-0", Local: true, Hash: 1}}})
+	body = serveStatus()
+	g.Expect(body.ConsistencyCheck).ToNot(BeNil())
+	g.Expect(body.ConsistencyCheck.Status).To(Equal(consistencyStatusConsistent))
+	g.Expect(body.ConsistencyCheck.Revision).To(BeEquivalentTo(42))
+	g.Expect(body.ConsistencyCheck.Members).To(HaveLen(1))
+}
+
 func testCreateEtcdClient(t *testing.T) {
 	table := []struct {
 		description       string
@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/metrics"
+	"github.com/gardener/etcd-wrapper/internal/snapshot"
+	"github.com/gardener/etcd-wrapper/internal/tracing"
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// Results of a verification of the local snapshot recorded in metrics.SnapshotVerificationsTotal.
+const (
+	snapshotVerificationValid   = "valid"
+	snapshotVerificationInvalid = "invalid"
+	snapshotVerificationError   = "error"
+)
+
+// verifySnapshotExecutable returns the path of the executable which verifies the local snapshot with its
+// verify-snapshot command. It is a variable so that tests can replace the executable.
+var verifySnapshotExecutable = os.Executable
+
+// verifySnapshotPeriodically verifies the local snapshot in the configured interval, until the application context
+// is cancelled or etcd stops.
+func (a *Application) verifySnapshotPeriodically(etcd *embed.Etcd) {
+	ticker := time.NewTicker(a.Config.SnapshotVerification.Interval)
+	defer ticker.Stop()
+	var lastVerified os.FileInfo
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-etcd.Server.StopNotify():
+			return
+		case <-ticker.C:
+			lastVerified = a.verifySnapshot(lastVerified)
+		}
+	}
+}
+
+// verifySnapshot verifies the local snapshot, unless it has not changed since lastVerified, and records the result
+// as metrics. It returns the file info of the verified snapshot, or nil if it could not be verified.
+func (a *Application) verifySnapshot(lastVerified os.FileInfo) os.FileInfo {
+	path := a.Config.SnapshotVerification.SnapshotPath
+	info, err := os.Stat(path)
+	if err != nil {
+		a.logger.Error("Cannot verify snapshot", zap.String("snapshot", path), zap.Error(err))
+		metrics.SnapshotVerificationsTotal.WithLabelValues(snapshotVerificationError).Inc()
+		return nil
+	}
+	if lastVerified != nil && info.Size() == lastVerified.Size() && info.ModTime().Equal(lastVerified.ModTime()) {
+		a.logger.Debug("Snapshot has not changed since its last verification, skipping verification", zap.String("snapshot", path))
+		return lastVerified
+	}
+
+	ctx, span := tracing.Tracer().Start(a.ctx, "VerifySnapshot")
+	report, err := a.runSnapshotVerification(ctx, path)
+	if err == nil {
+		span.SetAttributes(attribute.Bool("valid", report.Valid))
+	}
+	tracing.EndSpan(span, err)
+	if err != nil {
+		a.logger.Error("Cannot verify snapshot", zap.String("snapshot", path), zap.Error(err))
+		metrics.SnapshotVerificationsTotal.WithLabelValues(snapshotVerificationError).Inc()
+		return nil
+	}
+	recordSnapshotVerification(report)
+	if !report.Valid {
+		a.logger.Error("Snapshot is not restorable", zap.String("snapshot", path), zap.Any("checks", report.Checks))
+		return info
+	}
+	a.logger.Info("Verified that snapshot is restorable", zap.String("snapshot", path), zap.Int64("revision", report.Revision), zap.Float64("durationSeconds", report.DurationSeconds))
+	return info
+}
+
+// runSnapshotVerification verifies the snapshot at path with the verify-snapshot command in a separate process and
+// returns its report. The throwaway etcd of a verification must not run in the process of the served etcd, as it
+// would register the metrics of etcd again, which are global, and rebind them to its own key space.
+func (a *Application) runSnapshotVerification(ctx context.Context, path string) (*snapshot.VerifyReport, error) {
+	executable, err := verifySnapshotExecutable()
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine executable to verify snapshot: %w", err)
+	}
+	args := []string{"verify-snapshot", "--from", path, "--output", "json"}
+	if a.Config.SnapshotVerification.TempDir != "" {
+		args = append(args, "--temp-dir", a.Config.SnapshotVerification.TempDir)
+	}
+	cmd := exec.CommandContext(ctx, executable, args...)
+	// the verification is interrupted instead of killed, so that it tears down its throwaway etcd
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.Env = verifySnapshotEnv(os.Environ())
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	runErr := cmd.Run()
+	// verify-snapshot exits with a non-zero exit code if the snapshot is not restorable, but still prints its report
+	report := &snapshot.VerifyReport{}
+	if err = json.Unmarshal(stdout.Bytes(), report); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("verify-snapshot failed: %w", runErr)
+		}
+		return nil, fmt.Errorf("cannot decode report of verify-snapshot: %w", err)
+	}
+	return report, nil
+}
+
+// verifySnapshotEnv returns the passed environment without the variables which set flags of etcd-wrapper, e.g. the
+// wrapper configuration file of start-etcd. The verification is configured by its arguments only.
+func verifySnapshotEnv(environ []string) []string {
+	env := make([]string, 0, len(environ))
+	for _, variable := range environ {
+		if !strings.HasPrefix(variable, types.EnvVarPrefix) {
+			env = append(env, variable)
+		}
+	}
+	return env
+}
+
+// recordSnapshotVerification exports the result of a verification of the local snapshot as metrics.
+func recordSnapshotVerification(report *snapshot.VerifyReport) {
+	result := snapshotVerificationInvalid
+	if report.Valid {
+		result = snapshotVerificationValid
+		metrics.SnapshotVerificationLastSuccessTimestampSeconds.Set(float64(report.VerifiedAt.Unix()))
+		metrics.SnapshotVerificationRevision.Set(float64(report.Revision))
+	}
+	metrics.SnapshotVerificationsTotal.WithLabelValues(result).Inc()
+	metrics.SnapshotVerificationDurationSeconds.Set(report.DurationSeconds)
+	// checks which have not been run in the latest verification are not reported
+	metrics.SnapshotVerificationCheckPassed.Reset()
+	for _, check := range report.Checks {
+		value := 0.0
+		if check.Passed {
+			value = 1
+		}
+		metrics.SnapshotVerificationCheckPassed.WithLabelValues(check.Name).Set(value)
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/metrics"
+	"github.com/gardener/etcd-wrapper/internal/snapshot"
+	etcdtestutil "github.com/gardener/etcd-wrapper/internal/testutil"
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// verifySnapshotHelperEnv is set for the test binary when it is executed as the verify-snapshot command.
+const verifySnapshotHelperEnv = "TEST_VERIFY_SNAPSHOT_HELPER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(verifySnapshotHelperEnv) != "" {
+		os.Exit(runVerifySnapshotHelper(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// runVerifySnapshotHelper stands in for the verify-snapshot command of etcd-wrapper, which cannot be imported here.
+func runVerifySnapshotHelper(args []string) int {
+	fs := flag.NewFlagSet("verify-snapshot", flag.ContinueOnError)
+	opts := snapshot.VerifyOptions{}
+	fs.StringVar(&opts.SnapshotPath, "from", "", "")
+	fs.StringVar(&opts.TempDir, "temp-dir", "", "")
+	_ = fs.String("output", "", "")
+	if len(args) == 0 || args[0] != "verify-snapshot" || fs.Parse(args[1:]) != nil {
+		return 2
+	}
+	// verify-snapshot would apply the variables, which may set flags of other commands
+	for _, variable := range os.Environ() {
+		if strings.HasPrefix(variable, types.EnvVarPrefix) {
+			return 2
+		}
+	}
+	report, err := snapshot.Verify(context.Background(), opts, zap.NewNop())
+	if err != nil {
+		return 1
+	}
+	if err = json.NewEncoder(os.Stdout).Encode(report); err != nil || !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	etcd, err := etcdtestutil.StartEtcd(filepath.Join(dir, "source"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(etcdtestutil.PutKeys(etcd, map[string]string{"/registry/a": "1"})).To(Succeed())
+	cli, err := clientv3.New(clientv3.Config{Endpoints: []string{etcd.Config().AdvertiseClientUrls[0].String()}, Logger: zap.NewNop()})
+	g.Expect(err).ToNot(HaveOccurred())
+	defer func() { _ = cli.Close() }()
+	snapshotPath := filepath.Join(dir, "etcd.db")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app := createApplicationInstance(ctx, cancel, g)
+	defer app.Close()
+	app.Config.SnapshotVerification.SnapshotPath = snapshotPath
+	app.Config.SnapshotVerification.Interval = time.Hour
+	app.Config.SnapshotVerification.TempDir = dir
+	metrics.SnapshotVerificationsTotal.Reset()
+	t.Setenv(verifySnapshotHelperEnv, "true")
+	// the wrapper configuration file of start-etcd must not be passed on to the verification
+	wrapperConfigFile := filepath.Join(dir, "wrapper.yaml")
+	g.Expect(os.WriteFile(wrapperConfigFile, []byte("etcd-wrapper-port: 9096\n"), 0600)).To(Succeed())
+	t.Setenv(types.EnvVarPrefix+"CONFIG_FILE", wrapperConfigFile)
+
+	t.Log("a missing snapshot is recorded as error")
+	g.Expect(app.verifySnapshot(nil)).To(BeNil())
+	g.Expect(testutil.ToFloat64(metrics.SnapshotVerificationsTotal.WithLabelValues(snapshotVerificationError))).To(Equal(1.0))
+
+	t.Log("a restorable snapshot is recorded as valid")
+	_, err = snapshot.Save(context.Background(), cli, snapshotPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	etcd.Close()
+	verified := app.verifySnapshot(nil)
+	g.Expect(verified).ToNot(BeNil())
+	g.Expect(testutil.ToFloat64(metrics.SnapshotVerificationsTotal.WithLabelValues(snapshotVerificationValid))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(metrics.SnapshotVerificationCheckPassed.WithLabelValues(snapshot.CheckHash))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(metrics.SnapshotVerificationLastSuccessTimestampSeconds)).To(BeNumerically(">", 0))
+
+	t.Log("an unchanged snapshot is not verified again")
+	g.Expect(app.verifySnapshot(verified)).To(Equal(verified))
+	g.Expect(testutil.ToFloat64(metrics.SnapshotVerificationsTotal.WithLabelValues(snapshotVerificationValid))).To(Equal(1.0))
+
+	t.Log("a verification which does not report is recorded as error")
+	previousExecutable := verifySnapshotExecutable
+	defer func() { verifySnapshotExecutable = previousExecutable }()
+	verifySnapshotExecutable = func() (string, error) { return "false", nil }
+	g.Expect(app.verifySnapshot(nil)).To(BeNil())
+	g.Expect(testutil.ToFloat64(metrics.SnapshotVerificationsTotal.WithLabelValues(snapshotVerificationError))).To(Equal(2.0))
+}
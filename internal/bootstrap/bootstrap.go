@@ -7,18 +7,20 @@ package bootstrap
 import (
 	"context"
 	"errors"
-	"fmt"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gardener/etcd-wrapper/internal/types"
 
 	"github.com/gardener/etcd-wrapper/internal/brclient"
+	"github.com/gardener/etcd-wrapper/internal/etcdconfig"
+	"github.com/gardener/etcd-wrapper/internal/tracing"
 	"github.com/gardener/etcd-wrapper/internal/util"
 
 	"go.etcd.io/etcd/server/v3/embed"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -29,20 +31,36 @@ const (
 
 // EtcdInitializer is an interface for methods to be used to initialize etcd
 type EtcdInitializer interface {
+	// Run triggers the initialization of the etcd data directory on backup-restore, waits for it to succeed and
+	// returns the etcd configuration fetched from backup-restore.
 	Run(context.Context) (*embed.Config, error)
+	// DetermineValidationMode returns the validation mode with which the initialization would be triggered, without
+	// recording a start attempt.
+	DetermineValidationMode() (brclient.ValidationType, brclient.ValidationReason)
+	// GetEtcdConfig fetches the etcd configuration from backup-restore without triggering an initialization.
+	GetEtcdConfig(context.Context) (*embed.Config, error)
+	// BackupRestoreClient returns the client with which backup-restore is called, so that it can be shared.
+	BackupRestoreClient() brclient.BackupRestoreClient
 }
 
 type initializer struct {
 	brClient brclient.BackupRestoreClient
 	logger   *zap.Logger
+	// etcdConfigOverrides are applied to the etcd configuration fetched from backup-restore.
+	etcdConfigOverrides types.EtcdConfigOverridesConfig
+	// consecutiveFailedStarts is the number of preceding starts in which etcd did not become ready.
+	consecutiveFailedStarts int
 }
 
 // NewEtcdInitializer creates and returns an EtcdInitializer object
-func NewEtcdInitializer(brConfig *types.BackupRestoreConfig, logger *zap.Logger) (EtcdInitializer, error) {
+func NewEtcdInitializer(brConfig *types.BackupRestoreConfig, etcdConfigOverrides types.EtcdConfigOverridesConfig, logger *zap.Logger) (EtcdInitializer, error) {
 	// Validate backup-restore configuration
 	if err := brConfig.Validate(); err != nil {
 		return nil, err
 	}
+	if err := etcdConfigOverrides.Validate(); err != nil {
+		return nil, err
+	}
 
 	//create backup-restore client
 	brClient, err := brclient.NewDefaultClient(*brConfig)
@@ -51,28 +69,32 @@ func NewEtcdInitializer(brConfig *types.BackupRestoreConfig, logger *zap.Logger)
 	}
 
 	return &initializer{
-		brClient: brClient,
-		logger:   logger,
+		brClient:            brClient,
+		logger:              logger,
+		etcdConfigOverrides: etcdConfigOverrides,
 	}, nil
 }
 
+// BackupRestoreClient returns the client with which backup-restore is called.
+func (i *initializer) BackupRestoreClient() brclient.BackupRestoreClient {
+	return i.brClient
+}
+
 // Run initializes the etcd and gets the etcd configuration
 func (i *initializer) Run(ctx context.Context) (*embed.Config, error) {
-	var (
-		err        error
-		initStatus brclient.InitStatus
-	)
+	startAttempt, err := RecordStartAttempt(types.DefaultStartAttemptsFilePath)
+	if err != nil {
+		i.logger.Error("error while recording start attempt", zap.String("startAttemptsFilePath", types.DefaultStartAttemptsFilePath), zap.Error(err))
+	}
+	if startAttempt > 0 {
+		i.consecutiveFailedStarts = startAttempt - 1
+	}
+
+	var initStatus brclient.InitStatus
 	for initStatus != brclient.Successful {
-		if initStatus, err = i.brClient.GetInitializationStatus(ctx); err != nil {
-			i.logger.Error("error while fetching initialization status", zap.Error(err))
-		}
-		i.logger.Info("Fetched initialization status", zap.String("Status", initStatus.String()))
+		initStatus = i.getInitializationStatus(ctx)
 		if initStatus == brclient.New {
-			validationMode := determineValidationMode(types.DefaultExitCodeFilePath, i.logger)
-			i.logger.Info("Fetched initialization status is `New`. Triggering etcd initialization with validation mode", zap.Any("mode", validationMode))
-			if err = i.brClient.TriggerInitialization(ctx, validationMode); err != nil {
-				i.logger.Error("error while triggering initialization to backup-restore", zap.Error(err))
-			}
+			i.triggerInitialization(ctx)
 		}
 		select {
 		case <-ctx.Done():
@@ -84,53 +106,111 @@ func (i *initializer) Run(ctx context.Context) (*embed.Config, error) {
 	return i.tryGetEtcdConfig(ctx, defaultBackupRestoreMaxRetries, defaultBackOffBetweenRetries)
 }
 
-// ChangeFilePermissions changes the file permissions of all files in the given directory and its subdirectories recursively.
-func ChangeFilePermissions(dir string, mode os.FileMode) error {
-	info, err := os.Stat(dir)
+// getInitializationStatus polls the initialization status from backup-restore once.
+func (i *initializer) getInitializationStatus(ctx context.Context) brclient.InitStatus {
+	ctx, span := tracing.Tracer().Start(ctx, "GetInitializationStatus")
+	initStatus, err := i.brClient.GetInitializationStatus(ctx)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil
-		}
-		return fmt.Errorf("error stating directory %s: %w", dir, err)
+		i.logger.Error("error while fetching initialization status", zap.Error(err))
 	}
+	i.logger.Info("Fetched initialization status", zap.String("Status", initStatus.String()))
+	span.SetAttributes(attribute.String("status", initStatus.String()))
+	tracing.EndSpan(span, err)
+	return initStatus
+}
 
-	if !info.IsDir() {
-		return fmt.Errorf("path %s is not a directory", dir)
-	}
+// DetermineValidationMode returns the validation mode with which the initialization would be triggered if etcd-wrapper
+// was started now.
+func (i *initializer) DetermineValidationMode() (brclient.ValidationType, brclient.ValidationReason) {
+	validationMode, reason := determineValidationMode(types.DefaultExitCodeFilePath, i.logger)
+	reason.ConsecutiveFailedStarts = ReadStartAttempts(types.DefaultStartAttemptsFilePath)
+	return validationMode, reason
+}
 
-	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return fmt.Errorf("error walking the path %q: %w", path, err)
-		}
-		if d.IsDir() {
-			return nil
-		}
-		if err = os.Chmod(path, mode); err != nil {
-			return fmt.Errorf("error changing file permissions for %q: %w", path, err)
-		}
-		return nil
-	})
+// GetEtcdConfig fetches the etcd configuration from backup-restore without triggering an initialization.
+func (i *initializer) GetEtcdConfig(ctx context.Context) (*embed.Config, error) {
+	return i.tryGetEtcdConfig(ctx, defaultBackupRestoreMaxRetries, defaultBackOffBetweenRetries)
+}
+
+// triggerInitialization triggers the initialization on backup-restore with the validation mode determined from
+// the exit code of the previous run.
+func (i *initializer) triggerInitialization(ctx context.Context) {
+	ctx, span := tracing.Tracer().Start(ctx, "TriggerInitialization")
+	validationMode, reason := determineValidationMode(types.DefaultExitCodeFilePath, i.logger)
+	reason.ConsecutiveFailedStarts = i.consecutiveFailedStarts
+	span.SetAttributes(attribute.String("mode", string(validationMode)))
+	i.logger.Info("Fetched initialization status is `New`. Triggering etcd initialization with validation mode", zap.Any("mode", validationMode), zap.Any("reason", reason))
+	err := i.brClient.TriggerInitialization(ctx, validationMode, reason)
+	if err != nil {
+		i.logger.Error("error while triggering initialization to backup-restore", zap.Error(err))
+	}
+	tracing.EndSpan(span, err)
 }
 
-// CaptureExitCode captures the exit signal into a file `exit_code`
+// FullValidationRequestedExitCode is written to the `exit_code` file to request a full validation of the data
+// directory on the next start, no matter how etcd-wrapper exits afterwards.
+const FullValidationRequestedExitCode = "full-validation-requested"
+
+// CaptureExitCode captures the exit signal into a file `exit_code`, unless a full validation has been requested.
 func CaptureExitCode(signal os.Signal, exitCodeFilePath string) error {
 	if signal == nil {
 		return nil
 	}
+	if data, err := os.ReadFile(exitCodeFilePath); err == nil && strings.TrimSpace(string(data)) == FullValidationRequestedExitCode { // #nosec G304 -- only path passed is `DefaultExitCodeFilePath`, no user input is used.
+		return nil
+	}
 	interruptSignal := []byte(signal.String())
 	return os.WriteFile(exitCodeFilePath, interruptSignal, 0600)
 }
 
+// RequestFullValidation records in the `exit_code` file that the data directory has to be fully validated on the
+// next start, e.g. because it is suspected to be corrupted.
+func RequestFullValidation(exitCodeFilePath string) error {
+	return os.WriteFile(exitCodeFilePath, []byte(FullValidationRequestedExitCode), 0600)
+}
+
 // CleanupExitCode removes the `exit_code` file
 func CleanupExitCode(exitCodeFilePath string) error {
-	err := os.Remove(exitCodeFilePath)
+	return removeFileIfExists(exitCodeFilePath)
+}
+
+// RecordStartAttempt increments the number of consecutive start attempts stored in the file at startAttemptsFilePath
+// and returns the incremented number. A missing or unreadable file is treated as no previous start attempt.
+func RecordStartAttempt(startAttemptsFilePath string) (int, error) {
+	startAttempt := ReadStartAttempts(startAttemptsFilePath) + 1
+	return startAttempt, os.WriteFile(startAttemptsFilePath, []byte(strconv.Itoa(startAttempt)), 0600)
+}
+
+// ReadStartAttempts returns the number of consecutive start attempts stored in the file at startAttemptsFilePath. A
+// missing or unreadable file is treated as no previous start attempt.
+func ReadStartAttempts(startAttemptsFilePath string) int {
+	data, err := os.ReadFile(startAttemptsFilePath) // #nosec G304 -- only path passed is `DefaultStartAttemptsFilePath`, no user input is used.
+	if err != nil {
+		return 0
+	}
+	if attempts, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && attempts > 0 {
+		return attempts
+	}
+	return 0
+}
+
+// CleanupStartAttempts removes the `start_attempts` file. It should be called once etcd has started successfully.
+func CleanupStartAttempts(startAttemptsFilePath string) error {
+	return removeFileIfExists(startAttemptsFilePath)
+}
+
+func removeFileIfExists(path string) error {
+	err := os.Remove(path)
 	if errors.Is(err, os.ErrNotExist) {
 		return nil
 	}
 	return err
 }
 
-func (i *initializer) tryGetEtcdConfig(ctx context.Context, maxRetries int, interval time.Duration) (*embed.Config, error) {
+func (i *initializer) tryGetEtcdConfig(ctx context.Context, maxRetries int, interval time.Duration) (cfg *embed.Config, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "GetEtcdConfig")
+	defer func() { tracing.EndSpan(span, err) }()
+
 	// Get etcd config only
 	opResult := util.Retry[string](ctx, i.logger, "GetEtcdConfig", func() (string, error) {
 		return i.brClient.GetEtcdConfig(ctx)
@@ -140,30 +220,30 @@ func (i *initializer) tryGetEtcdConfig(ctx context.Context, maxRetries int, inte
 	}
 	etcdConfigFilePath := opResult.Value
 	i.logger.Info("Fetched and written etcd configuration", zap.String("path", etcdConfigFilePath))
-	return embed.ConfigFromFile(etcdConfigFilePath)
+	return etcdconfig.LoadConfig(etcdConfigFilePath, i.etcdConfigOverrides, i.logger)
 }
 
-func determineValidationMode(exitCodeFilePath string, logger *zap.Logger) brclient.ValidationType {
+func determineValidationMode(exitCodeFilePath string, logger *zap.Logger) (brclient.ValidationType, brclient.ValidationReason) {
 	var err error
-
-	// remove legacy validation_marker file created by etcd-custom-image
-	if err = CleanupExitCode(types.ValidationMarkerFilePath); err != nil {
-		logger.Error("error in removing validation_marker file", zap.String("validationMarkerFilePath", types.ValidationMarkerFilePath), zap.Error(err))
-	}
-
 	if _, err = os.Stat(exitCodeFilePath); err == nil {
 		data, err := os.ReadFile(exitCodeFilePath) // #nosec G304 -- only path passed is `DefaultExitCodeFilePath`, no user input is used.
 		if err != nil {
 			logger.Error("error in reading exitCodeFile, assuming full-validation to be done.", zap.String("exitCodeFilePath", exitCodeFilePath), zap.Error(err))
-			return brclient.FullValidation
+			return brclient.FullValidation, brclient.ValidationReason{Description: "last exit code could not be read"}
 		}
 		validationMarker := strings.TrimSpace(string(data))
 		if validationMarker == "terminated" || validationMarker == "interrupt" {
 			logger.Info("last captured exit code read, assuming sanity validation to be done.", zap.String("exitCodeFilePath", exitCodeFilePath), zap.String("signal-captured", validationMarker))
-			return brclient.SanityValidation
+			return brclient.SanityValidation, brclient.ValidationReason{Description: "previous run was terminated gracefully", LastExitSignal: validationMarker}
+		}
+		if validationMarker == FullValidationRequestedExitCode {
+			logger.Info("full validation has been requested by the previous run.", zap.String("exitCodeFilePath", exitCodeFilePath))
+			return brclient.FullValidation, brclient.ValidationReason{Description: "previous run requested a full validation", LastExitSignal: validationMarker}
 		}
+		logger.Error("last captured exit code is not a graceful termination, assuming full-validation to be done.", zap.String("exitCodeFilePath", exitCodeFilePath), zap.String("signal-captured", validationMarker))
+		return brclient.FullValidation, brclient.ValidationReason{Description: "previous run was not terminated gracefully", LastExitSignal: validationMarker}
 	}
 	logger.Error("error in checking if exitCodeFile exists, assuming full-validation to be done.", zap.String("exitCodeFilePath", exitCodeFilePath), zap.Error(err))
 	// Full validation if error
-	return brclient.FullValidation
+	return brclient.FullValidation, brclient.ValidationReason{Description: "no exit code was captured for the previous run"}
 }
@@ -29,89 +29,6 @@ func (f TestRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	return f(req), nil
 }
 
-func TestChangeFilePermissions(t *testing.T) {
-	table := []struct {
-		description string
-		setup       func(testDir string) string
-		mode        os.FileMode
-		expectError bool
-		verify      func(t *testing.T, testDir string, mode os.FileMode)
-	}{
-		{
-			description: "change permissions of files in a directory recursively",
-			setup: func(testDir string) string {
-				filePath := filepath.Join(testDir, "testfile")
-				err := os.WriteFile(filePath, []byte("test"), 0644)
-				if err != nil {
-					t.Fatalf("failed to create test file: %v", err)
-				}
-				subDirPath := filepath.Join(testDir, "subdir")
-				err = os.Mkdir(subDirPath, 0755)
-				if err != nil {
-					t.Fatalf("failed to create test directory: %v", err)
-				}
-				subFilePath := filepath.Join(subDirPath, "subfile")
-				err = os.WriteFile(subFilePath, []byte("test"), 0644)
-				if err != nil {
-					t.Fatalf("failed to create test file: %v", err)
-				}
-				return testDir
-			},
-			mode:        0600,
-			expectError: false,
-			verify: func(t *testing.T, testDir string, mode os.FileMode) {
-				g := NewWithT(t)
-				paths := []string{
-					filepath.Join(testDir, "testfile"),
-					filepath.Join(testDir, "subdir", "subfile"),
-				}
-				for _, path := range paths {
-					info, err := os.Stat(path)
-					g.Expect(err).To(BeNil())
-					g.Expect(info.Mode().Perm()).To(Equal(mode))
-				}
-			},
-		},
-		{
-			description: "return nil error for non-existent directory",
-			setup: func(testDir string) string {
-				return filepath.Join(testDir, "nonexistent/path")
-			},
-			mode:        0600,
-			expectError: false,
-			verify:      func(_ *testing.T, _ string, _ os.FileMode) {},
-		},
-		{
-			description: "return error when path is a file, not a directory",
-			setup: func(testDir string) string {
-				filePath := filepath.Join(testDir, "testfile")
-				err := os.WriteFile(filePath, []byte("test"), 0644)
-				if err != nil {
-					t.Fatalf("failed to create test file: %v", err)
-				}
-				return filePath
-			},
-			mode:        0600,
-			expectError: true,
-			verify:      func(_ *testing.T, _ string, _ os.FileMode) {},
-		},
-	}
-
-	for _, entry := range table {
-		t.Run(entry.description, func(t *testing.T) {
-			g := NewWithT(t)
-			testDir := createTestDir(t)
-			defer deleteTestDir(t, testDir)
-
-			path := entry.setup(testDir)
-			err := ChangeFilePermissions(path, entry.mode)
-			g.Expect(err != nil).To(Equal(entry.expectError))
-
-			entry.verify(t, testDir, entry.mode)
-		})
-	}
-}
-
 func TestCleanupExitCodeFile(t *testing.T) {
 	table := []struct {
 		description string
@@ -197,17 +114,33 @@ func TestCaptureExitCode(t *testing.T) {
 	}
 }
 
+func TestRequestFullValidation(t *testing.T) {
+	g := NewWithT(t)
+	exitCodeFilePath := filepath.Join(t.TempDir(), "exit_code")
+	g.Expect(RequestFullValidation(exitCodeFilePath)).To(Succeed())
+
+	t.Log("a signal captured afterwards does not replace the request")
+	g.Expect(CaptureExitCode(syscall.SIGTERM, exitCodeFilePath)).To(Succeed())
+	data, err := os.ReadFile(exitCodeFilePath) // #nosec G304 -- test file.
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(data)).To(Equal(FullValidationRequestedExitCode))
+	validationMode, _ := determineValidationMode(exitCodeFilePath, zap.NewNop())
+	g.Expect(validationMode).To(Equal(brclient.FullValidation))
+}
+
 func TestGetValidationMode(t *testing.T) {
 	logger := zaptest.NewLogger(t)
 	table := []struct {
 		description            string
 		exitCode               string
 		expectedValidationMode brclient.ValidationType
+		expectedLastExitSignal string
 	}{
-		{"exit code file not being present should result in full validation", "", brclient.FullValidation},
-		{"exit code having error string `interrupt` should result in sanity validation", os.Interrupt.String(), brclient.SanityValidation},
-		{"exit code having error string `terminated` should result in sanity validation", syscall.SIGTERM.String(), brclient.SanityValidation},
-		{"exit code having any other error string should result in full validation", "testutil", brclient.FullValidation},
+		{"exit code file not being present should result in full validation", "", brclient.FullValidation, ""},
+		{"exit code having error string `interrupt` should result in sanity validation", os.Interrupt.String(), brclient.SanityValidation, os.Interrupt.String()},
+		{"exit code having error string `terminated` should result in sanity validation", syscall.SIGTERM.String(), brclient.SanityValidation, syscall.SIGTERM.String()},
+		{"exit code having any other error string should result in full validation", "testutil", brclient.FullValidation, "testutil"},
+		{"requested full validation should result in full validation", FullValidationRequestedExitCode, brclient.FullValidation, FullValidationRequestedExitCode},
 	}
 	for _, entry := range table {
 		testDir := createTestDir(t)
@@ -223,8 +156,41 @@ func TestGetValidationMode(t *testing.T) {
 				err := os.WriteFile(exitCodeFilePath, []byte(entry.exitCode), 0644)
 				g.Expect(err).To(BeNil())
 			}
-			validationMode := determineValidationMode(exitCodeFilePath, logger)
+			validationMode, reason := determineValidationMode(exitCodeFilePath, logger)
 			g.Expect(validationMode).To(Equal(entry.expectedValidationMode))
+			g.Expect(reason.LastExitSignal).To(Equal(entry.expectedLastExitSignal))
+			g.Expect(reason.Description).ToNot(BeEmpty())
+		})
+	}
+}
+
+func TestRecordStartAttempt(t *testing.T) {
+	table := []struct {
+		description          string
+		previousAttempts     string
+		expectedStartAttempt int
+	}{
+		{"first start should be recorded as attempt 1", "", 1},
+		{"subsequent start should increment the recorded attempts", "2", 3},
+		{"unparsable recorded attempts should be recorded as attempt 1", "not-a-number", 1},
+	}
+	for _, entry := range table {
+		testDir := createTestDir(t)
+		startAttemptsFilePath := filepath.Join(testDir, "start_attempts")
+		t.Run(entry.description, func(t *testing.T) {
+			g := NewWithT(t)
+			defer deleteTestDir(t, testDir)
+			if entry.previousAttempts != "" {
+				g.Expect(os.WriteFile(startAttemptsFilePath, []byte(entry.previousAttempts), 0600)).To(Succeed())
+			}
+			startAttempt, err := RecordStartAttempt(startAttemptsFilePath)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(startAttempt).To(Equal(entry.expectedStartAttempt))
+			g.Expect(ReadStartAttempts(startAttemptsFilePath)).To(Equal(entry.expectedStartAttempt))
+
+			g.Expect(CleanupStartAttempts(startAttemptsFilePath)).To(Succeed())
+			_, err = os.Stat(startAttemptsFilePath)
+			g.Expect(os.IsNotExist(err)).To(BeTrue())
 		})
 	}
 }
@@ -287,8 +253,11 @@ func TestNewEtcdInitializer(t *testing.T) {
 			lgr, err := loggerConfig.Build()
 			g.Expect(err).ToNot(HaveOccurred())
 
-			_, err = NewEtcdInitializer(&entry.sidecarConfig, lgr)
+			etcdInitializer, err := NewEtcdInitializer(&entry.sidecarConfig, types.EtcdConfigOverridesConfig{}, lgr)
 			g.Expect(err != nil).To(Equal(entry.expectError))
+			if err == nil {
+				g.Expect(etcdInitializer.BackupRestoreClient()).ToNot(BeNil())
+			}
 		})
 	}
 }
@@ -5,16 +5,22 @@
 package brclient
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/gardener/etcd-wrapper/internal/types"
 	"github.com/gardener/etcd-wrapper/internal/util"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 // InitStatus is the status of initialisation as returned from backup-restore.
@@ -45,14 +51,76 @@ const (
 	httpClientRequestTimeout = 1 * time.Minute
 )
 
+// CapabilityInitializationStartPost is the capability of backup-restore to accept a POST with an InitializationRequest
+// as JSON body to trigger initialization. Without it, initialization is triggered with a GET passing the mode as query parameter.
+const CapabilityInitializationStartPost = "initialization-start-post"
+
+// CapabilityLifecycleEvents is the capability of backup-restore to accept notifications about lifecycle events of
+// etcd as a POST with a LifecycleEventRequest as JSON body. Without it, no notifications are sent.
+const CapabilityLifecycleEvents = "lifecycle-events"
+
+// LifecycleEvent is an event in the lifecycle of the embedded etcd which backup-restore is notified about.
+type LifecycleEvent string
+
+const (
+	// EtcdReady is sent when the embedded etcd is ready to serve client requests.
+	EtcdReady LifecycleEvent = "EtcdReady"
+	// LeadershipGained is sent when the embedded etcd has become the leader of the cluster.
+	LeadershipGained LifecycleEvent = "LeadershipGained"
+	// LeadershipLost is sent when the embedded etcd is no longer the leader of the cluster.
+	LeadershipLost LifecycleEvent = "LeadershipLost"
+	// EtcdStopping is sent when the embedded etcd is about to be stopped.
+	EtcdStopping LifecycleEvent = "EtcdStopping"
+)
+
+// LifecycleEventRequest is the JSON body sent to backup-restore to notify it about a LifecycleEvent.
+type LifecycleEventRequest struct {
+	// Event is the lifecycle event which occurred.
+	Event LifecycleEvent `json:"event"`
+	// Reason describes why the event occurred. It is only set for EtcdStopping.
+	Reason string `json:"reason,omitempty"`
+	// Timestamp is the time at which the event occurred.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ValidationReason describes why a ValidationType has been chosen, so that backup-restore can log why a validation was requested.
+type ValidationReason struct {
+	// Description is a human-readable explanation of why the validation type was chosen.
+	Description string `json:"description"`
+	// LastExitSignal is the signal captured when etcd-wrapper exited the last time. It is empty if none was captured.
+	LastExitSignal string `json:"lastExitSignal,omitempty"`
+	// ConsecutiveFailedStarts is the number of preceding starts of etcd-wrapper in which etcd did not become ready.
+	ConsecutiveFailedStarts int `json:"consecutiveFailedStarts"`
+}
+
+// InitializationRequest is the JSON body sent to backup-restore to trigger initialization.
+type InitializationRequest struct {
+	// Mode is the type of validation that should be done of the etcd DB.
+	Mode ValidationType `json:"mode"`
+	// Reason describes why Mode has been chosen.
+	Reason ValidationReason `json:"reason"`
+}
+
+// capabilitiesResponse is the response of the /capabilities endpoint of backup-restore.
+type capabilitiesResponse struct {
+	Capabilities []string `json:"capabilities"`
+}
+
 // BackupRestoreClient is a client to connect to the backup-restore HTTPs server.
 type BackupRestoreClient interface {
 	// GetInitializationStatus gets the latest state of initialization from the backup-restore.
 	GetInitializationStatus(ctx context.Context) (InitStatus, error)
-	// TriggerInitialization triggers the initialization on the backup-restore passing in the ValidationType.
-	TriggerInitialization(ctx context.Context, validationType ValidationType) error
+	// TriggerInitialization triggers the initialization on the backup-restore passing in the ValidationType and the
+	// ValidationReason for it. The reason is only passed on to backup-restore if it has CapabilityInitializationStartPost.
+	TriggerInitialization(ctx context.Context, validationType ValidationType, reason ValidationReason) error
 	// GetEtcdConfig gets the etcd configuration from the backup-restore, stores it into a file and returns the path to the file.
 	GetEtcdConfig(ctx context.Context) (string, error)
+	// NotifyEtcdReady notifies backup-restore that the embedded etcd is ready to serve client requests.
+	NotifyEtcdReady(ctx context.Context) error
+	// NotifyLeadershipChanged notifies backup-restore that the embedded etcd has gained or lost leadership.
+	NotifyLeadershipChanged(ctx context.Context, isLeader bool) error
+	// NotifyEtcdStopping notifies backup-restore that the embedded etcd is about to be stopped for the given reason.
+	NotifyEtcdStopping(ctx context.Context, reason string) error
 }
 
 // brClient implements BackupRestoreClient interface.
@@ -60,6 +128,9 @@ type brClient struct {
 	client                   *http.Client
 	backupRestoreBaseAddress string
 	etcdConfigFilePath       string
+	// capabilities are the capabilities of backup-restore, nil until they have been discovered.
+	capabilities   map[string]struct{}
+	capabilitiesMu sync.Mutex
 }
 
 // NewDefaultClient creates a BackupRestoreClient using the BackupRestoreConfig and etcd configuration at etcdConfigPath.
@@ -113,10 +184,8 @@ func (c *brClient) GetInitializationStatus(ctx context.Context) (InitStatus, err
 	}
 }
 
-func (c *brClient) TriggerInitialization(ctx context.Context, validationType ValidationType) error {
-	// TODO (@aaronfern): triggering initialization should not be using `GET` verb. `POST` should be used instead. This will require changes to backup-restore (to be done later).
-	url := c.backupRestoreBaseAddress + fmt.Sprintf("/initialization/start?mode=%s", validationType)
-	response, err := c.createAndExecuteHTTPRequest(ctx, http.MethodGet, url)
+func (c *brClient) TriggerInitialization(ctx context.Context, validationType ValidationType, reason ValidationReason) error {
+	response, err := c.sendInitializationRequest(ctx, validationType, reason)
 	if err != nil {
 		return err
 	}
@@ -129,6 +198,20 @@ func (c *brClient) TriggerInitialization(ctx context.Context, validationType Val
 	return nil
 }
 
+// sendInitializationRequest sends a POST with an InitializationRequest if backup-restore supports it, and falls back
+// to a GET passing only the validation type as query parameter for older versions of backup-restore.
+func (c *brClient) sendInitializationRequest(ctx context.Context, validationType ValidationType, reason ValidationReason) (*http.Response, error) {
+	if !c.hasCapability(ctx, CapabilityInitializationStartPost) {
+		url := c.backupRestoreBaseAddress + fmt.Sprintf("/initialization/start?mode=%s", validationType)
+		return c.createAndExecuteHTTPRequest(ctx, http.MethodGet, url)
+	}
+	body, err := json.Marshal(InitializationRequest{Mode: validationType, Reason: reason})
+	if err != nil {
+		return nil, err
+	}
+	return c.createAndExecuteHTTPRequestWithBody(ctx, http.MethodPost, c.backupRestoreBaseAddress+"/initialization/start", body)
+}
+
 func (c *brClient) GetEtcdConfig(ctx context.Context) (string, error) {
 	// TODO (@aaronfern) If and when we directly mount etcd configuration to etcd-wrapper then we need to remove this and also add a command line parameter to take the path to the configuration.
 	response, err := c.createAndExecuteHTTPRequest(ctx, http.MethodGet, c.backupRestoreBaseAddress+"/config")
@@ -151,16 +234,112 @@ func (c *brClient) GetEtcdConfig(ctx context.Context) (string, error) {
 	return c.etcdConfigFilePath, nil
 }
 
+func (c *brClient) NotifyEtcdReady(ctx context.Context) error {
+	return c.notifyLifecycleEvent(ctx, EtcdReady, "")
+}
+
+func (c *brClient) NotifyLeadershipChanged(ctx context.Context, isLeader bool) error {
+	if isLeader {
+		return c.notifyLifecycleEvent(ctx, LeadershipGained, "")
+	}
+	return c.notifyLifecycleEvent(ctx, LeadershipLost, "")
+}
+
+func (c *brClient) NotifyEtcdStopping(ctx context.Context, reason string) error {
+	return c.notifyLifecycleEvent(ctx, EtcdStopping, reason)
+}
+
+// notifyLifecycleEvent sends a LifecycleEventRequest to backup-restore. Nothing is sent if backup-restore does not
+// have CapabilityLifecycleEvents.
+func (c *brClient) notifyLifecycleEvent(ctx context.Context, event LifecycleEvent, reason string) error {
+	if !c.hasCapability(ctx, CapabilityLifecycleEvents) {
+		return nil
+	}
+	body, err := json.Marshal(LifecycleEventRequest{Event: event, Reason: reason, Timestamp: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	response, err := c.createAndExecuteHTTPRequestWithBody(ctx, http.MethodPost, c.backupRestoreBaseAddress+"/lifecycle/events", body)
+	if err != nil {
+		return err
+	}
+	defer util.CloseResponseBody(response)
+
+	if !util.ResponseHasOKCode(response) {
+		return fmt.Errorf("server returned error response code when attempting to notify lifecycle event %s: %v", event, response)
+	}
+	return nil
+}
+
+// hasCapability checks if backup-restore has the given capability. The capabilities are discovered once via the
+// /capabilities endpoint of backup-restore. Versions of backup-restore without this endpoint have no capabilities.
+// If the capabilities could not be discovered, it is assumed that backup-restore does not have the capability
+// and discovery is re-attempted on the next call. The lock is not held during the discovery, so concurrent calls
+// may discover the capabilities more than once.
+func (c *brClient) hasCapability(ctx context.Context, capability string) bool {
+	c.capabilitiesMu.Lock()
+	capabilities := c.capabilities
+	c.capabilitiesMu.Unlock()
+	if capabilities == nil {
+		var err error
+		if capabilities, err = c.getCapabilities(ctx); err != nil {
+			return false
+		}
+		c.capabilitiesMu.Lock()
+		c.capabilities = capabilities
+		c.capabilitiesMu.Unlock()
+	}
+	_, ok := capabilities[capability]
+	return ok
+}
+
+func (c *brClient) getCapabilities(ctx context.Context) (map[string]struct{}, error) {
+	response, err := c.createAndExecuteHTTPRequest(ctx, http.MethodGet, c.backupRestoreBaseAddress+"/capabilities")
+	if err != nil {
+		return nil, err
+	}
+	defer util.CloseResponseBody(response)
+
+	capabilities := make(map[string]struct{})
+	if response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusMethodNotAllowed {
+		return capabilities, nil
+	}
+	if !util.ResponseHasOKCode(response) {
+		return nil, fmt.Errorf("server returned error response code when attempting to get capabilities: %v", response)
+	}
+	var capResponse capabilitiesResponse
+	if err = json.NewDecoder(response.Body).Decode(&capResponse); err != nil {
+		return nil, err
+	}
+	for _, capability := range capResponse.Capabilities {
+		capabilities[capability] = struct{}{}
+	}
+	return capabilities, nil
+}
+
 func (c *brClient) createAndExecuteHTTPRequest(ctx context.Context, method, url string) (*http.Response, error) {
+	return c.createAndExecuteHTTPRequestWithBody(ctx, method, url, nil)
+}
+
+func (c *brClient) createAndExecuteHTTPRequestWithBody(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
 	// create cancellable child context for http request
 	httpCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	// create new request
-	req, err := http.NewRequestWithContext(httpCtx, method, url, nil)
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(httpCtx, method, url, bodyReader)
 	if err != nil {
 		return nil, err
 	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// propagate the trace context, if any, to backup-restore
+	otel.GetTextMapPropagator().Inject(httpCtx, propagation.HeaderCarrier(req.Header))
 
 	// send http request
 	response, err := c.client.Do(req)
@@ -176,9 +355,20 @@ func createClient(brConfig types.BackupRestoreConfig) (*http.Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	if brConfig.IsMutualTLSEnabled() {
+		certReloader, err := util.NewCertificateReloader(util.KeyPair{CertPath: brConfig.ClientCertPath, KeyPath: brConfig.ClientKeyPath})
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = certReloader.GetClientCertificate
+	}
 	transport := &http.Transport{
 		TLSClientConfig: tlsConfig,
 	}
+	if socketPath := brConfig.GetUnixSocketPath(); socketPath != "" {
+		// without TLS, the file permissions of the socket are what establishes trust in the sidecar
+		transport.DialContext = newUnixSocketDialer(socketPath, !brConfig.TLSEnabled)
+	}
 	client := &http.Client{
 		Transport: transport,
 		Timeout:   httpClientRequestTimeout,
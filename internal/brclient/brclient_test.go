@@ -7,6 +7,7 @@ package brclient
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
@@ -17,12 +18,18 @@ import (
 
 	"github.com/gardener/etcd-wrapper/internal/testutil"
 	"github.com/gardener/etcd-wrapper/internal/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
 	. "github.com/onsi/gomega"
 )
 
 var (
-	testdataPath       = "../testdata"
-	etcdCACertFilePath = filepath.Join(testdataPath, "ca.pem")
+	testdataPath           = "../testdata"
+	etcdCACertFilePath     = filepath.Join(testdataPath, "ca.pem")
+	etcdClientCertFilePath = filepath.Join(testdataPath, "client.pem")
+	etcdClientKeyFilePath  = filepath.Join(testdataPath, "client-key.pem")
 )
 
 type TestRoundTripper func(req *http.Request) *http.Response
@@ -39,6 +46,9 @@ func TestSuite(t *testing.T) {
 		{"getEtcdConfig", testGetEtcdConfig},
 		{"getInitializationStatus", testGetInitializationStatus},
 		{"triggerInitializer", testTriggerInitialization},
+		{"triggerInitializationMethod", testTriggerInitializationMethod},
+		{"notifyLifecycleEvents", testNotifyLifecycleEvents},
+		{"discoverCapabilitiesConcurrently", testDiscoverCapabilitiesConcurrently},
 		{"createClient", testCreateSidecarClient},
 	}
 
@@ -156,11 +166,148 @@ func testTriggerInitialization(t *testing.T, etcdConfigFilePath string) {
 
 		httpClient := getTestHttpClient(entry.responseCode, entry.responseBody)
 		brc := NewClient(httpClient, sidecarBaseAddress, etcdConfigFilePath)
-		err := brc.TriggerInitialization(context.TODO(), FullValidation)
+		err := brc.TriggerInitialization(context.TODO(), FullValidation, ValidationReason{Description: "no exit code was captured for the previous run"})
 		g.Expect(err != nil).To(Equal(entry.expectError))
 	}
 }
 
+func testTriggerInitializationMethod(t *testing.T, etcdConfigFilePath string) {
+	table := []struct {
+		description          string
+		capabilitiesCode     int
+		capabilitiesBody     string
+		expectedMethod       string
+		expectedModeQuery    string
+		expectedRequestBody  *InitializationRequest
+		expectedCapabilities int
+	}{
+		{"should use GET when backup-restore does not serve capabilities", http.StatusNotFound, "", http.MethodGet, string(FullValidation), nil, 1},
+		{"should use GET when backup-restore does not have the POST capability", http.StatusOK, `{"capabilities":[]}`, http.MethodGet, string(FullValidation), nil, 1},
+		{"should use GET and re-discover when capabilities cannot be fetched", http.StatusInternalServerError, "", http.MethodGet, string(FullValidation), nil, 2},
+		{"should use POST with a JSON body when backup-restore has the POST capability", http.StatusOK, `{"capabilities":["` + CapabilityInitializationStartPost + `"]}`, http.MethodPost, "",
+			&InitializationRequest{Mode: FullValidation, Reason: ValidationReason{Description: "previous run was not terminated gracefully", LastExitSignal: "killed", ConsecutiveFailedStarts: 2}}, 1},
+	}
+
+	for _, entry := range table {
+		t.Log(entry.description)
+		g := NewWithT(t)
+		var (
+			capabilitiesRequests int
+			method, modeQuery    string
+			requestBody          *InitializationRequest
+		)
+		httpClient := &http.Client{
+			Transport: TestRoundTripper(func(req *http.Request) *http.Response {
+				if req.URL.Path == "/capabilities" {
+					capabilitiesRequests++
+					return &http.Response{StatusCode: entry.capabilitiesCode, Body: io.NopCloser(bytes.NewReader([]byte(entry.capabilitiesBody)))}
+				}
+				method = req.Method
+				modeQuery = req.URL.Query().Get("mode")
+				if req.Body != nil {
+					requestBody = &InitializationRequest{}
+					g.Expect(json.NewDecoder(req.Body).Decode(requestBody)).To(Succeed())
+					g.Expect(req.Header.Get("Content-Type")).To(Equal("application/json"))
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(nil))}
+			}),
+		}
+		brc := NewClient(httpClient, "", etcdConfigFilePath)
+		reason := ValidationReason{Description: "previous run was not terminated gracefully", LastExitSignal: "killed", ConsecutiveFailedStarts: 2}
+		for i := 0; i < 2; i++ {
+			g.Expect(brc.TriggerInitialization(context.TODO(), FullValidation, reason)).To(Succeed())
+		}
+		g.Expect(method).To(Equal(entry.expectedMethod))
+		g.Expect(modeQuery).To(Equal(entry.expectedModeQuery))
+		g.Expect(requestBody).To(Equal(entry.expectedRequestBody))
+		g.Expect(capabilitiesRequests).To(Equal(entry.expectedCapabilities))
+	}
+}
+
+func testNotifyLifecycleEvents(t *testing.T, etcdConfigFilePath string) {
+	table := []struct {
+		description     string
+		capabilities    string
+		responseCode    int
+		notify          func(BackupRestoreClient) error
+		expectedRequest *LifecycleEventRequest
+		expectError     bool
+	}{
+		{"should not send anything when backup-restore does not have the capability", `{"capabilities":[]}`, http.StatusOK,
+			func(c BackupRestoreClient) error { return c.NotifyEtcdReady(context.TODO()) }, nil, false},
+		{"should send etcd ready event", `{"capabilities":["` + CapabilityLifecycleEvents + `"]}`, http.StatusOK,
+			func(c BackupRestoreClient) error { return c.NotifyEtcdReady(context.TODO()) }, &LifecycleEventRequest{Event: EtcdReady}, false},
+		{"should send leadership gained event", `{"capabilities":["` + CapabilityLifecycleEvents + `"]}`, http.StatusOK,
+			func(c BackupRestoreClient) error { return c.NotifyLeadershipChanged(context.TODO(), true) }, &LifecycleEventRequest{Event: LeadershipGained}, false},
+		{"should send leadership lost event", `{"capabilities":["` + CapabilityLifecycleEvents + `"]}`, http.StatusOK,
+			func(c BackupRestoreClient) error { return c.NotifyLeadershipChanged(context.TODO(), false) }, &LifecycleEventRequest{Event: LeadershipLost}, false},
+		{"should send etcd stopping event with reason", `{"capabilities":["` + CapabilityLifecycleEvents + `"]}`, http.StatusOK,
+			func(c BackupRestoreClient) error {
+				return c.NotifyEtcdStopping(context.TODO(), "caught shutdown signal terminated")
+			}, &LifecycleEventRequest{Event: EtcdStopping, Reason: "caught shutdown signal terminated"}, false},
+		{"should return error when backup-restore returns an error code", `{"capabilities":["` + CapabilityLifecycleEvents + `"]}`, http.StatusInternalServerError,
+			func(c BackupRestoreClient) error { return c.NotifyEtcdReady(context.TODO()) }, &LifecycleEventRequest{Event: EtcdReady}, true},
+	}
+
+	for _, entry := range table {
+		t.Log(entry.description)
+		g := NewWithT(t)
+		var request *LifecycleEventRequest
+		httpClient := &http.Client{
+			Transport: TestRoundTripper(func(req *http.Request) *http.Response {
+				if req.URL.Path == "/capabilities" {
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader([]byte(entry.capabilities)))}
+				}
+				g.Expect(req.Method).To(Equal(http.MethodPost))
+				g.Expect(req.URL.Path).To(Equal("/lifecycle/events"))
+				request = &LifecycleEventRequest{}
+				g.Expect(json.NewDecoder(req.Body).Decode(request)).To(Succeed())
+				return &http.Response{StatusCode: entry.responseCode, Body: io.NopCloser(bytes.NewReader(nil))}
+			}),
+		}
+		err := entry.notify(NewClient(httpClient, "", etcdConfigFilePath))
+		g.Expect(err != nil).To(Equal(entry.expectError))
+		if entry.expectedRequest == nil {
+			g.Expect(request).To(BeNil())
+			continue
+		}
+		g.Expect(request).ToNot(BeNil())
+		g.Expect(request.Timestamp).ToNot(BeZero())
+		request.Timestamp = time.Time{}
+		g.Expect(request).To(Equal(entry.expectedRequest))
+	}
+}
+
+func testDiscoverCapabilitiesConcurrently(t *testing.T, etcdConfigFilePath string) {
+	g := NewWithT(t)
+	capabilitiesRequests := make(chan struct{}, 2)
+	release := make(chan struct{})
+	httpClient := &http.Client{
+		Transport: TestRoundTripper(func(req *http.Request) *http.Response {
+			if req.URL.Path != "/capabilities" {
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(nil))}
+			}
+			capabilitiesRequests <- struct{}{}
+			if len(capabilitiesRequests) == 1 {
+				// the first discovery hangs until it is released
+				<-release
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader([]byte(`{"capabilities":["` + CapabilityLifecycleEvents + `"]}`)))}
+		}),
+	}
+	brc := NewClient(httpClient, "", etcdConfigFilePath)
+	hangingNotification := make(chan error, 1)
+	go func() { hangingNotification <- brc.NotifyEtcdReady(context.TODO()) }()
+	g.Eventually(capabilitiesRequests).Should(HaveLen(1))
+
+	// a hanging discovery must not block other calls of the client
+	done := make(chan error, 1)
+	go func() { done <- brc.NotifyLeadershipChanged(context.TODO(), true) }()
+	g.Eventually(done).Should(Receive(BeNil()))
+	close(release)
+	g.Eventually(hangingNotification).Should(Receive(BeNil()))
+}
+
 func testCreateSidecarClient(t *testing.T, _ string) {
 	incorrectCAFilePath := testdataPath + "/wrong-path"
 	table := []struct {
@@ -170,12 +317,18 @@ func testCreateSidecarClient(t *testing.T, _ string) {
 	}{
 		{"return error when incorrect sidecar config (CA filepath) is passed", types.BackupRestoreConfig{TLSEnabled: true, CaCertBundlePath: incorrectCAFilePath}, true},
 		{"return etcd client when valid sidecar config is passed", types.BackupRestoreConfig{TLSEnabled: true, CaCertBundlePath: etcdCACertFilePath}, false},
+		{"return error when incorrect client cert path is passed", types.BackupRestoreConfig{TLSEnabled: true, CaCertBundlePath: etcdCACertFilePath, ClientCertPath: incorrectCAFilePath, ClientKeyPath: etcdClientKeyFilePath}, true},
+		{"return etcd client presenting a client certificate when client cert and key are passed", types.BackupRestoreConfig{TLSEnabled: true, CaCertBundlePath: etcdCACertFilePath, ClientCertPath: etcdClientCertFilePath, ClientKeyPath: etcdClientKeyFilePath}, false},
 	}
 	g := NewWithT(t)
 	for _, entry := range table {
 		t.Log(entry.description)
-		_, err := createClient(entry.sidecarConfig)
+		client, err := createClient(entry.sidecarConfig)
 		g.Expect(err != nil).To(Equal(entry.expectError))
+		if err == nil {
+			tlsConfig := client.Transport.(*http.Transport).TLSClientConfig
+			g.Expect(tlsConfig.GetClientCertificate != nil).To(Equal(entry.sidecarConfig.IsMutualTLSEnabled()))
+		}
 	}
 }
 
@@ -202,6 +355,32 @@ func TestNewDefaultClient(t *testing.T) {
 	}
 }
 
+func TestTraceContextPropagation(t *testing.T) {
+	g := NewWithT(t)
+	previousPropagator := otel.GetTextMapPropagator()
+	t.Cleanup(func() { otel.SetTextMapPropagator(previousPropagator) })
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceParent string
+	httpClient := &http.Client{
+		Transport: TestRoundTripper(func(req *http.Request) *http.Response {
+			traceParent = req.Header.Get("traceparent")
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader([]byte(New.String())))}
+		}),
+	}
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x01},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanCtx)
+
+	brc := NewClient(httpClient, "", "")
+	_, err := brc.GetInitializationStatus(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(traceParent).To(ContainSubstring(spanCtx.TraceID().String()))
+}
+
 func getTestHttpClient(responseCode int, responseBody []byte) *http.Client {
 	return &http.Client{
 		Transport: TestRoundTripper(func(_ *http.Request) *http.Response {
@@ -249,4 +428,8 @@ func createTLSResources(g *WithT) {
 	caCertKeyPair, err = tlsResCreator.CreateCACertAndKey()
 	g.Expect(err).To(BeNil())
 	g.Expect(caCertKeyPair.EncodeAndWrite(testdataPath, "ca.pem", "ca-key.pem")).To(Succeed())
+	// create and write client certificate and private key
+	clientCertKeyPair, err := tlsResCreator.CreateETCDClientCertAndKey()
+	g.Expect(err).To(BeNil())
+	g.Expect(clientCertKeyPair.EncodeAndWrite(testdataPath, "client.pem", "client-key.pem")).To(Succeed())
 }
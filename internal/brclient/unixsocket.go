@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package brclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// newUnixSocketDialer returns a dial function which ignores the network and address of the request and always
+// connects to the unix domain socket at socketPath. If verifyPermissions is set, the permissions of the socket
+// and its directory are checked before every dial, since they are the only protection of the channel when TLS
+// is not used.
+func newUnixSocketDialer(socketPath string, verifyPermissions bool) func(context.Context, string, string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		if verifyPermissions {
+			if err := verifyUnixSocketPermissions(socketPath); err != nil {
+				return nil, err
+			}
+		}
+		return dialer.DialContext(ctx, "unix", socketPath)
+	}
+}
+
+// verifyUnixSocketPermissions checks that the file at socketPath is a unix domain socket which can not be
+// replaced or written to by other users, i.e. neither the socket nor its directory are world-writable.
+// A world-writable directory is accepted if the sticky bit is set, as only the owner can then replace the socket.
+func verifyUnixSocketPermissions(socketPath string) error {
+	info, err := os.Lstat(socketPath)
+	if err != nil {
+		return fmt.Errorf("error stating backup-restore unix domain socket %s: %w", socketPath, err)
+	}
+	if info.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("backup-restore endpoint %s is not a unix domain socket", socketPath)
+	}
+	if info.Mode().Perm()&0002 != 0 {
+		return fmt.Errorf("backup-restore unix domain socket %s is world-writable (%s)", socketPath, info.Mode().Perm())
+	}
+	dir := filepath.Dir(socketPath)
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("error stating directory %s of backup-restore unix domain socket: %w", dir, err)
+	}
+	if dirInfo.Mode().Perm()&0002 != 0 && dirInfo.Mode()&os.ModeSticky == 0 {
+		return fmt.Errorf("directory %s of backup-restore unix domain socket is world-writable (%s)", dir, dirInfo.Mode().Perm())
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package brclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUnixSocketTransport(t *testing.T) {
+	table := []struct {
+		description string
+		socketMode  os.FileMode
+		dirMode     os.FileMode
+		expectError bool
+	}{
+		{"should connect to socket with restrictive permissions", 0600, 0700, false},
+		{"should refuse world-writable socket", 0666, 0700, true},
+		{"should refuse socket in world-writable directory", 0600, 0777, true},
+		{"should allow socket in world-writable directory with sticky bit", 0600, 0777 | os.ModeSticky, false},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		dir := filepath.Join(t.TempDir(), "br")
+		g.Expect(os.Mkdir(dir, 0700)).To(Succeed())
+		socketPath := filepath.Join(dir, "br.sock")
+		listener, err := net.Listen("unix", socketPath)
+		g.Expect(err).ToNot(HaveOccurred())
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(Successful.String()))
+		})}
+		go func() { _ = server.Serve(listener) }()
+		g.Expect(os.Chmod(socketPath, entry.socketMode)).To(Succeed())
+		g.Expect(os.Chmod(dir, entry.dirMode)).To(Succeed())
+
+		brConfig := types.BackupRestoreConfig{HostPort: "unix://" + socketPath}
+		httpClient, err := createClient(brConfig)
+		g.Expect(err).ToNot(HaveOccurred())
+		status, err := NewClient(httpClient, brConfig.GetBaseAddress(), "").GetInitializationStatus(context.TODO())
+		g.Expect(err != nil).To(Equal(entry.expectError))
+		if !entry.expectError {
+			g.Expect(status).To(Equal(Successful))
+		}
+		g.Expect(server.Close()).To(Succeed())
+		g.Expect(os.Chmod(dir, 0700)).To(Succeed())
+	}
+}
+
+func TestVerifyUnixSocketPermissions(t *testing.T) {
+	g := NewWithT(t)
+	filePath := filepath.Join(t.TempDir(), "regular-file")
+	g.Expect(os.WriteFile(filePath, nil, 0600)).To(Succeed())
+	g.Expect(verifyUnixSocketPermissions(filePath)).To(MatchError(ContainSubstring("is not a unix domain socket")))
+	g.Expect(verifyUnixSocketPermissions(filepath.Join(t.TempDir(), "missing.sock"))).ToNot(Succeed())
+}
@@ -0,0 +1,386 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package datadir
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/client/pkg/v3/types"
+	etcddatadir "go.etcd.io/etcd/server/v3/datadir"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.etcd.io/etcd/server/v3/wal"
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultPrefixDepth is the default number of path segments of keys by which they are grouped into prefixes.
+	DefaultPrefixDepth = 2
+	// backendOpenTimeout is the time waited for the lock of the database, which is held while etcd is running.
+	backendOpenTimeout = time.Second
+
+	walFileSuffix  = ".wal"
+	snapFileSuffix = ".snap"
+	// revBytesLen is the length of a revision, the keys of the key bucket, see go.etcd.io/etcd/server/v3/mvcc.
+	revBytesLen = 8 + 1 + 8
+	// markedRevBytesLen is the length of a revision with a mark, which is only used to mark tombstones.
+	markedRevBytesLen = revBytesLen + 1
+)
+
+var (
+	keyBucketName  = []byte("key")
+	metaBucketName = []byte("meta")
+
+	consistentIndexKeyName  = []byte("consistent_index")
+	termKeyName             = []byte("term")
+	finishedCompactKeyName  = []byte("finishedCompactRev")
+	scheduledCompactKeyName = []byte("scheduledCompactRev")
+)
+
+// InspectOptions are the options of an inspection of a data directory.
+type InspectOptions struct {
+	// DataDir is the data directory of etcd.
+	DataDir string
+	// WALDir is the dedicated WAL directory of etcd. It is empty if the WAL resides in the data directory.
+	WALDir string
+	// PrefixDepth is the number of path segments of keys, separated by `/`, by which they are grouped into prefixes.
+	PrefixDepth int
+}
+
+// DataReport describes the contents of a data directory of etcd.
+type DataReport struct {
+	// DataDir is the inspected data directory.
+	DataDir string `json:"dataDir"`
+	// MemberID is the ID of the member, as recorded in the write-ahead log. It is empty if there is no WAL yet.
+	MemberID string `json:"memberID,omitempty"`
+	// ClusterID is the ID of the cluster, as recorded in the write-ahead log. It is empty if there is no WAL yet.
+	ClusterID string `json:"clusterID,omitempty"`
+	// WAL describes the write-ahead log.
+	WAL WALStats `json:"wal"`
+	// Snap describes the raft snapshots.
+	Snap SnapStats `json:"snap"`
+	// Backend describes the bbolt database. It is nil if the data directory has no database yet.
+	Backend *BackendStats `json:"backend,omitempty"`
+}
+
+// WALStats describes the segments of a write-ahead log.
+type WALStats struct {
+	// Dir is the directory of the write-ahead log.
+	Dir string `json:"dir"`
+	// Segments is the number of WAL segments.
+	Segments int `json:"segments"`
+	// SizeBytes is the total size of the WAL segments.
+	SizeBytes int64 `json:"sizeBytes"`
+	// SegmentFiles are the names of the WAL segments, from the oldest to the newest.
+	SegmentFiles []string `json:"segmentFiles,omitempty"`
+	// LastIndex is the raft index of the last entry in the write-ahead log.
+	LastIndex uint64 `json:"lastIndex,omitempty"`
+	// LastTerm is the raft term of the last entry in the write-ahead log.
+	LastTerm uint64 `json:"lastTerm,omitempty"`
+}
+
+// SnapStats describes the raft snapshots.
+type SnapStats struct {
+	// Dir is the directory of the snapshots and the database.
+	Dir string `json:"dir"`
+	// Snapshots is the number of raft snapshots.
+	Snapshots int `json:"snapshots"`
+	// SizeBytes is the total size of the raft snapshots.
+	SizeBytes int64 `json:"sizeBytes"`
+	// Files are the names of the raft snapshots, from the oldest to the newest.
+	Files []string `json:"files,omitempty"`
+	// LatestTerm is the raft term of the latest snapshot.
+	LatestTerm uint64 `json:"latestTerm,omitempty"`
+	// LatestIndex is the raft index of the latest snapshot.
+	LatestIndex uint64 `json:"latestIndex,omitempty"`
+}
+
+// BackendStats describes the bbolt database of etcd.
+type BackendStats struct {
+	// Path is the path of the database.
+	Path string `json:"path"`
+	// SizeBytes is the size of the database file.
+	SizeBytes int64 `json:"sizeBytes"`
+	// SizeInUseBytes is the size of the database file which is in use, the rest is reclaimed by a defragmentation.
+	SizeInUseBytes int64 `json:"sizeInUseBytes"`
+	// FreePages is the number of free pages of the database, including the pages which are pending to be freed.
+	FreePages int `json:"freePages"`
+	// Revision is the latest revision of the key space.
+	Revision int64 `json:"revision"`
+	// CompactRevision is the revision up to which the key space has been compacted.
+	CompactRevision int64 `json:"compactRevision"`
+	// ConsistentIndex is the raft index of the latest entry applied to the database.
+	ConsistentIndex uint64 `json:"consistentIndex"`
+	// Term is the raft term of the latest entry applied to the database.
+	Term uint64 `json:"term"`
+	// Buckets maps the names of the buckets of the database to the number of keys in them.
+	Buckets map[string]int `json:"buckets"`
+	// Keys is the number of keys which have not been deleted.
+	Keys int `json:"keys"`
+	// Revisions is the number of revisions of keys, including deletions, which have not been compacted.
+	Revisions int `json:"revisions"`
+	// Prefixes describes the keys grouped by prefix, ordered by the number of keys.
+	Prefixes []PrefixStats `json:"prefixes"`
+}
+
+// PrefixStats describes the keys with a common prefix.
+type PrefixStats struct {
+	// Prefix is the common prefix of the keys.
+	Prefix string `json:"prefix"`
+	// Keys is the number of keys which have not been deleted.
+	Keys int `json:"keys"`
+	// Revisions is the number of revisions of the keys, including deletions, which have not been compacted.
+	Revisions int `json:"revisions"`
+	// ValueSizeBytes is the total size of the latest values of the keys which have not been deleted.
+	ValueSizeBytes int64 `json:"valueSizeBytes"`
+}
+
+// Inspect describes the WAL, the raft snapshots and the database in a data directory of etcd which is not in use.
+// It only reads the data directory.
+func Inspect(opts InspectOptions) (*DataReport, error) {
+	info, err := os.Stat(opts.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot access data directory %s: %w", opts.DataDir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("data directory %s is not a directory", opts.DataDir)
+	}
+	walDir := opts.WALDir
+	if walDir == "" {
+		walDir = etcddatadir.ToWalDir(opts.DataDir)
+	}
+	report := &DataReport{DataDir: opts.DataDir}
+	var metadata etcdserverpb.Metadata
+	if report.WAL, metadata, err = inspectWAL(walDir); err != nil {
+		return nil, err
+	}
+	if report.WAL.Segments > 0 {
+		report.MemberID = types.ID(metadata.NodeID).String()
+		report.ClusterID = types.ID(metadata.ClusterID).String()
+	}
+	if report.Snap, err = inspectSnap(etcddatadir.ToSnapDir(opts.DataDir)); err != nil {
+		return nil, err
+	}
+	backendPath := etcddatadir.ToBackendFileName(opts.DataDir)
+	if _, err = os.Stat(backendPath); errors.Is(err, os.ErrNotExist) {
+		return report, nil
+	}
+	prefixDepth := opts.PrefixDepth
+	if prefixDepth <= 0 {
+		prefixDepth = DefaultPrefixDepth
+	}
+	if report.Backend, err = inspectBackend(backendPath, prefixDepth); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// inspectWAL reads the write-ahead log in dir from its latest snapshot on, without locking its segments, and returns
+// its statistics together with the metadata of the member which wrote it.
+func inspectWAL(dir string) (WALStats, etcdserverpb.Metadata, error) {
+	stats := WALStats{Dir: dir}
+	var metadata etcdserverpb.Metadata
+	names, err := filesWithSuffix(dir, walFileSuffix, &stats.SizeBytes)
+	if err != nil || len(names) == 0 {
+		return stats, metadata, err
+	}
+	stats.Segments = len(names)
+	stats.SegmentFiles = names
+	logger := zap.NewNop()
+	walSnaps, err := wal.ValidSnapshotEntries(logger, dir)
+	if err != nil {
+		return stats, metadata, fmt.Errorf("cannot read snapshots of WAL %s: %w", dir, err)
+	}
+	var start walpb.Snapshot
+	if len(walSnaps) > 0 {
+		start = walSnaps[len(walSnaps)-1]
+	}
+	w, err := wal.OpenForRead(logger, dir, start)
+	if err != nil {
+		return stats, metadata, fmt.Errorf("cannot open WAL %s: %w", dir, err)
+	}
+	// a WAL opened for reading has no directory to close, which is reported as an error
+	defer func() { _ = w.Close() }()
+	rawMetadata, _, entries, err := w.ReadAll()
+	if err != nil {
+		return stats, metadata, fmt.Errorf("cannot read WAL %s: %w", dir, err)
+	}
+	if err = metadata.Unmarshal(rawMetadata); err != nil {
+		return stats, metadata, fmt.Errorf("cannot decode metadata of WAL %s: %w", dir, err)
+	}
+	stats.LastIndex, stats.LastTerm = start.Index, start.Term
+	if len(entries) > 0 {
+		stats.LastIndex, stats.LastTerm = entries[len(entries)-1].Index, entries[len(entries)-1].Term
+	}
+	return stats, metadata, nil
+}
+
+func inspectSnap(dir string) (SnapStats, error) {
+	stats := SnapStats{Dir: dir}
+	names, err := filesWithSuffix(dir, snapFileSuffix, &stats.SizeBytes)
+	if err != nil || len(names) == 0 {
+		return stats, err
+	}
+	stats.Snapshots = len(names)
+	stats.Files = names
+	latest, err := snap.Read(zap.NewNop(), filepath.Join(dir, names[len(names)-1]))
+	if err != nil {
+		return stats, fmt.Errorf("cannot read snapshot %s: %w", names[len(names)-1], err)
+	}
+	stats.LatestTerm, stats.LatestIndex = latest.Metadata.Term, latest.Metadata.Index
+	return stats, nil
+}
+
+// filesWithSuffix returns the sorted names of the files in dir with the passed suffix and adds their sizes to size.
+// A directory which does not exist is treated as empty.
+func filesWithSuffix(dir, suffix string, size *int64) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read directory %s: %w", dir, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), suffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		*size += info.Size()
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func inspectBackend(path string, prefixDepth int) (*BackendStats, error) {
+	db, err := openDBReadOnly(path, "inspect")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	stats := &BackendStats{Path: path, Buckets: make(map[string]int)}
+	err = db.View(func(tx *bolt.Tx) error {
+		stats.SizeBytes = tx.Size()
+		stats.FreePages = db.Stats().FreePageN + db.Stats().PendingPageN
+		stats.SizeInUseBytes = stats.SizeBytes - int64(stats.FreePages)*int64(db.Info().PageSize)
+		if err := tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			stats.Buckets[string(name)] = bucket.Stats().KeyN
+			return nil
+		}); err != nil {
+			return err
+		}
+		if meta := tx.Bucket(metaBucketName); meta != nil {
+			stats.ConsistentIndex = uint64Value(meta.Get(consistentIndexKeyName))
+			stats.Term = uint64Value(meta.Get(termKeyName))
+			stats.CompactRevision = mainRevision(meta.Get(finishedCompactKeyName))
+		}
+		if keys := tx.Bucket(keyBucketName); keys != nil {
+			return inspectKeys(keys, prefixDepth, stats)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read database %s: %w", path, err)
+	}
+	return stats, nil
+}
+
+// inspectKeys counts the keys and revisions in the key bucket, whose keys are the revisions in ascending order and
+// whose values are the key-value pairs written in these revisions.
+func inspectKeys(bucket *bolt.Bucket, prefixDepth int, stats *BackendStats) error {
+	type keyState struct {
+		prefix    string
+		deleted   bool
+		valueSize int64
+	}
+	keys := make(map[string]*keyState)
+	prefixes := make(map[string]*PrefixStats)
+	err := bucket.ForEach(func(rev, value []byte) error {
+		if len(rev) != revBytesLen && len(rev) != markedRevBytesLen {
+			return fmt.Errorf("unexpected revision of length %d in bucket %s", len(rev), keyBucketName)
+		}
+		kv := mvccpb.KeyValue{}
+		if err := kv.Unmarshal(value); err != nil {
+			return fmt.Errorf("cannot decode key-value pair of revision %d: %w", binary.BigEndian.Uint64(rev[:8]), err)
+		}
+		stats.Revision = mainRevision(rev)
+		stats.Revisions++
+		state, ok := keys[string(kv.Key)]
+		if !ok {
+			state = &keyState{prefix: KeyPrefix(string(kv.Key), prefixDepth)}
+			keys[string(kv.Key)] = state
+		}
+		state.deleted = len(rev) == markedRevBytesLen
+		state.valueSize = int64(len(kv.Value))
+		prefix, ok := prefixes[state.prefix]
+		if !ok {
+			prefix = &PrefixStats{Prefix: state.prefix}
+			prefixes[state.prefix] = prefix
+		}
+		prefix.Revisions++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, state := range keys {
+		if state.deleted {
+			continue
+		}
+		stats.Keys++
+		prefixes[state.prefix].Keys++
+		prefixes[state.prefix].ValueSizeBytes += state.valueSize
+	}
+	stats.Prefixes = make([]PrefixStats, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		stats.Prefixes = append(stats.Prefixes, *prefix)
+	}
+	sort.Slice(stats.Prefixes, func(i, j int) bool {
+		if stats.Prefixes[i].Keys != stats.Prefixes[j].Keys {
+			return stats.Prefixes[i].Keys > stats.Prefixes[j].Keys
+		}
+		return stats.Prefixes[i].Prefix < stats.Prefixes[j].Prefix
+	})
+	return nil
+}
+
+// KeyPrefix returns the first depth path segments of key, separated by `/`, including a trailing `/`. The name of
+// the key itself is never part of its prefix, e.g. the prefix of `/registry/pods/default/nginx` is `/registry/pods/`
+// for a depth of 2, while the prefix of `/registry/health` is `/registry/`.
+func KeyPrefix(key string, depth int) string {
+	lead := ""
+	if strings.HasPrefix(key, "/") {
+		lead = "/"
+	}
+	segments := strings.SplitN(strings.TrimPrefix(key, "/"), "/", depth+1)
+	if len(segments) == 1 {
+		return lead
+	}
+	return lead + strings.Join(segments[:len(segments)-1], "/") + "/"
+}
+
+// uint64Value decodes a big endian uint64 as stored in the meta bucket, or returns 0 if it is not set.
+func uint64Value(value []byte) uint64 {
+	if len(value) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(value)
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package datadir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/testutil"
+
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	etcddatadir "go.etcd.io/etcd/server/v3/datadir"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.uber.org/zap"
+)
+
+func TestInspect(t *testing.T) {
+	g := NewWithT(t)
+	dataDir := filepath.Join(t.TempDir(), "data")
+	etcd, err := testutil.StartEtcd(dataDir)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(testutil.PutKeys(etcd, map[string]string{
+		"/registry/pods/default/a": "pod-a",
+		"/registry/pods/default/b": "pod-b",
+		"/registry/pods/default/c": "pod-c",
+		"/registry/secrets/s":      "secret",
+		"foo":                      "bar",
+	})).To(Succeed())
+	g.Expect(testutil.PutKeys(etcd, map[string]string{"/registry/pods/default/a": "pod-a-v2"})).To(Succeed())
+	g.Expect(testutil.DeleteKeys(etcd, "/registry/pods/default/c")).To(Succeed())
+
+	t.Log("the database cannot be inspected while etcd is running")
+	_, err = Inspect(InspectOptions{DataDir: dataDir})
+	g.Expect(err).To(MatchError(ContainSubstring("is in use")))
+	memberID, clusterID := etcd.Server.ID().String(), etcd.Server.Cluster().ID().String()
+	etcd.Close()
+	snapshot := raftpb.Snapshot{Data: []byte("snapshot"), Metadata: raftpb.SnapshotMetadata{Index: 3, Term: 2}}
+	g.Expect(snap.New(zap.NewNop(), etcddatadir.ToSnapDir(dataDir)).SaveSnap(snapshot)).To(Succeed())
+
+	report, err := Inspect(InspectOptions{DataDir: dataDir})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(report.MemberID).To(Equal(memberID))
+	g.Expect(report.ClusterID).To(Equal(clusterID))
+	g.Expect(report.WAL.Segments).To(BeNumerically(">=", 1))
+	g.Expect(report.WAL.SegmentFiles).To(HaveLen(report.WAL.Segments))
+	g.Expect(report.WAL.SizeBytes).To(BeNumerically(">", 0))
+	g.Expect(report.Snap.Files).To(Equal([]string{"0000000000000002-0000000000000003.snap"}))
+	g.Expect(report.Snap.LatestTerm).To(BeEquivalentTo(2))
+	g.Expect(report.Snap.LatestIndex).To(BeEquivalentTo(3))
+	g.Expect(report.Backend).ToNot(BeNil())
+	g.Expect(report.WAL.LastTerm).To(Equal(report.Backend.Term))
+	g.Expect(report.WAL.LastIndex).To(BeNumerically(">=", report.Backend.ConsistentIndex))
+	g.Expect(report.Backend.SizeBytes).To(BeNumerically(">=", report.Backend.SizeInUseBytes))
+	g.Expect(report.Backend.SizeInUseBytes).To(Equal(report.Backend.SizeBytes - int64(report.Backend.FreePages*os.Getpagesize())))
+	g.Expect(report.Backend.Revision).To(BeEquivalentTo(8))
+	g.Expect(report.Backend.Keys).To(Equal(4))
+	g.Expect(report.Backend.Revisions).To(Equal(7))
+	g.Expect(report.Backend.ConsistentIndex).To(BeNumerically(">", 0))
+	g.Expect(report.Backend.Buckets).To(HaveKeyWithValue("key", 7))
+	g.Expect(report.Backend.Prefixes).To(Equal([]PrefixStats{
+		{Prefix: "/registry/pods/", Keys: 2, Revisions: 5, ValueSizeBytes: int64(len("pod-a-v2") + len("pod-b"))},
+		{Prefix: "", Keys: 1, Revisions: 1, ValueSizeBytes: int64(len("bar"))},
+		{Prefix: "/registry/secrets/", Keys: 1, Revisions: 1, ValueSizeBytes: int64(len("secret"))},
+	}))
+}
+
+func TestInspectWithoutDatabase(t *testing.T) {
+	g := NewWithT(t)
+	dataDir := t.TempDir()
+
+	report, err := Inspect(InspectOptions{DataDir: dataDir})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(report.WAL.Segments).To(BeZero())
+	g.Expect(report.Snap.Snapshots).To(BeZero())
+	g.Expect(report.Backend).To(BeNil())
+
+	_, err = Inspect(InspectOptions{DataDir: filepath.Join(dataDir, "nonexistent")})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestKeyPrefix(t *testing.T) {
+	table := []struct {
+		description string
+		key         string
+		depth       int
+		expected    string
+	}{
+		{"should cut keys deeper than the depth", "/registry/pods/default/nginx", 2, "/registry/pods/"},
+		{"should not include the name of the key", "/registry/health", 2, "/registry/"},
+		{"should group keys in the root", "/health", 2, "/"},
+		{"should group keys without leading slash", "foo/bar/baz", 1, "foo/"},
+		{"should group keys without any slash", "foo", 2, ""},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		g.Expect(KeyPrefix(entry.key, entry.depth)).To(Equal(entry.expected))
+	}
+}
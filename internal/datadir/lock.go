@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package datadir
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LockFileName is the name of the lock file, which is kept next to the data directory of etcd instead of inside it, so
+// that it survives a restore of the data directory by backup-restore.
+const LockFileName = "etcd-wrapper.lock"
+
+// lockAttempts is the number of attempts to lock a lock file which is concurrently removed by its holder.
+const lockAttempts = 3
+
+// LockFilePath returns the path of the lock file of dataDir, which is kept in the parent directory of dataDir.
+func LockFilePath(dataDir string) string {
+	return filepath.Join(filepath.Dir(filepath.Clean(dataDir)), LockFileName)
+}
+
+// LockHolder describes the process holding the lock of a data directory.
+type LockHolder struct {
+	// PID is the process ID of the holder.
+	PID int `json:"pid"`
+	// Hostname is the name of the host on which the holder runs.
+	Hostname string `json:"hostname"`
+	// StartedAt is the time at which the holder acquired the lock.
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// String returns a human-readable description of the holder.
+func (h LockHolder) String() string {
+	return fmt.Sprintf("process %d on host %s since %s", h.PID, h.Hostname, h.StartedAt.Format(time.RFC3339))
+}
+
+// LockedError is returned if the data directory is locked by another process.
+type LockedError struct {
+	// Path is the path of the lock file.
+	Path string
+	// Holder is the process holding the lock, it is nil if the lock file does not record a holder.
+	Holder *LockHolder
+}
+
+// Error implements the error interface.
+func (e *LockedError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("data directory is locked via %s by another process", e.Path)
+	}
+	return fmt.Sprintf("data directory is locked via %s by %s", e.Path, e.Holder)
+}
+
+// Lock is an exclusive advisory lock of a data directory.
+type Lock struct {
+	file   *os.File
+	path   string
+	holder LockHolder
+}
+
+// AcquireLock takes an exclusive advisory lock of a data directory via the lock file at path, creating the lock file
+// and its directory if they do not exist yet, and records the current process as its holder in the lock file. If
+// another process holds the lock a *LockedError naming it is returned. The lock is released when the process exits,
+// a holder recorded in a lock file which is not locked is therefore stale and replaced.
+func AcquireLock(path string, logger *zap.Logger) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory of lock file %s: %w", path, err)
+	}
+	var (
+		file *os.File
+		err  error
+	)
+	for range lockAttempts {
+		if file, err = lockFile(path); err != nil || file != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, fmt.Errorf("failed to lock %s: lock file is repeatedly removed by its holders", path)
+	}
+	if staleHolder, err := readLockHolder(file); err == nil && staleHolder != nil {
+		logger.Warn("Replacing stale lock of data directory, its holder has exited without releasing it", zap.String("lockFilePath", path), zap.Stringer("staleHolder", staleHolder))
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	lock := &Lock{
+		file:   file,
+		path:   path,
+		holder: LockHolder{PID: os.Getpid(), Hostname: hostname, StartedAt: time.Now().UTC()},
+	}
+	if err = lock.writeHolder(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to record holder in lock file %s: %w", path, err)
+	}
+	logger.Info("Acquired lock of data directory", zap.String("lockFilePath", path), zap.Stringer("holder", lock.holder))
+	return lock, nil
+}
+
+// lockFile opens and locks the lock file at path. It returns no file and no error if the locked file has been removed
+// by its previous holder in the meantime, in which case the lock has to be taken on the file now at path.
+func lockFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600) // #nosec G304 -- path is built from the configured data directory.
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s: %w", path, err)
+	}
+	if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil { // #nosec G115 -- file descriptors fit into an int.
+		holder, _ := readLockHolder(file)
+		_ = file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, &LockedError{Path: path, Holder: holder}
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	lockedInfo, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to stat lock file %s: %w", path, err)
+	}
+	if currentInfo, err := os.Stat(path); err != nil || !os.SameFile(lockedInfo, currentInfo) {
+		_ = file.Close()
+		return nil, nil
+	}
+	return file, nil
+}
+
+// Path returns the path of the lock file.
+func (l *Lock) Path() string {
+	return l.path
+}
+
+// Holder returns the holder recorded in the lock file.
+func (l *Lock) Holder() LockHolder {
+	return l.holder
+}
+
+// Release removes the lock file and releases the lock. The file is removed while it is still locked, so that no other
+// process can lock it in between.
+func (l *Lock) Release() error {
+	err := os.Remove(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return errors.Join(
+		err,
+		syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN), // #nosec G115 -- file descriptors fit into an int.
+		l.file.Close(),
+	)
+}
+
+func (l *Lock) writeHolder() error {
+	data, err := json.Marshal(l.holder)
+	if err != nil {
+		return err
+	}
+	if err = l.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err = l.file.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// readLockHolder returns the holder recorded in the lock file, or nil if none is recorded.
+func readLockHolder(file *os.File) (*LockHolder, error) {
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, 1<<20))
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	holder := &LockHolder{}
+	if err = json.Unmarshal(data, holder); err != nil {
+		return nil, err
+	}
+	return holder, nil
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package datadir
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestAcquireLock(t *testing.T) {
+	g := NewWithT(t)
+	dataDir := filepath.Join(t.TempDir(), "data", "new.etcd")
+	lockFilePath := LockFilePath(dataDir)
+	g.Expect(lockFilePath).To(Equal(filepath.Join(filepath.Dir(dataDir), LockFileName)))
+
+	lock, err := AcquireLock(lockFilePath, zap.NewNop())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(dataDir).ToNot(BeADirectory())
+	g.Expect(lock.Path()).To(Equal(lockFilePath))
+	g.Expect(lock.Holder().PID).To(Equal(os.Getpid()))
+	recorded, err := os.ReadFile(lockFilePath)
+	g.Expect(err).ToNot(HaveOccurred())
+	holder := LockHolder{}
+	g.Expect(json.Unmarshal(recorded, &holder)).To(Succeed())
+	g.Expect(holder.PID).To(Equal(os.Getpid()))
+
+	t.Log("a second lock of the same data directory names the holder")
+	_, err = AcquireLock(lockFilePath, zap.NewNop())
+	lockedErr := &LockedError{}
+	g.Expect(errors.As(err, &lockedErr)).To(BeTrue())
+	g.Expect(lockedErr.Holder).ToNot(BeNil())
+	g.Expect(lockedErr.Holder.PID).To(Equal(os.Getpid()))
+	g.Expect(err.Error()).To(ContainSubstring(lock.Holder().Hostname))
+
+	t.Log("the lock file is removed once the lock has been released, after which the data directory can be locked again")
+	g.Expect(lock.Release()).To(Succeed())
+	g.Expect(lockFilePath).ToNot(BeAnExistingFile())
+	lock, err = AcquireLock(lockFilePath, zap.NewNop())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(lock.Release()).To(Succeed())
+}
+
+func TestAcquireStaleLock(t *testing.T) {
+	g := NewWithT(t)
+	lockFilePath := filepath.Join(t.TempDir(), LockFileName)
+	staleHolder := LockHolder{PID: 1, Hostname: "other-host", StartedAt: time.Now().Add(-time.Hour)}
+	data, err := json.Marshal(staleHolder)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(os.WriteFile(lockFilePath, data, 0600)).To(Succeed())
+
+	lock, err := AcquireLock(lockFilePath, zap.NewNop())
+	g.Expect(err).ToNot(HaveOccurred())
+	defer func() { g.Expect(lock.Release()).To(Succeed()) }()
+	recorded, err := os.ReadFile(lockFilePath)
+	g.Expect(err).ToNot(HaveOccurred())
+	holder := LockHolder{}
+	g.Expect(json.Unmarshal(recorded, &holder)).To(Succeed())
+	g.Expect(holder.PID).To(Equal(os.Getpid()))
+}
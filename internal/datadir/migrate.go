@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package datadir
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	"go.uber.org/zap"
+)
+
+// MigrationsFileName is the name of the marker file in the data directory of etcd which records the applied
+// migrations. It is kept in the migrated directory, so that it is replaced together with the data on a restore.
+const MigrationsFileName = "etcd-wrapper-migrations"
+
+// Migration is a change of the data directory which is applied once. Migrations must be idempotent, as a migration
+// is applied again if recording it as applied fails.
+type Migration struct {
+	// ID identifies the migration. It must never change once the migration has been released.
+	ID string
+	// Description describes what the migration changes.
+	Description string
+	// Apply applies the migration to the data directory of etcd.
+	Apply func(dataDir string) error
+}
+
+// Migrations are the migrations of the data directory in the order in which they are applied. New migrations are
+// appended. A migration is retired by removing it once all data directories have been migrated, its ID then stays
+// in the marker files without any effect and must not be reused.
+var Migrations = []Migration{
+	{
+		ID:          "0001-restrict-file-permissions",
+		Description: "restricts the permissions of files created before etcd-wrapper set the umask 0077 to 0600",
+		Apply: func(dataDir string) error {
+			return changeFilePermissions(dataDir, 0600)
+		},
+	},
+	{
+		ID:          "0002-remove-legacy-validation-marker",
+		Description: "removes the validation_marker file of etcd-custom-image, which has been replaced by the exit_code file",
+		Apply: func(_ string) error {
+			return removeFileIfExists(types.ValidationMarkerFilePath)
+		},
+	},
+}
+
+// AppliedMigration records a migration which has been applied.
+type AppliedMigration struct {
+	// ID is the ID of the applied migration.
+	ID string `json:"id"`
+	// AppliedAt is the time at which the migration has been applied.
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+// Migrate applies all migrations to dataDir which are not yet recorded as applied in its marker file, in order, and
+// records every applied migration in the marker file. It stops at the first migration which fails. Failing to record
+// a migration is only logged.
+func Migrate(dataDir string, migrations []Migration, logger *zap.Logger) error {
+	migrationsFilePath := filepath.Join(dataDir, MigrationsFileName)
+	applied, err := readAppliedMigrations(migrationsFilePath)
+	if err != nil {
+		return err
+	}
+	appliedIDs := make(map[string]struct{}, len(applied))
+	for _, migration := range applied {
+		appliedIDs[migration.ID] = struct{}{}
+	}
+	for _, migration := range migrations {
+		if _, ok := appliedIDs[migration.ID]; ok {
+			continue
+		}
+		logger.Info("Applying data directory migration", zap.String("id", migration.ID), zap.String("description", migration.Description), zap.String("dataDir", dataDir))
+		if err = migration.Apply(dataDir); err != nil {
+			return fmt.Errorf("failed to apply data directory migration %s: %w", migration.ID, err)
+		}
+		applied = append(applied, AppliedMigration{ID: migration.ID, AppliedAt: time.Now().UTC()})
+		// migrations are idempotent, a migration which cannot be recorded is applied again on the next start
+		if err = writeAppliedMigrations(migrationsFilePath, applied); err != nil {
+			logger.Error("error while recording applied data directory migration", zap.String("id", migration.ID), zap.String("migrationsFilePath", migrationsFilePath), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// ReadAppliedMigrations returns the migrations recorded as applied in the marker file of dataDir. A missing file is
+// treated as no migration having been applied.
+func ReadAppliedMigrations(dataDir string) ([]AppliedMigration, error) {
+	return readAppliedMigrations(filepath.Join(dataDir, MigrationsFileName))
+}
+
+func readAppliedMigrations(migrationsFilePath string) ([]AppliedMigration, error) {
+	data, err := os.ReadFile(migrationsFilePath) // #nosec G304 -- path is built from the configured data directory.
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read applied data directory migrations from %s: %w", migrationsFilePath, err)
+	}
+	var applied []AppliedMigration
+	if err = json.Unmarshal(data, &applied); err != nil {
+		return nil, fmt.Errorf("failed to parse applied data directory migrations from %s: %w", migrationsFilePath, err)
+	}
+	return applied, nil
+}
+
+// writeAppliedMigrations replaces the marker file at migrationsFilePath atomically with the passed migrations.
+func writeAppliedMigrations(migrationsFilePath string, applied []AppliedMigration) error {
+	data, err := json.MarshalIndent(applied, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempFilePath := migrationsFilePath + ".tmp"
+	if err = os.WriteFile(tempFilePath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tempFilePath, migrationsFilePath)
+}
+
+// changeFilePermissions changes the file permissions of all files in the given directory and its subdirectories recursively.
+func changeFilePermissions(dir string, mode os.FileMode) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("error stating directory %s: %w", dir, err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("path %s is not a directory", dir)
+	}
+
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking the path %q: %w", path, err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if err = os.Chmod(path, mode); err != nil {
+			return fmt.Errorf("error changing file permissions for %q: %w", path, err)
+		}
+		return nil
+	})
+}
+
+func removeFileIfExists(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
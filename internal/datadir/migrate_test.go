@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package datadir
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestMigrate(t *testing.T) {
+	table := []struct {
+		description   string
+		applied       []string
+		failingID     string
+		expectError   bool
+		expectApplied []string
+		expectRecords []string
+	}{
+		{"apply all migrations in order if none has been applied", nil, "", false, []string{"0001", "0002", "0003"}, []string{"0001", "0002", "0003"}},
+		{"apply only migrations which have not been applied", []string{"0001", "0003"}, "", false, []string{"0002"}, []string{"0001", "0003", "0002"}},
+		{"ignore applied migrations which have been retired", []string{"0000", "0001", "0002", "0003"}, "", false, nil, []string{"0000", "0001", "0002", "0003"}},
+		{"stop at the first failing migration and record the ones applied before", nil, "0002", true, []string{"0001", "0002"}, []string{"0001"}},
+	}
+
+	for _, entry := range table {
+		t.Log(entry.description)
+		g := NewWithT(t)
+		dataDir := t.TempDir()
+		migrationsFilePath := filepath.Join(dataDir, MigrationsFileName)
+		if entry.applied != nil {
+			records := make([]AppliedMigration, 0, len(entry.applied))
+			for _, id := range entry.applied {
+				records = append(records, AppliedMigration{ID: id})
+			}
+			g.Expect(writeAppliedMigrations(migrationsFilePath, records)).To(Succeed())
+		}
+		var applied []string
+		migrations := make([]Migration, 0, 3)
+		for _, id := range []string{"0001", "0002", "0003"} {
+			migrations = append(migrations, Migration{ID: id, Apply: func(dir string) error {
+				g.Expect(dir).To(Equal(dataDir))
+				applied = append(applied, id)
+				if id == entry.failingID {
+					return errors.New("test error")
+				}
+				return nil
+			}})
+		}
+
+		err := Migrate(dataDir, migrations, zap.NewNop())
+		g.Expect(err != nil).To(Equal(entry.expectError))
+		g.Expect(applied).To(Equal(entry.expectApplied))
+		records, err := ReadAppliedMigrations(dataDir)
+		g.Expect(err).ToNot(HaveOccurred())
+		ids := make([]string, 0, len(records))
+		for _, record := range records {
+			ids = append(ids, record.ID)
+		}
+		g.Expect(ids).To(Equal(entry.expectRecords))
+	}
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	g := NewWithT(t)
+	dataDir := t.TempDir()
+	count := 0
+	migrations := []Migration{{ID: "0001", Apply: func(_ string) error {
+		count++
+		return nil
+	}}}
+
+	g.Expect(Migrate(dataDir, migrations, zap.NewNop())).To(Succeed())
+	g.Expect(Migrate(dataDir, migrations, zap.NewNop())).To(Succeed())
+	g.Expect(count).To(Equal(1))
+	g.Expect(filepath.Join(dataDir, MigrationsFileName)).To(BeAnExistingFile())
+}
+
+func TestMigrateWithUnwritableMigrationsFile(t *testing.T) {
+	g := NewWithT(t)
+	dataDir := filepath.Join(t.TempDir(), "nonexistent")
+	migrationsFilePath := filepath.Join(dataDir, MigrationsFileName)
+	count := 0
+	migrations := []Migration{{ID: "0001", Apply: func(_ string) error {
+		count++
+		return nil
+	}}}
+
+	g.Expect(Migrate(dataDir, migrations, zap.NewNop())).To(Succeed())
+	g.Expect(count).To(Equal(1))
+	g.Expect(migrationsFilePath).ToNot(BeAnExistingFile())
+}
+
+func TestReadAppliedMigrations(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+
+	applied, err := ReadAppliedMigrations(filepath.Join(dir, "missing"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(applied).To(BeEmpty())
+
+	invalidFilePath := filepath.Join(dir, "invalid")
+	g.Expect(os.WriteFile(invalidFilePath, []byte("not json"), 0600)).To(Succeed())
+	_, err = ReadAppliedMigrations(invalidFilePath)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestMigrationIDsAreUnique(t *testing.T) {
+	g := NewWithT(t)
+	ids := make(map[string]struct{}, len(Migrations))
+	for _, migration := range Migrations {
+		g.Expect(ids).ToNot(HaveKey(migration.ID))
+		ids[migration.ID] = struct{}{}
+	}
+}
+
+func TestChangeFilePermissions(t *testing.T) {
+	table := []struct {
+		description string
+		setup       func(testDir string) string
+		mode        os.FileMode
+		expectError bool
+		verify      func(t *testing.T, testDir string, mode os.FileMode)
+	}{
+		{
+			description: "change permissions of files in a directory recursively",
+			setup: func(testDir string) string {
+				filePath := filepath.Join(testDir, "testfile")
+				err := os.WriteFile(filePath, []byte("test"), 0644)
+				if err != nil {
+					t.Fatalf("failed to create test file: %v", err)
+				}
+				subDirPath := filepath.Join(testDir, "subdir")
+				err = os.Mkdir(subDirPath, 0755)
+				if err != nil {
+					t.Fatalf("failed to create test directory: %v", err)
+				}
+				subFilePath := filepath.Join(subDirPath, "subfile")
+				err = os.WriteFile(subFilePath, []byte("test"), 0644)
+				if err != nil {
+					t.Fatalf("failed to create test file: %v", err)
+				}
+				return testDir
+			},
+			mode:        0600,
+			expectError: false,
+			verify: func(t *testing.T, testDir string, mode os.FileMode) {
+				g := NewWithT(t)
+				paths := []string{
+					filepath.Join(testDir, "testfile"),
+					filepath.Join(testDir, "subdir", "subfile"),
+				}
+				for _, path := range paths {
+					info, err := os.Stat(path)
+					g.Expect(err).To(BeNil())
+					g.Expect(info.Mode().Perm()).To(Equal(mode))
+				}
+			},
+		},
+		{
+			description: "return nil error for non-existent directory",
+			setup: func(testDir string) string {
+				return filepath.Join(testDir, "nonexistent/path")
+			},
+			mode:        0600,
+			expectError: false,
+			verify:      func(_ *testing.T, _ string, _ os.FileMode) {},
+		},
+		{
+			description: "return error when path is a file, not a directory",
+			setup: func(testDir string) string {
+				filePath := filepath.Join(testDir, "testfile")
+				err := os.WriteFile(filePath, []byte("test"), 0644)
+				if err != nil {
+					t.Fatalf("failed to create test file: %v", err)
+				}
+				return filePath
+			},
+			mode:        0600,
+			expectError: true,
+			verify:      func(_ *testing.T, _ string, _ os.FileMode) {},
+		},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.description, func(t *testing.T) {
+			g := NewWithT(t)
+			testDir := t.TempDir()
+
+			path := entry.setup(testDir)
+			err := changeFilePermissions(path, entry.mode)
+			g.Expect(err != nil).To(Equal(entry.expectError))
+
+			entry.verify(t, testDir, entry.mode)
+		})
+	}
+}
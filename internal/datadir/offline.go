@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package datadir
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	etcddatadir "go.etcd.io/etcd/server/v3/datadir"
+	"go.etcd.io/etcd/server/v3/mvcc/backend"
+	"go.uber.org/zap"
+)
+
+// DefragReport describes an offline defragmentation of the database of etcd.
+type DefragReport struct {
+	// Path is the path of the database.
+	Path string `json:"path"`
+	// SizeBytesBefore is the size of the database file before the defragmentation.
+	SizeBytesBefore int64 `json:"sizeBytesBefore"`
+	// SizeInUseBytesBefore is the size of the database file which was in use before the defragmentation.
+	SizeInUseBytesBefore int64 `json:"sizeInUseBytesBefore"`
+	// SizeBytesAfter is the size of the database file after the defragmentation.
+	SizeBytesAfter int64 `json:"sizeBytesAfter"`
+	// ReclaimedBytes is the number of bytes by which the database file has shrunk.
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+	// DurationSeconds is the time the defragmentation took in seconds.
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// HashReport describes the hash of the key space of the database of etcd up to a revision.
+type HashReport struct {
+	// Path is the path of the database.
+	Path string `json:"path"`
+	// Hash is the hash of all revisions of the key space up to Revision which have not been compacted, the same hash
+	// which is returned by the HashKV API of etcd.
+	Hash uint32 `json:"hash"`
+	// Revision is the revision up to which the key space has been hashed.
+	Revision int64 `json:"revision"`
+	// CompactRevision is the revision up to which the key space has been compacted.
+	CompactRevision int64 `json:"compactRevision"`
+	// CurrentRevision is the latest revision of the key space.
+	CurrentRevision int64 `json:"currentRevision"`
+}
+
+// DefragOffline defragments the database in dataDir, which must not be in use, and returns the sizes of the database
+// before and after the defragmentation.
+func DefragOffline(dataDir string, logger *zap.Logger) (report *DefragReport, err error) {
+	be, release, err := openBackend(dataDir, logger)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errors.Join(err, release()) }()
+
+	report = &DefragReport{
+		Path:                 etcddatadir.ToBackendFileName(dataDir),
+		SizeBytesBefore:      be.Size(),
+		SizeInUseBytesBefore: be.SizeInUse(),
+	}
+	start := time.Now()
+	if err = be.Defrag(); err != nil {
+		return nil, fmt.Errorf("failed to defragment database %s: %w", report.Path, err)
+	}
+	report.DurationSeconds = time.Since(start).Seconds()
+	report.SizeBytesAfter = be.Size()
+	report.ReclaimedBytes = report.SizeBytesBefore - report.SizeBytesAfter
+	return report, nil
+}
+
+// HashKV computes the hash of the key space of the database in dataDir, which must not be in use, up to revision.
+// The latest revision is used if revision is 0. The hash can be compared with the one returned by the HashKV API of
+// other members for the same revision. The database is only read, it is hashed the same way as etcd does in
+// go.etcd.io/etcd/server/v3/mvcc, without restoring the key space, which would e.g. resume a scheduled compaction.
+func HashKV(dataDir string, revision int64) (*HashReport, error) {
+	path := etcddatadir.ToBackendFileName(dataDir)
+	db, err := openDBReadOnly(path, "hash")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	report := &HashReport{Path: path}
+	err = db.View(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(keyBucketName)
+		if keys == nil {
+			return fmt.Errorf("bucket %s does not exist", keyBucketName)
+		}
+		if meta := tx.Bucket(metaBucketName); meta != nil {
+			// a scheduled compaction which has not finished is resumed by etcd when it starts, after which the hash
+			// skips the same revisions as the one computed here
+			report.CompactRevision = max(mainRevision(meta.Get(finishedCompactKeyName)), mainRevision(meta.Get(scheduledCompactKeyName)))
+		}
+		var err error
+		report.Hash, report.Revision, report.CurrentRevision, err = hashKeys(keys, revision, report.CompactRevision)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// hashKeys computes the hash of the key bucket up to revision, which is the current revision if it is 0, like
+// etcd computes it for the HashKV API. Revisions up to the compact revision are only hashed if they are kept by a
+// compaction at revision.
+func hashKeys(keys *bolt.Bucket, revision, compactRevision int64) (hash uint32, hashedRevision, currentRevision int64, err error) {
+	// the revisions kept by a compaction at revision are the latest revisions of the keys up to revision, unless
+	// these have deleted the key
+	currentRevision = compactRevision
+	latest := make(map[string][]byte)
+	if err = keys.ForEach(func(rev, value []byte) error {
+		if len(rev) != revBytesLen && len(rev) != markedRevBytesLen {
+			return fmt.Errorf("unexpected revision of length %d in bucket %s", len(rev), keyBucketName)
+		}
+		main := mainRevision(rev)
+		currentRevision = max(currentRevision, main)
+		if revision > 0 && main > revision {
+			return nil
+		}
+		kv := mvccpb.KeyValue{}
+		if err := kv.Unmarshal(value); err != nil {
+			return fmt.Errorf("cannot decode key-value pair of revision %d: %w", main, err)
+		}
+		latest[string(kv.Key)] = rev
+		return nil
+	}); err != nil {
+		return 0, 0, 0, err
+	}
+	switch {
+	case revision > 0 && revision < compactRevision:
+		return 0, 0, 0, fmt.Errorf("revision %d has been compacted, the key space can only be hashed up to revisions after the compact revision %d", revision, compactRevision)
+	case revision > currentRevision:
+		return 0, 0, 0, fmt.Errorf("revision %d is newer than the latest revision %d", revision, currentRevision)
+	case revision == 0:
+		revision = currentRevision
+	}
+	keep := make(map[string]struct{}, len(latest))
+	for _, rev := range latest {
+		if len(rev) == revBytesLen {
+			keep[string(rev)] = struct{}{}
+		}
+	}
+
+	hasher := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	_, _ = hasher.Write(keyBucketName)
+	err = keys.ForEach(func(rev, value []byte) error {
+		main := mainRevision(rev)
+		if main > revision {
+			return nil
+		}
+		if main <= compactRevision {
+			if _, ok := keep[string(rev[:revBytesLen])]; !ok && len(keep) > 0 {
+				return nil
+			}
+			// tombstones at the compact revision are removed by the compaction of older versions of etcd
+			if main == compactRevision && len(rev) == markedRevBytesLen {
+				return nil
+			}
+		}
+		_, _ = hasher.Write(rev)
+		_, _ = hasher.Write(value)
+		return nil
+	})
+	return hasher.Sum32(), revision, currentRevision, err
+}
+
+// mainRevision returns the main revision of a revision as stored in the key and meta buckets, or 0 if it is not set.
+func mainRevision(rev []byte) int64 {
+	if len(rev) < 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(rev[:8])) // #nosec G115 -- revisions are stored as int64 by etcd.
+}
+
+// openBackend locks dataDir and opens its database for writing. The returned function closes the database and
+// releases the lock. It fails if the database does not exist or is in use, instead of waiting for it to be released.
+func openBackend(dataDir string, logger *zap.Logger) (backend.Backend, func() error, error) {
+	path := etcddatadir.ToBackendFileName(dataDir)
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil, fmt.Errorf("cannot access database %s: %w", path, err)
+	}
+	lock, err := AcquireLock(LockFilePath(dataDir), logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the backend of etcd waits forever for the lock of the database, so check that it is not held by an etcd
+	// which is not run by etcd-wrapper
+	db, err := openDBReadOnly(path, "defragment")
+	if err == nil {
+		err = db.Close()
+	}
+	if err != nil {
+		_ = lock.Release()
+		return nil, nil, err
+	}
+	be := backend.NewDefaultBackend(path)
+	return be, func() error {
+		return errors.Join(be.Close(), lock.Release())
+	}, nil
+}
+
+// openDBReadOnly opens the database at path for reading. It fails if the database is in use, instead of waiting for
+// it to be released, action names what cannot be done to a database in use.
+func openDBReadOnly(path, action string) (*bolt.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("cannot access database %s: %w", path, err)
+	}
+	db, err := bolt.Open(path, 0400, &bolt.Options{ReadOnly: true, Timeout: backendOpenTimeout})
+	if err != nil {
+		if errors.Is(err, bolt.ErrTimeout) {
+			return nil, fmt.Errorf("database %s is in use, etcd has to be stopped to %s it", path, action)
+		}
+		return nil, fmt.Errorf("cannot open database %s: %w", path, err)
+	}
+	return db, nil
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package datadir
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/testutil"
+
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.uber.org/zap"
+)
+
+func TestDefragOffline(t *testing.T) {
+	g := NewWithT(t)
+	dataDir := filepath.Join(t.TempDir(), "data")
+	etcd, err := testutil.StartEtcd(dataDir)
+	g.Expect(err).ToNot(HaveOccurred())
+	kvs := make(map[string]string, 1000)
+	for i := 0; i < 1000; i++ {
+		kvs[fmt.Sprintf("/registry/configmaps/cm-%d", i)] = strings.Repeat("x", 1024)
+	}
+	g.Expect(testutil.PutKeys(etcd, kvs)).To(Succeed())
+	g.Expect(testutil.PutKeys(etcd, map[string]string{"/registry/health": "ok"})).To(Succeed())
+	_, err = etcd.Server.DeleteRange(context.Background(), &etcdserverpb.DeleteRangeRequest{Key: []byte("/registry/configmaps/"), RangeEnd: []byte("/registry/configmaps0")})
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = etcd.Server.Compact(context.Background(), &etcdserverpb.CompactionRequest{Revision: etcd.Server.KV().Rev(), Physical: true})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	t.Log("the database cannot be defragmented while etcd is running")
+	_, err = DefragOffline(dataDir, zap.NewNop())
+	g.Expect(err).To(MatchError(ContainSubstring("is in use")))
+	etcd.Close()
+
+	report, err := DefragOffline(dataDir, zap.NewNop())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(report.SizeBytesAfter).To(BeNumerically("<", report.SizeBytesBefore))
+	g.Expect(report.ReclaimedBytes).To(Equal(report.SizeBytesBefore - report.SizeBytesAfter))
+	g.Expect(report.SizeInUseBytesBefore).To(BeNumerically("<", report.SizeBytesBefore))
+
+	inspectReport, err := Inspect(InspectOptions{DataDir: dataDir})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(inspectReport.Backend.SizeBytes).To(Equal(report.SizeBytesAfter))
+	g.Expect(inspectReport.Backend.Keys).To(Equal(1))
+}
+
+func TestHashKV(t *testing.T) {
+	g := NewWithT(t)
+	dataDir := filepath.Join(t.TempDir(), "data")
+	etcd, err := testutil.StartEtcd(dataDir)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(testutil.PutKeys(etcd, map[string]string{"/a": "1", "/b": "2", "/c": "3"})).To(Succeed())
+	g.Expect(testutil.DeleteKeys(etcd, "/b")).To(Succeed())
+	g.Expect(testutil.PutKeys(etcd, map[string]string{"/a": "4"})).To(Succeed())
+	_, err = etcd.Server.Compact(context.Background(), &etcdserverpb.CompactionRequest{Revision: 4, Physical: true})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(testutil.PutKeys(etcd, map[string]string{"/d": "5"})).To(Succeed())
+	g.Expect(testutil.PutKeys(etcd, map[string]string{"/a": "6"})).To(Succeed())
+	g.Expect(testutil.DeleteKeys(etcd, "/c")).To(Succeed())
+	currentRevision := etcd.Server.KV().Rev()
+	onlineHashes := make(map[int64]uint32)
+	for revision := int64(4); revision <= currentRevision; revision++ {
+		onlineHash, _, err := etcd.Server.KV().HashStorage().HashByRev(revision)
+		g.Expect(err).ToNot(HaveOccurred())
+		onlineHashes[revision] = onlineHash.Hash
+	}
+
+	t.Log("a database in use cannot be hashed")
+	_, err = HashKV(dataDir, 0)
+	g.Expect(err).To(MatchError(ContainSubstring("is in use")))
+	etcd.Close()
+
+	backendPath := filepath.Join(dataDir, "member", "snap", "db")
+	before, err := os.ReadFile(backendPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	for revision, onlineHash := range onlineHashes {
+		report, err := HashKV(dataDir, revision)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(report.Hash).To(Equal(onlineHash), "hash of revision %d", revision)
+		g.Expect(report.Revision).To(Equal(revision))
+		g.Expect(report.CompactRevision).To(BeEquivalentTo(4))
+		g.Expect(report.CurrentRevision).To(Equal(currentRevision))
+	}
+
+	t.Log("the latest revision is hashed if no revision is passed")
+	report, err := HashKV(dataDir, 0)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(report.Revision).To(Equal(currentRevision))
+	g.Expect(report.Hash).To(Equal(onlineHashes[currentRevision]))
+
+	_, err = HashKV(dataDir, 3)
+	g.Expect(err).To(MatchError(ContainSubstring("has been compacted")))
+	_, err = HashKV(dataDir, currentRevision+1)
+	g.Expect(err).To(MatchError(ContainSubstring("is newer than the latest revision")))
+	_, err = HashKV(filepath.Join(dataDir, "nonexistent"), 0)
+	g.Expect(err).To(HaveOccurred())
+
+	t.Log("the data directory is only read")
+	after, err := os.ReadFile(backendPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(after).To(Equal(before))
+	g.Expect(LockFilePath(dataDir)).ToNot(BeAnExistingFile())
+	g.Expect(filepath.Join(dataDir, LockFileName)).ToNot(BeAnExistingFile())
+}
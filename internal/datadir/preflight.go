@@ -0,0 +1,279 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package datadir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/etcdserver"
+)
+
+// CheckStatus is the outcome of a single pre-flight check.
+type CheckStatus string
+
+const (
+	// CheckPassed denotes a check which found no problem.
+	CheckPassed CheckStatus = "passed"
+	// CheckWarning denotes a check which found a problem that does not prevent etcd from starting.
+	CheckWarning CheckStatus = "warning"
+	// CheckFailed denotes a check which found a problem that prevents etcd from running.
+	CheckFailed CheckStatus = "failed"
+)
+
+// Names of the pre-flight checks.
+const (
+	// CheckOwnership checks that the directory exists and is owned by the user running etcd.
+	CheckOwnership = "ownership"
+	// CheckWritable checks that files can be created in the directory.
+	CheckWritable = "writable"
+	// CheckFreeSpace checks that the file system has enough free space for etcd.
+	CheckFreeSpace = "free-space"
+	// CheckFileSystemType checks that the directory does not reside on a network file system.
+	CheckFileSystemType = "filesystem-type"
+	// CheckFsyncLatency measures the latency of fsync in the directory.
+	CheckFsyncLatency = "fsync-latency"
+)
+
+const (
+	// DirData is the kind of the data directory of etcd.
+	DirData = "data"
+	// DirWAL is the kind of the dedicated WAL directory of etcd.
+	DirWAL = "wal"
+
+	// minFreeBytes is the free space below which etcd cannot run at all, as it pre-allocates WAL segments of this size.
+	minFreeBytes = 64 * 1024 * 1024
+	// fsyncProbeCount is the number of fsyncs over which the latency is averaged.
+	fsyncProbeCount = 5
+	// fsyncProbeSize is the size of the data written before every probed fsync, the size of a WAL page.
+	fsyncProbeSize = 4096
+	// fsyncLatencyWarningThreshold is the average fsync latency above which a warning is reported. etcd requires
+	// a 99th percentile of the WAL fsync latency below 10ms to run reliably.
+	fsyncLatencyWarningThreshold = 10 * time.Millisecond
+)
+
+// networkFileSystems maps the magic numbers of network file systems, see statfs(2), to their names.
+var networkFileSystems = map[int64]string{
+	0x6969:     "nfs",
+	0xff534d42: "cifs",
+	0x517b:     "smb",
+	0xfe534d42: "smb2",
+	0x00c36400: "ceph",
+	0x65735546: "fuse",
+	0x564c:     "ncp",
+	0x5346414f: "afs",
+}
+
+// CheckResult is the result of a single pre-flight check of a directory.
+type CheckResult struct {
+	// Name is the name of the check.
+	Name string
+	// Dir is the kind of the checked directory, either DirData or DirWAL.
+	Dir string
+	// Path is the path of the checked directory.
+	Path string
+	// Status is the outcome of the check.
+	Status CheckStatus
+	// Message describes the outcome of the check.
+	Message string
+	// Value is the measured value of checks which measure something, like the free space in bytes or the fsync
+	// latency in seconds.
+	Value float64
+}
+
+// PreflightOptions are the options of the pre-flight checks.
+type PreflightOptions struct {
+	// DataDir is the data directory of etcd.
+	DataDir string
+	// WALDir is the dedicated WAL directory of etcd. It is empty if the WAL resides in the data directory.
+	WALDir string
+	// QuotaBackendBytes is the backend quota of etcd. If it is 0, the default quota of etcd is assumed.
+	QuotaBackendBytes int64
+}
+
+// RunPreflightChecks checks the data directory, and the WAL directory if it is a dedicated one, before etcd is
+// started. Directories which do not exist yet are checked via their closest existing parent, in which etcd will
+// create them.
+func RunPreflightChecks(opts PreflightOptions) []CheckResult {
+	quota := opts.QuotaBackendBytes
+	if quota <= 0 {
+		quota = etcdserver.DefaultQuotaBytes
+	}
+	// the database can grow up to the quota, the space already used by it is not needed anymore
+	requiredBytes := quota - fileSize(filepath.Join(opts.DataDir, "member", "snap", "db"))
+	results := checkDir(DirData, opts.DataDir, requiredBytes)
+	if opts.WALDir != "" {
+		results = append(results, checkDir(DirWAL, opts.WALDir, minFreeBytes)...)
+	}
+	return results
+}
+
+// HasFailures returns true if any of the results has failed.
+func HasFailures(results []CheckResult) bool {
+	for _, result := range results {
+		if result.Status == CheckFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDir runs all checks for the directory of the passed kind at path. The free space is checked against
+// requiredBytes.
+func checkDir(kind, path string, requiredBytes int64) []CheckResult {
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+	newResult := func(name string, status CheckStatus, value float64, format string, args ...any) CheckResult {
+		return CheckResult{Name: name, Dir: kind, Path: path, Status: status, Message: fmt.Sprintf(format, args...), Value: value}
+	}
+	existingDir, err := closestExistingDir(path)
+	if err != nil {
+		message := fmt.Sprintf("neither %s nor any of its parents can be accessed: %v", path, err)
+		results := make([]CheckResult, 0, 5)
+		for _, name := range []string{CheckOwnership, CheckWritable, CheckFreeSpace, CheckFileSystemType, CheckFsyncLatency} {
+			results = append(results, newResult(name, CheckFailed, 0, "%s", message))
+		}
+		return results
+	}
+	return []CheckResult{
+		checkOwnership(existingDir, path, newResult),
+		checkWritable(existingDir, newResult),
+		checkFreeSpace(existingDir, requiredBytes, newResult),
+		checkFileSystemType(existingDir, newResult),
+		checkFsyncLatency(existingDir, newResult),
+	}
+}
+
+type resultFunc func(name string, status CheckStatus, value float64, format string, args ...any) CheckResult
+
+func checkOwnership(existingDir, path string, newResult resultFunc) CheckResult {
+	info, err := os.Stat(existingDir)
+	if err != nil {
+		return newResult(CheckOwnership, CheckFailed, 0, "cannot stat %s: %v", existingDir, err)
+	}
+	if !info.IsDir() {
+		return newResult(CheckOwnership, CheckFailed, 0, "%s is not a directory", existingDir)
+	}
+	if existingDir != path {
+		return newResult(CheckOwnership, CheckPassed, 0, "%s does not exist yet and will be created in %s", path, existingDir)
+	}
+	uid := os.Geteuid()
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || uid == 0 || int(stat.Uid) == uid {
+		return newResult(CheckOwnership, CheckPassed, 0, "%s exists and is owned by the user running etcd", path)
+	}
+	if info.Mode().Perm()&0o022 != 0 {
+		return newResult(CheckOwnership, CheckWarning, 0, "%s is owned by uid %d instead of uid %d running etcd, but writable by group or others", path, stat.Uid, uid)
+	}
+	return newResult(CheckOwnership, CheckFailed, 0, "%s is owned by uid %d instead of uid %d running etcd", path, stat.Uid, uid)
+}
+
+func checkWritable(dir string, newResult resultFunc) CheckResult {
+	file, err := os.CreateTemp(dir, ".preflight-writable-*")
+	if err != nil {
+		return newResult(CheckWritable, CheckFailed, 0, "cannot create a file in %s: %v", dir, err)
+	}
+	_, err = file.Write([]byte("etcd-wrapper"))
+	err = errors.Join(err, file.Close(), os.Remove(file.Name()))
+	if err != nil {
+		return newResult(CheckWritable, CheckFailed, 0, "cannot write to a file in %s: %v", dir, err)
+	}
+	return newResult(CheckWritable, CheckPassed, 0, "%s is writable", dir)
+}
+
+func checkFreeSpace(dir string, requiredBytes int64, newResult resultFunc) CheckResult {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return newResult(CheckFreeSpace, CheckFailed, 0, "cannot determine the free space of the file system of %s: %v", dir, err)
+	}
+	freeBytes := int64(stat.Bavail) * int64(stat.Bsize) // #nosec G115 -- free block count and size of a file system fit into an int64.
+	switch {
+	case freeBytes < minFreeBytes:
+		return newResult(CheckFreeSpace, CheckFailed, float64(freeBytes), "only %d bytes are free in %s, etcd needs at least %d bytes to write its WAL", freeBytes, dir, minFreeBytes)
+	case freeBytes < requiredBytes:
+		return newResult(CheckFreeSpace, CheckWarning, float64(freeBytes), "only %d bytes are free in %s, the database can still grow by %d bytes until it reaches its quota", freeBytes, dir, requiredBytes)
+	default:
+		return newResult(CheckFreeSpace, CheckPassed, float64(freeBytes), "%d bytes are free in %s", freeBytes, dir)
+	}
+}
+
+func checkFileSystemType(dir string, newResult resultFunc) CheckResult {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return newResult(CheckFileSystemType, CheckWarning, 0, "cannot determine the file system type of %s: %v", dir, err)
+	}
+	if name, ok := networkFileSystems[int64(stat.Type)]; ok { // #nosec G115 -- file system magic numbers fit into an int64.
+		return newResult(CheckFileSystemType, CheckWarning, 0, "%s resides on a %s file system, network file systems are not recommended for etcd as they often have a high fsync latency and may not honour fsync", dir, name)
+	}
+	return newResult(CheckFileSystemType, CheckPassed, 0, "%s resides on a local file system", dir)
+}
+
+func checkFsyncLatency(dir string, newResult resultFunc) CheckResult {
+	latency, err := measureFsyncLatency(dir)
+	if err != nil {
+		return newResult(CheckFsyncLatency, CheckWarning, 0, "cannot measure the fsync latency in %s: %v", dir, err)
+	}
+	if latency > fsyncLatencyWarningThreshold {
+		return newResult(CheckFsyncLatency, CheckWarning, latency.Seconds(), "average fsync latency in %s is %s, which exceeds the %s recommended for etcd", dir, latency, fsyncLatencyWarningThreshold)
+	}
+	return newResult(CheckFsyncLatency, CheckPassed, latency.Seconds(), "average fsync latency in %s is %s", dir, latency)
+}
+
+// measureFsyncLatency returns the average latency of fsync after writing a WAL page to a temporary file in dir.
+func measureFsyncLatency(dir string) (latency time.Duration, err error) {
+	file, err := os.CreateTemp(dir, ".preflight-fsync-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err = errors.Join(err, file.Close(), os.Remove(file.Name()))
+	}()
+	page := make([]byte, fsyncProbeSize)
+	var total time.Duration
+	for i := 0; i < fsyncProbeCount; i++ {
+		if _, err = file.Write(page); err != nil {
+			return 0, err
+		}
+		start := time.Now()
+		if err = file.Sync(); err != nil {
+			return 0, err
+		}
+		total += time.Since(start)
+	}
+	return total / fsyncProbeCount, nil
+}
+
+// closestExistingDir returns path, or its closest existing parent if it does not exist.
+func closestExistingDir(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		_, err = os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(path)
+		if !errors.Is(err, os.ErrNotExist) || parent == path {
+			return "", err
+		}
+		path = parent
+	}
+}
+
+// fileSize returns the size of the file at path, or 0 if it does not exist.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
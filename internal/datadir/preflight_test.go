@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package datadir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRunPreflightChecks(t *testing.T) {
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "data")
+	g := NewWithT(t)
+	g.Expect(os.MkdirAll(dataDir, 0700)).To(Succeed())
+	notADir := filepath.Join(dir, "not-a-dir")
+	g.Expect(os.WriteFile(notADir, []byte("etcd"), 0600)).To(Succeed())
+
+	table := []struct {
+		description        string
+		opts               PreflightOptions
+		expectedResults    int
+		expectFailures     bool
+		expectedStatusByID map[string]CheckStatus
+	}{
+		{"should pass an existing data directory", PreflightOptions{DataDir: dataDir, QuotaBackendBytes: 1 << 20}, 5, false,
+			map[string]CheckStatus{CheckOwnership: CheckPassed, CheckWritable: CheckPassed, CheckFreeSpace: CheckPassed}},
+		{"should check the closest existing parent of a data directory which does not exist yet", PreflightOptions{DataDir: filepath.Join(dataDir, "new.etcd"), QuotaBackendBytes: 1 << 20}, 5, false,
+			map[string]CheckStatus{CheckOwnership: CheckPassed, CheckWritable: CheckPassed}},
+		{"should fail a data directory which is a file", PreflightOptions{DataDir: notADir}, 5, true,
+			map[string]CheckStatus{CheckOwnership: CheckFailed}},
+		{"should warn if the quota does not fit into the free space", PreflightOptions{DataDir: dataDir, QuotaBackendBytes: 1 << 60}, 5, false,
+			map[string]CheckStatus{CheckFreeSpace: CheckWarning}},
+		{"should check a dedicated WAL directory", PreflightOptions{DataDir: dataDir, WALDir: filepath.Join(dir, "wal"), QuotaBackendBytes: 1 << 20}, 10, false, nil},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		results := RunPreflightChecks(entry.opts)
+		g.Expect(results).To(HaveLen(entry.expectedResults))
+		g.Expect(HasFailures(results)).To(Equal(entry.expectFailures), "%+v", results)
+		for _, result := range results {
+			g.Expect(result.Message).ToNot(BeEmpty())
+			if result.Dir != DirData {
+				continue
+			}
+			if expectedStatus, ok := entry.expectedStatusByID[result.Name]; ok {
+				g.Expect(result.Status).To(Equal(expectedStatus), "%+v", result)
+			}
+		}
+		// the checks do not leave any files behind
+		entries, err := os.ReadDir(dataDir)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(entries).To(BeEmpty())
+	}
+}
+
+func TestRunPreflightChecksMeasures(t *testing.T) {
+	g := NewWithT(t)
+	results := RunPreflightChecks(PreflightOptions{DataDir: t.TempDir()})
+	for _, result := range results {
+		switch result.Name {
+		case CheckFreeSpace:
+			g.Expect(result.Value).To(BeNumerically(">", 0))
+		case CheckFsyncLatency:
+			g.Expect(result.Value).To(BeNumerically(">", 0))
+		}
+	}
+}
+
+func TestRunPreflightChecksFailsForReadOnlyDirectory(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	g := NewWithT(t)
+	dataDir := filepath.Join(t.TempDir(), "data")
+	g.Expect(os.MkdirAll(dataDir, 0500)).To(Succeed())
+	defer func() { _ = os.Chmod(dataDir, 0700) }()
+
+	results := RunPreflightChecks(PreflightOptions{DataDir: dataDir})
+	g.Expect(HasFailures(results)).To(BeTrue())
+	for _, result := range results {
+		if result.Name == CheckWritable {
+			g.Expect(result.Status).To(Equal(CheckFailed))
+		}
+	}
+}
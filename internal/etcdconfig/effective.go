@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcdconfig
+
+import (
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+var (
+	// untaggedFieldKeys maps fields of embed.Config which are not tagged with the key used in etcd configuration
+	// files to that key.
+	untaggedFieldKeys = map[string]string{
+		"ListenPeerUrls":       "listen-peer-urls",
+		"ListenClientUrls":     "listen-client-urls",
+		"ListenClientHttpUrls": "listen-client-http-urls",
+		"AdvertisePeerUrls":    "initial-advertise-peer-urls",
+		"AdvertiseClientUrls":  "advertise-client-urls",
+		"ClientTLSInfo":        "client-transport-security",
+		"ClientAutoTLS":        "client-auto-tls",
+		"PeerTLSInfo":          "peer-transport-security",
+		"PeerAutoTLS":          "peer-auto-tls",
+		"CORS":                 "cors",
+		"HostWhitelist":        "host-whitelist",
+		"ListenMetricsUrls":    "listen-metrics-urls",
+	}
+	// skippedFields are fields of embed.Config which are derived from other fields.
+	skippedFields = map[string]struct{}{
+		"ListenMetricsUrlsJSON": {},
+	}
+	// tlsInfoKeys maps fields of transport.TLSInfo to their keys in etcd configuration files.
+	tlsInfoKeys = map[string]string{
+		"CertFile":            "cert-file",
+		"KeyFile":             "key-file",
+		"ClientCertFile":      "client-cert-file",
+		"ClientKeyFile":       "client-key-file",
+		"ClientCertAuth":      "client-cert-auth",
+		"TrustedCAFile":       "trusted-ca-file",
+		"CRLFile":             "crl-file",
+		"AllowedCN":           "allowed-cn",
+		"AllowedHostname":     "allowed-hostname",
+		"SkipClientSANVerify": "skip-client-san-verification",
+	}
+
+	durationType = reflect.TypeOf(time.Duration(0))
+	urlType      = reflect.TypeOf(url.URL{})
+	tlsInfoType  = reflect.TypeOf(transport.TLSInfo{})
+)
+
+// EffectiveConfig returns the fields of cfg which determine the behaviour of the embedded etcd, keyed by the names
+// used in etcd configuration files. Fields which cannot be represented, like functions and loggers, are left out and
+// the values of sensitive fields, see types.IsSensitiveEtcdConfigKey, are redacted.
+func EffectiveConfig(cfg *embed.Config) map[string]any {
+	effective := make(map[string]any)
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if _, ok := skippedFields[field.Name]; ok || !field.IsExported() {
+			continue
+		}
+		key := fieldKey(field)
+		if key == "" {
+			continue
+		}
+		if value, ok := toPlainValue(key, v.Field(i)); ok {
+			effective[key] = value
+		}
+	}
+	return effective
+}
+
+// fieldKey returns the key of a field of embed.Config in etcd configuration files, or an empty string if it is not
+// part of the configuration.
+func fieldKey(field reflect.StructField) string {
+	if key, ok := untaggedFieldKeys[field.Name]; ok {
+		return key
+	}
+	tag, ok := field.Tag.Lookup("json")
+	if !ok {
+		return field.Name
+	}
+	key, _, _ := strings.Cut(tag, ",")
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+// toPlainValue converts v, the value of the field with the passed key, into a value which can be marshalled to YAML or
+// JSON. It returns false for values which cannot be represented.
+func toPlainValue(key string, v reflect.Value) (any, bool) {
+	if types.IsSensitiveEtcdConfigKey(key) && !v.IsZero() {
+		return types.RedactedValue, true
+	}
+	switch v.Type() {
+	case durationType:
+		return time.Duration(v.Int()).String(), true
+	case urlType:
+		u := v.Interface().(url.URL)
+		return u.String(), true
+	}
+	switch v.Kind() {
+	case reflect.Func, reflect.Chan, reflect.Pointer, reflect.Interface, reflect.UnsafePointer:
+		return nil, false
+	case reflect.Slice:
+		values := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if value, ok := toPlainValue(key, v.Index(i)); ok {
+				values = append(values, value)
+			}
+		}
+		return values, true
+	case reflect.Map:
+		// maps are only used for sets of strings, like the allowed CORS origins
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.Struct {
+			return nil, false
+		}
+		keys := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		return keys, true
+	case reflect.Struct:
+		values := make(map[string]any)
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			nestedKey := field.Name
+			if tlsInfoKey, ok := tlsInfoKeys[field.Name]; ok && v.Type() == tlsInfoType {
+				nestedKey = tlsInfoKey
+			}
+			if value, ok := toPlainValue(key+"."+nestedKey, v.Field(i)); ok {
+				values[nestedKey] = value
+			}
+		}
+		return values, true
+	default:
+		return v.Interface(), true
+	}
+}
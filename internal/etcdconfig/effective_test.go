@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcdconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/server/v3/embed"
+	"sigs.k8s.io/yaml"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "etcd.conf.yaml")
+	config := fmt.Sprintf(validConfig, filepath.Join(dir, "data")) + "initial-cluster-token: secret-token\n"
+	g.Expect(os.WriteFile(configPath, []byte(config), 0600)).To(Succeed())
+	cfg, err := embed.ConfigFromFile(configPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	cfg.CORS = map[string]struct{}{"https://b.example.com": {}, "https://a.example.com": {}}
+	cfg.PeerTLSInfo.CertFile = "/var/etcd/ssl/peer/tls.crt"
+	cfg.PeerTLSInfo.KeyFile = "/var/etcd/ssl/peer/tls.key"
+
+	effective := EffectiveConfig(cfg)
+	g.Expect(effective).To(HaveKeyWithValue("name", "etcd-0"))
+	g.Expect(effective).To(HaveKeyWithValue("quota-backend-bytes", int64(1073741824)))
+	g.Expect(effective).To(HaveKeyWithValue("listen-client-urls", []any{"http://127.0.0.1:2379"}))
+	g.Expect(effective).To(HaveKeyWithValue("initial-advertise-peer-urls", []any{"http://127.0.0.1:2380"}))
+	g.Expect(effective).To(HaveKeyWithValue("grpc-keepalive-min-time", "5s"))
+	g.Expect(effective).To(HaveKeyWithValue("cors", []string{"https://a.example.com", "https://b.example.com"}))
+	g.Expect(effective).To(HaveKeyWithValue("peer-transport-security", HaveKeyWithValue("cert-file", "/var/etcd/ssl/peer/tls.crt")))
+	g.Expect(effective).To(HaveKeyWithValue("peer-transport-security", HaveKeyWithValue("key-file", types.RedactedValue)))
+	g.Expect(effective).To(HaveKeyWithValue("client-transport-security", HaveKeyWithValue("key-file", "")))
+	g.Expect(effective).To(HaveKeyWithValue("initial-cluster-token", types.RedactedValue))
+	g.Expect(effective).To(HaveKeyWithValue("auth-token", types.RedactedValue))
+	g.Expect(effective).ToNot(HaveKey("ZapLoggerBuilder"))
+	g.Expect(effective).ToNot(HaveKey("ListenMetricsUrlsJSON"))
+
+	// the effective configuration must be printable
+	data, err := yaml.Marshal(effective)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(data)).ToNot(ContainSubstring("secret-token"))
+	g.Expect(string(data)).ToNot(ContainSubstring("tls.key"))
+}
+
+func TestEffectiveConfigDoesNotRedactEmptyValues(t *testing.T) {
+	g := NewWithT(t)
+	cfg := embed.NewConfig()
+	cfg.InitialClusterToken = ""
+	g.Expect(EffectiveConfig(cfg)).To(HaveKeyWithValue("initial-cluster-token", ""))
+}
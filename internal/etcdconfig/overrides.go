@@ -0,0 +1,197 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcdconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.uber.org/zap"
+	"sigs.k8s.io/yaml"
+)
+
+// fileOnlyKeys are the keys of etcd configuration files which are not tagged on a field of embed.Config.
+var fileOnlyKeys = []string{
+	"listen-peer-urls",
+	"listen-client-urls",
+	"listen-client-http-urls",
+	"initial-advertise-peer-urls",
+	"advertise-client-urls",
+	"listen-metrics-urls",
+	"cors",
+	"host-whitelist",
+	"client-transport-security",
+	"peer-transport-security",
+}
+
+// override is a single change of an etcd configuration.
+type override struct {
+	// path are the keys leading to the overridden field.
+	path []string
+	// value is the new value of the field.
+	value any
+	// source is where the override has been configured.
+	source string
+}
+
+// LoadConfig loads the etcd configuration file at path like embed.ConfigFromFile, after applying overrides. The
+// file itself is not changed, the configuration with the overrides applied is written to a temporary file next to it,
+// which is only readable by the owner as it may contain secrets, and removed once it has been loaded. Every applied
+// override is logged.
+func LoadConfig(path string, overrides types.EtcdConfigOverridesConfig, logger *zap.Logger) (*embed.Config, error) {
+	if overrides.IsEmpty() {
+		return embed.ConfigFromFile(path)
+	}
+	changes, err := parseOverrides(overrides)
+	if err != nil {
+		return nil, err
+	}
+	etcdConfig, err := readYAMLFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		key := strings.Join(change.path, ".")
+		loggedValue := change.value
+		if types.IsSensitiveEtcdConfigKey(key) {
+			loggedValue = types.RedactedValue
+		}
+		logger.Info("Overriding field of etcd configuration", zap.String("key", key), zap.Any("value", loggedValue), zap.String("source", change.source))
+		if err = setValue(etcdConfig, change.path, change.value); err != nil {
+			return nil, fmt.Errorf("failed to apply etcd configuration override %s from %s: %w", key, change.source, err)
+		}
+	}
+
+	data, err := yaml.Marshal(etcdConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal etcd configuration with overrides: %w", err)
+	}
+	// os.CreateTemp creates the file with the permissions 0600
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".overrides.*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file for etcd configuration with overrides: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tempFile.Name())
+	}()
+	_, err = tempFile.Write(data)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write etcd configuration with overrides: %w", err)
+	}
+	return embed.ConfigFromFile(tempFile.Name())
+}
+
+// parseOverrides returns the changes of the overlay file followed by the key=value overrides, so that the latter take
+// precedence. Overrides of unknown fields are rejected, as etcd silently ignores them.
+func parseOverrides(overrides types.EtcdConfigOverridesConfig) ([]override, error) {
+	var changes []override
+	if overrides.OverlayFilePath != "" {
+		overlay, err := readYAMLFile(overrides.OverlayFilePath)
+		if err != nil {
+			return nil, err
+		}
+		changes = flatten(nil, overlay, overrides.OverlayFilePath)
+	}
+	for _, keyValue := range overrides.Overrides {
+		key, rawValue, found := strings.Cut(keyValue, "=")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("etcd configuration override %q should be of the format <key>=<value>", keyValue)
+		}
+		var value any
+		if err := yaml.Unmarshal([]byte(rawValue), &value); err != nil {
+			// values which are no valid YAML are taken as they are
+			value = rawValue
+		}
+		changes = append(changes, override{path: strings.Split(strings.TrimSpace(key), "."), value: value, source: "--etcd-config-override"})
+	}
+
+	knownKeys := configFileKeys()
+	var err error
+	for _, change := range changes {
+		if _, ok := knownKeys[change.path[0]]; !ok {
+			err = errors.Join(err, fmt.Errorf("unknown etcd configuration field %s in override from %s", change.path[0], change.source))
+		}
+	}
+	return changes, err
+}
+
+// flatten returns an override for every value in values which is not a map.
+func flatten(path []string, values map[string]any, source string) []override {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var changes []override
+	for _, key := range keys {
+		keyPath := append(append([]string{}, path...), key)
+		if nested, ok := values[key].(map[string]any); ok {
+			changes = append(changes, flatten(keyPath, nested, source)...)
+			continue
+		}
+		changes = append(changes, override{path: keyPath, value: values[key], source: source})
+	}
+	return changes
+}
+
+// setValue sets the value at path in values, creating intermediate maps where needed.
+func setValue(values map[string]any, path []string, value any) error {
+	for _, key := range path[:len(path)-1] {
+		nested, ok := values[key].(map[string]any)
+		if !ok {
+			if values[key] != nil {
+				return fmt.Errorf("field %s is not a map", key)
+			}
+			nested = make(map[string]any)
+			values[key] = nested
+		}
+		values = nested
+	}
+	values[path[len(path)-1]] = value
+	return nil
+}
+
+// configFileKeys returns the top-level keys of etcd configuration files.
+func configFileKeys() map[string]struct{} {
+	keys := make(map[string]struct{})
+	for _, key := range fileOnlyKeys {
+		keys[key] = struct{}{}
+	}
+	configType := reflect.TypeOf(embed.Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		if tag, ok := configType.Field(i).Tag.Lookup("json"); ok {
+			if key, _, _ := strings.Cut(tag, ","); key != "-" {
+				keys[key] = struct{}{}
+			}
+		}
+	}
+	return keys
+}
+
+func readYAMLFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path of an etcd configuration passed by the operator.
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var values map[string]any
+	if err = yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if values == nil {
+		values = make(map[string]any)
+	}
+	return values, nil
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcdconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoadConfig(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "etcd.conf.yaml")
+	config := fmt.Sprintf(validConfig, filepath.Join(dir, "data"))
+	g.Expect(os.WriteFile(configPath, []byte(config), 0600)).To(Succeed())
+	overlayPath := filepath.Join(dir, "overlay.yaml")
+	g.Expect(os.WriteFile(overlayPath, []byte(`quota-backend-bytes: 4294967296
+experimental-warning-apply-duration: 200000000
+client-transport-security:
+  cert-file: /var/etcd/ssl/server/tls.crt
+`), 0600)).To(Succeed())
+
+	table := []struct {
+		description string
+		overrides   types.EtcdConfigOverridesConfig
+		expectError bool
+		check       func(g *WithT, cfg *embed.Config)
+	}{
+		{"should load the configuration as is without overrides", types.EtcdConfigOverridesConfig{}, false, func(g *WithT, cfg *embed.Config) {
+			g.Expect(cfg.QuotaBackendBytes).To(Equal(int64(1073741824)))
+		}},
+		{"should apply overrides passed as key=value", types.EtcdConfigOverridesConfig{Overrides: []string{"snapshot-count=10000", "experimental-initial-corrupt-check=true"}}, false, func(g *WithT, cfg *embed.Config) {
+			g.Expect(cfg.SnapshotCount).To(Equal(uint64(10000)))
+			g.Expect(cfg.ExperimentalInitialCorruptCheck).To(BeTrue())
+			g.Expect(cfg.Name).To(Equal("etcd-0"))
+		}},
+		{"should merge the overlay file", types.EtcdConfigOverridesConfig{OverlayFilePath: overlayPath}, false, func(g *WithT, cfg *embed.Config) {
+			g.Expect(cfg.QuotaBackendBytes).To(Equal(int64(4294967296)))
+			g.Expect(cfg.ExperimentalWarningApplyDuration.String()).To(Equal("200ms"))
+			g.Expect(cfg.ClientTLSInfo.CertFile).To(Equal("/var/etcd/ssl/server/tls.crt"))
+			g.Expect(cfg.ListenClientUrls[0].String()).To(Equal("http://127.0.0.1:2379"))
+		}},
+		{"should let overrides passed as key=value take precedence over the overlay file", types.EtcdConfigOverridesConfig{OverlayFilePath: overlayPath, Overrides: []string{"quota-backend-bytes=2147483648", "client-transport-security.key-file=/var/etcd/ssl/server/tls.key"}}, false, func(g *WithT, cfg *embed.Config) {
+			g.Expect(cfg.QuotaBackendBytes).To(Equal(int64(2147483648)))
+			g.Expect(cfg.ClientTLSInfo.CertFile).To(Equal("/var/etcd/ssl/server/tls.crt"))
+			g.Expect(cfg.ClientTLSInfo.KeyFile).To(Equal("/var/etcd/ssl/server/tls.key"))
+		}},
+		{"should reject overrides of unknown fields", types.EtcdConfigOverridesConfig{Overrides: []string{"snapshot-cnt=10000"}}, true, nil},
+		{"should reject overrides of nested fields of a field which is not a map", types.EtcdConfigOverridesConfig{Overrides: []string{"name.first=etcd"}}, true, nil},
+		{"should reject a missing overlay file", types.EtcdConfigOverridesConfig{OverlayFilePath: filepath.Join(dir, "missing.yaml")}, true, nil},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		cfg, err := LoadConfig(configPath, entry.overrides, zap.NewNop())
+		if entry.expectError {
+			g.Expect(err).To(HaveOccurred())
+			continue
+		}
+		g.Expect(err).ToNot(HaveOccurred())
+		entry.check(g, cfg)
+		// the fetched configuration itself is never changed
+		data, err := os.ReadFile(configPath) // #nosec G304 -- test file.
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(data)).To(Equal(config))
+		// the configuration with the overrides applied is removed once it has been loaded
+		g.Expect(filepath.Glob(filepath.Join(dir, "etcd.conf.yaml.overrides.*"))).To(BeEmpty())
+	}
+}
+
+func TestLoadConfigLogsOverrides(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "etcd.conf.yaml")
+	g.Expect(os.WriteFile(configPath, []byte(fmt.Sprintf(validConfig, filepath.Join(dir, "data"))), 0600)).To(Succeed())
+	core, logs := observer.New(zap.InfoLevel)
+
+	_, err := LoadConfig(configPath, types.EtcdConfigOverridesConfig{Overrides: []string{"snapshot-count=10000", "initial-cluster-token=secret-token"}}, zap.New(core))
+	g.Expect(err).ToNot(HaveOccurred())
+	entries := logs.FilterMessage("Overriding field of etcd configuration").All()
+	g.Expect(entries).To(HaveLen(2))
+	g.Expect(entries[0].ContextMap()).To(HaveKeyWithValue("key", "snapshot-count"))
+	g.Expect(entries[0].ContextMap()).To(HaveKeyWithValue("source", "--etcd-config-override"))
+	g.Expect(entries[1].ContextMap()).To(HaveKeyWithValue("key", "initial-cluster-token"))
+	g.Expect(entries[1].ContextMap()).To(HaveKeyWithValue("value", types.RedactedValue))
+}
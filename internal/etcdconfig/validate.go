@@ -0,0 +1,387 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcdconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	etcdtypes "go.etcd.io/etcd/client/pkg/v3/types"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.etcd.io/etcd/server/v3/etcdserver"
+	"sigs.k8s.io/yaml"
+)
+
+// CheckStatus is the outcome of a single check of an etcd configuration.
+type CheckStatus string
+
+const (
+	// CheckPassed indicates that the check found no problems.
+	CheckPassed CheckStatus = "passed"
+	// CheckWarning indicates that the check found problems which do not prevent etcd from starting.
+	CheckWarning CheckStatus = "warning"
+	// CheckFailed indicates that the check found problems which prevent etcd from starting or working correctly.
+	CheckFailed CheckStatus = "failed"
+	// CheckSkipped indicates that the check could not be run, since an earlier check failed.
+	CheckSkipped CheckStatus = "skipped"
+)
+
+// Names of the checks run by Validate.
+const (
+	CheckURLs           = "urls"
+	CheckEtcdConfig     = "etcd-config"
+	CheckURLHosts       = "url-hosts"
+	CheckTLSFiles       = "tls-files"
+	CheckQuota          = "quota"
+	CheckInitialCluster = "initial-cluster"
+)
+
+// defragmentationHeadroomFactor is the factor of the backend quota the data volume should at least provide, since
+// defragmentation writes a second copy of the database.
+const defragmentationHeadroomFactor = 2
+
+// resolveTimeout is the time allowed to resolve a single host of the advertised URLs.
+const resolveTimeout = 5 * time.Second
+
+// urlKeys are the keys of the etcd configuration file which hold comma separated URLs.
+var urlKeys = []string{
+	"listen-peer-urls",
+	"listen-client-urls",
+	"listen-client-http-urls",
+	"listen-metrics-urls",
+	"initial-advertise-peer-urls",
+	"advertise-client-urls",
+}
+
+// CheckResult is the result of a single check of an etcd configuration.
+type CheckResult struct {
+	// Name is the name of the check.
+	Name string `json:"name"`
+	// Status is the outcome of the check.
+	Status CheckStatus `json:"status"`
+	// Messages describe the problems found by the check, if any.
+	Messages []string `json:"messages,omitempty"`
+}
+
+// Report is the result of validating an etcd configuration file.
+type Report struct {
+	// File is the path of the validated etcd configuration file.
+	File string `json:"file"`
+	// Valid is false if any of the checks failed.
+	Valid bool `json:"valid"`
+	// Checks are the results of all checks in the order they were run.
+	Checks []CheckResult `json:"checks"`
+}
+
+// ValidationOptions configures the checks run by Validate.
+type ValidationOptions struct {
+	// DataVolumeSizeBytes is the size of the volume holding the data directory. If it is 0, the size of the
+	// file system the data directory (or its closest existing parent) resides on is used.
+	DataVolumeSizeBytes int64
+	// Resolver resolves the hosts of the advertised URLs. If it is nil, net.DefaultResolver is used.
+	Resolver HostResolver
+}
+
+// HostResolver resolves host names to addresses, it is implemented by *net.Resolver.
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// Validate runs all checks against the etcd configuration file at path. The file is only loaded with
+// embed.ConfigFromFile if all URLs in it are well-formed, as etcd exits the process on malformed URLs.
+func Validate(path string, opts ValidationOptions) Report {
+	report := Report{File: path}
+	urlsResult := checkURLs(path)
+	report.add(urlsResult)
+	if urlsResult.Status == CheckFailed {
+		report.skip(CheckEtcdConfig, CheckURLHosts, CheckTLSFiles, CheckQuota, CheckInitialCluster)
+		return report.finalize()
+	}
+
+	cfg, err := embed.ConfigFromFile(path)
+	if err != nil {
+		report.add(failed(CheckEtcdConfig, err.Error()))
+		report.skip(CheckURLHosts, CheckTLSFiles, CheckQuota, CheckInitialCluster)
+		return report.finalize()
+	}
+	report.add(passed(CheckEtcdConfig))
+	resolver := opts.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	report.add(checkURLHosts(cfg, resolver))
+	report.add(checkTLSFiles(cfg))
+	report.add(checkQuota(cfg, opts.DataVolumeSizeBytes))
+	report.add(checkInitialCluster(cfg))
+	return report.finalize()
+}
+
+func (r *Report) add(result CheckResult) {
+	r.Checks = append(r.Checks, result)
+}
+
+func (r *Report) skip(names ...string) {
+	for _, name := range names {
+		r.add(CheckResult{Name: name, Status: CheckSkipped})
+	}
+}
+
+func (r *Report) finalize() Report {
+	r.Valid = true
+	for _, check := range r.Checks {
+		if check.Status == CheckFailed {
+			r.Valid = false
+		}
+	}
+	return *r
+}
+
+// checkURLs checks that all URLs in the configuration file have a supported scheme and are of the format
+// <scheme>://<host>:<port>.
+func checkURLs(path string) CheckResult {
+	data, err := os.ReadFile(path) // #nosec G304 -- path of the configuration file to validate is passed explicitly by the user.
+	if err != nil {
+		return failed(CheckURLs, err.Error())
+	}
+	var rawConfig map[string]any
+	if err = yaml.Unmarshal(data, &rawConfig); err != nil {
+		return failed(CheckURLs, fmt.Sprintf("failed to parse configuration: %v", err))
+	}
+	var messages []string
+	for _, key := range urlKeys {
+		value, ok := rawConfig[key]
+		if !ok || value == nil {
+			continue
+		}
+		rawURLs, ok := value.(string)
+		if !ok {
+			messages = append(messages, fmt.Sprintf("%s should be a comma separated string of URLs", key))
+			continue
+		}
+		if strings.TrimSpace(rawURLs) == "" {
+			continue
+		}
+		if _, err = etcdtypes.NewURLs(strings.Split(rawURLs, ",")); err != nil {
+			messages = append(messages, fmt.Sprintf("%s %q is invalid: %v", key, rawURLs, err))
+		}
+	}
+	return result(CheckURLs, CheckFailed, messages)
+}
+
+// checkURLHosts checks that the hosts of the advertised URLs and of the initial cluster can be resolved. Hosts which
+// cannot be resolved are only warned about, since the DNS records of members are often created together with them.
+// The hosts of the listen URLs are not resolved, as etcd only accepts IP addresses and localhost for them.
+func checkURLHosts(cfg *embed.Config, resolver HostResolver) CheckResult {
+	urls := append(append([]url.URL{}, cfg.AdvertiseClientUrls...), cfg.AdvertisePeerUrls...)
+	if members, err := etcdtypes.NewURLsMap(cfg.InitialCluster); err == nil {
+		for _, memberURLs := range members {
+			urls = append(urls, memberURLs...)
+		}
+	}
+	var (
+		messages []string
+		resolved = make(map[string]bool)
+	)
+	for _, u := range urls {
+		host := u.Hostname()
+		if u.Scheme == "unix" || u.Scheme == "unixs" || host == "" || net.ParseIP(host) != nil || resolved[host] {
+			continue
+		}
+		resolved[host] = true
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		_, err := resolver.LookupHost(ctx, host)
+		cancel()
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("host %s of URL %s could not be resolved: %v", host, u.String(), err))
+		}
+	}
+	sort.Strings(messages)
+	return result(CheckURLHosts, CheckWarning, messages)
+}
+
+// checkTLSFiles checks that the configured certificates, keys and CA bundles exist, that each certificate matches its
+// key and that it is signed by the CA bundle, and that TLS is configured for all https URLs.
+func checkTLSFiles(cfg *embed.Config) CheckResult {
+	var messages []string
+	clientURLs := append(append(append([]url.URL{}, cfg.ListenClientUrls...), cfg.ListenClientHttpUrls...), cfg.AdvertiseClientUrls...)
+	peerURLs := append(append([]url.URL{}, cfg.ListenPeerUrls...), cfg.AdvertisePeerUrls...)
+	messages = append(messages, checkTLSInfo("client", cfg.ClientTLSInfo, cfg.ClientAutoTLS, clientURLs)...)
+	messages = append(messages, checkTLSInfo("peer", cfg.PeerTLSInfo, cfg.PeerAutoTLS, peerURLs)...)
+	return result(CheckTLSFiles, CheckFailed, messages)
+}
+
+func checkTLSInfo(kind string, tlsInfo transport.TLSInfo, autoTLS bool, urls []url.URL) []string {
+	if autoTLS {
+		return nil
+	}
+	var messages []string
+	if tlsInfo.Empty() {
+		for _, u := range urls {
+			if u.Scheme == "https" || u.Scheme == "unixs" {
+				messages = append(messages, fmt.Sprintf("%s URL %s requires %s TLS to be configured", kind, u.String(), kind))
+			}
+		}
+		return messages
+	}
+	if tlsInfo.CertFile == "" || tlsInfo.KeyFile == "" {
+		return []string{fmt.Sprintf("both cert-file and key-file are required for %s TLS", kind)}
+	}
+	keyPair, err := tls.LoadX509KeyPair(tlsInfo.CertFile, tlsInfo.KeyFile)
+	if err != nil {
+		return []string{fmt.Sprintf("%s certificate %s and key %s could not be loaded as a matching pair: %v", kind, tlsInfo.CertFile, tlsInfo.KeyFile, err)}
+	}
+	if tlsInfo.TrustedCAFile == "" {
+		if tlsInfo.ClientCertAuth {
+			messages = append(messages, fmt.Sprintf("%s client-cert-auth requires trusted-ca-file to be set", kind))
+		}
+		return messages
+	}
+	caBundle, err := os.ReadFile(tlsInfo.TrustedCAFile) // #nosec G304 -- path is taken from the configuration file to validate.
+	if err != nil {
+		return append(messages, fmt.Sprintf("%s trusted CA file could not be read: %v", kind, err))
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caBundle) {
+		return append(messages, fmt.Sprintf("%s trusted CA file %s does not contain any PEM encoded certificate", kind, tlsInfo.TrustedCAFile))
+	}
+	cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return append(messages, fmt.Sprintf("%s certificate %s could not be parsed: %v", kind, tlsInfo.CertFile, err))
+	}
+	intermediates := x509.NewCertPool()
+	for _, der := range keyPair.Certificate[1:] {
+		if intermediate, err := x509.ParseCertificate(der); err == nil {
+			intermediates.AddCert(intermediate)
+		}
+	}
+	if _, err = cert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		messages = append(messages, fmt.Sprintf("%s certificate %s is not valid for trusted CA file %s: %v", kind, tlsInfo.CertFile, tlsInfo.TrustedCAFile, err))
+	}
+	return messages
+}
+
+// checkQuota checks that the backend quota fits onto the data volume, leaving room for defragmentation.
+func checkQuota(cfg *embed.Config, dataVolumeSizeBytes int64) CheckResult {
+	quota := cfg.QuotaBackendBytes
+	if quota <= 0 {
+		quota = etcdserver.DefaultQuotaBytes
+	}
+	var warnings []string
+	if quota > etcdserver.MaxQuotaBytes {
+		warnings = append(warnings, fmt.Sprintf("quota-backend-bytes %d exceeds the maximum of %d recommended by etcd", quota, etcdserver.MaxQuotaBytes))
+	}
+	if dataVolumeSizeBytes <= 0 {
+		size, err := fileSystemSize(cfg.Dir)
+		if err != nil {
+			return result(CheckQuota, CheckWarning, append(warnings, fmt.Sprintf("size of the data volume could not be determined: %v", err)))
+		}
+		dataVolumeSizeBytes = size
+	}
+	if quota > dataVolumeSizeBytes {
+		return failed(CheckQuota, fmt.Sprintf("quota-backend-bytes %d exceeds the size of the data volume of %d bytes", quota, dataVolumeSizeBytes))
+	}
+	if defragmentationHeadroomFactor*quota > dataVolumeSizeBytes {
+		warnings = append(warnings, fmt.Sprintf("data volume of %d bytes leaves no room to defragment a database of the quota-backend-bytes %d", dataVolumeSizeBytes, quota))
+	}
+	return result(CheckQuota, CheckWarning, warnings)
+}
+
+// fileSystemSize returns the size of the file system on which dir, or its closest existing parent, resides.
+func fileSystemSize(dir string) (int64, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		var stat syscall.Statfs_t
+		err = syscall.Statfs(dir, &stat)
+		if err == nil {
+			return int64(stat.Blocks) * int64(stat.Bsize), nil // #nosec G115 -- block count and size of a file system fit into an int64.
+		}
+		parent := filepath.Dir(dir)
+		if !errors.Is(err, os.ErrNotExist) || parent == dir {
+			return 0, err
+		}
+		dir = parent
+	}
+}
+
+// checkInitialCluster checks that the initial cluster contains this member under its name with exactly its
+// advertised peer URLs, and that no peer URL is used by more than one member.
+func checkInitialCluster(cfg *embed.Config) CheckResult {
+	if cfg.InitialCluster == "" {
+		return result(CheckInitialCluster, CheckWarning, []string{"initial-cluster is not set, discovery is used to bootstrap the cluster"})
+	}
+	members, err := etcdtypes.NewURLsMap(cfg.InitialCluster)
+	if err != nil {
+		return failed(CheckInitialCluster, fmt.Sprintf("initial-cluster %q is invalid: %v", cfg.InitialCluster, err))
+	}
+	var messages []string
+	ownURLs, ok := members[cfg.Name]
+	if !ok {
+		messages = append(messages, fmt.Sprintf("initial-cluster does not contain a member named %q", cfg.Name))
+	} else if !sameURLs(ownURLs, cfg.AdvertisePeerUrls) {
+		messages = append(messages, fmt.Sprintf("initial-cluster URLs %q of member %q do not match initial-advertise-peer-urls %q", ownURLs.String(), cfg.Name, etcdtypes.URLs(cfg.AdvertisePeerUrls).String()))
+	}
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	memberByURL := make(map[string]string)
+	for _, name := range names {
+		for _, u := range members[name] {
+			if other, ok := memberByURL[u.String()]; ok {
+				messages = append(messages, fmt.Sprintf("peer URL %s is used by members %q and %q", u.String(), other, name))
+				continue
+			}
+			memberByURL[u.String()] = name
+		}
+	}
+	return result(CheckInitialCluster, CheckFailed, messages)
+}
+
+func sameURLs(a etcdtypes.URLs, b []url.URL) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	as, bs := a.StringSlice(), etcdtypes.URLs(b).StringSlice()
+	sort.Strings(as)
+	sort.Strings(bs)
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// result returns a CheckResult with the given status if there are any messages, and a passed one otherwise.
+func result(name string, status CheckStatus, messages []string) CheckResult {
+	if len(messages) == 0 {
+		return passed(name)
+	}
+	return CheckResult{Name: name, Status: status, Messages: messages}
+}
+
+func passed(name string) CheckResult {
+	return CheckResult{Name: name, Status: CheckPassed}
+}
+
+func failed(name string, message string) CheckResult {
+	return CheckResult{Name: name, Status: CheckFailed, Messages: []string{message}}
+}
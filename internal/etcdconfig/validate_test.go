@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package etcdconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/testutil"
+
+	. "github.com/onsi/gomega"
+)
+
+const (
+	validConfig = `name: etcd-0
+data-dir: %s
+listen-client-urls: http://127.0.0.1:2379
+advertise-client-urls: http://127.0.0.1:2379
+listen-peer-urls: http://127.0.0.1:2380
+initial-advertise-peer-urls: http://127.0.0.1:2380
+initial-cluster: etcd-0=http://127.0.0.1:2380
+quota-backend-bytes: 1073741824
+`
+	tlsConfig = `name: etcd-0
+data-dir: %s
+listen-client-urls: https://127.0.0.1:2379
+advertise-client-urls: https://127.0.0.1:2379
+listen-peer-urls: http://127.0.0.1:2380
+initial-advertise-peer-urls: http://127.0.0.1:2380
+initial-cluster: etcd-0=http://127.0.0.1:2380
+client-transport-security:
+  cert-file: %s
+  key-file: %s
+  trusted-ca-file: %s
+`
+)
+
+func TestValidate(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "data")
+	caPath, certPath, keyPath := createTLSFiles(g, dir, "")
+	otherCAPath, _, otherKeyPath := createTLSFiles(g, dir, "other-")
+
+	table := []struct {
+		description        string
+		config             string
+		dataVolumeSize     int64
+		expectValid        bool
+		expectedStatusByID map[string]CheckStatus
+	}{
+		{"should pass valid configuration", fmt.Sprintf(validConfig, dataDir), 8 << 30, true,
+			map[string]CheckStatus{CheckURLs: CheckPassed, CheckEtcdConfig: CheckPassed, CheckURLHosts: CheckPassed, CheckTLSFiles: CheckPassed, CheckQuota: CheckPassed, CheckInitialCluster: CheckPassed}},
+		{"should fail malformed URLs and skip all other checks", "name: etcd-0\nlisten-client-urls: 127.0.0.1:2379\n", 0, false,
+			map[string]CheckStatus{CheckURLs: CheckFailed, CheckEtcdConfig: CheckSkipped, CheckURLHosts: CheckSkipped, CheckTLSFiles: CheckSkipped, CheckQuota: CheckSkipped, CheckInitialCluster: CheckSkipped}},
+		{"should fail configuration rejected by etcd", fmt.Sprintf(validConfig, dataDir) + "initial-cluster-state: unknown\n", 0, false,
+			map[string]CheckStatus{CheckURLs: CheckPassed, CheckEtcdConfig: CheckFailed, CheckURLHosts: CheckSkipped, CheckTLSFiles: CheckSkipped}},
+		{"should pass resolvable advertised hosts", fmt.Sprintf(validConfig, dataDir) + "advertise-client-urls: http://etcd-0.etcd:2379\n", 8 << 30, true,
+			map[string]CheckStatus{CheckURLHosts: CheckPassed}},
+		{"should warn about advertised hosts which cannot be resolved", fmt.Sprintf(validConfig, dataDir) + "advertise-client-urls: http://etcd-1.etcd:2379\n", 8 << 30, true,
+			map[string]CheckStatus{CheckURLHosts: CheckWarning}},
+		{"should warn about hosts of the initial cluster which cannot be resolved", fmt.Sprintf(validConfig, dataDir) + "initial-cluster: etcd-0=http://127.0.0.1:2380,etcd-1=http://etcd-1.etcd:2380\n", 8 << 30, true,
+			map[string]CheckStatus{CheckURLHosts: CheckWarning, CheckInitialCluster: CheckPassed}},
+		{"should pass matching TLS files", fmt.Sprintf(tlsConfig, dataDir, certPath, keyPath, caPath), 8 << 30, true,
+			map[string]CheckStatus{CheckTLSFiles: CheckPassed}},
+		{"should fail https URLs without TLS", fmt.Sprintf(validConfig, dataDir) + "listen-client-http-urls: https://127.0.0.1:2381\n", 8 << 30, false,
+			map[string]CheckStatus{CheckTLSFiles: CheckFailed}},
+		{"should fail missing TLS files", fmt.Sprintf(tlsConfig, dataDir, filepath.Join(dir, "missing.pem"), keyPath, caPath), 8 << 30, false,
+			map[string]CheckStatus{CheckTLSFiles: CheckFailed}},
+		{"should fail certificate not matching key", fmt.Sprintf(tlsConfig, dataDir, certPath, otherKeyPath, caPath), 8 << 30, false,
+			map[string]CheckStatus{CheckTLSFiles: CheckFailed}},
+		{"should fail certificate not signed by trusted CA", fmt.Sprintf(tlsConfig, dataDir, certPath, keyPath, otherCAPath), 8 << 30, false,
+			map[string]CheckStatus{CheckTLSFiles: CheckFailed}},
+		{"should fail quota larger than data volume", fmt.Sprintf(validConfig, dataDir), 512 << 20, false,
+			map[string]CheckStatus{CheckQuota: CheckFailed}},
+		{"should warn if data volume leaves no room for defragmentation", fmt.Sprintf(validConfig, dataDir), 3 << 29, true,
+			map[string]CheckStatus{CheckQuota: CheckWarning}},
+		{"should warn about quota above the maximum recommended by etcd", fmt.Sprintf(validConfig, dataDir) + "quota-backend-bytes: 10737418240\n", 32 << 30, true,
+			map[string]CheckStatus{CheckQuota: CheckWarning}},
+		{"should use size of the file system of the closest existing parent of the data directory", fmt.Sprintf(validConfig, filepath.Join(dataDir, "does", "not", "exist")), 0, true,
+			map[string]CheckStatus{CheckQuota: CheckPassed}},
+		{"should fail initial cluster without this member", fmt.Sprintf(validConfig, dataDir) + "initial-cluster: etcd-1=http://127.0.0.1:2380\n", 8 << 30, false,
+			map[string]CheckStatus{CheckInitialCluster: CheckFailed}},
+		{"should fail initial cluster not matching advertised peer URLs", fmt.Sprintf(validConfig, dataDir) + "initial-cluster: etcd-0=http://127.0.0.1:2390\n", 8 << 30, false,
+			map[string]CheckStatus{CheckInitialCluster: CheckFailed}},
+		{"should fail peer URL used by several members", fmt.Sprintf(validConfig, dataDir) + "initial-cluster: etcd-0=http://127.0.0.1:2380,etcd-1=http://127.0.0.1:2380\n", 8 << 30, false,
+			map[string]CheckStatus{CheckInitialCluster: CheckFailed}},
+	}
+	for i, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		configPath := filepath.Join(dir, fmt.Sprintf("etcd-%d.conf.yaml", i))
+		g.Expect(os.WriteFile(configPath, []byte(entry.config), 0600)).To(Succeed())
+
+		report := Validate(configPath, ValidationOptions{DataVolumeSizeBytes: entry.dataVolumeSize, Resolver: testResolver{"etcd-0.etcd"}})
+		g.Expect(report.File).To(Equal(configPath))
+		g.Expect(report.Valid).To(Equal(entry.expectValid), "%+v", report.Checks)
+		g.Expect(report.Checks).To(HaveLen(6))
+		for _, check := range report.Checks {
+			if expectedStatus, ok := entry.expectedStatusByID[check.Name]; ok {
+				g.Expect(check.Status).To(Equal(expectedStatus), "%+v", check)
+			}
+		}
+	}
+}
+
+// testResolver resolves only the hosts it contains.
+type testResolver []string
+
+func (r testResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	for _, known := range r {
+		if known == host {
+			return []string{"10.0.0.1"}, nil
+		}
+	}
+	return nil, fmt.Errorf("no such host %s", host)
+}
+
+func TestValidateMissingFile(t *testing.T) {
+	g := NewWithT(t)
+	report := Validate(filepath.Join(t.TempDir(), "missing.yaml"), ValidationOptions{})
+	g.Expect(report.Valid).To(BeFalse())
+	g.Expect(report.Checks[0].Name).To(Equal(CheckURLs))
+	g.Expect(report.Checks[0].Status).To(Equal(CheckFailed))
+}
+
+// createTLSFiles creates a CA and a certificate signed by it in dir, and returns the paths of the CA certificate, the
+// certificate and its key.
+func createTLSFiles(g *WithT, dir, prefix string) (string, string, string) {
+	tlsResCreator, err := testutil.NewTLSResourceCreator()
+	g.Expect(err).ToNot(HaveOccurred())
+	caCertKeyPair, err := tlsResCreator.CreateCACertAndKey()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(caCertKeyPair.EncodeAndWrite(dir, prefix+"ca.pem", prefix+"ca-key.pem")).To(Succeed())
+	certKeyPair, err := tlsResCreator.CreateETCDClientCertAndKey()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(certKeyPair.EncodeAndWrite(dir, prefix+"etcd.pem", prefix+"etcd-key.pem")).To(Succeed())
+	return filepath.Join(dir, prefix+"ca.pem"), filepath.Join(dir, prefix+"etcd.pem"), filepath.Join(dir, prefix+"etcd-key.pem")
+}
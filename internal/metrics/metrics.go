@@ -0,0 +1,338 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/gardener/etcd-wrapper/internal/version"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace            = "etcd_wrapper"
+	subsystemEtcd        = "etcd"
+	subsystemPreflight   = "preflight"
+	subsystemSnapshot    = "snapshot_verification"
+	subsystemConsistency = "consistency_check"
+	subsystemDefrag      = "defragmentation"
+	subsystemQuota       = "quota"
+	// LabelWarning is the label for the kind of warning logged by the embedded etcd.
+	LabelWarning = "warning"
+	// LabelCheck is the label for the name of a check.
+	LabelCheck = "check"
+	// LabelDir is the label for the kind of a directory of etcd, either data or wal.
+	LabelDir = "dir"
+	// LabelStatus is the label for the status of a check.
+	LabelStatus = "status"
+	// LabelResult is the label for the result of an operation.
+	LabelResult = "result"
+	// LabelMember is the label for the name of an etcd member.
+	LabelMember = "member"
+	// LabelThreshold is the label for a warning threshold in percent.
+	LabelThreshold = "threshold"
+)
+
+var (
+	// Registry is the registry for all etcd-wrapper metrics. It is kept separate from the default registry
+	// which holds the metrics of the embedded etcd, which are already served by etcd itself.
+	Registry = prometheus.NewRegistry()
+
+	// BuildInfo is a constant metric with value 1 carrying the build information of etcd-wrapper as labels.
+	BuildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "build_info",
+			Help:      "Build information of etcd-wrapper, the value is always 1.",
+		},
+		[]string{"version", "git_commit", "build_date", "go_version", "etcd_server_version", "etcd_client_version"},
+	)
+
+	// EtcdWarningsTotal is the number of performance warnings logged by the embedded etcd.
+	EtcdWarningsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystemEtcd,
+			Name:      "warnings_total",
+			Help:      "Total number of performance warnings logged by the embedded etcd.",
+		},
+		[]string{LabelWarning},
+	)
+
+	// EtcdWarningDurationSeconds is the duration reported in the performance warnings logged by the embedded etcd.
+	EtcdWarningDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystemEtcd,
+			Name:      "warning_duration_seconds",
+			Help:      "Duration reported in the performance warnings logged by the embedded etcd.",
+			// 10ms ... ~82s
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+		},
+		[]string{LabelWarning},
+	)
+
+	// PreflightCheckStatus is the status of the pre-flight checks of the directories of etcd. For every check, the
+	// series of its current status has the value 1, the series of all other statuses have the value 0.
+	PreflightCheckStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemPreflight,
+			Name:      "check_status",
+			Help:      "Status of the pre-flight checks of the directories of etcd, 1 for the current status of a check and 0 otherwise.",
+		},
+		[]string{LabelCheck, LabelDir, LabelStatus},
+	)
+
+	// PreflightFreeBytes is the free space measured by the pre-flight checks.
+	PreflightFreeBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemPreflight,
+			Name:      "free_bytes",
+			Help:      "Free space of the file system of the directories of etcd measured before etcd was started.",
+		},
+		[]string{LabelDir},
+	)
+
+	// PreflightFsyncLatencySeconds is the fsync latency measured by the pre-flight checks.
+	PreflightFsyncLatencySeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemPreflight,
+			Name:      "fsync_latency_seconds",
+			Help:      "Average fsync latency in the directories of etcd measured before etcd was started.",
+		},
+		[]string{LabelDir},
+	)
+	// SnapshotVerificationsTotal is the number of verifications of the local snapshot, by their result: valid,
+	// invalid or error if the verification could not be run.
+	SnapshotVerificationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystemSnapshot,
+			Name:      "total",
+			Help:      "Total number of verifications of the local snapshot by their result.",
+		},
+		[]string{LabelResult},
+	)
+
+	// SnapshotVerificationCheckPassed is the outcome of the checks of the latest verification of the local snapshot.
+	SnapshotVerificationCheckPassed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemSnapshot,
+			Name:      "check_passed",
+			Help:      "Outcome of the checks of the latest verification of the local snapshot, 1 if the check passed and 0 otherwise.",
+		},
+		[]string{LabelCheck},
+	)
+
+	// SnapshotVerificationLastSuccessTimestampSeconds is the time of the latest verification which proved the local
+	// snapshot to be restorable.
+	SnapshotVerificationLastSuccessTimestampSeconds = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemSnapshot,
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Unix time of the latest verification which proved the local snapshot to be restorable.",
+		},
+	)
+
+	// SnapshotVerificationDurationSeconds is the duration of the latest verification of the local snapshot.
+	SnapshotVerificationDurationSeconds = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemSnapshot,
+			Name:      "duration_seconds",
+			Help:      "Duration of the latest verification of the local snapshot.",
+		},
+	)
+
+	// SnapshotVerificationRevision is the revision of the key space in the latest verified local snapshot.
+	SnapshotVerificationRevision = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemSnapshot,
+			Name:      "revision",
+			Help:      "Revision of the key space in the latest verified local snapshot.",
+		},
+	)
+	// ConsistencyChecksTotal is the number of comparisons of the key space with the peers, by their result.
+	ConsistencyChecksTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystemConsistency,
+			Name:      "total",
+			Help:      "Total number of comparisons of the hash of the key space with the peers by their result.",
+		},
+		[]string{LabelResult},
+	)
+
+	// ConsistencyCheckRevision is the revision at which the key space has been compared in the latest check.
+	ConsistencyCheckRevision = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemConsistency,
+			Name:      "revision",
+			Help:      "Revision at which the hash of the key space has been compared with the peers in the latest check.",
+		},
+	)
+
+	// ConsistencyCheckDivergedMembers is the number of members whose key space differs from the one of the largest
+	// group of members with the same key space in the latest check.
+	ConsistencyCheckDivergedMembers = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemConsistency,
+			Name:      "diverged_members",
+			Help:      "Number of members whose hash of the key space differs from the hash of the largest group of members in the latest check.",
+		},
+	)
+
+	// ConsistencyCheckDiverged is 1 if the key space of this member has diverged from the one of a quorum of members.
+	ConsistencyCheckDiverged = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemConsistency,
+			Name:      "diverged",
+			Help:      "1 if the hash of the key space of this member differs from the hash agreed on by a quorum of members in the latest check, 0 otherwise.",
+		},
+	)
+
+	// DefragmentationsTotal is the number of defragmentations of this member, by their result.
+	DefragmentationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystemDefrag,
+			Name:      "total",
+			Help:      "Total number of defragmentations of this member by their result.",
+		},
+		[]string{LabelResult},
+	)
+
+	// DefragmentationDurationSeconds is the duration of the latest defragmentation of a member.
+	DefragmentationDurationSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemDefrag,
+			Name:      "duration_seconds",
+			Help:      "Duration of the latest defragmentation of a member.",
+		},
+		[]string{LabelMember},
+	)
+
+	// DefragmentationReclaimedBytes is the space reclaimed by the latest defragmentation of a member.
+	DefragmentationReclaimedBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemDefrag,
+			Name:      "reclaimed_bytes",
+			Help:      "Decrease of the database size by the latest defragmentation of a member.",
+		},
+		[]string{LabelMember},
+	)
+
+	// DefragmentationLastSuccessTimestampSeconds is the time of the latest successful defragmentation of this member.
+	DefragmentationLastSuccessTimestampSeconds = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemDefrag,
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Unix time of the latest successful defragmentation of this member.",
+		},
+	)
+
+	// QuotaBackendBytes is the backend quota of etcd against which the size of the database is watched.
+	QuotaBackendBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemQuota,
+			Name:      "backend_bytes",
+			Help:      "Backend quota of etcd against which the size of the database is watched.",
+		},
+	)
+
+	// QuotaUsageRatio is the share of the backend quota used by the database.
+	QuotaUsageRatio = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemQuota,
+			Name:      "usage_ratio",
+			Help:      "Size of the database divided by the backend quota.",
+		},
+	)
+
+	// QuotaGrowthRateBytesPerSecond is the growth rate of the database within the growth window.
+	QuotaGrowthRateBytesPerSecond = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemQuota,
+			Name:      "growth_rate_bytes_per_second",
+			Help:      "Growth rate of the size of the database within the last hour, negative if it has shrunk.",
+		},
+	)
+
+	// QuotaProjectedTimeToFullSeconds is the time until the database reaches the backend quota at its growth rate.
+	QuotaProjectedTimeToFullSeconds = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemQuota,
+			Name:      "projected_time_to_full_seconds",
+			Help:      "Time until the size of the database reaches the backend quota at its current growth rate, -1 if it does not grow.",
+		},
+	)
+
+	// QuotaThresholdExceeded is 1 for every warning threshold which the size of the database exceeds.
+	QuotaThresholdExceeded = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemQuota,
+			Name:      "threshold_exceeded",
+			Help:      "1 if the size of the database exceeds the warning threshold in percent of the backend quota, 0 otherwise.",
+		},
+		[]string{LabelThreshold},
+	)
+
+	// QuotaWarningsTotal is the number of warnings logged because the database exceeded a warning threshold.
+	QuotaWarningsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystemQuota,
+			Name:      "warnings_total",
+			Help:      "Total number of times the size of the database has exceeded a warning threshold in percent of the backend quota.",
+		},
+		[]string{LabelThreshold},
+	)
+)
+
+func init() {
+	info := version.Get()
+	BuildInfo.WithLabelValues(info.Version, info.GitCommit, info.BuildDate, info.GoVersion, info.EtcdServerVersion, info.EtcdClientVersion).Set(1)
+	Registry.MustRegister(BuildInfo)
+	Registry.MustRegister(EtcdWarningsTotal)
+	Registry.MustRegister(EtcdWarningDurationSeconds)
+	Registry.MustRegister(PreflightCheckStatus)
+	Registry.MustRegister(PreflightFreeBytes)
+	Registry.MustRegister(PreflightFsyncLatencySeconds)
+	Registry.MustRegister(SnapshotVerificationsTotal)
+	Registry.MustRegister(SnapshotVerificationCheckPassed)
+	Registry.MustRegister(SnapshotVerificationLastSuccessTimestampSeconds)
+	Registry.MustRegister(SnapshotVerificationDurationSeconds)
+	Registry.MustRegister(SnapshotVerificationRevision)
+	Registry.MustRegister(ConsistencyChecksTotal)
+	Registry.MustRegister(ConsistencyCheckRevision)
+	Registry.MustRegister(ConsistencyCheckDivergedMembers)
+	Registry.MustRegister(ConsistencyCheckDiverged)
+	Registry.MustRegister(DefragmentationsTotal)
+	Registry.MustRegister(DefragmentationDurationSeconds)
+	Registry.MustRegister(DefragmentationReclaimedBytes)
+	Registry.MustRegister(DefragmentationLastSuccessTimestampSeconds)
+	Registry.MustRegister(QuotaBackendBytes)
+	Registry.MustRegister(QuotaUsageRatio)
+	Registry.MustRegister(QuotaGrowthRateBytesPerSecond)
+	Registry.MustRegister(QuotaProjectedTimeToFullSeconds)
+	Registry.MustRegister(QuotaThresholdExceeded)
+	Registry.MustRegister(QuotaWarningsTotal)
+}
@@ -6,6 +6,7 @@ package signal
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -22,9 +23,11 @@ var (
 // finishes in time before the subsequent signal is caught which will result in a forced exit of the app.
 type Callback[T any] func(os.Signal, T) error
 
-// SetupHandler sets up a context which reacts to shutdownSignals
+// SetupHandler sets up a context which reacts to shutdownSignals. When the context is cancelled due to a signal,
+// context.Cause returns an error naming the signal.
 func SetupHandler[T any](logger *zap.Logger, callback Callback[T], callbackParam T) (context.Context, context.CancelFunc) {
-	ctx, cancelFn := context.WithCancel(context.Background())
+	ctx, cancelCauseFn := context.WithCancelCause(context.Background())
+	cancelFn := func() { cancelCauseFn(nil) }
 	notifierCh := make(chan os.Signal, 1)
 	signal.Notify(notifierCh, shutdownSignals...)
 
@@ -35,9 +38,15 @@ func SetupHandler[T any](logger *zap.Logger, callback Callback[T], callbackParam
 			logger.Error("failed to capture exit code", zap.Error(err))
 		}
 		logger.Info("caught shutdown signal", zap.Any("signal", sig))
-		cancelFn()
+		cancelCauseFn(fmt.Errorf("caught shutdown signal %s", sig))
 		<-notifierCh
 		os.Exit(1)
 	}()
 	return ctx, cancelFn
 }
+
+// SetupCancelHandler sets up a context which reacts to shutdownSignals like SetupHandler, without invoking a
+// callback for the caught signal.
+func SetupCancelHandler(logger *zap.Logger) (context.Context, context.CancelFunc) {
+	return SetupHandler(logger, func(os.Signal, struct{}) error { return nil }, struct{}{})
+}
@@ -37,5 +37,6 @@ func TestSetupSignalHandler(t *testing.T) {
 	g.Expect(err).To(BeNil())
 	time.Sleep(5 * time.Second)
 	g.Expect(ctx.Err()).To(Equal(context.Canceled))
+	g.Expect(context.Cause(ctx)).To(MatchError("caught shutdown signal interrupt"))
 	g.Expect(receivedSignal).To(Equal(os.Interrupt.String()))
 }
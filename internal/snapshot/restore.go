@@ -0,0 +1,274 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/client/pkg/v3/types"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	"go.etcd.io/etcd/server/v3/config"
+	etcddatadir "go.etcd.io/etcd/server/v3/datadir"
+	"go.etcd.io/etcd/server/v3/etcdserver"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/membership"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/v2store"
+	"go.etcd.io/etcd/server/v3/etcdserver/cindex"
+	"go.etcd.io/etcd/server/v3/mvcc/backend"
+	"go.etcd.io/etcd/server/v3/wal"
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+	"go.uber.org/zap"
+)
+
+// RestoreOptions are the options of a restoration of a snapshot.
+type RestoreOptions struct {
+	// SnapshotPath is the path of the snapshot to restore.
+	SnapshotPath string
+	// SkipChecksumFile skips verifying the snapshot against the checksum in its sidecar file. The checksum which etcd
+	// appends to the snapshot is verified nevertheless.
+	SkipChecksumFile bool
+	// DataDir is the data directory to restore the snapshot into. It must not exist or be empty.
+	DataDir string
+	// WALDir is the dedicated WAL directory of the member. It is empty if the WAL resides in the data directory.
+	WALDir string
+	// Name is the name of the member.
+	Name string
+	// InitialCluster is the initial cluster of the restored cluster, of the format <name>=<peer URL>,...
+	InitialCluster string
+	// InitialClusterToken is the token of the restored cluster.
+	InitialClusterToken string
+	// AdvertisePeerURLs are the peer URLs which the member advertises.
+	AdvertisePeerURLs []string
+}
+
+// RestoreReport describes a snapshot which has been restored.
+type RestoreReport struct {
+	// SnapshotPath is the path of the restored snapshot.
+	SnapshotPath string `json:"snapshotPath"`
+	// SHA256 is the hex encoded SHA-256 checksum of the snapshot. It is empty if the checksum file has been skipped.
+	SHA256 string `json:"sha256,omitempty"`
+	// DataDir is the data directory the snapshot has been restored into.
+	DataDir string `json:"dataDir"`
+	// WALDir is the directory of the WAL of the restored member.
+	WALDir string `json:"walDir"`
+	// Name is the name of the restored member.
+	Name string `json:"name"`
+	// MemberID is the ID of the restored member.
+	MemberID string `json:"memberID"`
+	// ClusterID is the ID of the restored cluster.
+	ClusterID string `json:"clusterID"`
+}
+
+// Restore restores the snapshot into a new data directory for a member of a new cluster, the way `etcdutl snapshot
+// restore` does. The integrity of the snapshot is verified against the checksum in its sidecar file and against the
+// checksum which etcd appends to every snapshot.
+func Restore(opts RestoreOptions, logger *zap.Logger) (report *RestoreReport, err error) {
+	report = &RestoreReport{SnapshotPath: opts.SnapshotPath, DataDir: opts.DataDir, WALDir: opts.WALDir, Name: opts.Name}
+	if report.WALDir == "" {
+		report.WALDir = etcddatadir.ToWalDir(opts.DataDir)
+	}
+	if !opts.SkipChecksumFile {
+		if report.SHA256, err = VerifyChecksum(opts.SnapshotPath); err != nil {
+			return nil, err
+		}
+	}
+	cluster, err := newCluster(opts, logger)
+	if err != nil {
+		return nil, err
+	}
+	member := cluster.MemberByName(opts.Name)
+	report.MemberID = member.ID.String()
+	report.ClusterID = cluster.ID().String()
+
+	if err = checkEmptyDir(opts.DataDir); err != nil {
+		return nil, err
+	}
+	if err = checkEmptyDir(opts.WALDir); opts.WALDir != "" && err != nil {
+		return nil, err
+	}
+	lock, err := datadir.AcquireLock(datadir.LockFilePath(opts.DataDir), logger)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errors.Join(err, lock.Release()) }()
+	// do not leave a partially restored member behind, from which etcd would fail to start
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, os.RemoveAll(etcddatadir.ToMemberDir(opts.DataDir)))
+			if opts.WALDir != "" {
+				err = errors.Join(err, os.RemoveAll(opts.WALDir))
+			}
+		}
+	}()
+
+	snapDir := etcddatadir.ToSnapDir(opts.DataDir)
+	backendPath := etcddatadir.ToBackendFileName(opts.DataDir)
+	if err = copyAndVerifyDB(opts.SnapshotPath, snapDir, backendPath); err != nil {
+		return nil, err
+	}
+	hardState, err := saveWALAndSnap(cluster, member, backendPath, report.WALDir, snapDir, logger)
+	if err != nil {
+		return nil, err
+	}
+	be := backend.NewDefaultBackend(backendPath)
+	defer func() { err = errors.Join(err, be.Close()) }()
+	cindex.UpdateConsistentIndex(be.BatchTx(), hardState.Commit, hardState.Term)
+	return report, nil
+}
+
+// newCluster returns the cluster described by the options, after checking that the member is part of it.
+func newCluster(opts RestoreOptions, logger *zap.Logger) (*membership.RaftCluster, error) {
+	initialCluster, err := types.NewURLsMap(opts.InitialCluster)
+	if err != nil {
+		return nil, fmt.Errorf("invalid initial cluster %q: %w", opts.InitialCluster, err)
+	}
+	peerURLs, err := types.NewURLs(opts.AdvertisePeerURLs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid advertised peer URLs %v: %w", opts.AdvertisePeerURLs, err)
+	}
+	serverConfig := config.ServerConfig{
+		Logger:              logger,
+		Name:                opts.Name,
+		PeerURLs:            peerURLs,
+		InitialPeerURLsMap:  initialCluster,
+		InitialClusterToken: opts.InitialClusterToken,
+	}
+	if err = serverConfig.VerifyBootstrap(); err != nil {
+		return nil, fmt.Errorf("invalid cluster configuration: %w", err)
+	}
+	return membership.NewClusterFromURLsMap(logger, opts.InitialClusterToken, initialCluster)
+}
+
+// checkEmptyDir checks that dir does not exist, or is empty.
+func checkEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("cannot read data directory %s: %w", dir, err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("data directory %s is not empty, a snapshot can only be restored into an empty data directory", dir)
+	}
+	return nil
+}
+
+// copyAndVerifyDB copies the snapshot to the database of the member and verifies the SHA-256 checksum which etcd
+// appends to the snapshot, which is then truncated.
+func copyAndVerifyDB(snapshotPath, snapDir, backendPath string) (err error) {
+	src, err := os.Open(snapshotPath) // #nosec G304 -- path of the snapshot passed by the user.
+	if err != nil {
+		return fmt.Errorf("cannot read snapshot: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+	if err = os.MkdirAll(snapDir, 0700); err != nil {
+		return err
+	}
+	db, err := os.OpenFile(backendPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304 -- path of the database in the data directory passed by the user.
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, db.Close()) }()
+	size, err := io.Copy(db, src)
+	if err != nil {
+		return fmt.Errorf("cannot copy snapshot %s to %s: %w", snapshotPath, backendPath, err)
+	}
+	// etcd appends the checksum of the database to snapshots, whose size is otherwise a multiple of the page size
+	if size%512 != sha256.Size {
+		return fmt.Errorf("snapshot %s does not end with the checksum appended by etcd", snapshotPath)
+	}
+	expected := make([]byte, sha256.Size)
+	if _, err = db.ReadAt(expected, size-sha256.Size); err != nil {
+		return err
+	}
+	if err = db.Truncate(size - sha256.Size); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err = io.Copy(hash, io.NewSectionReader(db, 0, size-sha256.Size)); err != nil {
+		return err
+	}
+	if !bytes.Equal(hash.Sum(nil), expected) {
+		return fmt.Errorf("snapshot %s is corrupted, its database does not match the checksum appended by etcd", snapshotPath)
+	}
+	return db.Sync()
+}
+
+// saveWALAndSnap replaces the members stored in the database with the members of the new cluster and writes a WAL
+// and a raft snapshot from which the member bootstraps the new cluster.
+func saveWALAndSnap(cluster *membership.RaftCluster, member *membership.Member, backendPath, walDir, snapDir string, logger *zap.Logger) (*raftpb.HardState, error) {
+	be := backend.NewDefaultBackend(backendPath)
+	defer func() { _ = be.Close() }()
+	if err := membership.TrimMembershipFromBackend(logger, be); err != nil {
+		return nil, err
+	}
+	store := v2store.New(etcdserver.StoreClusterPrefix, etcdserver.StoreKeysPrefix)
+	cluster.SetStore(store)
+	cluster.SetBackend(be)
+	for _, m := range cluster.Members() {
+		cluster.AddMember(m, membership.ApplyBoth)
+	}
+
+	metadata, err := (&etcdserverpb.Metadata{NodeID: uint64(member.ID), ClusterID: uint64(cluster.ID())}).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(walDir), 0700); err != nil {
+		return nil, err
+	}
+	w, err := wal.Create(logger, walDir, metadata)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = w.Close() }()
+
+	memberIDs := cluster.MemberIDs()
+	entries := make([]raftpb.Entry, 0, len(memberIDs))
+	voters := make([]uint64, 0, len(memberIDs))
+	for i, id := range memberIDs {
+		memberContext, err := json.Marshal(cluster.Member(id))
+		if err != nil {
+			return nil, err
+		}
+		confChange := raftpb.ConfChange{Type: raftpb.ConfChangeAddNode, NodeID: uint64(id), Context: memberContext}
+		data, err := confChange.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, raftpb.Entry{Type: raftpb.EntryConfChange, Term: 1, Index: uint64(i + 1), Data: data}) // #nosec G115 -- the number of members is small.
+		voters = append(voters, uint64(id))
+	}
+	hardState := raftpb.HardState{Term: 1, Vote: voters[0], Commit: uint64(len(entries))}
+	if err = w.Save(hardState, entries); err != nil {
+		return nil, err
+	}
+	storeData, err := store.Save()
+	if err != nil {
+		return nil, err
+	}
+	confState := raftpb.ConfState{Voters: voters}
+	raftSnapshot := raftpb.Snapshot{
+		Data:     storeData,
+		Metadata: raftpb.SnapshotMetadata{Index: hardState.Commit, Term: hardState.Term, ConfState: confState},
+	}
+	if err = snap.New(logger, snapDir).SaveSnap(raftSnapshot); err != nil {
+		return nil, err
+	}
+	if err = w.SaveSnapshot(walpb.Snapshot{Index: hardState.Commit, Term: hardState.Term, ConfState: &confState}); err != nil {
+		return nil, err
+	}
+	return &hardState, nil
+}
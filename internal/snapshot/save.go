@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshot
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ChecksumFileSuffix is the suffix of the sidecar file which holds the SHA-256 checksum of a snapshot.
+const ChecksumFileSuffix = ".sha256"
+
+// SaveReport describes a snapshot which has been saved.
+type SaveReport struct {
+	// Path is the path of the snapshot.
+	Path string `json:"path"`
+	// ChecksumPath is the path of the sidecar file holding the SHA-256 checksum of the snapshot.
+	ChecksumPath string `json:"checksumPath"`
+	// SHA256 is the hex encoded SHA-256 checksum of the snapshot.
+	SHA256 string `json:"sha256"`
+	// SizeBytes is the size of the snapshot.
+	SizeBytes int64 `json:"sizeBytes"`
+	// DurationSeconds is the time saving the snapshot took in seconds.
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// Save streams a snapshot of the database of etcd to path and writes its SHA-256 checksum to a sidecar file next to
+// it, see ChecksumPath. The snapshot is written to a temporary file first, so that path only ever holds complete
+// snapshots.
+func Save(ctx context.Context, maintenance clientv3.Maintenance, path string) (*SaveReport, error) {
+	start := time.Now()
+	partPath := path + ".part"
+	file, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304 -- path of the snapshot passed by the user.
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot file %s: %w", partPath, err)
+	}
+	defer func() { _ = os.Remove(partPath) }()
+
+	hash := sha256.New()
+	size, err := streamSnapshot(ctx, maintenance, io.MultiWriter(file, hash))
+	if err == nil {
+		err = file.Sync()
+	}
+	err = errors.Join(err, file.Close())
+	if err != nil {
+		return nil, fmt.Errorf("failed to save snapshot to %s: %w", partPath, err)
+	}
+	if err = os.Rename(partPath, path); err != nil {
+		return nil, fmt.Errorf("failed to save snapshot to %s: %w", path, err)
+	}
+
+	report := &SaveReport{
+		Path:         path,
+		ChecksumPath: ChecksumPath(path),
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+		SizeBytes:    size,
+	}
+	if err = writeChecksum(report.ChecksumPath, path, report.SHA256); err != nil {
+		return nil, fmt.Errorf("failed to write checksum of snapshot to %s: %w", report.ChecksumPath, err)
+	}
+	report.DurationSeconds = time.Since(start).Seconds()
+	return report, nil
+}
+
+// ChecksumPath returns the path of the sidecar file holding the SHA-256 checksum of the snapshot at path.
+func ChecksumPath(path string) string {
+	return path + ChecksumFileSuffix
+}
+
+// VerifyChecksum verifies the snapshot at path against the SHA-256 checksum in its sidecar file. It returns the
+// checksum of the snapshot.
+func VerifyChecksum(path string) (string, error) {
+	expected, err := readChecksum(ChecksumPath(path))
+	if err != nil {
+		return "", err
+	}
+	actual, err := fileChecksum(path)
+	if err != nil {
+		return "", err
+	}
+	if actual != expected {
+		return "", fmt.Errorf("SHA-256 checksum %s of snapshot %s does not match checksum %s in %s", actual, path, expected, ChecksumPath(path))
+	}
+	return actual, nil
+}
+
+func streamSnapshot(ctx context.Context, maintenance clientv3.Maintenance, w io.Writer) (int64, error) {
+	reader, err := maintenance.Snapshot(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = reader.Close() }()
+	return io.Copy(w, reader)
+}
+
+// writeChecksum writes the checksum of the snapshot at snapshotPath in the format of sha256sum, so that it can also
+// be verified with `sha256sum -c`.
+func writeChecksum(checksumPath, snapshotPath, checksum string) error {
+	line := fmt.Sprintf("%s  %s\n", checksum, filepath.Base(snapshotPath))
+	return os.WriteFile(checksumPath, []byte(line), 0600)
+}
+
+func readChecksum(checksumPath string) (string, error) {
+	file, err := os.Open(checksumPath) // #nosec G304 -- path of the checksum next to the snapshot passed by the user.
+	if err != nil {
+		return "", fmt.Errorf("cannot read checksum of snapshot: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("cannot read checksum of snapshot from %s: %w", checksumPath, err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no checksum found in %s", checksumPath)
+	}
+	if _, err = hex.DecodeString(fields[0]); err != nil || len(fields[0]) != 2*sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 checksum %q in %s", fields[0], checksumPath)
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path) // #nosec G304 -- path of the snapshot passed by the user.
+	if err != nil {
+		return "", fmt.Errorf("cannot read snapshot: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("cannot read snapshot %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
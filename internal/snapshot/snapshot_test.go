@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+	"github.com/gardener/etcd-wrapper/internal/testutil"
+
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+func TestSaveAndRestore(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	etcd, err := testutil.StartEtcd(filepath.Join(dir, "source"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(testutil.PutKeys(etcd, map[string]string{"/registry/a": "1", "/registry/b": "2"})).To(Succeed())
+	cli, err := clientv3.New(clientv3.Config{Endpoints: []string{etcd.Config().AdvertiseClientUrls[0].String()}, Logger: zap.NewNop()})
+	g.Expect(err).ToNot(HaveOccurred())
+	defer func() { _ = cli.Close() }()
+	onlineHash, revision, err := etcd.Server.KV().HashStorage().HashByRev(0)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	t.Log("saving a snapshot writes its checksum next to it")
+	snapshotPath := filepath.Join(dir, "etcd.db")
+	saveReport, err := Save(context.Background(), cli, snapshotPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(saveReport.Path).To(Equal(snapshotPath))
+	g.Expect(saveReport.ChecksumPath).To(Equal(snapshotPath + ".sha256"))
+	g.Expect(saveReport.SizeBytes).To(BeNumerically(">", 0))
+	g.Expect(snapshotPath + ".part").ToNot(BeAnExistingFile())
+	checksum, err := os.ReadFile(saveReport.ChecksumPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(checksum)).To(Equal(saveReport.SHA256 + "  etcd.db\n"))
+	g.Expect(VerifyChecksum(snapshotPath)).To(Equal(saveReport.SHA256))
+	etcd.Close()
+
+	t.Log("restoring the snapshot creates a data directory with the same key space")
+	peerPort, err := testutil.FreePort()
+	g.Expect(err).ToNot(HaveOccurred())
+	peerURL := fmt.Sprintf("http://127.0.0.1:%d", peerPort)
+	restoredDataDir := filepath.Join(dir, "restored")
+	restoreReport, err := Restore(RestoreOptions{
+		SnapshotPath:        snapshotPath,
+		DataDir:             restoredDataDir,
+		Name:                "etcd-test",
+		InitialCluster:      "etcd-test=" + peerURL,
+		InitialClusterToken: "restored",
+		AdvertisePeerURLs:   []string{peerURL},
+	}, zap.NewNop())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(restoreReport.SHA256).To(Equal(saveReport.SHA256))
+	g.Expect(restoreReport.WALDir).To(Equal(filepath.Join(restoredDataDir, "member", "wal")))
+	g.Expect(restoreReport.MemberID).ToNot(BeEmpty())
+	hashReport, err := datadir.HashKV(restoredDataDir, revision)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(hashReport.Hash).To(Equal(onlineHash.Hash))
+
+	t.Log("etcd starts from the restored data directory")
+	restored, err := testutil.StartEtcd(restoredDataDir)
+	g.Expect(err).ToNot(HaveOccurred())
+	response, err := restored.Server.Range(context.Background(), &etcdserverpb.RangeRequest{Key: []byte("/registry/a")})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(response.Kvs).To(HaveLen(1))
+	g.Expect(string(response.Kvs[0].Value)).To(Equal("1"))
+	restored.Close()
+
+	t.Log("a snapshot is not restored into a data directory which is not empty")
+	_, err = Restore(RestoreOptions{
+		SnapshotPath:        snapshotPath,
+		DataDir:             restoredDataDir,
+		Name:                "etcd-test",
+		InitialCluster:      "etcd-test=" + peerURL,
+		InitialClusterToken: "restored",
+		AdvertisePeerURLs:   []string{peerURL},
+	}, zap.NewNop())
+	g.Expect(err).To(MatchError(ContainSubstring("is not empty")))
+}
+
+func TestRestoreCorruptedSnapshot(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	etcd, err := testutil.StartEtcd(filepath.Join(dir, "source"))
+	g.Expect(err).ToNot(HaveOccurred())
+	cli, err := clientv3.New(clientv3.Config{Endpoints: []string{etcd.Config().AdvertiseClientUrls[0].String()}, Logger: zap.NewNop()})
+	g.Expect(err).ToNot(HaveOccurred())
+	defer func() { _ = cli.Close() }()
+	snapshotPath := filepath.Join(dir, "etcd.db")
+	_, err = Save(context.Background(), cli, snapshotPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	etcd.Close()
+
+	data, err := os.ReadFile(snapshotPath) // #nosec G304 -- test file.
+	g.Expect(err).ToNot(HaveOccurred())
+	data[4096] ^= 0xff
+	g.Expect(os.WriteFile(snapshotPath, data, 0600)).To(Succeed())
+	opts := RestoreOptions{
+		SnapshotPath:        snapshotPath,
+		Name:                "etcd-test",
+		InitialCluster:      "etcd-test=http://127.0.0.1:2380",
+		InitialClusterToken: "restored",
+		AdvertisePeerURLs:   []string{"http://127.0.0.1:2380"},
+	}
+
+	table := []struct {
+		description      string
+		skipChecksumFile bool
+		expectedError    string
+	}{
+		{"should detect corruption via the checksum file", false, "does not match checksum"},
+		{"should detect corruption via the checksum appended by etcd", true, "is corrupted"},
+	}
+	for i, entry := range table {
+		t.Log(entry.description)
+		opts.SkipChecksumFile = entry.skipChecksumFile
+		opts.DataDir = filepath.Join(dir, fmt.Sprintf("restored-%d", i))
+		_, err = Restore(opts, zap.NewNop())
+		g.Expect(err).To(MatchError(ContainSubstring(entry.expectedError)))
+		g.Expect(filepath.Join(opts.DataDir, "member")).ToNot(BeAnExistingFile())
+	}
+}
+
+func TestRestoreInvalidCluster(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "etcd.db")
+
+	_, err := Restore(RestoreOptions{
+		SnapshotPath:        snapshotPath,
+		SkipChecksumFile:    true,
+		DataDir:             filepath.Join(dir, "restored"),
+		Name:                "etcd-0",
+		InitialCluster:      "etcd-1=http://127.0.0.1:2380",
+		InitialClusterToken: "restored",
+		AdvertisePeerURLs:   []string{"http://127.0.0.1:2380"},
+	}, zap.NewNop())
+	g.Expect(err).To(MatchError(ContainSubstring("invalid cluster configuration")))
+	g.Expect(filepath.Join(dir, "restored")).ToNot(BeAnExistingFile())
+}
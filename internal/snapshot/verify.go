@@ -0,0 +1,347 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gardener/etcd-wrapper/internal/datadir"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.uber.org/zap"
+)
+
+// Names of the checks of a snapshot verification.
+const (
+	// CheckRestore checks that the snapshot is intact and can be restored into a data directory.
+	CheckRestore = "restore"
+	// CheckStart checks that etcd starts from the restored data directory and becomes ready.
+	CheckStart = "start"
+	// CheckRevision checks that etcd serves the revision stored in the snapshot.
+	CheckRevision = "revision"
+	// CheckHash checks that the hash of the key space served by etcd matches the hash of the key space in the snapshot.
+	CheckHash = "hash"
+	// CheckKeyCount checks that etcd serves as many keys per prefix as the snapshot holds.
+	CheckKeyCount = "key-count"
+)
+
+const (
+	// DefaultVerifyReadyTimeout is the default time the embedded etcd is given to become ready.
+	DefaultVerifyReadyTimeout = 2 * time.Minute
+	// verifyMemberName is the name of the member of the throwaway cluster a snapshot is verified with.
+	verifyMemberName = "verify-snapshot"
+	// verifyRangeLimit is the number of keys fetched from the embedded etcd at once.
+	verifyRangeLimit = 1000
+)
+
+// VerifyOptions are the options of a verification of a snapshot.
+type VerifyOptions struct {
+	// SnapshotPath is the path of the snapshot to verify.
+	SnapshotPath string
+	// SkipChecksumFile skips verifying the snapshot against the checksum in its sidecar file.
+	SkipChecksumFile bool
+	// TempDir is the directory in which the temporary data directory is created. The default directory for
+	// temporary files is used if it is empty.
+	TempDir string
+	// PrefixDepth is the number of path segments by which keys are grouped to count them, see datadir.KeyPrefix.
+	// datadir.DefaultPrefixDepth is used if it is 0.
+	PrefixDepth int
+	// ReadyTimeout is the time the embedded etcd is given to become ready. DefaultVerifyReadyTimeout is used if it
+	// is 0.
+	ReadyTimeout time.Duration
+}
+
+// VerifyCheck is the result of a single check of a snapshot verification.
+type VerifyCheck struct {
+	// Name is the name of the check.
+	Name string `json:"name"`
+	// Passed is true if the check passed.
+	Passed bool `json:"passed"`
+	// Message describes the outcome of the check.
+	Message string `json:"message"`
+}
+
+// PrefixCount is the number of keys with a prefix.
+type PrefixCount struct {
+	// Prefix is the prefix of the keys.
+	Prefix string `json:"prefix"`
+	// Keys is the number of keys with the prefix which have not been deleted.
+	Keys int `json:"keys"`
+}
+
+// VerifyReport describes the verification of a snapshot.
+type VerifyReport struct {
+	// SnapshotPath is the path of the verified snapshot.
+	SnapshotPath string `json:"snapshotPath"`
+	// SHA256 is the hex encoded SHA-256 checksum of the snapshot. It is empty if the checksum file has been skipped.
+	SHA256 string `json:"sha256,omitempty"`
+	// Valid is true if all checks passed.
+	Valid bool `json:"valid"`
+	// Revision is the latest revision of the key space in the snapshot.
+	Revision int64 `json:"revision"`
+	// CompactRevision is the revision up to which the key space in the snapshot has been compacted.
+	CompactRevision int64 `json:"compactRevision"`
+	// Hash is the hash of the key space in the snapshot up to Revision, the same hash which is returned by the
+	// HashKV API of etcd.
+	Hash uint32 `json:"hash"`
+	// Keys is the number of keys in the snapshot which have not been deleted.
+	Keys int `json:"keys"`
+	// Prefixes are the numbers of keys per prefix.
+	Prefixes []PrefixCount `json:"prefixes,omitempty"`
+	// Checks are the results of the checks, in the order they have been run. Checks which depend on a failed check
+	// are not run.
+	Checks []VerifyCheck `json:"checks"`
+	// VerifiedAt is the time the verification finished.
+	VerifiedAt time.Time `json:"verifiedAt"`
+	// DurationSeconds is the time the verification took in seconds.
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// Verify proves that a snapshot is restorable. It restores the snapshot into a temporary data directory, starts a
+// throwaway single member etcd on loopback ports from it and checks that etcd serves the revision, the hash of the
+// key space and the number of keys per prefix which are stored in the snapshot. Everything is torn down before it
+// returns. Failed checks are reported in the returned report, an error is only returned if the verification could
+// not be run at all.
+func Verify(ctx context.Context, opts VerifyOptions, logger *zap.Logger) (*VerifyReport, error) {
+	if opts.PrefixDepth == 0 {
+		opts.PrefixDepth = datadir.DefaultPrefixDepth
+	}
+	if opts.ReadyTimeout == 0 {
+		opts.ReadyTimeout = DefaultVerifyReadyTimeout
+	}
+	tempDir, err := os.MkdirTemp(opts.TempDir, "verify-snapshot-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory to verify snapshot %s: %w", opts.SnapshotPath, err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			logger.Error("failed to remove temporary directory of snapshot verification", zap.String("dir", tempDir), zap.Error(err))
+		}
+	}()
+
+	start := time.Now()
+	report := &VerifyReport{SnapshotPath: opts.SnapshotPath}
+	v := &verifier{opts: opts, dataDir: filepath.Join(tempDir, "data"), report: report, logger: logger}
+	v.run(ctx)
+	report.Valid = true
+	for _, check := range report.Checks {
+		report.Valid = report.Valid && check.Passed
+	}
+	report.VerifiedAt = time.Now()
+	report.DurationSeconds = report.VerifiedAt.Sub(start).Seconds()
+	return report, nil
+}
+
+// verifier runs the checks of a snapshot verification.
+type verifier struct {
+	opts    VerifyOptions
+	dataDir string
+	report  *VerifyReport
+	logger  *zap.Logger
+	// prefixes are the numbers of keys per prefix in the snapshot.
+	prefixes map[string]int
+}
+
+func (v *verifier) run(ctx context.Context) {
+	clientURL, peerURL, err := loopbackURLs()
+	if !v.check(CheckRestore, err) {
+		return
+	}
+	if !v.check(CheckRestore, v.restore(peerURL)) {
+		return
+	}
+	v.pass(CheckRestore, "snapshot %s has been restored into %s", v.opts.SnapshotPath, v.dataDir)
+
+	etcd, err := v.startEtcd(clientURL, peerURL)
+	if !v.check(CheckStart, err) {
+		return
+	}
+	defer etcd.Close()
+	v.pass(CheckStart, "etcd became ready")
+
+	v.check(CheckRevision, v.checkRevision(etcd))
+	v.check(CheckHash, v.checkHash(etcd))
+	v.check(CheckKeyCount, v.checkKeyCount(ctx, etcd))
+}
+
+// check records a failed check if err is not nil, and returns whether err is nil.
+func (v *verifier) check(name string, err error) bool {
+	if err != nil {
+		v.report.Checks = append(v.report.Checks, VerifyCheck{Name: name, Message: err.Error()})
+	}
+	return err == nil
+}
+
+func (v *verifier) pass(name, format string, args ...any) {
+	v.report.Checks = append(v.report.Checks, VerifyCheck{Name: name, Passed: true, Message: fmt.Sprintf(format, args...)})
+}
+
+// restore restores the snapshot and records what it holds, read from the data directory while etcd is not running.
+func (v *verifier) restore(peerURL url.URL) error {
+	restoreReport, err := Restore(RestoreOptions{
+		SnapshotPath:        v.opts.SnapshotPath,
+		SkipChecksumFile:    v.opts.SkipChecksumFile,
+		DataDir:             v.dataDir,
+		Name:                verifyMemberName,
+		InitialCluster:      fmt.Sprintf("%s=%s", verifyMemberName, peerURL.String()),
+		InitialClusterToken: verifyMemberName,
+		AdvertisePeerURLs:   []string{peerURL.String()},
+	}, v.logger)
+	if err != nil {
+		return err
+	}
+	v.report.SHA256 = restoreReport.SHA256
+
+	hashReport, err := datadir.HashKV(v.dataDir, 0)
+	if err != nil {
+		return err
+	}
+	v.report.Revision = hashReport.Revision
+	v.report.CompactRevision = hashReport.CompactRevision
+	v.report.Hash = hashReport.Hash
+
+	dataReport, err := datadir.Inspect(datadir.InspectOptions{DataDir: v.dataDir, PrefixDepth: v.opts.PrefixDepth})
+	if err != nil {
+		return err
+	}
+	v.prefixes = make(map[string]int, len(dataReport.Backend.Prefixes))
+	for _, prefix := range dataReport.Backend.Prefixes {
+		v.prefixes[prefix.Prefix] = prefix.Keys
+		v.report.Prefixes = append(v.report.Prefixes, PrefixCount{Prefix: prefix.Prefix, Keys: prefix.Keys})
+	}
+	v.report.Keys = dataReport.Backend.Keys
+	return nil
+}
+
+// startEtcd starts a single member etcd from the restored data directory which only listens on loopback ports.
+func (v *verifier) startEtcd(clientURL, peerURL url.URL) (*embed.Etcd, error) {
+	cfg := embed.NewConfig()
+	cfg.Name = verifyMemberName
+	cfg.Dir = v.dataDir
+	cfg.LogLevel = "error"
+	cfg.ListenClientUrls = []url.URL{clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{clientURL}
+	cfg.ListenPeerUrls = []url.URL{peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	cfg.InitialClusterToken = verifyMemberName
+	etcd, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start etcd from the restored data directory: %w", err)
+	}
+	select {
+	case <-etcd.Server.ReadyNotify():
+		return etcd, nil
+	case err = <-etcd.Err():
+		etcd.Close()
+		return nil, fmt.Errorf("etcd failed while starting from the restored data directory: %w", err)
+	case <-time.After(v.opts.ReadyTimeout):
+		etcd.Close()
+		return nil, fmt.Errorf("etcd did not become ready within %s", v.opts.ReadyTimeout)
+	}
+}
+
+func (v *verifier) checkRevision(etcd *embed.Etcd) error {
+	revision := etcd.Server.KV().Rev()
+	if revision != v.report.Revision {
+		return fmt.Errorf("etcd serves revision %d, but the snapshot holds revision %d", revision, v.report.Revision)
+	}
+	if revision < v.report.CompactRevision {
+		return fmt.Errorf("revision %d is older than the compact revision %d", revision, v.report.CompactRevision)
+	}
+	v.pass(CheckRevision, "etcd serves revision %d, compacted up to revision %d", revision, v.report.CompactRevision)
+	return nil
+}
+
+func (v *verifier) checkHash(etcd *embed.Etcd) error {
+	hash, _, err := etcd.Server.KV().HashStorage().HashByRev(v.report.Revision)
+	if err != nil {
+		return fmt.Errorf("failed to hash the key space served by etcd: %w", err)
+	}
+	if hash.Hash != v.report.Hash {
+		return fmt.Errorf("etcd serves a key space with hash %d up to revision %d, but the snapshot holds a key space with hash %d", hash.Hash, v.report.Revision, v.report.Hash)
+	}
+	v.pass(CheckHash, "etcd serves a key space with hash %d up to revision %d", hash.Hash, v.report.Revision)
+	return nil
+}
+
+// checkKeyCount ranges over all keys served by etcd at the revision of the snapshot and compares the number of keys
+// per prefix with the numbers read from the restored database.
+func (v *verifier) checkKeyCount(ctx context.Context, etcd *embed.Etcd) error {
+	served := make(map[string]int, len(v.prefixes))
+	key := []byte{0}
+	for {
+		response, err := etcd.Server.Range(ctx, &etcdserverpb.RangeRequest{
+			Key:          key,
+			RangeEnd:     []byte{0},
+			Revision:     v.report.Revision,
+			Limit:        verifyRangeLimit,
+			KeysOnly:     true,
+			Serializable: true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to range over the keys served by etcd: %w", err)
+		}
+		for _, kv := range response.Kvs {
+			served[datadir.KeyPrefix(string(kv.Key), v.opts.PrefixDepth)]++
+		}
+		if !response.More || len(response.Kvs) == 0 {
+			break
+		}
+		key = append(response.Kvs[len(response.Kvs)-1].Key, 0)
+	}
+
+	var mismatches []error
+	for _, prefix := range sortedPrefixes(v.prefixes, served) {
+		if served[prefix] != v.prefixes[prefix] {
+			mismatches = append(mismatches, fmt.Errorf("etcd serves %d keys with prefix %s, but the snapshot holds %d", served[prefix], prefix, v.prefixes[prefix]))
+		}
+	}
+	if len(mismatches) > 0 {
+		return errors.Join(mismatches...)
+	}
+	v.pass(CheckKeyCount, "etcd serves %d keys with %d prefixes", v.report.Keys, len(v.prefixes))
+	return nil
+}
+
+// sortedPrefixes returns the prefixes which are keys of any of the passed maps, in ascending order.
+func sortedPrefixes(counts ...map[string]int) []string {
+	unique := make(map[string]struct{})
+	for _, count := range counts {
+		for prefix := range count {
+			unique[prefix] = struct{}{}
+		}
+	}
+	prefixes := make([]string, 0, len(unique))
+	for prefix := range unique {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// loopbackURLs returns a client and a peer URL on free loopback ports.
+func loopbackURLs() (clientURL, peerURL url.URL, err error) {
+	var ports [2]int
+	for i := range ports {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return url.URL{}, url.URL{}, fmt.Errorf("failed to find a free loopback port: %w", err)
+		}
+		ports[i] = listener.Addr().(*net.TCPAddr).Port
+		defer func() { _ = listener.Close() }()
+	}
+	return url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", ports[0])},
+		url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", ports[1])}, nil
+}
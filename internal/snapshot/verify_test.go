@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/testutil"
+
+	. "github.com/onsi/gomega"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+func TestVerify(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	etcd, err := testutil.StartEtcd(filepath.Join(dir, "source"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(testutil.PutKeys(etcd, map[string]string{
+		"/registry/pods/default/a": "1",
+		"/registry/pods/default/b": "2",
+		"/registry/secrets/kube/c": "3",
+		"/registry/health":         "ok",
+	})).To(Succeed())
+	g.Expect(testutil.DeleteKeys(etcd, "/registry/pods/default/b")).To(Succeed())
+	cli, err := clientv3.New(clientv3.Config{Endpoints: []string{etcd.Config().AdvertiseClientUrls[0].String()}, Logger: zap.NewNop()})
+	g.Expect(err).ToNot(HaveOccurred())
+	defer func() { _ = cli.Close() }()
+	snapshotPath := filepath.Join(dir, "etcd.db")
+	saveReport, err := Save(context.Background(), cli, snapshotPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	onlineHash, revision, err := etcd.Server.KV().HashStorage().HashByRev(0)
+	g.Expect(err).ToNot(HaveOccurred())
+	etcd.Close()
+
+	t.Log("an intact snapshot passes all checks")
+	tempDir := filepath.Join(dir, "tmp")
+	g.Expect(os.Mkdir(tempDir, 0700)).To(Succeed())
+	report, err := Verify(context.Background(), VerifyOptions{SnapshotPath: snapshotPath, TempDir: tempDir}, zap.NewNop())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(report.Checks).To(HaveLen(5))
+	for _, check := range report.Checks {
+		g.Expect(check.Passed).To(BeTrue(), "check %s failed: %s", check.Name, check.Message)
+	}
+	g.Expect(report.Valid).To(BeTrue())
+	g.Expect(report.SHA256).To(Equal(saveReport.SHA256))
+	g.Expect(report.Revision).To(Equal(revision))
+	g.Expect(report.Hash).To(Equal(onlineHash.Hash))
+	g.Expect(report.Keys).To(Equal(3))
+	g.Expect(report.Prefixes).To(ConsistOf(
+		PrefixCount{Prefix: "/registry/pods/", Keys: 1},
+		PrefixCount{Prefix: "/registry/secrets/", Keys: 1},
+		PrefixCount{Prefix: "/registry/", Keys: 1},
+	))
+	g.Expect(os.ReadDir(tempDir)).To(BeEmpty())
+
+	t.Log("a corrupted snapshot fails the restore check, the other checks are not run")
+	data, err := os.ReadFile(snapshotPath) // #nosec G304 -- test file.
+	g.Expect(err).ToNot(HaveOccurred())
+	data[4096] ^= 0xff
+	g.Expect(os.WriteFile(snapshotPath, data, 0600)).To(Succeed())
+	report, err = Verify(context.Background(), VerifyOptions{SnapshotPath: snapshotPath, TempDir: tempDir}, zap.NewNop())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(report.Valid).To(BeFalse())
+	g.Expect(report.Checks).To(HaveLen(1))
+	g.Expect(report.Checks[0].Name).To(Equal(CheckRestore))
+	g.Expect(report.Checks[0].Message).To(ContainSubstring("does not match checksum"))
+	g.Expect(os.ReadDir(tempDir)).To(BeEmpty())
+}
@@ -0,0 +1,279 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Initialization statuses served by the FakeBackupRestore on /initialization/status.
+const (
+	InitializationStatusNew        = "New"
+	InitializationStatusInProgress = "InProgress"
+	InitializationStatusFailed     = "Failed"
+	InitializationStatusSuccessful = "Successful"
+)
+
+// FakeInitializationRequest is a request to /initialization/start received by the FakeBackupRestore.
+type FakeInitializationRequest struct {
+	// Method is the HTTP method of the request.
+	Method string
+	// Mode is the validation mode passed via the `mode` query parameter, if any.
+	Mode string
+	// Body is the body of the request, if any.
+	Body []byte
+}
+
+// FakeLifecycleEvent is a lifecycle event notification received by the FakeBackupRestore.
+type FakeLifecycleEvent struct {
+	// Event is the name of the lifecycle event.
+	Event string `json:"event"`
+	// Reason is the reason passed along with the event, if any.
+	Reason string `json:"reason"`
+}
+
+// FakeBackupRestore is an in-process HTTP server which fakes the endpoints of etcd-backup-restore that are used by
+// etcd-wrapper during bootstrap. Its initialization status starts as New. A request to /initialization/start
+// starts an initialization, after which every request to /initialization/status reports the next of the configured
+// steps for as long as the initialization is in progress. A Failed step is reported once, after which the status is
+// reset to New so that the initialization is triggered again, continuing with the remaining steps.
+type FakeBackupRestore struct {
+	server             *httptest.Server
+	steps              []string
+	latency            time.Duration
+	tlsEnabled         bool
+	capabilities       []string
+	etcdConfigTemplate *template.Template
+	etcdConfigData     any
+
+	mu                     sync.Mutex
+	status                 string
+	nextStep               int
+	initializationRequests []FakeInitializationRequest
+	lifecycleEvents        []FakeLifecycleEvent
+}
+
+// FakeBackupRestoreOption configures a FakeBackupRestore.
+type FakeBackupRestoreOption func(*FakeBackupRestore) error
+
+// WithInitializationSteps sets the statuses which are reported once an initialization has been started.
+// Defaults to InProgress followed by Successful.
+func WithInitializationSteps(steps ...string) FakeBackupRestoreOption {
+	return func(f *FakeBackupRestore) error {
+		if len(steps) == 0 {
+			return fmt.Errorf("at least one initialization step is required")
+		}
+		f.steps = steps
+		return nil
+	}
+}
+
+// WithLatency delays the response to every request by the given duration.
+func WithLatency(latency time.Duration) FakeBackupRestoreOption {
+	return func(f *FakeBackupRestore) error {
+		f.latency = latency
+		return nil
+	}
+}
+
+// WithTLS serves HTTPS instead of HTTP, using a self-signed certificate which can be written to a file
+// with FakeBackupRestore.WriteCACert.
+func WithTLS() FakeBackupRestoreOption {
+	return func(f *FakeBackupRestore) error {
+		f.tlsEnabled = true
+		return nil
+	}
+}
+
+// WithCapabilities serves the given capabilities on /capabilities. Without this option /capabilities is not
+// served, like with older versions of backup-restore.
+func WithCapabilities(capabilities ...string) FakeBackupRestoreOption {
+	return func(f *FakeBackupRestore) error {
+		f.capabilities = capabilities
+		return nil
+	}
+}
+
+// WithEtcdConfigTemplate serves the etcd configuration on /config by executing the given text/template with data.
+func WithEtcdConfigTemplate(etcdConfigTemplate string, data any) FakeBackupRestoreOption {
+	return func(f *FakeBackupRestore) error {
+		tmpl, err := template.New("etcd-config").Option("missingkey=error").Parse(etcdConfigTemplate)
+		if err != nil {
+			return fmt.Errorf("failed to parse etcd config template: %w", err)
+		}
+		f.etcdConfigTemplate = tmpl
+		f.etcdConfigData = data
+		return nil
+	}
+}
+
+// NewFakeBackupRestore creates and starts a FakeBackupRestore listening on a loopback address.
+func NewFakeBackupRestore(opts ...FakeBackupRestoreOption) (*FakeBackupRestore, error) {
+	f := &FakeBackupRestore{
+		steps:  []string{InitializationStatusInProgress, InitializationStatusSuccessful},
+		status: InitializationStatusNew,
+	}
+	for _, opt := range opts {
+		if err := opt(f); err != nil {
+			return nil, err
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/initialization/status", f.serveInitializationStatus)
+	mux.HandleFunc("/initialization/start", f.serveInitializationStart)
+	mux.HandleFunc("/config", f.serveEtcdConfig)
+	mux.HandleFunc("/lifecycle/events", f.serveLifecycleEvents)
+	if f.capabilities != nil {
+		mux.HandleFunc("/capabilities", f.serveCapabilities)
+	}
+	f.server = httptest.NewUnstartedServer(f.withLatency(mux))
+	if f.tlsEnabled {
+		f.server.StartTLS()
+	} else {
+		f.server.Start()
+	}
+	return f, nil
+}
+
+// HostPort returns the <host>:<port> the FakeBackupRestore listens on.
+func (f *FakeBackupRestore) HostPort() string {
+	return f.server.Listener.Addr().String()
+}
+
+// URL returns the base URL of the FakeBackupRestore.
+func (f *FakeBackupRestore) URL() string {
+	return f.server.URL
+}
+
+// WriteCACert writes the PEM encoded certificate served by the FakeBackupRestore, which is self-signed and can
+// hence be used as CA certificate bundle, to the given path. The certificate is valid for 127.0.0.1.
+func (f *FakeBackupRestore) WriteCACert(path string) error {
+	cert := f.server.Certificate()
+	if cert == nil {
+		return fmt.Errorf("fake backup-restore does not serve TLS")
+	}
+	return os.WriteFile(path, pemEncode(cert.Raw, "CERTIFICATE"), 0600)
+}
+
+// Status returns the current initialization status.
+func (f *FakeBackupRestore) Status() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status
+}
+
+// InitializationRequests returns all requests received on /initialization/start.
+func (f *FakeBackupRestore) InitializationRequests() []FakeInitializationRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeInitializationRequest(nil), f.initializationRequests...)
+}
+
+// LifecycleEvents returns all lifecycle events received on /lifecycle/events in the order they were received.
+func (f *FakeBackupRestore) LifecycleEvents() []FakeLifecycleEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeLifecycleEvent(nil), f.lifecycleEvents...)
+}
+
+// Close shuts down the FakeBackupRestore.
+func (f *FakeBackupRestore) Close() {
+	f.server.Close()
+}
+
+func (f *FakeBackupRestore) withLatency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.latency > 0 {
+			select {
+			case <-time.After(f.latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *FakeBackupRestore) serveInitializationStatus(w http.ResponseWriter, _ *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.status == InitializationStatusInProgress && f.nextStep < len(f.steps) {
+		f.status = f.steps[f.nextStep]
+		f.nextStep++
+	}
+	status := f.status
+	if status == InitializationStatusFailed {
+		// the failure is reported once, after which the initialization has to be triggered again
+		f.status = InitializationStatusNew
+	}
+	_, _ = io.WriteString(w, status)
+}
+
+func (f *FakeBackupRestore) serveInitializationStart(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodPost && !json.Valid(body) {
+		http.Error(w, "request body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.initializationRequests = append(f.initializationRequests, FakeInitializationRequest{
+		Method: r.Method,
+		Mode:   r.URL.Query().Get("mode"),
+		Body:   body,
+	})
+	if f.status == InitializationStatusNew {
+		f.status = InitializationStatusInProgress
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *FakeBackupRestore) serveEtcdConfig(w http.ResponseWriter, _ *http.Request) {
+	if f.etcdConfigTemplate == nil {
+		http.Error(w, "no etcd config template configured", http.StatusNotFound)
+		return
+	}
+	var buf bytes.Buffer
+	if err := f.etcdConfigTemplate.Execute(&buf, f.etcdConfigData); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (f *FakeBackupRestore) serveLifecycleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	var event FakeLifecycleEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lifecycleEvents = append(f.lifecycleEvents, event)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *FakeBackupRestore) serveCapabilities(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string][]string{"capabilities": f.capabilities})
+}
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package testutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// etcdReadyTimeout is the time an embedded etcd started by StartEtcd is given to become ready.
+const etcdReadyTimeout = 30 * time.Second
+
+// StartEtcd starts a single member embedded etcd with its data directory at dataDir, which listens on free loopback
+// ports. It returns once etcd is ready to serve requests. The caller must close the returned etcd.
+func StartEtcd(dataDir string) (*embed.Etcd, error) {
+	etcds, err := StartEtcdCluster(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	return etcds[0], nil
+}
+
+// StartEtcdCluster starts an embedded etcd cluster with one member per passed data directory, which listen on free
+// loopback ports. It returns once all members are ready to serve requests. The caller must close the returned etcds.
+func StartEtcdCluster(dataDirs ...string) ([]*embed.Etcd, error) {
+	cfgs := make([]*embed.Config, 0, len(dataDirs))
+	initialCluster := make([]string, 0, len(dataDirs))
+	for i, dataDir := range dataDirs {
+		clientPort, err := FreePort()
+		if err != nil {
+			return nil, err
+		}
+		peerPort, err := FreePort()
+		if err != nil {
+			return nil, err
+		}
+		clientURL := url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", clientPort)}
+		peerURL := url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", peerPort)}
+
+		cfg := embed.NewConfig()
+		cfg.Name = "etcd-test"
+		if len(dataDirs) > 1 {
+			cfg.Name = fmt.Sprintf("etcd-test-%d", i)
+		}
+		cfg.Dir = dataDir
+		cfg.LogLevel = "error"
+		cfg.ListenClientUrls = []url.URL{clientURL}
+		cfg.AdvertiseClientUrls = []url.URL{clientURL}
+		cfg.ListenPeerUrls = []url.URL{peerURL}
+		cfg.AdvertisePeerUrls = []url.URL{peerURL}
+		cfgs = append(cfgs, cfg)
+		initialCluster = append(initialCluster, fmt.Sprintf("%s=%s", cfg.Name, peerURL.String()))
+	}
+	etcds := make([]*embed.Etcd, 0, len(cfgs))
+	closeAll := func() {
+		for _, etcd := range etcds {
+			etcd.Close()
+		}
+	}
+	for _, cfg := range cfgs {
+		cfg.InitialCluster = strings.Join(initialCluster, ",")
+		etcd, err := embed.StartEtcd(cfg)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		etcds = append(etcds, etcd)
+	}
+	timeout := time.After(etcdReadyTimeout)
+	for _, etcd := range etcds {
+		select {
+		case <-etcd.Server.ReadyNotify():
+		case <-timeout:
+			closeAll()
+			return nil, errors.New("timed out waiting for the embedded etcd to become ready")
+		}
+	}
+	return etcds, nil
+}
+
+// PutKeys writes the passed key-value pairs to the embedded etcd.
+func PutKeys(etcd *embed.Etcd, kvs map[string]string) error {
+	for key, value := range kvs {
+		if _, err := etcd.Server.Put(context.Background(), &etcdserverpb.PutRequest{Key: []byte(key), Value: []byte(value)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteKeys deletes the passed keys from the embedded etcd.
+func DeleteKeys(etcd *embed.Etcd, keys ...string) error {
+	for _, key := range keys {
+		if _, err := etcd.Server.DeleteRange(context.Background(), &etcdserverpb.DeleteRangeRequest{Key: []byte(key)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FreePort returns a free TCP port on the loopback interface.
+func FreePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = listener.Close() }()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package testutil
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// OTLPCollector is an in-process stub of an OTLP gRPC trace collector which records all spans it receives.
+type OTLPCollector struct {
+	collectortracepb.UnimplementedTraceServiceServer
+	listener      net.Listener
+	server        *grpc.Server
+	mu            sync.Mutex
+	resourceSpans []*tracepb.ResourceSpans
+}
+
+// NewOTLPCollector creates an OTLPCollector listening on a random loopback port and starts serving.
+func NewOTLPCollector() (*OTLPCollector, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	c := &OTLPCollector{
+		listener: listener,
+		server:   grpc.NewServer(),
+	}
+	collectortracepb.RegisterTraceServiceServer(c.server, c)
+	go func() {
+		_ = c.server.Serve(listener)
+	}()
+	return c, nil
+}
+
+// Endpoint returns the host and port the collector is listening on.
+func (c *OTLPCollector) Endpoint() string {
+	return c.listener.Addr().String()
+}
+
+// Export records the spans in the request.
+func (c *OTLPCollector) Export(_ context.Context, req *collectortracepb.ExportTraceServiceRequest) (*collectortracepb.ExportTraceServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resourceSpans = append(c.resourceSpans, req.GetResourceSpans()...)
+	return &collectortracepb.ExportTraceServiceResponse{}, nil
+}
+
+// SpanNames returns the names of all spans received so far, in the order they were received.
+func (c *OTLPCollector) SpanNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for _, rs := range c.resourceSpans {
+		for _, ss := range rs.GetScopeSpans() {
+			for _, span := range ss.GetSpans() {
+				names = append(names, span.GetName())
+			}
+		}
+	}
+	return names
+}
+
+// ResourceAttributes returns the string attributes of the resources of all spans received so far.
+func (c *OTLPCollector) ResourceAttributes() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	attributes := make(map[string]string)
+	for _, rs := range c.resourceSpans {
+		for _, kv := range rs.GetResource().GetAttributes() {
+			attributes[kv.GetKey()] = kv.GetValue().GetStringValue()
+		}
+	}
+	return attributes
+}
+
+// Stop stops the collector.
+func (c *OTLPCollector) Stop() {
+	c.server.Stop()
+}
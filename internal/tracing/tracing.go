@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gardener/etcd-wrapper/internal/types"
+	"github.com/gardener/etcd-wrapper/internal/version"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	// ServiceName is the name of the service reported in the traces of etcd-wrapper.
+	ServiceName = "etcd-wrapper"
+	// EtcdServiceName is the name of the service reported in the traces of the embedded etcd.
+	EtcdServiceName = "etcd"
+	// instrumentationName is the name of the tracer used by etcd-wrapper.
+	instrumentationName = "github.com/gardener/etcd-wrapper"
+)
+
+// ShutdownFunc flushes all pending spans and shuts down the exporter.
+type ShutdownFunc func(context.Context) error
+
+// Setup validates the tracing configuration and, if tracing is enabled, registers a global tracer provider which
+// exports spans via OTLP gRPC to the configured endpoint along with a W3C trace context propagator. The returned
+// ShutdownFunc should be called before the application exits.
+func Setup(ctx context.Context, cfg types.TracingConfig, logger *zap.Logger) (ShutdownFunc, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracegrpc.New(ctx,
+		otlptracegrpc.WithInsecure(),
+		otlptracegrpc.WithEndpoint(cfg.Endpoint),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(ServiceName),
+			semconv.ServiceVersion(version.Version),
+		)),
+		sdktrace.WithSampler(sdktrace.ParentBased(determineSampler(cfg.SamplingRatePerMillion))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	logger.Info("Exporting traces", zap.String("endpoint", cfg.Endpoint), zap.Int("samplingRatePerMillion", cfg.SamplingRatePerMillion))
+
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), exporter.Shutdown(ctx))
+	}, nil
+}
+
+// Tracer returns the tracer used to instrument etcd-wrapper. Spans started from it are no-ops if tracing has
+// not been enabled via Setup.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// EndSpan records err, if any, on the span and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func determineSampler(samplingRatePerMillion int) sdktrace.Sampler {
+	if samplingRatePerMillion == 0 {
+		return sdktrace.NeverSample()
+	}
+	return sdktrace.TraceIDRatioBased(float64(samplingRatePerMillion) / float64(types.MaxTracingSamplingRatePerMillion))
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gardener/etcd-wrapper/internal/testutil"
+	"github.com/gardener/etcd-wrapper/internal/types"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSetup(t *testing.T) {
+	table := []struct {
+		description string
+		config      types.TracingConfig
+		expectError bool
+	}{
+		{"should return error when tracing is enabled without an endpoint", types.TracingConfig{Enabled: true, SamplingRatePerMillion: types.MaxTracingSamplingRatePerMillion}, true},
+		{"should return error when sampling rate is out of range", types.TracingConfig{Enabled: true, Endpoint: "localhost:4317", SamplingRatePerMillion: -1}, true},
+		{"should not return error when tracing is disabled", types.TracingConfig{}, false},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.description, func(t *testing.T) {
+			g := NewWithT(t)
+			shutdown, err := Setup(context.Background(), entry.config, zap.NewNop())
+			g.Expect(err != nil).To(Equal(entry.expectError))
+			if !entry.expectError {
+				g.Expect(shutdown(context.Background())).To(Succeed())
+			}
+		})
+	}
+}
+
+func TestSetupExportsSpans(t *testing.T) {
+	g := NewWithT(t)
+	collector, err := testutil.NewOTLPCollector()
+	g.Expect(err).ToNot(HaveOccurred())
+	defer collector.Stop()
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	shutdown, err := Setup(context.Background(), types.TracingConfig{
+		Enabled:                true,
+		Endpoint:               collector.Endpoint(),
+		SamplingRatePerMillion: types.MaxTracingSamplingRatePerMillion,
+	}, zap.NewNop())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	ctx, parent := Tracer().Start(context.Background(), "Bootstrap")
+	_, child := Tracer().Start(ctx, "GetInitializationStatus")
+	EndSpan(child, errors.New("connection refused"))
+	EndSpan(parent, nil)
+	g.Expect(shutdown(context.Background())).To(Succeed())
+
+	g.Expect(collector.SpanNames()).To(ConsistOf("Bootstrap", "GetInitializationStatus"))
+	g.Expect(collector.ResourceAttributes()).To(HaveKeyWithValue("service.name", ServiceName))
+}
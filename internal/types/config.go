@@ -7,7 +7,12 @@ package types
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gardener/etcd-wrapper/internal/util"
 )
@@ -22,6 +27,238 @@ type Config struct {
 	EtcdClientPort int
 	// EtcdWrapperPort is the server port for etcd-wrapper.
 	EtcdWrapperPort int
+	// EtcdLogger is the configuration for the logger used by the embedded etcd.
+	EtcdLogger EtcdLoggerConfig
+	// Tracing is the configuration for exporting OpenTelemetry traces.
+	Tracing TracingConfig
+	// EtcdConfigOverrides are changes applied to the etcd configuration fetched from backup-restore before etcd is started.
+	EtcdConfigOverrides EtcdConfigOverridesConfig
+	// Preflight is the configuration of the checks of the data directory before etcd is started.
+	Preflight PreflightConfig
+	// SnapshotVerification is the configuration of the periodic verification of a local snapshot.
+	SnapshotVerification SnapshotVerificationConfig
+	// ConsistencyCheck is the configuration of the periodic comparison of the key space with the peers.
+	ConsistencyCheck ConsistencyCheckConfig
+	// Defragmentation is the configuration of the scheduled defragmentation of the members.
+	Defragmentation DefragmentationConfig
+	// QuotaWatcher is the configuration of the watcher of the database size against the backend quota.
+	QuotaWatcher QuotaWatcherConfig
+}
+
+// PreflightMode decides how failed pre-flight checks of the data directory are treated.
+type PreflightMode string
+
+const (
+	// PreflightModeDisabled disables the pre-flight checks.
+	PreflightModeDisabled PreflightMode = "disabled"
+	// PreflightModeWarn logs failed pre-flight checks, but starts etcd nevertheless.
+	PreflightModeWarn PreflightMode = "warn"
+	// PreflightModeFatal does not start etcd if any pre-flight check failed.
+	PreflightModeFatal PreflightMode = "fatal"
+)
+
+// PreflightConfig holds the configuration of the checks of the data directory before etcd is started.
+type PreflightConfig struct {
+	// Mode decides how failed checks are treated. An empty mode is treated as PreflightModeWarn.
+	Mode PreflightMode
+}
+
+// Validate validates the pre-flight configuration.
+func (c *PreflightConfig) Validate() error {
+	switch c.Mode {
+	case "", PreflightModeDisabled, PreflightModeWarn, PreflightModeFatal:
+		return nil
+	default:
+		return fmt.Errorf("pre-flight mode %q should be one of %q, %q or %q", c.Mode, PreflightModeDisabled, PreflightModeWarn, PreflightModeFatal)
+	}
+}
+
+// SnapshotVerificationConfig holds the configuration of the periodic verification that a local snapshot is
+// restorable.
+type SnapshotVerificationConfig struct {
+	// SnapshotPath is the path of the snapshot which is verified, e.g. the file written by `snapshot save`.
+	SnapshotPath string
+	// Interval is the interval in which the snapshot is verified. The verification is disabled if it is 0.
+	Interval time.Duration
+	// TempDir is the directory in which the snapshot is restored for its verification. The default directory for
+	// temporary files is used if it is empty.
+	TempDir string
+}
+
+// IsEnabled returns true if the periodic verification of the snapshot has been enabled.
+func (c *SnapshotVerificationConfig) IsEnabled() bool {
+	return c.Interval > 0
+}
+
+// Validate validates the snapshot verification configuration.
+func (c *SnapshotVerificationConfig) Validate() (err error) {
+	if c.Interval < 0 {
+		err = errors.Join(err, fmt.Errorf("snapshot verification interval cannot be negative"))
+	}
+	if c.IsEnabled() && strings.TrimSpace(c.SnapshotPath) == "" {
+		err = errors.Join(err, fmt.Errorf("snapshot verification file cannot be empty when the snapshot verification is enabled"))
+	}
+	return
+}
+
+// ConsistencyMismatchPolicy decides what happens if the consistency check finds that the key space of this member
+// has diverged from the one of the other members.
+type ConsistencyMismatchPolicy string
+
+const (
+	// ConsistencyMismatchPolicyAlert only reports the mismatch in logs, metrics and on /status.
+	ConsistencyMismatchPolicyAlert ConsistencyMismatchPolicy = "alert"
+	// ConsistencyMismatchPolicyFailReadiness additionally fails the readiness of this member.
+	ConsistencyMismatchPolicyFailReadiness ConsistencyMismatchPolicy = "fail-readiness"
+	// ConsistencyMismatchPolicyStop additionally stops this member and requests a full validation of its data
+	// directory on the next start.
+	ConsistencyMismatchPolicyStop ConsistencyMismatchPolicy = "stop"
+)
+
+// ConsistencyCheckConfig holds the configuration of the periodic comparison of the hash of the key space of this
+// member with the hashes of its peers.
+type ConsistencyCheckConfig struct {
+	// Interval is the interval in which the key space is compared. The check is disabled if it is 0.
+	Interval time.Duration
+	// MismatchPolicy decides what happens if the key space of this member has diverged. An empty policy is treated
+	// as ConsistencyMismatchPolicyAlert.
+	MismatchPolicy ConsistencyMismatchPolicy
+}
+
+// IsEnabled returns true if the periodic consistency check has been enabled.
+func (c *ConsistencyCheckConfig) IsEnabled() bool {
+	return c.Interval > 0
+}
+
+// Validate validates the consistency check configuration.
+func (c *ConsistencyCheckConfig) Validate() (err error) {
+	if c.Interval < 0 {
+		err = errors.Join(err, fmt.Errorf("consistency check interval cannot be negative"))
+	}
+	switch c.MismatchPolicy {
+	case "", ConsistencyMismatchPolicyAlert, ConsistencyMismatchPolicyFailReadiness, ConsistencyMismatchPolicyStop:
+	default:
+		err = errors.Join(err, fmt.Errorf("consistency mismatch policy %q should be one of %q, %q or %q", c.MismatchPolicy, ConsistencyMismatchPolicyAlert, ConsistencyMismatchPolicyFailReadiness, ConsistencyMismatchPolicyStop))
+	}
+	return
+}
+
+// DefragmentationConfig holds the configuration of the scheduled defragmentation of the members. The etcd-wrapper of
+// every member defragments its own member, the one of the leader last.
+type DefragmentationConfig struct {
+	// Schedule is a cron expression of five fields deciding when the members are defragmented. It cannot be set
+	// together with Interval.
+	Schedule string
+	// Interval is the interval in which the members are defragmented. It cannot be set together with Schedule.
+	Interval time.Duration
+	// SamplingInterval is the interval in which the fragmentation of the database is sampled, so that the member is
+	// defragmented as soon as it exceeds MinFragmentationRatio, independent of Schedule and Interval.
+	SamplingInterval time.Duration
+	// MinFragmentationRatio is the minimal share of the database size which is not in use for a member to be
+	// defragmented. Every member is defragmented if it is 0.
+	MinFragmentationRatio float64
+	// MinDBSizeBytes is the minimal size of the database for a member to be defragmented.
+	MinDBSizeBytes int64
+}
+
+// IsEnabled returns true if the scheduled or the fragmentation triggered defragmentation has been enabled.
+func (c *DefragmentationConfig) IsEnabled() bool {
+	return c.Schedule != "" || c.Interval > 0 || c.SamplingInterval > 0
+}
+
+// Validate validates the defragmentation configuration.
+func (c *DefragmentationConfig) Validate() (err error) {
+	if c.Interval < 0 {
+		err = errors.Join(err, fmt.Errorf("defragmentation interval cannot be negative"))
+	}
+	if c.Schedule != "" {
+		if c.Interval != 0 {
+			err = errors.Join(err, fmt.Errorf("defragmentation schedule and interval cannot both be set"))
+		}
+		if _, parseErr := util.ParseCronSchedule(c.Schedule); parseErr != nil {
+			err = errors.Join(err, parseErr)
+		}
+	}
+	if c.SamplingInterval < 0 {
+		err = errors.Join(err, fmt.Errorf("defragmentation sampling interval cannot be negative"))
+	}
+	if c.SamplingInterval > 0 && c.MinFragmentationRatio == 0 {
+		err = errors.Join(err, fmt.Errorf("defragmentation sampling interval requires a minimal fragmentation ratio"))
+	}
+	if c.MinFragmentationRatio < 0 || c.MinFragmentationRatio >= 1 {
+		err = errors.Join(err, fmt.Errorf("minimal fragmentation ratio %v should be at least 0 and less than 1", c.MinFragmentationRatio))
+	}
+	if c.MinDBSizeBytes < 0 {
+		err = errors.Join(err, fmt.Errorf("minimal database size for defragmentation cannot be negative"))
+	}
+	return
+}
+
+// DefaultQuotaWarningThresholds are the default percentages of the backend quota at which a warning is logged.
+var DefaultQuotaWarningThresholds = []float64{70, 85, 95}
+
+// QuotaWatcherConfig holds the configuration of the watcher which samples the size of the database and compares it
+// with the backend quota of etcd.
+type QuotaWatcherConfig struct {
+	// Interval is the interval in which the size of the database is sampled. The watcher is disabled if it is 0.
+	Interval time.Duration
+	// WarningThresholds are the ascending percentages of the backend quota at which a warning is logged once the
+	// size of the database exceeds them.
+	WarningThresholds []float64
+	// CompactionEnabled enables a compaction of the key space by the leader once a warning threshold is exceeded.
+	CompactionEnabled bool
+}
+
+// IsEnabled returns true if the quota watcher has been enabled.
+func (c *QuotaWatcherConfig) IsEnabled() bool {
+	return c.Interval > 0
+}
+
+// Validate validates the quota watcher configuration.
+func (c *QuotaWatcherConfig) Validate() (err error) {
+	if c.Interval < 0 {
+		err = errors.Join(err, fmt.Errorf("quota watcher interval cannot be negative"))
+	}
+	for i, threshold := range c.WarningThresholds {
+		if threshold <= 0 || threshold > 100 {
+			err = errors.Join(err, fmt.Errorf("quota warning threshold %v should be a percentage above 0 and at most 100", threshold))
+		}
+		if i > 0 && threshold <= c.WarningThresholds[i-1] {
+			err = errors.Join(err, fmt.Errorf("quota warning thresholds should be ascending, found %v after %v", threshold, c.WarningThresholds[i-1]))
+		}
+	}
+	return
+}
+
+// EtcdConfigOverridesConfig holds changes which are applied to the etcd configuration fetched from backup-restore.
+type EtcdConfigOverridesConfig struct {
+	// OverlayFilePath is the path of a YAML file which is merged on top of the etcd configuration.
+	OverlayFilePath string
+	// Overrides are key=value pairs which are applied after the overlay file. Keys of nested fields, like
+	// client-transport-security.cert-file, are separated by dots. Values are parsed as YAML.
+	Overrides []string `redact:"etcd-config-override"`
+}
+
+// IsEmpty returns true if no overrides have been configured.
+func (c *EtcdConfigOverridesConfig) IsEmpty() bool {
+	return c.OverlayFilePath == "" && len(c.Overrides) == 0
+}
+
+// Validate validates the etcd configuration overrides.
+func (c *EtcdConfigOverridesConfig) Validate() (err error) {
+	for _, override := range c.Overrides {
+		if key, _, found := strings.Cut(override, "="); !found || strings.TrimSpace(key) == "" {
+			err = errors.Join(err, fmt.Errorf("etcd configuration override %q should be of the format <key>=<value>", override))
+		}
+	}
+	return
+}
+
+// EtcdLoggerConfig holds the configuration for the logger used by the embedded etcd.
+type EtcdLoggerConfig struct {
+	// UseWrapperLogger routes the logs of the embedded etcd through the etcd-wrapper logger if set to true, instead of
+	// the logger configured in the etcd configuration fetched from backup-restore.
+	UseWrapperLogger bool
 }
 
 // EtcdClientTLSConfig holds the TLS configuration to configure a etcd client.
@@ -32,45 +269,152 @@ type EtcdClientTLSConfig struct {
 	// CertPath is the path to the client certificate
 	CertPath string
 	// KeyPath is the path to the client key
-	KeyPath string
+	KeyPath string `redact:"value"`
+}
+
+// TracingConfig holds the configuration for exporting OpenTelemetry traces via OTLP.
+type TracingConfig struct {
+	// Enabled enables exporting traces of the etcd-wrapper bootstrap if set to true.
+	Enabled bool
+	// Endpoint is the host and port of the OTLP gRPC collector to which traces are exported.
+	Endpoint string
+	// SamplingRatePerMillion is the number of traces that are sampled per million.
+	SamplingRatePerMillion int
+	// EtcdTracingEnabled enables distributed tracing in the embedded etcd if set to true. Traces of etcd are
+	// exported to the same Endpoint with the same SamplingRatePerMillion.
+	EtcdTracingEnabled bool
+}
+
+// Validate validates the tracing configuration.
+func (c *TracingConfig) Validate() (err error) {
+	if (c.Enabled || c.EtcdTracingEnabled) && strings.TrimSpace(c.Endpoint) == "" {
+		err = errors.Join(err, fmt.Errorf("tracing endpoint cannot be empty when tracing is enabled"))
+	}
+	if c.SamplingRatePerMillion < 0 || c.SamplingRatePerMillion > MaxTracingSamplingRatePerMillion {
+		err = errors.Join(err, fmt.Errorf("tracing sampling rate per million should be between 0 and %d", MaxTracingSamplingRatePerMillion))
+	}
+	return
 }
 
 // BackupRestoreConfig defines parameters needed to interact with the backup-restore container
 type BackupRestoreConfig struct {
-	HostPort         string
+	// HostPort is the endpoint of backup-restore. It is either of the format <host>:<port>, where the host can be a
+	// bracketed IPv6 literal, a full URL of the format <scheme>://<host>:<port>[/<path-prefix>] or a unix domain
+	// socket of the format unix:///<path>.
+	HostPort string
+	// TLSServerName overrides the server name used to verify the certificate of backup-restore. If it is empty, the
+	// host of HostPort is used.
+	TLSServerName    string
 	TLSEnabled       bool
 	CaCertBundlePath string
+	// ClientCertPath is the path to the client certificate presented to backup-restore when TLS is enabled.
+	ClientCertPath string
+	// ClientKeyPath is the path to the key of the client certificate presented to backup-restore when TLS is enabled.
+	ClientKeyPath string `redact:"value"`
 }
 
 // Validate validates backup-restore configuration.
 func (c *BackupRestoreConfig) Validate() (err error) {
-	splits := strings.Split(c.HostPort, ":")
-	if len(splits) < 2 {
-		err = errors.Join(err, fmt.Errorf("both host and port needs to be specified and should be adhere to format: <host>:<port>"))
-	}
-
-	if strings.HasPrefix(c.HostPort, "http:") || strings.HasPrefix(c.HostPort, "https:") {
-		err = errors.Join(err, fmt.Errorf("backup-restore-host-port should not contain scheme"))
+	endpoint, parseErr := c.parseEndpoint()
+	if parseErr != nil {
+		err = errors.Join(err, parseErr)
+	} else if endpoint.Scheme != "" && endpoint.Scheme != schemeUnix && endpoint.Scheme != c.scheme() {
+		err = errors.Join(err, fmt.Errorf("scheme %q of backup-restore-host-port does not match the TLS setting, expected %q", endpoint.Scheme, c.scheme()))
 	}
 	if c.TLSEnabled {
 		if strings.TrimSpace(c.CaCertBundlePath) == "" {
 			err = errors.Join(err, fmt.Errorf("certificate bundle path cannot be nil or empty when TLS is enabled"))
 		}
 	}
+	hasClientCert, hasClientKey := strings.TrimSpace(c.ClientCertPath) != "", strings.TrimSpace(c.ClientKeyPath) != ""
+	if hasClientCert != hasClientKey {
+		err = errors.Join(err, fmt.Errorf("both client certificate path and client key path need to be specified to use mutual TLS"))
+	}
+	if (hasClientCert || hasClientKey) && !c.TLSEnabled {
+		err = errors.Join(err, fmt.Errorf("client certificate and key can only be specified when TLS is enabled"))
+	}
 	return
 }
 
-// GetBaseAddress returns the complete address of the backup restore container.
+// IsMutualTLSEnabled checks if a client certificate should be presented to backup-restore.
+func (c *BackupRestoreConfig) IsMutualTLSEnabled() bool {
+	return c.TLSEnabled && strings.TrimSpace(c.ClientCertPath) != "" && strings.TrimSpace(c.ClientKeyPath) != ""
+}
+
+// GetBaseAddress returns the complete address of the backup restore container including the path prefix, if any.
 func (c *BackupRestoreConfig) GetBaseAddress() string {
-	return util.ConstructBaseAddress(c.TLSEnabled, c.HostPort)
+	endpoint, err := c.parseEndpoint()
+	if err != nil || endpoint.Scheme == "" {
+		return util.ConstructBaseAddress(c.TLSEnabled, c.HostPort)
+	}
+	if endpoint.Scheme == schemeUnix {
+		// the host is not used to connect to a unix domain socket, but is required for a valid URL
+		return util.ConstructBaseAddress(c.TLSEnabled, c.GetHost())
+	}
+	return util.ConstructBaseAddress(c.TLSEnabled, endpoint.Host+strings.TrimSuffix(endpoint.Path, "/"))
 }
 
-// GetHost extracts the backup-restore server host from host-port string.
+// GetHost returns the server name used to verify the certificate of backup-restore. It is TLSServerName if set,
+// otherwise the host of HostPort without brackets for IPv6 literals. It defaults to `localhost`.
 func (c *BackupRestoreConfig) GetHost() string {
+	if serverName := strings.TrimSpace(c.TLSServerName); serverName != "" {
+		return serverName
+	}
 	host := "localhost"
-	splits := strings.Split(c.HostPort, ":")
-	if len(strings.TrimSpace(splits[0])) > 0 {
-		host = splits[0]
+	if endpoint, err := c.parseEndpoint(); err == nil && endpoint.Scheme != schemeUnix && len(strings.TrimSpace(endpoint.Hostname())) > 0 {
+		host = endpoint.Hostname()
 	}
 	return host
 }
+
+// parseEndpoint parses HostPort into a URL. The scheme of the returned URL is empty if HostPort is of the format <host>:<port>.
+func (c *BackupRestoreConfig) parseEndpoint() (*url.URL, error) {
+	rawEndpoint := c.HostPort
+	if !strings.Contains(rawEndpoint, "://") {
+		// parse as a network path reference to get the host and port split for free
+		rawEndpoint = "//" + rawEndpoint
+	}
+	endpoint, err := url.Parse(rawEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup-restore-host-port %q: %w", c.HostPort, err)
+	}
+	if endpoint.Scheme == schemeUnix {
+		if endpoint.Host != "" || !filepath.IsAbs(endpoint.Path) {
+			return nil, fmt.Errorf("unix domain socket in backup-restore-host-port should be of the format unix:///<absolute-path>")
+		}
+		return endpoint, nil
+	}
+	if endpoint.Scheme != "" && endpoint.Scheme != schemeHTTP && endpoint.Scheme != schemeHTTPS {
+		return nil, fmt.Errorf("unsupported scheme %q in backup-restore-host-port, should be one of %q, %q or %q", endpoint.Scheme, schemeHTTP, schemeHTTPS, schemeUnix)
+	}
+	if endpoint.Scheme == "" && endpoint.Path != "" {
+		return nil, fmt.Errorf("path prefix in backup-restore-host-port is only allowed for a full URL of the format <scheme>://<host>:<port>/<path-prefix>")
+	}
+	if endpoint.User != nil || endpoint.RawQuery != "" || endpoint.Fragment != "" {
+		return nil, fmt.Errorf("backup-restore-host-port should not contain user info, query or fragment")
+	}
+	if _, port, err := net.SplitHostPort(endpoint.Host); err != nil || port == "" {
+		return nil, fmt.Errorf("both host and port needs to be specified and should be adhere to format: <host>:<port>")
+	}
+	if port, err := strconv.Atoi(endpoint.Port()); err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("port in backup-restore-host-port should be a number between 1 and 65535")
+	}
+	return endpoint, nil
+}
+
+// GetUnixSocketPath returns the path of the unix domain socket if HostPort is of the format unix:///<path>, and
+// an empty string otherwise.
+func (c *BackupRestoreConfig) GetUnixSocketPath() string {
+	endpoint, err := c.parseEndpoint()
+	if err != nil || endpoint.Scheme != schemeUnix {
+		return ""
+	}
+	return endpoint.Path
+}
+
+func (c *BackupRestoreConfig) scheme() string {
+	if c.TLSEnabled {
+		return schemeHTTPS
+	}
+	return schemeHTTP
+}
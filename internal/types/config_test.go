@@ -7,6 +7,7 @@ package types
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 )
@@ -36,24 +37,254 @@ func TestValidate(t *testing.T) {
 		tlsEnabled       bool
 		hostPort         string
 		caCertBundlePath string
+		clientCertPath   string
+		clientKeyPath    string
 		expectedError    bool
 	}{
-		{"missing host should result in error", false, "2379", "", true},
-		{"missing port should result in error", false, "localhost", "", true},
-		{"should allow empty host", false, ":2379", "", false},
-		{"should disallow specifying scheme", false, "http://localhost:2379", "", true},
-		{"should disallow empty caCertBundlePath when TLS is enabled", true, ":2379", "", true},
+		{"missing host should result in error", false, "2379", "", "", "", true},
+		{"missing port should result in error", false, "localhost", "", "", "", true},
+		{"should allow empty host", false, ":2379", "", "", "", false},
+		{"should allow bracketed IPv6 host", false, "[fd00::1]:8080", "", "", "", false},
+		{"should disallow unbracketed IPv6 host", false, "fd00::1:8080", "", "", "", true},
+		{"should disallow non-numeric port", false, "localhost:http", "", "", "", true},
+		{"should allow full URL with scheme matching TLS setting", false, "http://localhost:2379", "", "", "", false},
+		{"should allow full URL with IPv6 host and path prefix", true, "https://[fd00::1]:8080/backup-restore", defaultTestCaCertBundlePath, "", "", false},
+		{"should disallow full URL with scheme not matching TLS setting", false, "https://localhost:2379", "", "", "", true},
+		{"should disallow full URL with unsupported scheme", false, "ftp://localhost:2379", "", "", "", true},
+		{"should disallow full URL without port", false, "http://localhost/prefix", "", "", "", true},
+		{"should disallow path prefix without scheme", false, "localhost:2379/prefix", "", "", "", true},
+		{"should allow unix domain socket without TLS", false, "unix:///var/run/backup-restore/backup-restore.sock", "", "", "", false},
+		{"should allow unix domain socket with TLS", true, "unix:///var/run/backup-restore/backup-restore.sock", defaultTestCaCertBundlePath, "", "", false},
+		{"should disallow unix domain socket with relative path", false, "unix://backup-restore.sock", "", "", "", true},
+		{"should disallow unix domain socket without path", false, "unix://", "", "", "", true},
+		{"should disallow empty caCertBundlePath when TLS is enabled", true, ":2379", "", "", "", true},
+		{"should allow client cert and key when TLS is enabled", true, ":2379", defaultTestCaCertBundlePath, "/var/etcd/ssl/client/tls.crt", "/var/etcd/ssl/client/tls.key", false},
+		{"should disallow client cert without client key", true, ":2379", defaultTestCaCertBundlePath, "/var/etcd/ssl/client/tls.crt", "", true},
+		{"should disallow client key without client cert", true, ":2379", defaultTestCaCertBundlePath, "", "/var/etcd/ssl/client/tls.key", true},
+		{"should disallow client cert and key when TLS is disabled", false, ":2379", "", "/var/etcd/ssl/client/tls.crt", "/var/etcd/ssl/client/tls.key", true},
 	}
 	for _, entry := range table {
 		g := NewWithT(t)
 		t.Log(entry.description)
 		c := createSidecarConfig(entry.tlsEnabled, entry.hostPort)
 		c.CaCertBundlePath = entry.caCertBundlePath
+		c.ClientCertPath = entry.clientCertPath
+		c.ClientKeyPath = entry.clientKeyPath
 		err := c.Validate()
 		g.Expect(err != nil).To(Equal(entry.expectedError))
 	}
 }
 
+func TestGetBaseAddress(t *testing.T) {
+	table := []struct {
+		description         string
+		tlsEnabled          bool
+		hostPort            string
+		expectedBaseAddress string
+	}{
+		{"should use host and port as is", false, "etcd-main-local:8080", "http://etcd-main-local:8080"},
+		{"should keep brackets of IPv6 host", true, "[fd00::1]:8080", "https://[fd00::1]:8080"},
+		{"should include path prefix of full URL", true, "https://[fd00::1]:8080/backup-restore/", "https://[fd00::1]:8080/backup-restore"},
+		{"should drop trailing slash of full URL", false, "http://localhost:8080/", "http://localhost:8080"},
+		{"should use placeholder host for unix domain socket", false, "unix:///var/run/backup-restore.sock", "http://localhost"},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		c := createSidecarConfig(entry.tlsEnabled, entry.hostPort)
+		g.Expect(c.GetBaseAddress()).To(Equal(entry.expectedBaseAddress))
+	}
+}
+
+func TestGetHost(t *testing.T) {
+	table := []struct {
+		description   string
+		hostPort      string
+		tlsServerName string
+		expectedHost  string
+	}{
+		{"should return host of host and port", "etcd-main-local:8080", "", "etcd-main-local"},
+		{"should default to localhost for empty host", ":8080", "", "localhost"},
+		{"should strip brackets of IPv6 host", "[fd00::1]:8080", "", "fd00::1"},
+		{"should return host of full URL", "https://etcd-main-local:8080/backup-restore", "", "etcd-main-local"},
+		{"should prefer TLS server name override", "[fd00::1]:8080", "etcd-main-local", "etcd-main-local"},
+		{"should default to localhost for unix domain socket", "unix:///var/run/backup-restore.sock", "", "localhost"},
+		{"should prefer TLS server name override for unix domain socket", "unix:///var/run/backup-restore.sock", "etcd-main-local", "etcd-main-local"},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		c := createSidecarConfig(true, entry.hostPort)
+		c.TLSServerName = entry.tlsServerName
+		g.Expect(c.GetHost()).To(Equal(entry.expectedHost))
+	}
+}
+
+func TestGetUnixSocketPath(t *testing.T) {
+	table := []struct {
+		description        string
+		hostPort           string
+		expectedSocketPath string
+	}{
+		{"should return path of unix domain socket", "unix:///var/run/backup-restore.sock", "/var/run/backup-restore.sock"},
+		{"should return empty path for host and port", "etcd-main-local:8080", ""},
+		{"should return empty path for full URL", "http://etcd-main-local:8080/backup-restore", ""},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		c := createSidecarConfig(false, entry.hostPort)
+		g.Expect(c.GetUnixSocketPath()).To(Equal(entry.expectedSocketPath))
+	}
+}
+
+func TestValidateTracingConfig(t *testing.T) {
+	table := []struct {
+		description   string
+		config        TracingConfig
+		expectedError bool
+	}{
+		{"should allow disabled tracing without endpoint", TracingConfig{}, false},
+		{"should disallow enabled tracing without endpoint", TracingConfig{Enabled: true}, true},
+		{"should disallow etcd tracing without endpoint", TracingConfig{EtcdTracingEnabled: true}, true},
+		{"should disallow negative sampling rate", TracingConfig{Enabled: true, Endpoint: "localhost:4317", SamplingRatePerMillion: -1}, true},
+		{"should disallow sampling rate above one million", TracingConfig{Enabled: true, Endpoint: "localhost:4317", SamplingRatePerMillion: MaxTracingSamplingRatePerMillion + 1}, true},
+		{"should allow enabled tracing with endpoint", TracingConfig{Enabled: true, EtcdTracingEnabled: true, Endpoint: "localhost:4317", SamplingRatePerMillion: MaxTracingSamplingRatePerMillion}, false},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		err := entry.config.Validate()
+		g.Expect(err != nil).To(Equal(entry.expectedError))
+	}
+}
+
+func TestValidateEtcdConfigOverridesConfig(t *testing.T) {
+	table := []struct {
+		description   string
+		config        EtcdConfigOverridesConfig
+		expectedError bool
+	}{
+		{"should allow no overrides", EtcdConfigOverridesConfig{}, false},
+		{"should allow overrides of the format key=value", EtcdConfigOverridesConfig{Overrides: []string{"snapshot-count=10000", "client-transport-security.cert-file=/var/etcd/ssl/tls.crt", "log-outputs="}}, false},
+		{"should disallow overrides without value", EtcdConfigOverridesConfig{Overrides: []string{"snapshot-count"}}, true},
+		{"should disallow overrides without key", EtcdConfigOverridesConfig{Overrides: []string{"=10000"}}, true},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		err := entry.config.Validate()
+		g.Expect(err != nil).To(Equal(entry.expectedError))
+	}
+}
+
+func TestValidatePreflightConfig(t *testing.T) {
+	table := []struct {
+		description   string
+		mode          PreflightMode
+		expectedError bool
+	}{
+		{"should allow an empty mode", "", false},
+		{"should allow the disabled mode", PreflightModeDisabled, false},
+		{"should allow the warn mode", PreflightModeWarn, false},
+		{"should allow the fatal mode", PreflightModeFatal, false},
+		{"should disallow an unknown mode", "strict", true},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		config := PreflightConfig{Mode: entry.mode}
+		g.Expect(config.Validate() != nil).To(Equal(entry.expectedError))
+	}
+}
+
+func TestValidateSnapshotVerificationConfig(t *testing.T) {
+	table := []struct {
+		description   string
+		config        SnapshotVerificationConfig
+		expectedError bool
+	}{
+		{"should allow a disabled verification", SnapshotVerificationConfig{}, false},
+		{"should allow an enabled verification with a snapshot", SnapshotVerificationConfig{SnapshotPath: "/var/etcd/backup/etcd.db", Interval: time.Hour}, false},
+		{"should disallow an enabled verification without a snapshot", SnapshotVerificationConfig{Interval: time.Hour}, true},
+		{"should disallow a negative interval", SnapshotVerificationConfig{SnapshotPath: "/var/etcd/backup/etcd.db", Interval: -time.Hour}, true},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		g.Expect(entry.config.Validate() != nil).To(Equal(entry.expectedError))
+	}
+}
+
+func TestValidateConsistencyCheckConfig(t *testing.T) {
+	table := []struct {
+		description   string
+		config        ConsistencyCheckConfig
+		expectedError bool
+	}{
+		{"should allow a disabled check", ConsistencyCheckConfig{}, false},
+		{"should allow the alert policy", ConsistencyCheckConfig{Interval: time.Hour, MismatchPolicy: ConsistencyMismatchPolicyAlert}, false},
+		{"should allow the fail-readiness policy", ConsistencyCheckConfig{Interval: time.Hour, MismatchPolicy: ConsistencyMismatchPolicyFailReadiness}, false},
+		{"should allow the stop policy", ConsistencyCheckConfig{Interval: time.Hour, MismatchPolicy: ConsistencyMismatchPolicyStop}, false},
+		{"should disallow an unknown policy", ConsistencyCheckConfig{Interval: time.Hour, MismatchPolicy: "ignore"}, true},
+		{"should disallow a negative interval", ConsistencyCheckConfig{Interval: -time.Hour}, true},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		g.Expect(entry.config.Validate() != nil).To(Equal(entry.expectedError))
+	}
+}
+
+func TestValidateDefragmentationConfig(t *testing.T) {
+	table := []struct {
+		description   string
+		config        DefragmentationConfig
+		expectedError bool
+	}{
+		{"should allow a disabled defragmentation", DefragmentationConfig{}, false},
+		{"should allow a schedule", DefragmentationConfig{Schedule: "0 3 * * *", MinFragmentationRatio: 0.5}, false},
+		{"should allow an interval", DefragmentationConfig{Interval: 24 * time.Hour, MinDBSizeBytes: 100 << 20}, false},
+		{"should disallow a schedule together with an interval", DefragmentationConfig{Schedule: "0 3 * * *", Interval: 24 * time.Hour}, true},
+		{"should disallow an invalid schedule", DefragmentationConfig{Schedule: "0 25 * * *"}, true},
+		{"should disallow a negative interval", DefragmentationConfig{Interval: -time.Hour}, true},
+		{"should disallow a negative fragmentation ratio", DefragmentationConfig{Interval: time.Hour, MinFragmentationRatio: -0.1}, true},
+		{"should disallow a fragmentation ratio of 1", DefragmentationConfig{Interval: time.Hour, MinFragmentationRatio: 1}, true},
+		{"should disallow a negative database size", DefragmentationConfig{Interval: time.Hour, MinDBSizeBytes: -1}, true},
+		{"should allow a sampling interval with a fragmentation ratio", DefragmentationConfig{SamplingInterval: time.Minute, MinFragmentationRatio: 0.5}, false},
+		{"should disallow a sampling interval without a fragmentation ratio", DefragmentationConfig{SamplingInterval: time.Minute}, true},
+		{"should disallow a negative sampling interval", DefragmentationConfig{SamplingInterval: -time.Minute, MinFragmentationRatio: 0.5}, true},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		g.Expect(entry.config.Validate() != nil).To(Equal(entry.expectedError))
+	}
+}
+
+func TestValidateQuotaWatcherConfig(t *testing.T) {
+	table := []struct {
+		description   string
+		config        QuotaWatcherConfig
+		expectedError bool
+	}{
+		{"should allow a disabled watcher", QuotaWatcherConfig{}, false},
+		{"should allow the default thresholds", QuotaWatcherConfig{Interval: time.Minute, WarningThresholds: DefaultQuotaWarningThresholds, CompactionEnabled: true}, false},
+		{"should allow no thresholds", QuotaWatcherConfig{Interval: time.Minute}, false},
+		{"should allow a threshold of 100", QuotaWatcherConfig{Interval: time.Minute, WarningThresholds: []float64{99.5, 100}}, false},
+		{"should disallow a negative interval", QuotaWatcherConfig{Interval: -time.Minute}, true},
+		{"should disallow a threshold of 0", QuotaWatcherConfig{Interval: time.Minute, WarningThresholds: []float64{0, 50}}, true},
+		{"should disallow a threshold above 100", QuotaWatcherConfig{Interval: time.Minute, WarningThresholds: []float64{70, 120}}, true},
+		{"should disallow descending thresholds", QuotaWatcherConfig{Interval: time.Minute, WarningThresholds: []float64{85, 70}}, true},
+		{"should disallow duplicate thresholds", QuotaWatcherConfig{Interval: time.Minute, WarningThresholds: []float64{70, 70}}, true},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		g.Expect(entry.config.Validate() != nil).To(Equal(entry.expectedError))
+	}
+}
+
 func createSidecarConfig(tlsEnabled bool, hostPort string) BackupRestoreConfig {
 	var caCertBundlePath string
 	if tlsEnabled {
@@ -13,8 +13,22 @@ const (
 	DefaultBackupRestoreHostPort = ":8080"
 	// DefaultExitCodeFilePath defines the default file path for the file that stores the exit code of the previous run
 	DefaultExitCodeFilePath = "/var/etcd/data/exit_code"
+	// DefaultStartAttemptsFilePath defines the default file path for the file that counts the consecutive starts in which etcd did not become ready
+	DefaultStartAttemptsFilePath = "/var/etcd/data/start_attempts"
+	// DefaultLockFilePath defines the default file path for the lock file of the data directory, next to the default data directory /var/etcd/data/new.etcd
+	DefaultLockFilePath = "/var/etcd/data/etcd-wrapper.lock"
 	// ValidationMarkerFilePath defines the file path to the legacy file that was used to record exit code of the previous run
 	ValidationMarkerFilePath = "/var/etcd/data/validation_marker"
+	// EnvVarPrefix is the prefix of the environment variables from which the flags of etcd-wrapper are set
+	EnvVarPrefix = "ETCD_WRAPPER_"
 	// DefaultLogLevel defines the default log level for any zap loggers created
 	DefaultLogLevel = zapcore.InfoLevel
+	// schemeHTTP is the scheme used to talk to backup-restore when TLS is disabled
+	schemeHTTP = "http"
+	// schemeHTTPS is the scheme used to talk to backup-restore when TLS is enabled
+	schemeHTTPS = "https"
+	// schemeUnix is the scheme used to talk to backup-restore over a unix domain socket
+	schemeUnix = "unix"
+	// MaxTracingSamplingRatePerMillion defines the sampling rate at which every trace is sampled
+	MaxTracingSamplingRatePerMillion = 1000000
 )
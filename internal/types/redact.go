@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"reflect"
+	"strings"
+)
+
+const (
+	// RedactedValue replaces the values of sensitive fields wherever configuration is logged or served.
+	RedactedValue = "<redacted>"
+
+	// redactTag is the struct tag which marks sensitive fields of Config. Its value is the redaction mode.
+	redactTag = "redact"
+	// redactValue redacts the whole value of a string field.
+	redactValue = "value"
+	// redactEtcdConfigOverride redacts the values of overrides of sensitive etcd configuration fields in a list of
+	// <key>=<value> pairs.
+	redactEtcdConfigOverride = "etcd-config-override"
+)
+
+// sensitiveEtcdConfigKeys are the keys of the fields of an etcd configuration file whose values must not be logged
+// or served. Keys of nested fields are separated by dots.
+var sensitiveEtcdConfigKeys = map[string]struct{}{
+	"initial-cluster-token":                     {},
+	"auth-token":                                {},
+	"client-transport-security.key-file":        {},
+	"client-transport-security.client-key-file": {},
+	"peer-transport-security.key-file":          {},
+	"peer-transport-security.client-key-file":   {},
+}
+
+// IsSensitiveEtcdConfigKey returns true if the value of the etcd configuration field with the passed key must not be
+// logged or served. Keys of nested fields are separated by dots.
+func IsSensitiveEtcdConfigKey(key string) bool {
+	_, ok := sensitiveEtcdConfigKeys[key]
+	return ok
+}
+
+// RedactEtcdConfigOverride returns the passed <key>=<value> override of an etcd configuration field with the value
+// redacted if the field is sensitive.
+func RedactEtcdConfigOverride(override string) string {
+	key, _, found := strings.Cut(override, "=")
+	if found && IsSensitiveEtcdConfigKey(strings.TrimSpace(key)) {
+		return key + "=" + RedactedValue
+	}
+	return override
+}
+
+// redactorsByMode are the functions which redact a single value of a field, by the redaction mode of the field.
+var redactorsByMode = map[string]func(string) string{
+	redactValue:              func(string) string { return RedactedValue },
+	redactEtcdConfigOverride: RedactEtcdConfigOverride,
+}
+
+// Redacted returns a copy of the configuration in which the values of all fields tagged with `redact` are redacted.
+// It should be used wherever the configuration is logged or served.
+func (c Config) Redacted() Config {
+	redactFields(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+// Redactors returns the function which redacts a single value of every field of c tagged with `redact`, keyed by the
+// address of the field. It allows to redact the values of flags bound to the fields of c.
+func (c *Config) Redactors() map[uintptr]func(string) string {
+	redactors := make(map[uintptr]func(string) string)
+	visitRedactedFields(reflect.ValueOf(c).Elem(), func(field reflect.Value, redact func(string) string) {
+		redactors[field.Addr().Pointer()] = redact
+	})
+	return redactors
+}
+
+// redactFields redacts the tagged fields of the struct v and all structs nested in it. Set values are replaced, so
+// that slices shared with the original are not changed.
+func redactFields(v reflect.Value) {
+	visitRedactedFields(v, func(field reflect.Value, redact func(string) string) {
+		switch {
+		case field.Kind() == reflect.String && field.String() != "":
+			field.SetString(redact(field.String()))
+		case field.Kind() == reflect.Slice && field.Len() > 0:
+			values := make([]string, 0, field.Len())
+			for j := 0; j < field.Len(); j++ {
+				values = append(values, redact(field.Index(j).String()))
+			}
+			field.Set(reflect.ValueOf(values))
+		}
+	})
+}
+
+// visitRedactedFields calls visit for every field tagged with `redact` of the struct v and all structs nested in it,
+// together with the function which redacts a single value of the field.
+func visitRedactedFields(v reflect.Value, visit func(field reflect.Value, redact func(string) string)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			visitRedactedFields(field, visit)
+			continue
+		}
+		if redact, ok := redactorsByMode[v.Type().Field(i).Tag.Get(redactTag)]; ok {
+			visit(field, redact)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"testing"
+	"unsafe"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRedacted(t *testing.T) {
+	g := NewWithT(t)
+	config := Config{
+		BackupRestore: BackupRestoreConfig{
+			HostPort:       "etcd-main-local:8080",
+			ClientCertPath: "/var/etcd/ssl/backup-restore-client/tls.crt",
+			ClientKeyPath:  "/var/etcd/ssl/backup-restore-client/tls.key",
+		},
+		EtcdClientTLS: EtcdClientTLSConfig{
+			CertPath: "/var/etcd/ssl/client/tls.crt",
+			KeyPath:  "/var/etcd/ssl/client/tls.key",
+		},
+		EtcdConfigOverrides: EtcdConfigOverridesConfig{
+			Overrides: []string{"snapshot-count=10000", "initial-cluster-token=secret-token", "client-transport-security.key-file=/var/etcd/ssl/server/tls.key"},
+		},
+	}
+
+	redacted := config.Redacted()
+	g.Expect(redacted.BackupRestore.HostPort).To(Equal(config.BackupRestore.HostPort))
+	g.Expect(redacted.BackupRestore.ClientCertPath).To(Equal(config.BackupRestore.ClientCertPath))
+	g.Expect(redacted.BackupRestore.ClientKeyPath).To(Equal(RedactedValue))
+	g.Expect(redacted.EtcdClientTLS.CertPath).To(Equal(config.EtcdClientTLS.CertPath))
+	g.Expect(redacted.EtcdClientTLS.KeyPath).To(Equal(RedactedValue))
+	g.Expect(redacted.EtcdConfigOverrides.Overrides).To(Equal([]string{"snapshot-count=10000", "initial-cluster-token=" + RedactedValue, "client-transport-security.key-file=" + RedactedValue}))
+	// the original configuration is not changed
+	g.Expect(config.BackupRestore.ClientKeyPath).To(Equal("/var/etcd/ssl/backup-restore-client/tls.key"))
+	g.Expect(config.EtcdConfigOverrides.Overrides[1]).To(Equal("initial-cluster-token=secret-token"))
+}
+
+func TestRedactedKeepsEmptyValues(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(Config{}.Redacted()).To(Equal(Config{}))
+}
+
+func TestRedactors(t *testing.T) {
+	g := NewWithT(t)
+	config := Config{}
+	redactors := config.Redactors()
+	g.Expect(redactors).To(HaveLen(3))
+	g.Expect(redactors[uintptr(unsafe.Pointer(&config.BackupRestore.ClientKeyPath))]("tls.key")).To(Equal(RedactedValue))
+	g.Expect(redactors[uintptr(unsafe.Pointer(&config.EtcdClientTLS.KeyPath))]("tls.key")).To(Equal(RedactedValue))
+	g.Expect(redactors[uintptr(unsafe.Pointer(&config.EtcdConfigOverrides.Overrides))]("auth-token=jwt")).To(Equal("auth-token=" + RedactedValue))
+	g.Expect(redactors).ToNot(HaveKey(uintptr(unsafe.Pointer(&config.BackupRestore.ClientCertPath))))
+}
+
+func TestRedactEtcdConfigOverride(t *testing.T) {
+	table := []struct {
+		description string
+		override    string
+		expected    string
+	}{
+		{"should keep overrides of fields which are not sensitive", "quota-backend-bytes=8589934592", "quota-backend-bytes=8589934592"},
+		{"should redact overrides of sensitive fields", "auth-token=jwt,pub-key=app.rsa.pub", "auth-token=" + RedactedValue},
+		{"should redact overrides of sensitive nested fields", "peer-transport-security.key-file=/var/etcd/ssl/peer/tls.key", "peer-transport-security.key-file=" + RedactedValue},
+		{"should keep malformed overrides", "initial-cluster-token", "initial-cluster-token"},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		g.Expect(RedactEtcdConfigOverride(entry.override)).To(Equal(entry.expected))
+	}
+}
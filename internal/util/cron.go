@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCronSearchYears bounds the search for the next activation of a schedule which can never be activated, e.g. on
+// the 30th of February.
+const maxCronSearchYears = 5
+
+// cronField describes the range of values of a field of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// CronSchedule is a schedule given by a cron expression of the five fields minute, hour, day of month, month and day
+// of week. Every field is either `*` or a comma separated list of values `a`, ranges `a-b` and steps `*/n`, `a/n`
+// or `a-b/n`. Sunday is day 0 or 7 of the week. As in cron, a day matches if either the day of month or the day of
+// week matches in case both are restricted, i.e. do not start with `*`.
+type CronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	dayOfMonthRestricted, dayOfWeekRestricted  bool
+}
+
+// ParseCronSchedule parses a cron expression of five fields.
+func ParseCronSchedule(spec string) (*CronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q should have %d fields, found %d", spec, len(cronFields), len(fields))
+	}
+	bits := make([]uint64, len(fields))
+	var err error
+	for i, field := range fields {
+		var fieldErr error
+		if bits[i], fieldErr = parseCronField(field, cronFields[i]); fieldErr != nil {
+			err = errors.Join(err, fieldErr)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", spec, err)
+	}
+	// Sunday can be given as 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &CronSchedule{
+		minute:               bits[0],
+		hour:                 bits[1],
+		dayOfMonth:           bits[2],
+		month:                bits[3],
+		dayOfWeek:            bits[4],
+		dayOfMonthRestricted: !strings.HasPrefix(fields[2], "*"),
+		dayOfWeekRestricted:  !strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField returns a bit set of the values matched by a field of a cron expression.
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("%s: step %q should be a positive number", f.name, stepPart)
+			}
+		}
+		start, end := f.min, f.max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = parseCronValue(from, f); err != nil {
+				return 0, err
+			}
+			switch {
+			case isRange:
+				if end, err = parseCronValue(to, f); err != nil {
+					return 0, err
+				}
+				if end < start {
+					return 0, fmt.Errorf("%s: range %q should not end before it starts", f.name, rangePart)
+				}
+			case !hasStep:
+				end = start
+			}
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+// parseCronValue parses a single value of a field of a cron expression.
+func parseCronValue(value string, f cronField) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("%s: value %q should be a number between %d and %d", f.name, value, f.min, f.max)
+	}
+	return n, nil
+}
+
+// Next returns the first time after t at which the schedule is activated, in the location of t. It returns the
+// zero time if the schedule is not activated within the next years.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxCronSearchYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay checks if the day of t matches the day of month and day of week of the schedule.
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth&(1<<t.Day()) != 0
+	dayOfWeek := s.dayOfWeek&(1<<int(t.Weekday())) != 0
+	if s.dayOfMonthRestricted && s.dayOfWeekRestricted {
+		return dayOfMonth || dayOfWeek
+	}
+	return dayOfMonth && dayOfWeek
+}
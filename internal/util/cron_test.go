@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	table := []struct {
+		description   string
+		spec          string
+		expectedError bool
+	}{
+		{"should allow every minute", "* * * * *", false},
+		{"should allow lists, ranges and steps", "0,30 1-5 */2 1-12/3 1-5", false},
+		{"should allow Sunday as day 7", "0 3 * * 7", false},
+		{"should disallow too few fields", "0 3 * *", true},
+		{"should disallow too many fields", "0 0 3 * * *", true},
+		{"should disallow values out of range", "60 3 * * *", true},
+		{"should disallow a day of month 0", "0 3 0 * *", true},
+		{"should disallow names", "0 3 * * MON", true},
+		{"should disallow inverted ranges", "0 5-1 * * *", true},
+		{"should disallow a zero step", "*/0 * * * *", true},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		_, err := ParseCronSchedule(entry.spec)
+		g.Expect(err != nil).To(Equal(entry.expectedError))
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2024-05-02 is a Thursday
+	now := time.Date(2024, time.May, 2, 10, 11, 12, 0, time.UTC)
+	table := []struct {
+		description  string
+		spec         string
+		expectedNext time.Time
+	}{
+		{"should activate every minute in the next minute", "* * * * *", time.Date(2024, time.May, 2, 10, 12, 0, 0, time.UTC)},
+		{"should activate every 15 minutes at the next quarter", "*/15 * * * *", time.Date(2024, time.May, 2, 10, 15, 0, 0, time.UTC)},
+		{"should activate daily at 3:00 on the next day", "0 3 * * *", time.Date(2024, time.May, 3, 3, 0, 0, 0, time.UTC)},
+		{"should activate daily at 10:30 on the same day", "30 10 * * *", time.Date(2024, time.May, 2, 10, 30, 0, 0, time.UTC)},
+		{"should activate on Sundays given as day 0", "0 3 * * 0", time.Date(2024, time.May, 5, 3, 0, 0, 0, time.UTC)},
+		{"should activate on Sundays given as day 7", "0 3 * * 7", time.Date(2024, time.May, 5, 3, 0, 0, 0, time.UTC)},
+		{"should activate on weekdays", "0 3 * * 1-5", time.Date(2024, time.May, 3, 3, 0, 0, 0, time.UTC)},
+		{"should activate on the first of the next month", "0 0 1 * *", time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{"should activate in the next matching month", "0 0 1 1,7 *", time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC)},
+		{"should activate if either day of month or day of week matches", "0 0 15 * 6", time.Date(2024, time.May, 4, 0, 0, 0, 0, time.UTC)},
+		{"should activate if both day of month and day of week match for a day of month with a step", "0 0 */2 * 6", time.Date(2024, time.May, 11, 0, 0, 0, 0, time.UTC)},
+		{"should activate if both day of month and day of week match for a day of week with a step", "0 0 3 * */3", time.Date(2024, time.July, 3, 0, 0, 0, 0, time.UTC)},
+		{"should activate on leap days", "0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"should never activate on the 30th of February", "0 0 30 2 *", time.Time{}},
+	}
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		schedule, err := ParseCronSchedule(entry.spec)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(schedule.Next(now)).To(Equal(entry.expectedNext))
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"os"
+	"sync"
+	"time"
 )
 
 // CreateCACertPool creates a CA cert pool gives a CA cert bundle
@@ -56,3 +58,52 @@ func CreateTLSConfig(tlsEnabledFn IsTLSEnabledFn, serverName, caCertPath string,
 	}
 	return &tlsConf, nil
 }
+
+// CertificateReloader provides a certificate-key pair which is reloaded from disk whenever either of the files has
+// been modified. This allows certificates to be rotated without restarting etcd-wrapper.
+type CertificateReloader struct {
+	keyPair     KeyPair
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// NewCertificateReloader creates a CertificateReloader and loads the certificate-key pair for the first time.
+func NewCertificateReloader(keyPair KeyPair) (*CertificateReloader, error) {
+	r := &CertificateReloader{keyPair: keyPair}
+	if _, err := r.loadIfModified(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetClientCertificate returns the current certificate-key pair, reloading it if the files have been modified.
+// If reloading fails, e.g. because only one of the two files has been rotated so far, the previously loaded
+// certificate-key pair is returned. It can be used as tls.Config.GetClientCertificate.
+func (r *CertificateReloader) GetClientCertificate(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.loadIfModified()
+}
+
+func (r *CertificateReloader) loadIfModified() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	certInfo, certErr := os.Stat(r.keyPair.CertPath)
+	keyInfo, keyErr := os.Stat(r.keyPair.KeyPath)
+	if certErr == nil && keyErr == nil && r.certificate != nil &&
+		certInfo.ModTime().Equal(r.certModTime) && keyInfo.ModTime().Equal(r.keyModTime) {
+		return r.certificate, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(r.keyPair.CertPath, r.keyPair.KeyPath)
+	if err != nil {
+		if r.certificate != nil {
+			return r.certificate, nil
+		}
+		return nil, err
+	}
+	r.certificate = &certificate
+	if certErr == nil && keyErr == nil {
+		r.certModTime, r.keyModTime = certInfo.ModTime(), keyInfo.ModTime()
+	}
+	return r.certificate, nil
+}
@@ -6,9 +6,11 @@ package util
 
 import (
 	"errors"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/gardener/etcd-wrapper/internal/testutil"
 	. "github.com/onsi/gomega"
@@ -80,6 +82,46 @@ func TestCreateTLSConfig(t *testing.T) {
 	}
 }
 
+func TestCertificateReloader(t *testing.T) {
+	g := NewWithT(t)
+	defer func() {
+		g.Expect(os.RemoveAll(testdataPath)).To(BeNil())
+	}()
+
+	_, err := NewCertificateReloader(KeyPair{CertPath: etcdClientCertPath, KeyPath: etcdClientKeyPath})
+	g.Expect(err).To(HaveOccurred())
+
+	createTLSResources(g)
+	reloader, err := NewCertificateReloader(KeyPair{CertPath: etcdClientCertPath, KeyPath: etcdClientKeyPath})
+	g.Expect(err).ToNot(HaveOccurred())
+	initialCert, err := reloader.GetClientCertificate(nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	unchangedCert, err := reloader.GetClientCertificate(nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(unchangedCert).To(BeIdenticalTo(initialCert))
+
+	t.Log("should keep the previous certificate while only the key has been rotated")
+	g.Expect(os.WriteFile(etcdClientKeyPath, []byte("rotation in progress"), 0600)).To(Succeed())
+	touch(g, etcdClientKeyPath)
+	partiallyRotatedCert, err := reloader.GetClientCertificate(nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(partiallyRotatedCert).To(BeIdenticalTo(initialCert))
+
+	t.Log("should reload the certificate once both files have been rotated")
+	createTLSResources(g)
+	touch(g, etcdClientCertPath)
+	touch(g, etcdClientKeyPath)
+	rotatedCert, err := reloader.GetClientCertificate(nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rotatedCert.Certificate[0]).ToNot(Equal(initialCert.Certificate[0]))
+}
+
+// touch sets the modification time of the file into the future to not depend on the granularity of the file system timestamps.
+func touch(g *WithT, path string) {
+	future := time.Now().Add(time.Duration(rand.Intn(3600)+1) * time.Second)
+	g.Expect(os.Chtimes(path, future, future)).To(Succeed())
+}
+
 func alwaysReturnsTrue() bool {
 	return true
 }
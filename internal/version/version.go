@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	etcdversion "go.etcd.io/etcd/api/v3/version"
+)
+
+const (
+	unknown = "unknown"
+
+	etcdServerModule = "go.etcd.io/etcd/server/v3"
+	etcdClientModule = "go.etcd.io/etcd/client/v3"
+)
+
+var (
+	// Version is the version of etcd-wrapper. It is set at build time via -ldflags from the top-level VERSION file.
+	Version = "dev"
+	// GitCommit is the git commit etcd-wrapper was built from. It is set at build time via -ldflags.
+	GitCommit = ""
+	// BuildDate is the date at which etcd-wrapper was built in RFC 3339 format. It is set at build time via -ldflags.
+	BuildDate = ""
+)
+
+// Info describes the build of etcd-wrapper.
+type Info struct {
+	// Version is the version of etcd-wrapper.
+	Version string `json:"version"`
+	// GitCommit is the git commit etcd-wrapper was built from.
+	GitCommit string `json:"gitCommit"`
+	// BuildDate is the date at which etcd-wrapper was built.
+	BuildDate string `json:"buildDate"`
+	// GoVersion is the version of Go etcd-wrapper was built with.
+	GoVersion string `json:"goVersion"`
+	// EtcdServerVersion is the version of the vendored etcd server which is embedded.
+	EtcdServerVersion string `json:"etcdServerVersion"`
+	// EtcdClientVersion is the version of the vendored etcd client.
+	EtcdClientVersion string `json:"etcdClientVersion"`
+}
+
+// Get returns the Info of this build of etcd-wrapper. Values which have not been set at build time are taken from
+// the build information embedded into the binary, where available.
+func Get() Info {
+	info := Info{
+		Version:           Version,
+		GitCommit:         GitCommit,
+		BuildDate:         BuildDate,
+		GoVersion:         runtime.Version(),
+		EtcdServerVersion: etcdversion.Version,
+		EtcdClientVersion: etcdversion.Version,
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range buildInfo.Deps {
+			switch dep.Path {
+			case etcdServerModule:
+				info.EtcdServerVersion = moduleVersion(dep)
+			case etcdClientModule:
+				info.EtcdClientVersion = moduleVersion(dep)
+			}
+		}
+		if info.GitCommit == "" {
+			for _, setting := range buildInfo.Settings {
+				if setting.Key == "vcs.revision" {
+					info.GitCommit = setting.Value
+				}
+			}
+		}
+	}
+	if info.GitCommit == "" {
+		info.GitCommit = unknown
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = unknown
+	}
+	return info
+}
+
+// moduleVersion returns the version of a module without the leading `v`, in line with the versions reported by etcd.
+func moduleVersion(module *debug.Module) string {
+	if module.Replace != nil {
+		module = module.Replace
+	}
+	return strings.TrimPrefix(module.Version, "v")
+}
@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"runtime"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	etcdversion "go.etcd.io/etcd/api/v3/version"
+)
+
+func TestGet(t *testing.T) {
+	table := []struct {
+		description       string
+		gitCommit         string
+		buildDate         string
+		expectedBuildDate string
+	}{
+		{"should default build date to unknown if it is not set at build time", "", "", unknown},
+		{"should use git commit and build date set at build time", "0123456789abcdef", "2024-05-02T10:15:00Z", "2024-05-02T10:15:00Z"},
+	}
+	defer func(gitCommit, buildDate string) { GitCommit, BuildDate = gitCommit, buildDate }(GitCommit, BuildDate)
+	for _, entry := range table {
+		g := NewWithT(t)
+		t.Log(entry.description)
+		GitCommit, BuildDate = entry.gitCommit, entry.buildDate
+		info := Get()
+		g.Expect(info.Version).To(Equal(Version))
+		if entry.gitCommit != "" {
+			g.Expect(info.GitCommit).To(Equal(entry.gitCommit))
+		} else {
+			g.Expect(info.GitCommit).ToNot(BeEmpty())
+		}
+		g.Expect(info.BuildDate).To(Equal(entry.expectedBuildDate))
+		g.Expect(info.GoVersion).To(Equal(runtime.Version()))
+		g.Expect(info.EtcdServerVersion).To(Equal(etcdversion.Version))
+		g.Expect(info.EtcdClientVersion).To(Equal(etcdversion.Version))
+	}
+}
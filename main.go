@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -20,8 +21,8 @@ import (
 )
 
 func main() {
-	args := os.Args[1:]
-	checkArgs(args)
+	command, args := cmd.LookupCommand(os.Args[1:])
+	checkCommand(command)
 
 	//create logger
 	loggerCfg := bootstrap.SetupLoggerConfig(types.DefaultLogLevel)
@@ -30,39 +31,51 @@ func main() {
 		log.Fatalf("error creating zap logger %v", err)
 	}
 
-	//setup signal handler
-	ctx, cancelFn := signal.SetupHandler(logger, bootstrap.CaptureExitCode, types.DefaultExitCodeFilePath)
+	//setup signal handler, the exit code is only captured for etcd as it determines the validation of the next start
+	var (
+		ctx      context.Context
+		cancelFn context.CancelFunc
+	)
+	if command == &cmd.EtcdCmd {
+		ctx, cancelFn = signal.SetupHandler(logger, bootstrap.CaptureExitCode, types.DefaultExitCodeFilePath)
+	} else {
+		ctx, cancelFn = signal.SetupCancelHandler(logger)
+	}
 
 	// Add flags
 	fs := flag.CommandLine
-	cmd.EtcdCmd.AddFlags(fs)
-	if err = fs.Parse(args[1:]); err != nil {
+	command.AddFlags(fs)
+	flagSources, err := cmd.ParseFlags(fs, args)
+	if err != nil {
 		logger.Fatal("error parsing command flags", zap.Error(err))
 	}
 
-	// Print all flags
-	printFlags(logger)
+	// Print all flags of etcd, the other commands print their results and are not cluttered with them
+	if command == &cmd.EtcdCmd {
+		printFlags(logger, flagSources)
+	}
 
-	// InitAndStartEtcd command
-	if err = cmd.EtcdCmd.Run(ctx, cancelFn, logger); err != nil {
-		logger.Fatal("error during start or run of etcd", zap.Error(err))
+	// Run the command
+	if err = command.Run(ctx, cancelFn, logger); err != nil {
+		logger.Fatal("error during run of command", zap.String("command", command.Name), zap.Error(err))
 	}
 }
 
-// checkArgs checks the command arguments and prints the usage if either the command name itself is not specified
-// or the command specified is not supported.
-func checkArgs(args []string) {
-	//check if any unsupported command is specified. Print help if that is the case
-	if len(args) < 1 || !cmd.IsCommandSupported(args[0]) {
+// checkCommand prints the usage if either the command name itself is not specified or the command specified is not
+// supported.
+func checkCommand(command *cmd.Command) {
+	if command == nil {
 		_ = cmd.PrintHelp(os.Stderr)
 		os.Exit(1)
 	}
 }
 
-func printFlags(logger *zap.Logger) {
+// printFlags logs the values of all flags together with the source they have been taken from. Sensitive values are
+// redacted.
+func printFlags(logger *zap.Logger, flagSources map[string]cmd.FlagSource) {
 	var flagsToPrint string
 	flag.VisitAll(func(f *flag.Flag) {
-		flagsToPrint += fmt.Sprintf("%s: %s, ", f.Name, f.Value)
+		flagsToPrint += fmt.Sprintf("%s: %s (%s), ", f.Name, cmd.RedactedFlagValue(f), flagSources[f.Name])
 	})
 	logger.Info(fmt.Sprintf("Running with flags: %s", strings.TrimSuffix(flagsToPrint, ", ")))
 }